@@ -6,15 +6,24 @@ import (
 )
 
 const (
-	PathGetLedgerID         = "/get_ledger_id"
-	PathGetAccountOutputs   = "/get_account_outputs"
-	PathGetChainOutput      = "/get_chain_output"
-	PathGetOutput           = "/get_output"
-	PathQueryTxStatus       = "/query_tx_status"
-	PathQueryInclusionScore = "/query_inclusion_score"
-	PathSubmitTransaction   = "/submit_tx"
-	PathGetSyncInfo         = "/sync_info"
-	PathGetNodeInfo         = "/node_info"
+	PathGetLedgerID                 = "/get_ledger_id"
+	PathGetAccountOutputs           = "/get_account_outputs"
+	PathGetChainOutput              = "/get_chain_output"
+	PathGetOutput                   = "/get_output"
+	PathQueryTxStatus               = "/query_tx_status"
+	PathQueryInclusionScore         = "/query_inclusion_score"
+	PathSubmitTransaction           = "/submit_tx"
+	PathGetSyncInfo                 = "/sync_info"
+	PathGetNodeInfo                 = "/node_info"
+	PathGetTokenBalances            = "/get_token_balances"
+	PathGetStateDiff                = "/get_state_diff"
+	PathGetOutputWithProof          = "/get_output_with_proof"
+	PathGetAccountOutputsWithProofs = "/get_account_outputs_with_proofs"
+	PathGetBranchChain              = "/get_branch_chain"
+	PathGetPeers                    = "/peers"
+	PathAddPeer                     = "/peers/add"
+	PathRemovePeer                  = "/peers/remove"
+	PathBlockPeer                   = "/peers/block"
 )
 
 type Error struct {
@@ -26,6 +35,8 @@ type LedgerID struct {
 	Error
 	// hex-encoded ledger id bytes
 	LedgerIDBytes string `json:"ledger_id_bytes,omitempty"`
+	// activation slots of ledger library upgrades by version. Upgrades which are not scheduled are omitted
+	UpgradeActivationSlots map[byte]uint32 `json:"upgrade_activation_slots,omitempty"`
 }
 
 // OutputList is returned by 'get_account_outputs'
@@ -36,6 +47,14 @@ type OutputList struct {
 	Outputs map[string]string `json:"outputs,omitempty"`
 }
 
+// TokenBalances is returned by 'get_token_balances'
+type TokenBalances struct {
+	Error
+	// key is hex-encoded token ID (chain ID of the minting chain)
+	// value is token balance in the account
+	Balances map[string]uint64 `json:"balances,omitempty"`
+}
+
 // ChainOutput is returned by 'get_chain_output'
 type ChainOutput struct {
 	Error
@@ -53,6 +72,64 @@ type OutputData struct {
 	//Inclusion  []InclusionDataEncoded `json:"inclusion,omitempty"`
 }
 
+// OutputWithProof is returned by 'get_output_with_proof'
+type OutputWithProof struct {
+	Error
+	// hex-encoded output data. Empty if output is not in the state, then proof is a proof of absence
+	OutputData string `json:"output_data,omitempty"`
+	// hex-encoded branch transaction ID
+	BranchID string `json:"branch_id,omitempty"`
+	// root record of the branch. Proof is checked against its root
+	RootRecord *multistate.RootRecordJSONAble `json:"root_record,omitempty"`
+	// hex-encoded Merkle proof of inclusion or absence of the output in the state of the branch
+	Proof string `json:"proof,omitempty"`
+	// hex-encoded branch transaction bytes, signed by the sequencer. Empty if not available on the node
+	BranchTxBytes string `json:"branch_tx_bytes,omitempty"`
+	// hex-encoded Merkle proof of inclusion of the stem output of the branch transaction in the state of the branch.
+	// Binds the root record to the branch transaction. Present together with the branch transaction
+	StemProof string `json:"stem_proof,omitempty"`
+}
+
+// OutputDataWithProof is hex-encoded output data with the hex-encoded proof of its inclusion in the state
+type OutputDataWithProof struct {
+	OutputData string `json:"output_data"`
+	Proof      string `json:"proof"`
+}
+
+// OutputsWithProofs is returned by 'get_account_outputs_with_proofs'
+type OutputsWithProofs struct {
+	Error
+	// hex-encoded branch transaction ID
+	BranchID string `json:"branch_id,omitempty"`
+	// root record of the branch. Proofs are checked against its root
+	RootRecord *multistate.RootRecordJSONAble `json:"root_record,omitempty"`
+	// key is hex-encoded outputID
+	Outputs map[string]OutputDataWithProof `json:"outputs,omitempty"`
+}
+
+// BranchTxData is a branch transaction with metadata calculated by the node
+type BranchTxData struct {
+	// hex-encoded transaction ID
+	TxID string `json:"txid"`
+	// hex-encoded transaction bytes
+	TxBytes string `json:"tx_bytes"`
+	// hex-encoded transaction metadata: state root, ledger coverage, slot inflation and supply of the branch
+	Metadata string `json:"metadata"`
+}
+
+// BranchChain is returned by 'get_branch_chain'
+type BranchChain struct {
+	Error
+	// branches of the heaviest chain, descending by slot
+	Branches []BranchTxData `json:"branches,omitempty"`
+}
+
+// StateDiff is returned by 'get_state_diff'
+type StateDiff struct {
+	Error
+	Diff *multistate.StateDiffJSONAble `json:"diff,omitempty"`
+}
+
 type QueryTxStatus struct {
 	Error
 	TxIDStatus vertex.TxIDStatusJSONAble       `json:"txid_status"`
@@ -79,6 +156,23 @@ type (
 		Synced       bool                         `json:"synced"`
 		InSyncWindow bool                         `json:"in_sync_window,omitempty"`
 		PerSequencer map[string]SequencerSyncInfo `json:"per_sequencer,omitempty"`
+		// latest slot committed to the state and the current slot by the clock
+		LatestSlot  uint32        `json:"latest_slot"`
+		CurrentSlot uint32        `json:"current_slot"`
+		BulkSync    *BulkSyncInfo `json:"bulk_sync,omitempty"`
+	}
+	// BulkSyncInfo is progress of the current or of the latest bulk download of slots from a peer
+	BulkSyncInfo struct {
+		InProgress         bool   `json:"in_progress"`
+		PeerID             string `json:"peer_id"`
+		FromSlot           uint32 `json:"from_slot"`
+		ToSlot             uint32 `json:"to_slot"`
+		NumBranches        int    `json:"num_branches"`
+		NumBranchesFetched int    `json:"num_branches_fetched"`
+		NumTxReceived      int    `json:"num_tx_received"`
+		// unix time in seconds
+		Started   int64  `json:"started"`
+		LastError string `json:"last_error,omitempty"`
 	}
 	SequencerSyncInfo struct {
 		Synced           bool   `json:"synced"`
@@ -87,6 +181,37 @@ type (
 	}
 )
 
+type (
+	// PeersInfo is returned by 'peers'
+	PeersInfo struct {
+		Error
+		Peers []PeerInfo `json:"peers,omitempty"`
+	}
+	PeerInfo struct {
+		// libp2p peer ID
+		ID    string   `json:"id"`
+		Name  string   `json:"name"`
+		Addrs []string `json:"addrs,omitempty"`
+		// static peers are configured or added by the operator. They are never dropped by auto-peering
+		Static     bool `json:"static"`
+		Alive      bool `json:"alive"`
+		HasTxStore bool `json:"has_tx_store"`
+		// unix time in milliseconds, 0 if never active
+		LastActivity int64 `json:"last_activity,omitempty"`
+		// unix time in milliseconds, 0 if communications are not blocked
+		BlockedUntil int64  `json:"blocked_until,omitempty"`
+		MsgIn        uint64 `json:"msg_in"`
+		MsgOut       uint64 `json:"msg_out"`
+		BytesIn      uint64 `json:"bytes_in"`
+		BytesOut     uint64 `json:"bytes_out"`
+		// gossip messages dropped because the peer is slow
+		MsgDropped uint64 `json:"msg_dropped,omitempty"`
+		// reputation score and number of bans of the misbehaving peer
+		Score   int `json:"score"`
+		NumBans int `json:"num_bans,omitempty"`
+	}
+)
+
 const ErrGetOutputNotFound = "output not found"
 
 func CalcTxInclusionScore(inclusion *multistate.TxInclusion, thresholdNumerator, thresholdDenominator int) TxInclusionScore {
@@ -12,15 +12,18 @@ import (
 	"time"
 
 	"github.com/lunfardo314/proxima/api"
+	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/core/vertex"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/ledger/transaction"
 	"github.com/lunfardo314/proxima/ledger/txbuilder"
 	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/proof_verify"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/proxima/util/txutils"
 	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
 	"golang.org/x/crypto/blake2b"
 )
 
@@ -46,20 +49,11 @@ func New(serverURL string, timeout ...time.Duration) *APIClient {
 
 // GetLedgerID retrieves ledger ID from server
 func (c *APIClient) GetLedgerID() (*ledger.IdentityData, error) {
-	body, err := c.getBody(api.PathGetLedgerID)
+	res, err := c.getLedgerID()
 	if err != nil {
 		return nil, err
 	}
 
-	var res api.LedgerID
-	err = json.Unmarshal(body, &res)
-	if err != nil {
-		return nil, err
-	}
-	if res.Error.Error != "" {
-		return nil, fmt.Errorf("GetLedgerID: from server: %s", res.Error.Error)
-	}
-
 	idBin, err := hex.DecodeString(res.LedgerIDBytes)
 	if err != nil {
 		return nil, fmt.Errorf("GetLedgerID: error while decoding data: %w", err)
@@ -75,6 +69,36 @@ func (c *APIClient) GetLedgerID() (*ledger.IdentityData, error) {
 	return ret, nil
 }
 
+// GetUpgradeActivationSlots returns activation slots of ledger library upgrades scheduled in the node
+func (c *APIClient) GetUpgradeActivationSlots() (map[byte]ledger.Slot, error) {
+	res, err := c.getLedgerID()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[byte]ledger.Slot, len(res.UpgradeActivationSlots))
+	for v, slot := range res.UpgradeActivationSlots {
+		ret[v] = ledger.Slot(slot)
+	}
+	return ret, nil
+}
+
+func (c *APIClient) getLedgerID() (*api.LedgerID, error) {
+	body, err := c.getBody(api.PathGetLedgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.LedgerID
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("GetLedgerID: from server: %s", res.Error.Error)
+	}
+	return &res, nil
+}
+
 // getAccountOutputs fetches all outputs of the account
 func (c *APIClient) getAccountOutputs(accountable ledger.Accountable) ([]*ledger.OutputDataWithID, error) {
 	path := fmt.Sprintf(api.PathGetAccountOutputs+"?accountable=%s", accountable.String())
@@ -115,6 +139,34 @@ func (c *APIClient) getAccountOutputs(accountable ledger.Accountable) ([]*ledger
 	return ret, nil
 }
 
+// GetTokenBalances fetches balances of all tokens held in the account
+func (c *APIClient) GetTokenBalances(accountable ledger.Accountable) (ledger.TokenBalances, error) {
+	path := fmt.Sprintf(api.PathGetTokenBalances+"?accountable=%s", accountable.String())
+	body, err := c.getBody(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.TokenBalances
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+
+	ret := make(ledger.TokenBalances)
+	for idStr, amount := range res.Balances {
+		id, err := ledger.ChainIDFromHexString(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("wrong token ID data from server: %s", idStr)
+		}
+		ret[id] = amount
+	}
+	return ret, nil
+}
+
 func (c *APIClient) GetChainOutputData(chainID ledger.ChainID) (*ledger.OutputDataWithID, error) {
 	path := fmt.Sprintf(api.PathGetChainOutput+"?chainid=%s", chainID.StringHex())
 	body, err := c.getBody(path)
@@ -194,6 +246,190 @@ func (c *APIClient) GetOutputDataFromHeaviestState(oid *ledger.OutputID) ([]byte
 	return oData, nil
 }
 
+// GetOutputWithProof returns output with the proof of its inclusion (or the proof of absence) in the state of the branch.
+// If branch is not specified, the heaviest branch of the latest slot is used. The proof is not verified
+func (c *APIClient) GetOutputWithProof(oid *ledger.OutputID, branchID ...*ledger.TransactionID) (*proof_verify.OutputProof, error) {
+	path := fmt.Sprintf(api.PathGetOutputWithProof+"?id=%s", oid.StringHex())
+	if len(branchID) > 0 && branchID[0] != nil {
+		path += "&branch=" + branchID[0].StringHex()
+	}
+	body, err := c.getBody(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.OutputWithProof
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	if res.RootRecord == nil {
+		return nil, fmt.Errorf("root record is missing in the response")
+	}
+
+	ret := &proof_verify.OutputProof{OutputID: *oid}
+	if ret.OutputData, err = hex.DecodeString(res.OutputData); err != nil {
+		return nil, fmt.Errorf("can't decode output data: %v", err)
+	}
+	if len(ret.OutputData) == 0 {
+		ret.OutputData = nil
+	}
+	if ret.BranchID, err = ledger.TransactionIDFromHexString(res.BranchID); err != nil {
+		return nil, err
+	}
+	if ret.RootRecord, err = res.RootRecord.Parse(); err != nil {
+		return nil, err
+	}
+	proofBytes, err := hex.DecodeString(res.Proof)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode proof: %v", err)
+	}
+	if ret.Proof, err = trie_blake2b.ProofFromBytes(proofBytes); err != nil {
+		return nil, err
+	}
+	if ret.BranchTxBytes, err = hex.DecodeString(res.BranchTxBytes); err != nil {
+		return nil, fmt.Errorf("can't decode branch transaction: %v", err)
+	}
+	if res.StemProof != "" {
+		stemProofBytes, err := hex.DecodeString(res.StemProof)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode stem proof: %v", err)
+		}
+		if ret.StemProof, err = trie_blake2b.ProofFromBytes(stemProofBytes); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// GetAccountOutputsWithProofs returns outputs locked in the account together with proofs of their inclusion
+// in the state of the branch. If branch is not specified, the heaviest branch of the latest slot is used.
+// Proofs are not verified. They do not contain the branch transaction, so only OutputProof.VerifyUnbound can be used
+func (c *APIClient) GetAccountOutputsWithProofs(accountable ledger.Accountable, branchID ...*ledger.TransactionID) ([]*proof_verify.OutputProof, error) {
+	path := fmt.Sprintf(api.PathGetAccountOutputsWithProofs+"?accountable=%s", accountable.String())
+	if len(branchID) > 0 && branchID[0] != nil {
+		path += "&branch=" + branchID[0].StringHex()
+	}
+	body, err := c.getBody(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.OutputsWithProofs
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	if res.RootRecord == nil {
+		return nil, fmt.Errorf("root record is missing in the response")
+	}
+	branch, err := ledger.TransactionIDFromHexString(res.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := res.RootRecord.Parse()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*proof_verify.OutputProof, 0, len(res.Outputs))
+	for idStr, o := range res.Outputs {
+		p := &proof_verify.OutputProof{
+			BranchID:   branch,
+			RootRecord: rr,
+		}
+		if p.OutputID, err = ledger.OutputIDFromHexString(idStr); err != nil {
+			return nil, fmt.Errorf("wrong output ID data from server: %s", idStr)
+		}
+		if p.OutputData, err = hex.DecodeString(o.OutputData); err != nil {
+			return nil, fmt.Errorf("wrong output data from server: %s", o.OutputData)
+		}
+		proofBytes, err := hex.DecodeString(o.Proof)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode proof: %v", err)
+		}
+		if p.Proof, err = trie_blake2b.ProofFromBytes(proofBytes); err != nil {
+			return nil, err
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return bytes.Compare(ret[i].OutputID[:], ret[j].OutputID[:]) < 0
+	})
+	return ret, nil
+}
+
+// BranchTxWithMetadata is a branch transaction with metadata, as reported by the node
+type BranchTxWithMetadata struct {
+	TxID     ledger.TransactionID
+	TxBytes  []byte
+	Metadata *txmetadata.TransactionMetadata
+}
+
+// GetBranchChain returns branch transactions of the heaviest chain the specified number of slots back from the latest,
+// descending by slot. Transactions and metadata are not verified
+func (c *APIClient) GetBranchChain(slots int) ([]*BranchTxWithMetadata, error) {
+	body, err := c.getBody(fmt.Sprintf(api.PathGetBranchChain+"?slots=%d", slots))
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.BranchChain
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	ret := make([]*BranchTxWithMetadata, len(res.Branches))
+	for i, b := range res.Branches {
+		ret[i] = &BranchTxWithMetadata{}
+		if ret[i].TxID, err = ledger.TransactionIDFromHexString(b.TxID); err != nil {
+			return nil, err
+		}
+		if ret[i].TxBytes, err = hex.DecodeString(b.TxBytes); err != nil {
+			return nil, fmt.Errorf("can't decode transaction bytes: %v", err)
+		}
+		metadataBytes, err := hex.DecodeString(b.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode transaction metadata: %v", err)
+		}
+		if ret[i].Metadata, err = txmetadata.TransactionMetadataFromBytes(metadataBytes); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// GetStateDiff returns difference of the state of branch B with respect to the state of branch A.
+// The node returns an error if the difference is too large
+func (c *APIClient) GetStateDiff(branchA, branchB *ledger.TransactionID) (*multistate.StateDiff, error) {
+	path := fmt.Sprintf(api.PathGetStateDiff+"?branch_a=%s&branch_b=%s", branchA.StringHex(), branchB.StringHex())
+	body, err := c.getBody(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res api.StateDiff
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	if res.Diff == nil {
+		return nil, fmt.Errorf("empty response")
+	}
+	return res.Diff.Parse()
+}
+
 const waitOutputFinalPollPeriod = 1 * time.Second
 
 // WaitOutputInTheHeaviestState return true once output is found in the latest heaviest branch.
@@ -328,6 +564,22 @@ func (c *APIClient) GetNodeInfo() (*global.NodeInfo, error) {
 	return global.NodeInfoFromBytes(body)
 }
 
+// GetSyncInfo returns sync status of the node and progress of the bulk sync
+func (c *APIClient) GetSyncInfo() (*api.SyncInfo, error) {
+	body, err := c.getBody(api.PathGetSyncInfo)
+	if err != nil {
+		return nil, err
+	}
+	var res api.SyncInfo
+	if err = json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("GetSyncInfo: %w, response: '%s'", err, string(body))
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	return &res, nil
+}
+
 // GetTransferableOutputs does the same as GetTransferableOutputs but cuts to the maximum outputs provided and returns total
 func (c *APIClient) GetTransferableOutputs(account ledger.Accountable, maxOutputs ...int) ([]*ledger.OutputWithID, uint64, error) {
 	ret, err := c.GetAccountOutputs(account, func(_ *ledger.OutputID, o *ledger.Output) bool {
@@ -404,9 +656,19 @@ func (c *APIClient) TransferFromED25519Wallet(par TransferFromED25519WalletParam
 		return nil, fmt.Errorf("minimum transfer amount is %d", minimumTransferAmount)
 	}
 	walletAccount := ledger.AddressED25519FromPrivateKey(par.WalletPrivateKey)
-	nowisTs := ledger.TimeNow()
-
 	walletOutputs, _, err := c.GetTransferableOutputs(walletAccount, par.MaxOutputs)
+	if err != nil {
+		return nil, err
+	}
+	return c.TransferFromOutputs(walletOutputs, par)
+}
+
+// TransferFromOutputs makes transfer transaction with the provided wallet outputs as inputs and submits it
+func (c *APIClient) TransferFromOutputs(walletOutputs []*ledger.OutputWithID, par TransferFromED25519WalletParams) (*transaction.TxContext, error) {
+	if par.Amount < minimumTransferAmount {
+		return nil, fmt.Errorf("minimum transfer amount is %d", minimumTransferAmount)
+	}
+	nowisTs := ledger.TimeNow()
 
 	txBytes, err := MakeTransferTransaction(MakeTransferTransactionParams{
 		Inputs:        walletOutputs,
@@ -531,6 +793,103 @@ func (c *APIClient) MakeChainOrigin(par TransferFromED25519WalletParams) (*trans
 	return txCtx, chainID, err
 }
 
+type MintTokensParams struct {
+	WalletPrivateKey ed25519.PrivateKey
+	ChainID          ledger.ChainID
+	TagAlongSeqID    *ledger.ChainID
+	TagAlongFee      uint64 // 0 means no fee output will be produced
+	Amount           uint64
+	Target           ledger.Lock
+	TraceTx          bool
+}
+
+// MintTokens mints tokens controlled by the chain and sends them to the target. The chain must be controlled by the wallet
+func (c *APIClient) MintTokens(par MintTokensParams) (*transaction.TxContext, error) {
+	chainOut, _, err := c.GetChainOutputFromHeaviestState(par.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	mintPar := &txbuilder.MintTokensData{
+		ChainOutput: chainOut,
+		PrivateKey:  par.WalletPrivateKey,
+		Target:      par.Target,
+		TokenAmount: par.Amount,
+		Timestamp:   ledger.TimeNow(),
+	}
+	if par.TagAlongFee > 0 {
+		if par.TagAlongSeqID == nil {
+			return nil, fmt.Errorf("tag-along sequencer not specified")
+		}
+		mintPar.TagAlong = &txbuilder.TagAlongData{
+			SeqID:  *par.TagAlongSeqID,
+			Amount: par.TagAlongFee,
+		}
+	}
+	txBytes, err := txbuilder.MakeMintTokensTransaction(mintPar)
+	if err != nil {
+		return nil, err
+	}
+	txCtx, err := transaction.TxContextFromTransferableBytes(txBytes, transaction.PickOutputFromListFunc([]*ledger.OutputWithID{&chainOut.OutputWithID}))
+	if err != nil {
+		return nil, err
+	}
+	err = c.SubmitTransaction(txBytes, par.TraceTx)
+	return txCtx, err
+}
+
+type TransferTokensParams struct {
+	WalletPrivateKey ed25519.PrivateKey
+	TokenID          ledger.ChainID
+	TagAlongSeqID    *ledger.ChainID
+	TagAlongFee      uint64 // 0 means no fee output will be produced
+	Amount           uint64
+	Target           ledger.Lock
+	TraceTx          bool
+}
+
+// TransferTokens sends tokens from the ED25519 wallet to the target
+func (c *APIClient) TransferTokens(par TransferTokensParams) (*transaction.TxContext, error) {
+	walletAccount := ledger.AddressED25519FromPrivateKey(par.WalletPrivateKey)
+	// consuming all outputs which can be unlocked with the signature: outputs with tokens and plain outputs
+	inputs, err := c.GetAccountOutputs(walletAccount, func(_ *ledger.OutputID, o *ledger.Output) bool {
+		return o.NumConstraints() == 2 || (o.HasTokens() && ledger.EqualConstraints(o.Lock(), walletAccount))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) > 256 {
+		inputs = inputs[:256]
+	}
+	transferPar := &txbuilder.TransferTokensData{
+		Inputs:     inputs,
+		PrivateKey: par.WalletPrivateKey,
+		TokenID:    par.TokenID,
+		Amount:     par.Amount,
+		Target:     par.Target,
+		Remainder:  walletAccount,
+		Timestamp:  ledger.TimeNow(),
+	}
+	if par.TagAlongFee > 0 {
+		if par.TagAlongSeqID == nil {
+			return nil, fmt.Errorf("tag-along sequencer not specified")
+		}
+		transferPar.TagAlong = &txbuilder.TagAlongData{
+			SeqID:  *par.TagAlongSeqID,
+			Amount: par.TagAlongFee,
+		}
+	}
+	txBytes, err := txbuilder.MakeTransferTokensTransaction(transferPar)
+	if err != nil {
+		return nil, err
+	}
+	txCtx, err := transaction.TxContextFromTransferableBytes(txBytes, transaction.PickOutputFromListFunc(inputs))
+	if err != nil {
+		return nil, err
+	}
+	err = c.SubmitTransaction(txBytes, par.TraceTx)
+	return txCtx, err
+}
+
 type MakeTransferTransactionParams struct {
 	Inputs        []*ledger.OutputWithID
 	Target        ledger.Lock
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lunfardo314/proxima/api"
+)
+
+// peer management is an admin API. The node serves it on the separate port of the local host only,
+// so the client must be created with the admin API endpoint
+
+// GetPeersInfo returns info of the node's peers
+func (c *APIClient) GetPeersInfo() ([]api.PeerInfo, error) {
+	body, err := c.getBody(api.PathGetPeers)
+	if err != nil {
+		return nil, err
+	}
+	var res api.PeersInfo
+	if err = json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("GetPeersInfo: %w, response: '%s'", err, string(body))
+	}
+	if res.Error.Error != "" {
+		return nil, fmt.Errorf("from server: %s", res.Error.Error)
+	}
+	return res.Peers, nil
+}
+
+// AddPeer adds static peer. Multiaddress must contain /p2p/<peer ID> component
+func (c *APIClient) AddPeer(name, multiAddr string) error {
+	return c.postAdmin(api.PathAddPeer, url.Values{"name": {name}, "multiaddr": {multiAddr}})
+}
+
+// RemovePeer removes the peer
+func (c *APIClient) RemovePeer(peerID string) error {
+	return c.postAdmin(api.PathRemovePeer, url.Values{"id": {peerID}})
+}
+
+// BlockPeer blocks communications with the peer for the duration. Zero duration unblocks the peer
+func (c *APIClient) BlockPeer(peerID string, d time.Duration) error {
+	return c.postAdmin(api.PathBlockPeer, url.Values{"id": {peerID}, "duration": {strconv.Itoa(int(d / time.Second))}})
+}
+
+func (c *APIClient) postAdmin(path string, params url.Values) error {
+	resp, err := c.c.Post(c.prefix+path+"?"+params.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("from server: %s", resp.Status)
+	}
+	var res api.Error
+	if err = json.Unmarshal(body, &res); err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return fmt.Errorf("from server: %s", res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+// Package lightclient implements a client of the node API which trusts the node less.
+// It follows the heaviest branch chain by branch transactions only and verifies account outputs
+// with proofs of inclusion into the state, instead of trusting JSON answers of the node.
+//
+// The light client verifies:
+//   - signatures of branch transactions and that the signer controls the sequencer output
+//   - continuity of the stem chain: each branch consumes the stem output of its predecessor
+//   - that the state root of the latest followed branch commits to the stem output of the signed branch transaction.
+//     The stem output is consumed by the next branch, so the root can't be a root of another branch
+//   - inclusion of each account output into the state root of the latest followed branch
+//
+// The state root and the ledger coverage come from the transaction metadata, calculated by the node. They are
+// not signed by the sequencer and the coverage is not committed by the state, so they can't be checked
+// with branch transactions and proofs only. Instead, the light client asks several nodes and only follows branches
+// reported with the same state root and coverage by the majority of them. Of the chains confirmed by the majority
+// it follows the heaviest one. The fork of the followed chain is replaced only by the heavier chain.
+// With one node, the state fabricated by the node together with the stem output and the wrong coverage are not
+// detected. The light client also cannot detect outputs omitted by the node
+package lightclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lunfardo314/proxima/api/client"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/multistate/proof_verify"
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/exp/slices"
+)
+
+type (
+	LightClient struct {
+		// the first node is used for queries of outputs and for submitting transactions
+		nodes []*client.APIClient
+		mutex sync.RWMutex
+		// followed heaviest branch chain, ascending by slot
+		chain []*Branch
+		// true if activation slots of ledger library upgrades were checked against the node
+		upgradesChecked bool
+	}
+
+	// Branch is a verified branch of the followed chain
+	Branch struct {
+		ID              ledger.TransactionID
+		SequencerID     ledger.ChainID
+		Stem            ledger.OutputID
+		PredecessorStem ledger.OutputID
+		// Root is the state root reported by the nodes. Verified for the latest followed branch only
+		Root common.VCommitment
+		// LedgerCoverage is reported by the nodes. It is confirmed by the majority of nodes, not verified
+		LedgerCoverage uint64
+		// stem output data from the signed branch transaction
+		stemOutputData []byte
+	}
+)
+
+const (
+	DefaultSyncSlots = 10
+	maxChainLength   = 100
+)
+
+// New creates the light client, which follows the chain confirmed by the majority of nodes. The ledger must be
+// initialized with activation slots of ledger library upgrades of the nodes, see client.GetUpgradeActivationSlots
+func New(c *client.APIClient, others ...*client.APIClient) *LightClient {
+	return &LightClient{nodes: append([]*client.APIClient{c}, others...)}
+}
+
+// Client returns the API client of the first node
+func (lc *LightClient) Client() *client.APIClient {
+	return lc.nodes[0]
+}
+
+// Quorum is the number of nodes which must report the branch with the same state root and ledger coverage
+func (lc *LightClient) Quorum() int {
+	return len(lc.nodes)/2 + 1
+}
+
+// LatestBranch returns the tip of the followed chain or nil if not synced
+func (lc *LightClient) LatestBranch() *Branch {
+	lc.mutex.RLock()
+	defer lc.mutex.RUnlock()
+
+	if len(lc.chain) == 0 {
+		return nil
+	}
+	return lc.chain[len(lc.chain)-1]
+}
+
+// Sync fetches branches of the heaviest chain from each node, verifies them and extends the followed chain
+// with the heaviest chain confirmed by the majority of nodes. The chain must be connected to the followed one,
+// so the light client must be synced at least once in 'slots' slots
+func (lc *LightClient) Sync(slots ...int) error {
+	nSlots := DefaultSyncSlots
+	if len(slots) > 0 && slots[0] > 0 {
+		nSlots = slots[0]
+	}
+	if err := lc.checkUpgrades(); err != nil {
+		return err
+	}
+	chains := make([][]*Branch, len(lc.nodes))
+	errs := make([]error, 0)
+	numReceived := 0
+	for i, c := range lc.nodes {
+		var err error
+		if chains[i], err = fetchChain(c, nSlots); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		numReceived++
+	}
+	quorum := lc.Quorum()
+	if numReceived < quorum {
+		return fmt.Errorf("lightclient: valid branch chain received from %d nodes out of %d, at least %d required: %w",
+			numReceived, len(lc.nodes), quorum, errors.Join(errs...))
+	}
+	received, nodeIdx := heaviestConfirmedChain(chains, quorum)
+	if len(received) == 0 {
+		return fmt.Errorf("lightclient: no branch is reported with the same state root and ledger coverage by %d nodes", quorum)
+	}
+	// the latest received branch becomes the tip of the followed chain
+	if err := verifyRoot(lc.nodes[nodeIdx], received[len(received)-1]); err != nil {
+		return err
+	}
+
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	var err error
+	if lc.chain, err = connect(lc.chain, received); err != nil {
+		return err
+	}
+	if len(lc.chain) > maxChainLength {
+		lc.chain = lc.chain[len(lc.chain)-maxChainLength:]
+	}
+	return nil
+}
+
+// fetchChain fetches heaviest branch chain from the node and verifies branch transactions and the stem chain.
+// Returns branches ascending by slot
+func fetchChain(c *client.APIClient, nSlots int) ([]*Branch, error) {
+	txs, err := c.GetBranchChain(nSlots)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("lightclient: node returned empty branch chain")
+	}
+	// the node returns branches descending by slot
+	ret := make([]*Branch, len(txs))
+	for i, tx := range txs {
+		if ret[len(txs)-1-i], err = verifyBranch(tx); err != nil {
+			return nil, err
+		}
+	}
+	for i := 1; i < len(ret); i++ {
+		if ret[i].PredecessorStem != ret[i-1].Stem {
+			return nil, fmt.Errorf("lightclient: stem chain is broken at branch %s", ret[i].ID.StringShort())
+		}
+	}
+	return ret, nil
+}
+
+// heaviestConfirmedChain cuts each chain at its latest branch, reported with the same state root and ledger coverage
+// in at least quorum chains, and returns the one with the biggest coverage of the tip, together with the index
+// of the chain. Nil chains are ignored
+func heaviestConfirmedChain(chains [][]*Branch, quorum int) ([]*Branch, int) {
+	type branchKey struct {
+		id       ledger.TransactionID
+		root     string
+		coverage uint64
+	}
+	keyOf := func(b *Branch) branchKey {
+		return branchKey{id: b.ID, root: string(b.Root.Bytes()), coverage: b.LedgerCoverage}
+	}
+	numConfirmations := make(map[branchKey]int)
+	for _, chain := range chains {
+		for _, b := range chain {
+			numConfirmations[keyOf(b)]++
+		}
+	}
+	var ret []*Branch
+	retIdx := -1
+	for i, chain := range chains {
+		for j := len(chain) - 1; j >= 0; j-- {
+			if numConfirmations[keyOf(chain[j])] < quorum {
+				continue
+			}
+			if len(ret) == 0 || chain[j].LedgerCoverage > ret[len(ret)-1].LedgerCoverage {
+				ret, retIdx = chain[:j+1], i
+			}
+			break
+		}
+	}
+	return ret, retIdx
+}
+
+// checkUpgrades checks if the ledger is initialized with the same activation slots of library upgrades as the node.
+// Otherwise transactions after activation would be parsed with rules of the other version
+func (lc *LightClient) checkUpgrades() error {
+	lc.mutex.RLock()
+	checked := lc.upgradesChecked
+	lc.mutex.RUnlock()
+	if checked {
+		return nil
+	}
+	activationSlots, err := lc.Client().GetUpgradeActivationSlots()
+	if err != nil {
+		return err
+	}
+	for _, v := range ledger.L().Versions()[1:] {
+		slot, scheduled := activationSlots[v.Version]
+		if !scheduled {
+			slot = ledger.UpgradeNotScheduled
+		}
+		if slot != v.ActivationSlot {
+			return fmt.Errorf("lightclient: activation slot of the ledger library version %d is different in the node. The ledger must be initialized with activation slots of the node",
+				v.Version)
+		}
+	}
+	for v := range activationSlots {
+		if v > ledger.L().LatestVersion() {
+			return fmt.Errorf("lightclient: node runs ledger library version %d, which is unknown locally", v)
+		}
+	}
+	lc.mutex.Lock()
+	lc.upgradesChecked = true
+	lc.mutex.Unlock()
+	return nil
+}
+
+// connect returns followed chain extended with the received one. The received chain replaces the fork of the followed
+// one only if its tip has bigger ledger coverage than the tip of the followed chain
+func connect(followed, received []*Branch) ([]*Branch, error) {
+	if len(followed) == 0 {
+		return received, nil
+	}
+	tip := followed[len(followed)-1]
+	newTip := received[len(received)-1]
+	extend := func(j int, tail []*Branch) ([]*Branch, error) {
+		if j < len(followed)-1 && newTip.LedgerCoverage <= tip.LedgerCoverage {
+			return nil, fmt.Errorf("lightclient: fork %s is not heavier than the followed branch %s",
+				newTip.ID.StringShort(), tip.ID.StringShort())
+		}
+		return append(slices.Clone(followed[:j+1]), tail...), nil
+	}
+	// find the latest received branch which is already followed or which continues the followed chain
+	for i := len(received) - 1; i >= 0; i-- {
+		for j := len(followed) - 1; j >= 0; j-- {
+			switch {
+			case received[i].ID == followed[j].ID:
+				if i == len(received)-1 {
+					// nothing new, the tip of the followed chain remains
+					return followed, nil
+				}
+				return extend(j, received[i+1:])
+			case received[i].PredecessorStem == followed[j].Stem:
+				return extend(j, received[i:])
+			}
+		}
+	}
+	return nil, fmt.Errorf("lightclient: received chain %s..%s is not connected to the followed chain %s..%s",
+		received[0].ID.StringShort(), newTip.ID.StringShort(), followed[0].ID.StringShort(), tip.ID.StringShort())
+}
+
+// verifyBranch checks branch transaction and its metadata
+func verifyBranch(b *client.BranchTxWithMetadata) (*Branch, error) {
+	tx, err := transaction.FromBytes(b.TxBytes, transaction.ScanSequencerData(), transaction.CheckSender())
+	if err != nil {
+		return nil, fmt.Errorf("lightclient: %w", err)
+	}
+	if *tx.ID() != b.TxID {
+		return nil, fmt.Errorf("lightclient: transaction ID %s is not equal to the expected %s", tx.IDShortString(), b.TxID.StringShort())
+	}
+	if !tx.IsBranchTransaction() {
+		return nil, fmt.Errorf("lightclient: %s is not a branch transaction", tx.IDShortString())
+	}
+	sender := tx.SenderAddress()
+	if !slices.ContainsFunc(tx.SequencerOutput().Output.Lock().Accounts(), func(a ledger.Accountable) bool {
+		return ledger.EqualAccountables(a, sender)
+	}) {
+		return nil, fmt.Errorf("lightclient: sequencer output of %s is not controlled by the signer", tx.IDShortString())
+	}
+	if b.Metadata == nil || common.IsNil(b.Metadata.StateRoot) || b.Metadata.LedgerCoverage == nil {
+		return nil, fmt.Errorf("lightclient: state root and ledger coverage of the branch %s must be provided", tx.IDShortString())
+	}
+	return &Branch{
+		ID:              b.TxID,
+		SequencerID:     tx.SequencerTransactionData().SequencerID,
+		Stem:            tx.StemOutput().ID,
+		PredecessorStem: tx.StemOutputData().PredecessorOutputID,
+		Root:            b.Metadata.StateRoot,
+		LedgerCoverage:  *b.Metadata.LedgerCoverage,
+		stemOutputData:  tx.MustOutputDataAt(tx.SequencerTransactionData().StemOutputIndex),
+	}, nil
+}
+
+// verifyRoot checks if the state root of the branch, reported in the metadata, commits to the stem output
+// of the signed branch transaction. The ledger coverage in the root record must be equal to the one in the metadata
+func verifyRoot(c *client.APIClient, b *Branch) error {
+	p, err := c.GetOutputWithProof(&b.Stem, &b.ID)
+	if err != nil {
+		return err
+	}
+	if p.BranchID != b.ID || !ledger.CommitmentModel.EqualCommitments(p.RootRecord.Root, b.Root) {
+		return fmt.Errorf("lightclient: root record of the branch %s is not equal to the state root in the metadata", b.ID.StringShort())
+	}
+	if p.RootRecord.LedgerCoverage != b.LedgerCoverage {
+		return fmt.Errorf("lightclient: ledger coverage of the root record of the branch %s is not equal to the one in the metadata", b.ID.StringShort())
+	}
+	if p.RootRecord.SequencerID != b.SequencerID {
+		return fmt.Errorf("lightclient: sequencer ID of the root record of the branch %s is wrong", b.ID.StringShort())
+	}
+	if err = proof_verify.VerifyOutputInclusion(p.RootRecord, &b.Stem, b.stemOutputData, p.Proof); err != nil {
+		return fmt.Errorf("lightclient: state root of the branch %s does not commit to its stem output: %w", b.ID.StringShort(), err)
+	}
+	return nil
+}
+
+// GetAccountOutputs returns outputs locked in the account in the state of the latest followed branch.
+// Each output is verified with the proof of inclusion into the state
+func (lc *LightClient) GetAccountOutputs(account ledger.Accountable, filter ...func(oid *ledger.OutputID, o *ledger.Output) bool) ([]*ledger.OutputWithID, error) {
+	tip := lc.LatestBranch()
+	if tip == nil {
+		return nil, fmt.Errorf("lightclient: not synced")
+	}
+	proofs, err := lc.Client().GetAccountOutputsWithProofs(account, &tip.ID)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*ledger.OutputWithID, 0, len(proofs))
+	for _, p := range proofs {
+		if p.BranchID != tip.ID || !ledger.CommitmentModel.EqualCommitments(p.RootRecord.Root, tip.Root) {
+			return nil, fmt.Errorf("lightclient: proof of %s is not for the state of the branch %s", p.OutputID.StringShort(), tip.ID.StringShort())
+		}
+		// root of the tip is already verified against the branch transaction
+		included, err := p.VerifyUnbound()
+		if err != nil {
+			return nil, fmt.Errorf("lightclient: invalid proof of %s: %w", p.OutputID.StringShort(), err)
+		}
+		if !included {
+			return nil, fmt.Errorf("lightclient: output %s is not in the state", p.OutputID.StringShort())
+		}
+		o, err := ledger.OutputFromBytesReadOnly(p.OutputData)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(o.Lock().Accounts(), func(a ledger.Accountable) bool {
+			return ledger.EqualAccountables(a, account)
+		}) {
+			return nil, fmt.Errorf("lightclient: output %s does not belong to the account %s", p.OutputID.StringShort(), account.String())
+		}
+		if len(filter) > 0 && !filter[0](&p.OutputID, o) {
+			continue
+		}
+		ret = append(ret, &ledger.OutputWithID{ID: p.OutputID, Output: o})
+	}
+	return ret, nil
+}
+
+// GetTransferableOutputs returns verified outputs which can be consumed by the transfer
+func (lc *LightClient) GetTransferableOutputs(account ledger.Accountable, maxOutputs ...int) ([]*ledger.OutputWithID, uint64, error) {
+	ret, err := lc.GetAccountOutputs(account, func(_ *ledger.OutputID, o *ledger.Output) bool {
+		return o.NumConstraints() == 2
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	maxOut := 256
+	if len(maxOutputs) > 0 && maxOutputs[0] > 0 && maxOutputs[0] < 256 {
+		maxOut = maxOutputs[0]
+	}
+	if len(ret) > maxOut {
+		ret = ret[:maxOut]
+	}
+	sum := uint64(0)
+	for _, o := range ret {
+		sum += o.Output.Amount()
+	}
+	return ret, sum, nil
+}
+
+// TransferFromED25519Wallet makes transfer transaction from verified wallet outputs and submits it to the node
+func (lc *LightClient) TransferFromED25519Wallet(par client.TransferFromED25519WalletParams) (*transaction.TxContext, error) {
+	walletAccount := ledger.AddressED25519FromPrivateKey(par.WalletPrivateKey)
+	walletOutputs, _, err := lc.GetTransferableOutputs(walletAccount, par.MaxOutputs)
+	if err != nil {
+		return nil, err
+	}
+	return lc.Client().TransferFromOutputs(walletOutputs, par)
+}
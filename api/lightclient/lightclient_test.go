@@ -0,0 +1,121 @@
+package lightclient
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	ledger.InitWithTestingLedgerIDData()
+}
+
+// makeChain makes chain of branches in slots from..to on top of the predecessor stem, with random roots
+func makeChain(t *testing.T, pred ledger.OutputID, from, to ledger.Slot, coverage uint64) []*Branch {
+	ret := make([]*Branch, 0)
+	for slot := from; slot <= to; slot++ {
+		randomID := ledger.RandomTransactionID(true)
+		txid := ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 0), randomID.ShortID(), true)
+		rootBin := make([]byte, ledger.TrieHashSize)
+		_, _ = rand.Read(rootBin)
+		root, err := common.VectorCommitmentFromBytes(ledger.CommitmentModel, rootBin)
+		require.NoError(t, err)
+		b := &Branch{
+			ID:              txid,
+			Stem:            ledger.NewOutputID(&txid, 1),
+			PredecessorStem: pred,
+			Root:            root,
+			LedgerCoverage:  coverage,
+		}
+		ret = append(ret, b)
+		pred = b.Stem
+	}
+	return ret
+}
+
+func TestConnect(t *testing.T) {
+	followed := makeChain(t, ledger.OutputID{}, 1, 5, 100)
+
+	t.Run("init", func(t *testing.T) {
+		res, err := connect(nil, followed)
+		require.NoError(t, err)
+		require.EqualValues(t, followed, res)
+	})
+	t.Run("overlap", func(t *testing.T) {
+		received := append(slices.Clone(followed[2:]), makeChain(t, followed[4].Stem, 6, 8, 90)...)
+		res, err := connect(followed, received)
+		require.NoError(t, err)
+		require.EqualValues(t, 8, len(res))
+		require.EqualValues(t, received[len(received)-1].ID, res[7].ID)
+	})
+	t.Run("continuation", func(t *testing.T) {
+		// continuation with smaller coverage is accepted, it is the same chain
+		received := makeChain(t, followed[4].Stem, 6, 7, 50)
+		res, err := connect(followed, received)
+		require.NoError(t, err)
+		require.EqualValues(t, 7, len(res))
+		// followed chain is not modified
+		require.EqualValues(t, 5, len(followed))
+	})
+	t.Run("behind", func(t *testing.T) {
+		res, err := connect(followed, followed[1:3])
+		require.NoError(t, err)
+		require.EqualValues(t, followed, res)
+	})
+	t.Run("heavier fork", func(t *testing.T) {
+		received := makeChain(t, followed[2].Stem, 4, 5, 200)
+		res, err := connect(followed, received)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, len(res))
+		require.EqualValues(t, followed[2].ID, res[2].ID)
+		require.EqualValues(t, received[1].ID, res[4].ID)
+	})
+	t.Run("lighter fork", func(t *testing.T) {
+		received := append(slices.Clone(followed[1:3]), makeChain(t, followed[2].Stem, 4, 6, 100)...)
+		_, err := connect(followed, received)
+		require.Error(t, err)
+	})
+	t.Run("not connected", func(t *testing.T) {
+		received := makeChain(t, ledger.OutputID{}, 7, 8, 100)
+		_, err := connect(followed, received)
+		require.Error(t, err)
+	})
+}
+
+func TestHeaviestConfirmedChain(t *testing.T) {
+	base := makeChain(t, ledger.OutputID{}, 1, 3, 100)
+	heavy := append(slices.Clone(base), makeChain(t, base[2].Stem, 4, 5, 300)...)
+	light := append(slices.Clone(base), makeChain(t, base[2].Stem, 4, 6, 200)...)
+
+	t.Run("one node", func(t *testing.T) {
+		ret, idx := heaviestConfirmedChain([][]*Branch{light}, 1)
+		require.EqualValues(t, light, ret)
+		require.EqualValues(t, 0, idx)
+	})
+	t.Run("heaviest of confirmed", func(t *testing.T) {
+		ret, idx := heaviestConfirmedChain([][]*Branch{light, heavy, heavy[:4], light}, 2)
+		require.EqualValues(t, heavy[:4], ret)
+		require.EqualValues(t, 1, idx)
+	})
+	t.Run("not confirmed fork", func(t *testing.T) {
+		// the heavy fork is reported by one node only, the chain is cut at the latest common branch
+		ret, _ := heaviestConfirmedChain([][]*Branch{heavy, base, nil}, 2)
+		require.EqualValues(t, base, ret)
+	})
+	t.Run("different coverage", func(t *testing.T) {
+		lied := slices.Clone(base)
+		tip := *lied[2]
+		tip.LedgerCoverage = 1000
+		lied[2] = &tip
+		ret, _ := heaviestConfirmedChain([][]*Branch{lied, base[:2]}, 2)
+		require.EqualValues(t, base[:2], ret)
+	})
+	t.Run("nothing confirmed", func(t *testing.T) {
+		ret, _ := heaviestConfirmedChain([][]*Branch{heavy[3:], light[3:]}, 2)
+		require.EqualValues(t, 0, len(ret))
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/api"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// peer management is an admin API. It is served by the separate server, listening on the local host only,
+// see RunAdminOn. Requests from other hosts are rejected in case the admin port is forwarded
+
+const maxBlockPeerDuration = 24 * time.Hour
+
+func (srv *Server) getPeers(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getPeers invoked")
+
+	if !checkAdminRequest(w, r, http.MethodGet) {
+		return
+	}
+	peers := srv.Peers().PeersInfo()
+	resp := &api.PeersInfo{
+		Peers: make([]api.PeerInfo, len(peers)),
+	}
+	for i, p := range peers {
+		resp.Peers[i] = api.PeerInfo{
+			ID:         p.ID.String(),
+			Name:       p.Name,
+			Addrs:      p.Addrs,
+			Static:     p.Static,
+			Alive:      p.Alive,
+			HasTxStore: p.HasTxStore,
+			MsgIn:      p.MsgIn,
+			MsgOut:     p.MsgOut,
+			BytesIn:    p.BytesIn,
+			BytesOut:   p.BytesOut,
+			MsgDropped: p.MsgDropped,
+			Score:      p.Score,
+			NumBans:    p.NumBans,
+		}
+		if !p.LastActivity.IsZero() {
+			resp.Peers[i].LastActivity = p.LastActivity.UnixMilli()
+		}
+		if !p.BlockedUntil.IsZero() {
+			resp.Peers[i].BlockedUntil = p.BlockedUntil.UnixMilli()
+		}
+	}
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
+// addPeer request format: POST 'peers/add?name=<peer name>&multiaddr=<multiaddress with /p2p/<peer ID> component>'
+func (srv *Server) addPeer(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "addPeer invoked")
+
+	if !checkAdminRequest(w, r, http.MethodPost) {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	maddrStr := r.URL.Query().Get("multiaddr")
+	if name == "" || maddrStr == "" {
+		writeErr(w, "parameters 'name' and 'multiaddr' are required in request 'peers/add'")
+		return
+	}
+	maddr, err := multiaddr.NewMultiaddr(maddrStr)
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	if err = srv.Peers().AddPeer(maddr, name); err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	srv.Log().Infof("peer '%s' %s has been added via API", name, maddrStr)
+	writeOk(w)
+}
+
+// removePeer request format: POST 'peers/remove?id=<peer ID>'
+func (srv *Server) removePeer(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "removePeer invoked")
+
+	if !checkAdminRequest(w, r, http.MethodPost) {
+		return
+	}
+	id, err := peer.Decode(r.URL.Query().Get("id"))
+	if err != nil {
+		writeErr(w, fmt.Sprintf("wrong parameter 'id' in request 'peers/remove': %v", err))
+		return
+	}
+	if err = srv.Peers().RemovePeer(id); err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	writeOk(w)
+}
+
+// blockPeer request format: POST 'peers/block?id=<peer ID>&duration=<seconds>'. Duration 0 unblocks the peer
+func (srv *Server) blockPeer(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "blockPeer invoked")
+
+	if !checkAdminRequest(w, r, http.MethodPost) {
+		return
+	}
+	id, err := peer.Decode(r.URL.Query().Get("id"))
+	if err != nil {
+		writeErr(w, fmt.Sprintf("wrong parameter 'id' in request 'peers/block': %v", err))
+		return
+	}
+	durationSec, err := strconv.Atoi(r.URL.Query().Get("duration"))
+	if err != nil || durationSec < 0 || time.Duration(durationSec)*time.Second > maxBlockPeerDuration {
+		writeErr(w, fmt.Sprintf("parameter 'duration' must be between 0 and %d seconds", int(maxBlockPeerDuration/time.Second)))
+		return
+	}
+	if err = srv.Peers().BlockPeer(id, time.Duration(durationSec)*time.Second); err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	writeOk(w)
+}
+
+// checkAdminRequest writes error response and returns false if request is not from the local host or has wrong method.
+// Requests through the local reverse proxy look local, so the admin server must not be exposed by the proxy
+func checkAdminRequest(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		http.Error(w, "admin API is only available from the local host", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -12,10 +12,13 @@ import (
 	"time"
 
 	"github.com/lunfardo314/proxima/api"
+	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/core/vertex"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
+	"github.com/lunfardo314/proxima/peering"
 	"github.com/lunfardo314/proxima/util"
 	"golang.org/x/exp/slices"
 )
@@ -24,10 +27,14 @@ type (
 	Environment interface {
 		global.Logging
 		GetNodeInfo() *global.NodeInfo
+		GetSyncInfo() *api.SyncInfo
 		HeaviestStateForLatestTimeSlot() multistate.SugaredStateReader
 		SubmitTxBytesFromAPI(txBytes []byte, trace ...bool) (*ledger.TransactionID, error)
 		QueryTxIDStatusJSONAble(txid *ledger.TransactionID) vertex.TxIDStatusJSONAble
 		GetTxInclusion(txid *ledger.TransactionID, slotsBack int) *multistate.TxInclusion
+		StateStore() global.StateStore
+		TxBytesStore() global.TxBytesStore
+		Peers() *peering.Peers
 	}
 
 	Server struct {
@@ -52,6 +59,8 @@ func (srv *Server) registerHandlers() {
 	http.HandleFunc(api.PathGetLedgerID, getLedgerID)
 	// GET request format: 'get_account_outputs?accountable=<EasyFL source form of the accountable lock constraint>'
 	http.HandleFunc(api.PathGetAccountOutputs, srv.getAccountOutputs)
+	// GET request format: 'get_token_balances?accountable=<EasyFL source form of the accountable lock constraint>'
+	http.HandleFunc(api.PathGetTokenBalances, srv.getTokenBalances)
 	// GET request format: 'get_chain_output?chainid=<hex-encoded chain ID>'
 	http.HandleFunc(api.PathGetChainOutput, srv.getChainOutput)
 	// GET request format: 'get_output?id=<hex-encoded output ID>'
@@ -66,11 +75,38 @@ func (srv *Server) registerHandlers() {
 	http.HandleFunc(api.PathGetSyncInfo, srv.getSyncInfo)
 	// GET sync info from the node
 	http.HandleFunc(api.PathGetNodeInfo, srv.getNodeInfo)
+	// GET request format: 'get_output_with_proof?id=<hex-encoded output ID>[&branch=<hex-encoded branch txid>]'
+	http.HandleFunc(api.PathGetOutputWithProof, srv.getOutputWithProof)
+	// GET request format: 'get_account_outputs_with_proofs?accountable=<EasyFL source form of the accountable lock constraint>[&branch=<hex-encoded branch txid>]'
+	http.HandleFunc(api.PathGetAccountOutputsWithProofs, srv.getAccountOutputsWithProofs)
+	// GET request format: 'get_branch_chain[?slots=<slots back>]'
+	http.HandleFunc(api.PathGetBranchChain, srv.getBranchChain)
+	// GET request format: 'get_state_diff?branch_a=<hex-encoded branch txid>&branch_b=<hex-encoded branch txid>'
+	// Returns error if more than maxStateDiffChanges keys are changed
+	http.HandleFunc(api.PathGetStateDiff, srv.getStateDiff)
+}
+
+// registerAdminHandlers registers admin API on its own mux. It is not served by the public API server
+func (srv *Server) registerAdminHandlers(mux *http.ServeMux) {
+	// GET request format: 'peers'
+	mux.HandleFunc(api.PathGetPeers, srv.getPeers)
+	// POST request format: 'peers/add?name=<peer name>&multiaddr=<multiaddress with /p2p/<peer ID> component>'
+	mux.HandleFunc(api.PathAddPeer, srv.addPeer)
+	// POST request format: 'peers/remove?id=<peer ID>'
+	mux.HandleFunc(api.PathRemovePeer, srv.removePeer)
+	// POST request format: 'peers/block?id=<peer ID>&duration=<seconds>'
+	mux.HandleFunc(api.PathBlockPeer, srv.blockPeer)
 }
 
 func getLedgerID(w http.ResponseWriter, r *http.Request) {
 	resp := &api.LedgerID{
-		LedgerIDBytes: hex.EncodeToString(ledger.L().ID.Bytes()),
+		LedgerIDBytes:          hex.EncodeToString(ledger.L().ID.Bytes()),
+		UpgradeActivationSlots: make(map[byte]uint32),
+	}
+	for _, v := range ledger.L().Versions()[1:] {
+		if v.ActivationSlot != ledger.UpgradeNotScheduled {
+			resp.UpgradeActivationSlots[v.Version] = uint32(v.ActivationSlot)
+		}
 	}
 	respBin, err := json.MarshalIndent(resp, "", "  ")
 	if err != nil {
@@ -122,6 +158,47 @@ func (srv *Server) getAccountOutputs(w http.ResponseWriter, r *http.Request) {
 	util.AssertNoError(err)
 }
 
+func (srv *Server) getTokenBalances(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getTokenBalances invoked")
+
+	lst, ok := r.URL.Query()["accountable"]
+	if !ok || len(lst) != 1 {
+		writeErr(w, "wrong parameters in request 'get_token_balances'")
+		return
+	}
+	accountable, err := ledger.AccountableFromSource(lst[0])
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+
+	var balances ledger.TokenBalances
+	err = util.CatchPanicOrError(func() error {
+		var err1 error
+		balances, err1 = srv.HeaviestStateForLatestTimeSlot().GetTokenBalancesInAccount(accountable.AccountID())
+		return err1
+	})
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	resp := &api.TokenBalances{}
+	if len(balances) > 0 {
+		resp.Balances = make(map[string]uint64)
+		for id, amount := range balances {
+			resp.Balances[id.StringHex()] = amount
+		}
+	}
+
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
 func (srv *Server) getChainOutput(w http.ResponseWriter, r *http.Request) {
 	srv.Tracef(TraceTag, "getChainOutput invoked")
 
@@ -198,6 +275,202 @@ func (srv *Server) getOutput(w http.ResponseWriter, r *http.Request) {
 	util.AssertNoError(err)
 }
 
+// branchFromRequest returns branch from the optional parameter 'branch'.
+// By default, it is the heaviest branch of the latest slot
+func (srv *Server) branchFromRequest(r *http.Request) (ledger.TransactionID, error) {
+	lst, ok := r.URL.Query()["branch"]
+	if ok && len(lst) == 1 {
+		branchID, err := ledger.TransactionIDFromHexString(lst[0])
+		if err != nil {
+			return ledger.TransactionID{}, err
+		}
+		if !branchID.IsBranchTransaction() {
+			return ledger.TransactionID{}, fmt.Errorf("parameter 'branch' must be a branch transaction ID")
+		}
+		return branchID, nil
+	}
+	latest := multistate.FetchLatestBranchTransactionIDs(srv.StateStore())
+	if len(latest) == 0 {
+		return ledger.TransactionID{}, fmt.Errorf("no branches found")
+	}
+	return latest[0], nil
+}
+
+func (srv *Server) getOutputWithProof(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getOutputWithProof invoked")
+
+	lst, ok := r.URL.Query()["id"]
+	if !ok || len(lst) != 1 {
+		writeErr(w, "wrong parameter in request 'get_output_with_proof'")
+		return
+	}
+	oid, err := ledger.OutputIDFromHexString(lst[0])
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	branchID, err := srv.branchFromRequest(r)
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+
+	resp := &api.OutputWithProof{
+		BranchID: branchID.StringHex(),
+	}
+	err = util.CatchPanicOrError(func() error {
+		rr, oData, proof, found := multistate.GetUTXOWithProofInBranch(srv.StateStore(), &branchID, &oid)
+		if !found {
+			return fmt.Errorf("branch %s not found", branchID.StringShort())
+		}
+		resp.RootRecord = rr.JSONAble()
+		resp.OutputData = hex.EncodeToString(oData)
+		resp.Proof = hex.EncodeToString(proof.Bytes())
+
+		if txBytesWithMetadata := srv.TxBytesStore().GetTxBytesWithMetadata(&branchID); len(txBytesWithMetadata) > 0 {
+			_, txBytes, err1 := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+			if err1 != nil {
+				return err1
+			}
+			resp.BranchTxBytes = hex.EncodeToString(txBytes)
+			// the only stem output in the state is the one produced by the branch transaction
+			rdr := multistate.MustNewReadable(srv.StateStore(), rr.Root, 0)
+			stemID := multistate.MakeSugared(rdr).GetStemOutput().ID
+			_, stemProof := rdr.GetUTXOWithProof(&stemID)
+			resp.StemProof = hex.EncodeToString(stemProof.Bytes())
+		}
+		return nil
+	})
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
+func (srv *Server) getAccountOutputsWithProofs(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getAccountOutputsWithProofs invoked")
+
+	lst, ok := r.URL.Query()["accountable"]
+	if !ok || len(lst) != 1 {
+		writeErr(w, "wrong parameters in request 'get_account_outputs_with_proofs'")
+		return
+	}
+	accountable, err := ledger.AccountableFromSource(lst[0])
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	branchID, err := srv.branchFromRequest(r)
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+
+	resp := &api.OutputsWithProofs{
+		BranchID: branchID.StringHex(),
+	}
+	err = util.CatchPanicOrError(func() error {
+		rr, found := multistate.FetchRootRecord(srv.StateStore(), branchID)
+		if !found {
+			return fmt.Errorf("branch %s not found", branchID.StringShort())
+		}
+		rdr := multistate.MustNewReadable(srv.StateStore(), rr.Root, 0)
+		oIDs, err1 := rdr.GetIDsLockedInAccount(accountable.AccountID())
+		if err1 != nil {
+			return err1
+		}
+		resp.RootRecord = rr.JSONAble()
+		resp.Outputs = make(map[string]api.OutputDataWithProof)
+		for i := range oIDs {
+			oData, proof := rdr.GetUTXOWithProof(&oIDs[i])
+			if len(oData) == 0 {
+				continue
+			}
+			resp.Outputs[oIDs[i].StringHex()] = api.OutputDataWithProof{
+				OutputData: hex.EncodeToString(oData),
+				Proof:      hex.EncodeToString(proof.Bytes()),
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
+const defaultBranchChainSlots = 10
+
+func (srv *Server) getBranchChain(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getBranchChain invoked")
+
+	slots := defaultBranchChainSlots
+	lst, ok := r.URL.Query()["slots"]
+	if ok && len(lst) == 1 {
+		var err error
+		slots, err = strconv.Atoi(lst[0])
+		if err != nil || slots < 1 || slots > maxBranchChainSlots {
+			writeErr(w, fmt.Sprintf("parameter 'slots' must be between 1 and %d", maxBranchChainSlots))
+			return
+		}
+	}
+
+	resp := &api.BranchChain{}
+	err := util.CatchPanicOrError(func() error {
+		for _, bd := range multistate.FetchHeaviestBranchChainNSlotsBack(srv.StateStore(), slots) {
+			txBytesWithMetadata := srv.TxBytesStore().GetTxBytesWithMetadata(bd.TxID())
+			if len(txBytesWithMetadata) == 0 {
+				// the chain is returned only as long as branch transactions are available in the txStore
+				break
+			}
+			_, txBytes, err1 := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+			if err1 != nil {
+				return err1
+			}
+			metadata := &txmetadata.TransactionMetadata{
+				StateRoot:      bd.Root,
+				LedgerCoverage: util.Ref(bd.LedgerCoverage),
+				SlotInflation:  util.Ref(bd.SlotInflation),
+				Supply:         util.Ref(bd.Supply),
+			}
+			resp.Branches = append(resp.Branches, api.BranchTxData{
+				TxID:     bd.TxID().StringHex(),
+				TxBytes:  hex.EncodeToString(txBytes),
+				Metadata: hex.EncodeToString(metadata.Bytes()),
+			})
+		}
+		if len(resp.Branches) == 0 {
+			return fmt.Errorf("branch transactions are not available")
+		}
+		return nil
+	})
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
 const (
 	maxTxUploadSize            = 64 * (1 << 10)
 	defaultTxAppendWaitTimeout = 10 * time.Second
@@ -256,7 +529,14 @@ func (srv *Server) submitTx(w http.ResponseWriter, r *http.Request) {
 }
 
 func (srv *Server) getSyncInfo(w http.ResponseWriter, r *http.Request) {
-	writeErr(w, "getSyncInfo: not implemented")
+	syncInfo := srv.GetSyncInfo()
+	respBin, err := json.MarshalIndent(syncInfo, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
 }
 
 func (srv *Server) getNodeInfo(w http.ResponseWriter, r *http.Request) {
@@ -270,7 +550,10 @@ func (srv *Server) getNodeInfo(w http.ResponseWriter, r *http.Request) {
 	util.AssertNoError(err)
 }
 
-const maxSlotsSpan = 10
+const (
+	maxSlotsSpan        = 10
+	maxBranchChainSlots = 100
+)
 
 func (srv *Server) queryTxStatus(w http.ResponseWriter, r *http.Request) {
 	srv.Tracef(TraceTag, "queryTxStatus invoked")
@@ -322,6 +605,50 @@ func (srv *Server) queryTxStatus(w http.ResponseWriter, r *http.Request) {
 	util.AssertNoError(err)
 }
 
+// maxStateDiffChanges limits the number of changed keys in the response of 'get_state_diff'. The diff is calculated
+// in memory, so branches far apart are not compared by the public API. Use 'proxi db diff' for them
+const maxStateDiffChanges = 10_000
+
+func (srv *Server) getStateDiff(w http.ResponseWriter, r *http.Request) {
+	srv.Tracef(TraceTag, "getStateDiff invoked")
+
+	var branches [2]ledger.TransactionID
+	for i, par := range []string{"branch_a", "branch_b"} {
+		lst, ok := r.URL.Query()[par]
+		if !ok || len(lst) != 1 {
+			writeErr(w, fmt.Sprintf("wrong parameter '%s' in request 'get_state_diff'", par))
+			return
+		}
+		var err error
+		if branches[i], err = ledger.TransactionIDFromHexString(lst[0]); err != nil {
+			writeErr(w, err.Error())
+			return
+		}
+		if !branches[i].IsBranchTransaction() {
+			writeErr(w, fmt.Sprintf("parameter '%s' must be a branch transaction ID", par))
+			return
+		}
+	}
+
+	var diff *multistate.StateDiff
+	err := util.CatchPanicOrError(func() error {
+		var err1 error
+		diff, err1 = multistate.DiffBranches(srv.StateStore(), branches[0], branches[1], maxStateDiffChanges)
+		return err1
+	})
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	respBin, err := json.MarshalIndent(&api.StateDiff{Diff: diff.JSONAble()}, "", "  ")
+	if err != nil {
+		writeErr(w, err.Error())
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
 func decodeThreshold(par string) (int, int, error) {
 	thrSplit := strings.Split(par, "-")
 	if len(thrSplit) != 2 {
@@ -335,7 +662,7 @@ func decodeThreshold(par string) (int, int, error) {
 	if err != nil {
 		return 0, 0, fmt.Errorf("wrong parameter 'threshold': %v", err)
 	}
-	if !multistate.ValidInclusionThresholdFraction(num, denom) {
+	if !rootrecord.ValidInclusionThresholdFraction(num, denom) {
 		return 0, 0, fmt.Errorf("wrong parameter 'threshold': %s", par)
 	}
 	return num, denom, nil
@@ -438,3 +765,18 @@ func RunOn(addr string, env Environment) {
 	err := http.ListenAndServe(addr, nil)
 	util.AssertNoError(err)
 }
+
+// RunAdminOn serves admin API on the port of the local host. Admin API has no authentication,
+// so it is never served on other interfaces
+func RunAdminOn(port int, env Environment) {
+	srv := New(env)
+	mux := http.NewServeMux()
+	srv.registerAdminHandlers(mux)
+	err := http.ListenAndServe(AdminAddr(port), mux)
+	util.AssertNoError(err)
+}
+
+// AdminAddr is the listen address of the admin API
+func AdminAddr(port int) string {
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
@@ -349,7 +349,7 @@ func (a *attacher) finalTouchNonSequencer(v *vertex.Vertex, vid *vertex.WrappedT
 	// non-sequencer transaction always have empty persistent metadata
 	// (sequencer transactions will be persisted upon finalization of the attacher)
 	if !glbFlags.FlagsUp(vertex.FlagVertexTxBytesPersisted) {
-		a.AsyncPersistTxBytesWithMetadata(v.Tx.Bytes(), nil)
+		a.AsyncPersistTxWithMetadata(v.Tx, nil)
 		vid.SetFlagsUpNoLock(vertex.FlagVertexTxBytesPersisted)
 
 		a.Tracef(TraceTagAttachVertex, "tx bytes persisted: %s", v.Tx.IDShortString)
@@ -546,6 +546,15 @@ func (a *attacher) attachRooted(wOut vertex.WrappedOutput) (ok bool, isRooted bo
 	oid := wOut.DecodeID()
 	txid := oid.TransactionID()
 	if len(consumedRooted) == 0 && !stateReader.KnowsCommittedTransaction(&txid) {
+		if stateReader.TxIDBehindPruningHorizon(&txid) {
+			// transaction behind the pruning horizon is treated as rooted. Its ID is not in the state, so
+			// all its outputs are already consumed
+			err := fmt.Errorf("output %s is behind the pruning horizon and is already consumed in the baseline state %s",
+				wOut.IDShortString(), a.baseline.IDShortString())
+			a.setError(err)
+			a.Tracef(TraceTagAttachOutput, "%v", err)
+			return false, false
+		}
 		// it is not rooted in the baseline state, but it is fine
 		return true, false
 	}
@@ -42,7 +42,7 @@ type (
 		DAGAccessEnvironment
 		PullEnvironment
 		PostEventEnvironment
-		AsyncPersistTxBytesWithMetadata(txBytes []byte, metadata *txmetadata.TransactionMetadata)
+		AsyncPersistTxWithMetadata(tx *transaction.Transaction, metadata *txmetadata.TransactionMetadata)
 		GossipAttachedTransaction(tx *transaction.Transaction, metadata *txmetadata.TransactionMetadata)
 		ParseMilestoneData(msVID *vertex.WrappedTx) *ledger.MilestoneData
 	}
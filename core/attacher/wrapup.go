@@ -51,7 +51,7 @@ func (a *milestoneAttacher) wrapUpAttacher() {
 		if a.metadata == nil || a.metadata.SourceTypeNonPersistent != txmetadata.SourceTypeTxStore {
 			flags := a.vid.FlagsNoLock()
 			if !flags.FlagsUp(vertex.FlagVertexTxBytesPersisted) {
-				a.AsyncPersistTxBytesWithMetadata(v.Tx.Bytes(), &calculatedMetadata)
+				a.AsyncPersistTxWithMetadata(v.Tx, &calculatedMetadata)
 				a.vid.SetFlagsUpNoLock(vertex.FlagVertexTxBytesPersisted)
 			}
 		}
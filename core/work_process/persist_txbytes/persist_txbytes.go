@@ -3,6 +3,8 @@ package persist_txbytes
 import (
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
 	"github.com/lunfardo314/proxima/util/queue"
 )
 
@@ -13,10 +15,15 @@ type (
 	}
 
 	Input struct {
-		TxBytes  []byte
+		Tx       *transaction.Transaction
 		Metadata *txmetadata.TransactionMetadata
 	}
 
+	// txPersist is implemented by transaction stores which can persist parsed transaction without parsing its bytes again
+	txPersist interface {
+		PersistTxWithMetadata(tx *transaction.Transaction, metadata *txmetadata.TransactionMetadata) (ledger.TransactionID, error)
+	}
+
 	PersistTxBytes struct {
 		*queue.Queue[Input]
 		Environment
@@ -45,7 +52,13 @@ func (d *PersistTxBytes) Start() {
 }
 
 func (d *PersistTxBytes) Consume(inp Input) {
-	txid, err := d.TxBytesStore().PersistTxBytesWithMetadata(inp.TxBytes, inp.Metadata)
+	var txid ledger.TransactionID
+	var err error
+	if store, ok := d.TxBytesStore().(txPersist); ok {
+		txid, err = store.PersistTxWithMetadata(inp.Tx, inp.Metadata)
+	} else {
+		txid, err = d.TxBytesStore().PersistTxBytesWithMetadata(inp.Tx.Bytes(), inp.Metadata)
+	}
 	if err != nil {
 		d.Environment.Log().Errorf("error while persisting transaction bytes: '%v'", err)
 	} else {
@@ -0,0 +1,298 @@
+package sync_client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/core/vertex"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/peering"
+)
+
+// SyncClient brings the node which is many slots behind the network up to date with bulk download of the ledger
+// from a peer with transaction store. It requests branch chain of the range of slots first, then downloads past cones
+// of branches in parallel. Transactions are fed to the attacher as they arrive, each past cone in topological order.
+// Past cones are not buffered, so transactions of the later branch may arrive before inputs from the past cone of
+// the earlier one, then the attacher waits for them. Failed download of the past cone is retried separately.
+// It is much faster than solidification by pulling transactions one by one
+
+type (
+	Environment interface {
+		global.NodeGlobal
+		StateStore() global.StateStore
+		GetVertex(txid *ledger.TransactionID) *vertex.WrappedTx
+		RandomPeerWithTxStore() (peer.ID, bool)
+		SyncBranchChain(id peer.ID, fromSlot, toSlot ledger.Slot) ([]ledger.TransactionID, error)
+		SyncPastCone(id peer.ID, branchID ledger.TransactionID, fun func(txBytesWithMetadata []byte)) (int, error)
+		TxBytesFromPeerIn(from peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) (*ledger.TransactionID, error)
+	}
+
+	SyncClient struct {
+		Environment
+		mutex    sync.RWMutex
+		progress Progress
+	}
+
+	// Progress of the bulk sync
+	Progress struct {
+		InProgress bool
+		Peer       peer.ID
+		FromSlot   ledger.Slot
+		ToSlot     ledger.Slot
+		// branches of the current range, which were not known to the node
+		NumBranches        int
+		NumBranchesFetched int
+		NumTxReceived      int
+		Started            time.Time
+		LastError          string
+	}
+)
+
+const (
+	Name     = "sync_client"
+	TraceTag = Name
+)
+
+const (
+	checkPeriod = time.Second
+	// bulk sync starts when the latest slot in the state is that much behind the current slot
+	syncThresholdSlots = 3
+	// maximum number of slots requested at once. Peers reject bigger ranges
+	maxSlotsPerRange = peering.MaxSyncSlotsPerRange
+	// number of past cones downloaded in parallel. Peers serve limited number of sync requests of one peer at once
+	syncParallelism = peering.MaxSyncRequestsPerPeer
+	// failed download of the past cone is repeated, each time after longer delay
+	maxPastConeAttempts = 3
+	pastConeRetryDelay  = time.Second
+	// after failed or useless attempt
+	retryPeriod = 10 * time.Second
+	// downloaded range must be committed to the state in time
+	rangeCommitTimeout = time.Minute
+)
+
+func New(env Environment) *SyncClient {
+	return &SyncClient{Environment: env}
+}
+
+func (c *SyncClient) Start() {
+	c.MarkWorkProcessStarted(Name)
+	go c.syncLoop()
+}
+
+// Progress returns progress of the current or of the latest bulk sync
+func (c *SyncClient) Progress() Progress {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.progress
+}
+
+// SlotsBehind returns number of slots the latest state is behind the current slot
+func (c *SyncClient) SlotsBehind() int {
+	latestSlot := multistate.FetchLatestSlot(c.StateStore())
+	nowSlot := ledger.TimeNow().Slot()
+	if nowSlot <= latestSlot {
+		return 0
+	}
+	return int(nowSlot - latestSlot)
+}
+
+// IsSynced returns true if the latest state is within the sync threshold
+func (c *SyncClient) IsSynced() bool {
+	return c.SlotsBehind() <= syncThresholdSlots
+}
+
+func (c *SyncClient) syncLoop() {
+	defer c.MarkWorkProcessStopped(Name)
+
+	var nextAttempt time.Time
+	for {
+		select {
+		case <-c.Ctx().Done():
+			return
+		case <-time.After(checkPeriod):
+		}
+		if c.IsSynced() || time.Now().Before(nextAttempt) {
+			continue
+		}
+		id, ok := c.RandomPeerWithTxStore()
+		if !ok {
+			continue
+		}
+		if err := c.syncRange(id); err != nil {
+			c.Log().Warnf("[%s] %v", Name, err)
+			c.updateProgress(func(p *Progress) {
+				p.InProgress = false
+				p.LastError = err.Error()
+			})
+			nextAttempt = time.Now().Add(retryPeriod)
+		}
+	}
+}
+
+// syncRange downloads next range of slots from the peer and waits until it is committed to the state
+func (c *SyncClient) syncRange(id peer.ID) error {
+	fromSlot := multistate.FetchLatestSlot(c.StateStore()) + 1
+	toSlot := min(fromSlot+maxSlotsPerRange-1, ledger.TimeNow().Slot())
+
+	chain, err := c.SyncBranchChain(id, fromSlot, toSlot)
+	if err != nil {
+		return fmt.Errorf("failed to fetch branch chain [%d, %d] from %s: %w", fromSlot, toSlot, id.String(), err)
+	}
+	chain = c.unknownBranches(chain)
+	if len(chain) == 0 {
+		return fmt.Errorf("peer %s has no new branches in slots [%d, %d]", id.String(), fromSlot, toSlot)
+	}
+	c.Log().Infof("[%s] syncing %d branches in slots [%d, %d] from peer %s", Name, len(chain), fromSlot, toSlot, id.String())
+	c.updateProgress(func(p *Progress) {
+		*p = Progress{
+			InProgress:  true,
+			Peer:        id,
+			FromSlot:    fromSlot,
+			ToSlot:      toSlot,
+			NumBranches: len(chain),
+			Started:     time.Now(),
+		}
+	})
+
+	lastSlot := chain[len(chain)-1].Slot()
+	if err = c.fetchPastCones(id, chain); err != nil {
+		return err
+	}
+	if err = c.waitCommitted(lastSlot); err != nil {
+		return err
+	}
+	c.updateProgress(func(p *Progress) {
+		p.InProgress = false
+		p.LastError = ""
+	})
+	c.Log().Infof("[%s] slots [%d, %d] synced in %v", Name, fromSlot, toSlot, time.Since(c.Progress().Started).Round(time.Millisecond))
+	return nil
+}
+
+// unknownBranches filters out branches which are already in the state or on the MemDAG
+func (c *SyncClient) unknownBranches(chain []ledger.TransactionID) []ledger.TransactionID {
+	ret := make([]ledger.TransactionID, 0, len(chain))
+	for _, txid := range chain {
+		if _, found := multistate.FetchRootRecord(c.StateStore(), txid); found {
+			continue
+		}
+		if vid := c.GetVertex(&txid); vid != nil && !vid.IsVirtualTx() {
+			continue
+		}
+		ret = append(ret, txid)
+	}
+	return ret
+}
+
+// fetchPastCones downloads past cones of branches by syncParallelism workers, in the order of the branch chain.
+// Transactions are fed to the attacher as they are received
+func (c *SyncClient) fetchPastCones(id peer.ID, branches []ledger.TransactionID) error {
+	branchCh := make(chan ledger.TransactionID, len(branches))
+	for _, branchID := range branches {
+		branchCh <- branchID
+	}
+	close(branchCh)
+
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var err error
+	for i := 0; i < syncParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for branchID := range branchCh {
+				if errFetch := c.fetchPastCone(id, branchID); errFetch != nil {
+					errMutex.Lock()
+					err = errFetch
+					errMutex.Unlock()
+					return
+				}
+				c.updateProgress(func(p *Progress) {
+					p.NumBranchesFetched++
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+// fetchPastCone downloads past cone of the branch. Failed download is repeated. Transactions received before
+// the failure are received again, the attacher ignores repeated ones
+func (c *SyncClient) fetchPastCone(id peer.ID, branchID ledger.TransactionID) error {
+	var err error
+	for attempt := 1; attempt <= maxPastConeAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-c.Ctx().Done():
+				return c.Ctx().Err()
+			case <-time.After(time.Duration(attempt-1) * pastConeRetryDelay):
+			}
+		}
+		_, err = c.SyncPastCone(id, branchID, func(txBytesWithMetadata []byte) {
+			c.txIn(id, txBytesWithMetadata)
+			c.updateProgress(func(p *Progress) {
+				p.NumTxReceived++
+			})
+		})
+		if err == nil {
+			return nil
+		}
+		c.Log().Warnf("[%s] attempt %d to fetch past cone of %s from %s failed: %v", Name, attempt, branchID.StringShort(), id.String(), err)
+	}
+	return fmt.Errorf("failed to fetch past cone of %s from %s: %w", branchID.StringShort(), id.String(), err)
+}
+
+func (c *SyncClient) txIn(from peer.ID, txBytesWithMetadata []byte) {
+	metadataBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+	if err != nil {
+		c.Log().Errorf("[%s] error while parsing tx metadata: '%v'", Name, err)
+		return
+	}
+	metadata, err := txmetadata.TransactionMetadataFromBytes(metadataBytes)
+	if err != nil {
+		c.Log().Errorf("[%s] error while parsing tx metadata: '%v'", Name, err)
+		return
+	}
+	if metadata == nil {
+		metadata = &txmetadata.TransactionMetadata{}
+	}
+	// downloaded transactions are not gossiped
+	metadata.IsResponseToPull = true
+	if txid, err := c.TxBytesFromPeerIn(from, txBytes, metadata); err != nil {
+		txidStr := "<nil>"
+		if txid != nil {
+			txidStr = txid.StringShort()
+		}
+		c.Log().Errorf("[%s] tx parse error, txid: %s: '%v'", Name, txidStr, err)
+	}
+}
+
+// waitCommitted waits until the latest slot of the state reaches the slot
+func (c *SyncClient) waitCommitted(slot ledger.Slot) error {
+	deadline := time.Now().Add(rangeCommitTimeout)
+	for multistate.FetchLatestSlot(c.StateStore()) < slot {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("downloaded slots were not committed up to slot %d in %v", slot, rangeCommitTimeout)
+		}
+		select {
+		case <-c.Ctx().Done():
+			return c.Ctx().Err()
+		case <-time.After(checkPeriod):
+		}
+	}
+	return nil
+}
+
+func (c *SyncClient) updateProgress(fun func(p *Progress)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fun(&c.progress)
+}
@@ -0,0 +1,130 @@
+package sync_server
+
+import (
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/peering"
+	"github.com/lunfardo314/proxima/util"
+)
+
+// SyncServer responds to bulk sync requests of peers from the multi-state and from the transaction store
+
+type (
+	Environment interface {
+		global.NodeGlobal
+		StateStore() global.StateStore
+		TxBytesStore() global.TxBytesStore
+	}
+
+	SyncServer struct {
+		Environment
+	}
+)
+
+const (
+	Name     = "sync_server"
+	TraceTag = Name
+	// past cone of one branch is not expected to be bigger
+	maxPastConeSize = 100_000
+)
+
+func New(env Environment) *SyncServer {
+	return &SyncServer{Environment: env}
+}
+
+// BranchChain returns branches of the heaviest chain in the range of slots, in ascending order. The chain ends with
+// the heaviest branch of the range. Only the range is read, which is limited to peering.MaxSyncSlotsPerRange slots
+func (s *SyncServer) BranchChain(fromSlot, toSlot ledger.Slot) []ledger.TransactionID {
+	latestSlot := multistate.FetchLatestSlot(s.StateStore())
+	if fromSlot > latestSlot || fromSlot > toSlot {
+		return nil
+	}
+	if toSlot-fromSlot >= peering.MaxSyncSlotsPerRange {
+		toSlot = fromSlot + peering.MaxSyncSlotsPerRange - 1
+	}
+	toSlot = min(toSlot, latestSlot)
+	chain := multistate.FetchHeaviestBranchChainInSlotRange(s.StateStore(), fromSlot, toSlot)
+	ret := make([]ledger.TransactionID, 0, len(chain))
+	// chain is descending by slot
+	for i := len(chain) - 1; i >= 0; i-- {
+		ret = append(ret, chain[i].Stem.ID.TransactionID())
+	}
+	s.Tracef(TraceTag, "branch chain [%d, %d]: %d branches", fromSlot, toSlot, len(ret))
+	return ret
+}
+
+// PastCone sends transactions of the past cone of the branch, which are not committed in the state of the predecessor
+// branch. Transactions are sent in topological order. Transactions missing in the transaction store are skipped
+func (s *SyncServer) PastCone(branchID ledger.TransactionID, send func(txBytesWithMetadata []byte) bool) {
+	rr, found := multistate.FetchRootRecord(s.StateStore(), branchID)
+	if !found {
+		s.Tracef(TraceTag, "past cone of %s: branch not found", branchID.StringShort)
+		return
+	}
+	// state of the predecessor branch is used to cut the past cone. If it is not available, only branch is sent
+	var predecessorState *multistate.Readable
+	bd := multistate.FetchBranchDataByRoot(s.StateStore(), rr)
+	stemLock, ok := bd.Stem.Output.StemLock()
+	util.Assertf(ok, "stem output expected")
+	if predRR, found := multistate.FetchRootRecord(s.StateStore(), stemLock.PredecessorOutputID.TransactionID()); found {
+		predecessorState = multistate.MustNewReadable(s.StateStore(), predRR.Root, 0)
+	}
+
+	visited := make(map[ledger.TransactionID]struct{})
+	numSent := 0
+
+	// visit returns false if sending must be stopped
+	var visit func(txid ledger.TransactionID) bool
+	visit = func(txid ledger.TransactionID) bool {
+		if _, already := visited[txid]; already {
+			return true
+		}
+		visited[txid] = struct{}{}
+		if len(visited) > maxPastConeSize {
+			s.Log().Warnf("past cone of %s exceeds %d transactions", branchID.StringShort(), maxPastConeSize)
+			return false
+		}
+		if txid != branchID && (predecessorState == nil || predecessorState.KnowsCommittedTransaction(&txid) || predecessorState.TxIDBehindPruningHorizon(&txid)) {
+			return true
+		}
+		txBytesWithMetadata := s.TxBytesStore().GetTxBytesWithMetadata(&txid)
+		if len(txBytesWithMetadata) == 0 {
+			// the peer will pull it, if needed
+			return true
+		}
+		// transaction store can be remote, so its data is not trusted
+		_, txBytes, err := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+		if err != nil {
+			s.Log().Errorf("past cone of %s: wrong data of %s in the transaction store: %v", branchID.StringShort(), txid.StringShort(), err)
+			return false
+		}
+		tx, err := transaction.FromBytes(txBytes)
+		if err != nil {
+			s.Log().Errorf("past cone of %s: wrong transaction %s in the transaction store: %v", branchID.StringShort(), txid.StringShort(), err)
+			return false
+		}
+
+		cont := true
+		tx.ForEachInput(func(_ byte, oid *ledger.OutputID) bool {
+			cont = visit(oid.TransactionID())
+			return cont
+		})
+		if !cont {
+			return false
+		}
+		tx.ForEachEndorsement(func(_ byte, endorsedTxID *ledger.TransactionID) bool {
+			cont = visit(*endorsedTxID)
+			return cont
+		})
+		if !cont {
+			return false
+		}
+		numSent++
+		return send(txBytesWithMetadata)
+	}
+	visit(branchID)
+	s.Tracef(TraceTag, "past cone of %s: %d transactions sent", branchID.StringShort, numSent)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/lunfardo314/proxima/core/vertex"
 	"github.com/lunfardo314/proxima/core/work_process/gossip"
 	"github.com/lunfardo314/proxima/core/work_process/persist_txbytes"
+	"github.com/lunfardo314/proxima/core/work_process/sync_client"
 	"github.com/lunfardo314/proxima/core/work_process/tippool"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/ledger/transaction"
@@ -66,6 +67,30 @@ func (w *Workflow) QueryTransactionsFromRandomPeer(lst ...ledger.TransactionID)
 	return w.peers.PullTransactionsFromRandomPeer(lst...)
 }
 
+func (w *Workflow) RandomPeerWithTxStore() (peer.ID, bool) {
+	return w.peers.RandomPeerWithTxStore()
+}
+
+func (w *Workflow) SyncBranchChain(id peer.ID, fromSlot, toSlot ledger.Slot) ([]ledger.TransactionID, error) {
+	return w.peers.SyncBranchChain(id, fromSlot, toSlot)
+}
+
+func (w *Workflow) SyncPastCone(id peer.ID, branchID ledger.TransactionID, fun func(txBytesWithMetadata []byte)) (int, error) {
+	return w.peers.SyncPastCone(id, branchID, fun)
+}
+
+func (w *Workflow) SyncProgress() sync_client.Progress {
+	return w.syncClient.Progress()
+}
+
+func (w *Workflow) SlotsBehind() int {
+	return w.syncClient.SlotsBehind()
+}
+
+func (w *Workflow) IsSynced() bool {
+	return w.syncClient.IsSynced()
+}
+
 func (w *Workflow) SendTxBytesWithMetadataToPeer(id peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) bool {
 	return w.peers.SendTxBytesWithMetadataToPeer(id, txBytes, metadata)
 }
@@ -74,10 +99,10 @@ func (w *Workflow) GossipTxBytesToPeers(txBytes []byte, metadata *txmetadata.Tra
 	return w.peers.GossipTxBytesToPeers(txBytes, metadata, except...)
 }
 
-func (w *Workflow) AsyncPersistTxBytesWithMetadata(txBytes []byte, metadata *txmetadata.TransactionMetadata) {
-	w.Tracef(persist_txbytes.TraceTag, "AsyncPersistTxBytesWithMetadata: %d bytes, meta: %s", len(txBytes), metadata.String())
+func (w *Workflow) AsyncPersistTxWithMetadata(tx *transaction.Transaction, metadata *txmetadata.TransactionMetadata) {
+	w.Tracef(persist_txbytes.TraceTag, "AsyncPersistTxWithMetadata: %s, meta: %s", tx.IDShortString, metadata.String)
 	w.persistTxBytes.Push(persist_txbytes.Input{
-		TxBytes:  txBytes,
+		Tx:       tx,
 		Metadata: metadata,
 	})
 }
@@ -86,6 +111,10 @@ func (w *Workflow) TxBytesWithMetadataIn(txBytes []byte, metadata *txmetadata.Tr
 	return w.TxBytesIn(txBytes, WithMetadata(metadata))
 }
 
+func (w *Workflow) TxBytesFromPeerIn(from peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) (*ledger.TransactionID, error) {
+	return w.TxBytesIn(txBytes, WithPeerMetadata(from, metadata))
+}
+
 func (w *Workflow) SendToTippool(vid *vertex.WrappedTx) {
 	w.tippool.Push(tippool.Input{VID: vid})
 }
@@ -0,0 +1,38 @@
+package workflow
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/core/attacher"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/peering"
+)
+
+const TraceTagBranchTips = "branchTips"
+
+// respondBranchTips sends to the peer latest branches of the node
+func (w *Workflow) respondBranchTips(from peer.ID) {
+	txids := multistate.FetchLatestBranchTransactionIDs(w.StateStore())
+	w.Tracef(TraceTagBranchTips, "respond %d branch tips to peer %s", len(txids), from.String)
+	w.peers.SendBranchTipsToPeer(from, txids)
+}
+
+// attachBranchTips attaches branches of the peer which are neither on the MemDAG nor in the state.
+// Missing branches are pulled and solidified together with their past cones, so that the node catches up
+func (w *Workflow) attachBranchTips(from peer.ID, txids []ledger.TransactionID) {
+	numMissing := 0
+	for _, txid := range txids {
+		if w.GetVertex(&txid) != nil {
+			continue
+		}
+		if _, found := multistate.FetchRootRecord(w.StateStore(), txid); found {
+			continue
+		}
+		attacher.AttachTxID(txid, w, attacher.OptionInvokedBy("branchTips"))
+		numMissing++
+	}
+	if numMissing > 0 {
+		w.Log().Infof("pulling %d missing branch(es) out of %d branch tips received from peer %s",
+			numMissing, len(txids), peering.ShortPeerIDString(from))
+	}
+}
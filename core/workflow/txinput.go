@@ -1,6 +1,7 @@
 package workflow
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -28,6 +29,10 @@ const (
 	TraceTagTxInput = "txinput"
 )
 
+// ErrTimestampUpperBound transaction is too far in the future wrt the local clock. It may be caused by the clock
+// difference with the sender, so the transaction is not treated as invalid data
+var ErrTimestampUpperBound = errors.New("upper timestamp bound exceeded")
+
 func (w *Workflow) TxBytesIn(txBytes []byte, opts ...TxBytesInOption) (*ledger.TransactionID, error) {
 	// base validation
 	tx, err := transaction.FromBytes(txBytes)
@@ -69,7 +74,7 @@ func (w *Workflow) TxBytesIn(txBytes []byte, opts ...TxBytesInOption) (*ledger.T
 	if err != nil {
 		if enforceTimeBounds {
 			w.Tracef(TraceTagTxInput, "invalidate %s: time bounds validation failed", txid.StringShort)
-			err = fmt.Errorf("upper timestamp bound exceeded (MaxDurationInTheFuture = %v)", w.MaxDurationInTheFuture())
+			err = fmt.Errorf("%w (MaxDurationInTheFuture = %v)", ErrTimestampUpperBound, w.MaxDurationInTheFuture())
 			attacher.InvalidateTxID(*txid, w, err)
 
 			return txid, err
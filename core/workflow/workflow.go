@@ -1,6 +1,7 @@
 package workflow
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -14,6 +15,8 @@ import (
 	"github.com/lunfardo314/proxima/core/work_process/pruner"
 	"github.com/lunfardo314/proxima/core/work_process/pull_client"
 	"github.com/lunfardo314/proxima/core/work_process/pull_server"
+	"github.com/lunfardo314/proxima/core/work_process/sync_client"
+	"github.com/lunfardo314/proxima/core/work_process/sync_server"
 	"github.com/lunfardo314/proxima/core/work_process/tippool"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
@@ -36,6 +39,8 @@ type (
 		// daemons
 		pullClient       *pull_client.PullClient
 		pullServer       *pull_server.PullServer
+		syncClient       *sync_client.SyncClient
+		syncServer       *sync_server.SyncServer
 		gossip           *gossip.Gossip
 		persistTxBytes   *persist_txbytes.PersistTxBytes
 		poker            *poker.Poker
@@ -71,6 +76,8 @@ func New(env Environment, peers *peering.Peers, opts ...ConfigOption) *Workflow
 	ret.events = events.New(ret)
 	ret.pullClient = pull_client.New(ret)
 	ret.pullServer = pull_server.New(ret)
+	ret.syncClient = sync_client.New(ret)
+	ret.syncServer = sync_server.New(ret)
 	ret.gossip = gossip.New(ret)
 	ret.persistTxBytes = persist_txbytes.New(ret)
 	ret.tippool = tippool.New(ret)
@@ -85,6 +92,7 @@ func (w *Workflow) Start() {
 	w.events.Start()
 	w.pullClient.Start()
 	w.pullServer.Start()
+	w.syncClient.Start()
 	w.gossip.Start()
 	w.persistTxBytes.Start()
 	w.tippool.Start()
@@ -94,8 +102,14 @@ func (w *Workflow) Start() {
 	}
 
 	w.peers.OnReceiveTxBytes(func(from peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) {
+		// failure to attach is not reported: peers relay transactions after pre-validation, before they are attached.
+		// Otherwise, anyone could get honest peers banned by publishing a bad milestone
 		txid, err := w.TxBytesIn(txBytes, WithPeerMetadata(from, metadata))
 		if err != nil {
+			if !errors.Is(err, ErrTimestampUpperBound) {
+				// peer sent data which can't be parsed or pre-validated
+				w.peers.ReportInvalidTx(from)
+			}
 			txidStr := "(no id)"
 			if txid != nil {
 				txidStr = txid.StringShort()
@@ -106,6 +120,11 @@ func (w *Workflow) Start() {
 		}
 	})
 
+	w.peers.OnQueryTxKnown(func(txid *ledger.TransactionID) bool {
+		vid := w.GetVertex(txid)
+		return vid != nil && !vid.IsVirtualTx()
+	})
+
 	w.peers.OnReceivePullRequest(func(from peer.ID, txids []ledger.TransactionID) {
 		for i := range txids {
 			w.Tracef(pull_server.TraceTag, "received pull request for %s", txids[i].StringShort)
@@ -115,4 +134,11 @@ func (w *Workflow) Start() {
 			})
 		}
 	})
+
+	// branch tips are exchanged with each peer when it is connected, for catching up after downtime
+	w.peers.OnReceivePullTipsRequest(w.respondBranchTips)
+	w.peers.OnReceiveBranchTips(w.attachBranchTips)
+
+	w.peers.OnSyncBranchChainRequest(w.syncServer.BranchChain)
+	w.peers.OnSyncPastConeRequest(w.syncServer.PastCone)
 }
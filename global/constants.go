@@ -1,7 +1,31 @@
 package global
 
 const (
-	MultiStateDBName     = "proximadb"
-	TxStoreDBName        = "proximadb.txstore"
-	ConfigKeyTxStoreType = "txstore.type"
+	MultiStateDBName          = "proximadb"
+	TxStoreDBName             = "proximadb.txstore"
+	ConfigKeyDatabaseBackend  = "database.backend"
+	ConfigKeyTxStoreType      = "txstore.type"
+	ConfigKeyTxStoreURL       = "txstore.url"
+	ConfigKeyTxStoreCacheSize = "txstore.cache_size"
+	ConfigKeyTxStoreRetries   = "txstore.retries"
+	ConfigKeyTxStoreToken     = "txstore.token"
+
+	// ConfigKeyUpgradeActivationSlot is the template of the key of the activation slot of the ledger library version
+	ConfigKeyUpgradeActivationSlot = "ledger.upgrades.v%d.activation_slot"
+
+	ConfigKeyTxStorePruningEnable           = "txstore.pruning.enable"
+	ConfigKeyTxStorePruningHorizonSlots     = "txstore.pruning.horizon_slots"
+	ConfigKeyTxStorePruningKeepAllFinalized = "txstore.pruning.keep_all_finalized"
+	ConfigKeyTxStorePruningArchive          = "txstore.pruning.archive"
+	ConfigKeyTxStorePruningDryRun           = "txstore.pruning.dry_run"
+	ConfigKeyTxStorePruningPeriodSlots      = "txstore.pruning.period_slots"
+
+	ConfigKeyMultiStatePruningEnable       = "multistate.pruning.enable"
+	ConfigKeyMultiStatePruningHorizonSlots = "multistate.pruning.horizon_slots"
+	ConfigKeyMultiStatePruningPeriodSlots  = "multistate.pruning.period_slots"
+
+	ConfigKeyAnalyticsEnable      = "multistate.analytics.enable"
+	ConfigKeyAnalyticsSlotsBack   = "multistate.analytics.slots_back"
+	ConfigKeyAnalyticsTopAccounts = "multistate.analytics.top_accounts"
+	ConfigKeyAnalyticsPeriodSlots = "multistate.analytics.period_slots"
 )
@@ -16,6 +16,12 @@ type NodeInfo struct {
 	NumActivePeers uint16                 `json:"num_active_peers"`
 	Sequencers     []ledger.ChainID       `json:"sequencers,omitempty"`
 	Branches       []ledger.TransactionID `json:"branches,omitempty"`
+	// addresses advertised to peers, including relayed ones
+	Addrs []string `json:"addrs,omitempty"`
+	// addresses of the node as observed by peers
+	ObservedAddrs []string `json:"observed_addrs,omitempty"`
+	// 'Public', 'Private' or 'Unknown'
+	Reachability string `json:"reachability,omitempty"`
 }
 
 func (ni *NodeInfo) Bytes() []byte {
@@ -42,6 +48,9 @@ func (ni *NodeInfo) Lines(prefix ...string) *lines.Lines {
 		Add("   static peers: %d", ni.NumStaticPeers).
 		Add("   active peers: %d", ni.NumActivePeers).
 		Add("   sequencers: %d", len(ni.Sequencers)).
-		Add("   branches: %d", len(ni.Branches))
+		Add("   branches: %d", len(ni.Branches)).
+		Add("   reachability: %s", ni.Reachability).
+		Add("   advertised addresses: %v", ni.Addrs).
+		Add("   observed addresses: %v", ni.ObservedAddrs)
 	return ret
 }
@@ -16,12 +16,15 @@ type (
 		GetUTXO(id *ledger.OutputID) ([]byte, bool)
 		HasUTXO(id *ledger.OutputID) bool
 		KnowsCommittedTransaction(txid *ledger.TransactionID) bool // all txids are kept in the state for some time
+		// TxIDBehindPruningHorizon true if not known transaction ID may have been pruned from the state
+		TxIDBehindPruningHorizon(txid *ledger.TransactionID) bool
 	}
 
 	StateIndexReader interface {
 		GetIDsLockedInAccount(addr ledger.AccountID) ([]ledger.OutputID, error)
 		GetUTXOsLockedInAccount(accountID ledger.AccountID) ([]*ledger.OutputDataWithID, error)
 		GetUTXOForChainID(id *ledger.ChainID) (*ledger.OutputDataWithID, error)
+		GetTokenBalancesInAccount(addr ledger.AccountID) (ledger.TokenBalances, error)
 		Root() common.VCommitment
 		MustLedgerIdentityBytes() []byte // either state identity consistent or panic
 	}
@@ -55,9 +58,18 @@ type (
 		PersistTxBytesWithMetadata(txBytes []byte, metadata *txmetadata.TransactionMetadata) (ledger.TransactionID, error)
 	}
 
+	// TxBytesIndex iterates IDs of stored transactions in the slot range [fromSlot, toSlot] in the order of slots.
+	// Iteration stops when fun returns false
+	TxBytesIndex interface {
+		IterateTxIDsInSlots(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error
+		IterateBranchTxIDs(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error
+		IterateSequencerMilestones(seqID ledger.ChainID, fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error
+	}
+
 	TxBytesStore interface {
 		TxBytesGet
 		TxBytesPersist
+		TxBytesIndex
 	}
 
 	Logging interface {
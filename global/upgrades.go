@@ -0,0 +1,20 @@
+package global
+
+import (
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/spf13/viper"
+)
+
+// SetUpgradeActivationSlotsFromConfig sets activation slots of ledger library upgrades, if configured. Must be called
+// before the ledger is initialized. The node and tools which validate ledger data must use activation slots of the network,
+// otherwise they validate data after activation with rules of the previous version
+func SetUpgradeActivationSlotsFromConfig() {
+	for v := 1; v <= int(ledger.LatestLibraryVersion); v++ {
+		key := fmt.Sprintf(ConfigKeyUpgradeActivationSlot, v)
+		if viper.IsSet(key) {
+			ledger.SetUpgradeActivationSlot(byte(v), ledger.Slot(viper.GetUint32(key)))
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package kvdb
+
+import (
+	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
+)
+
+func init() {
+	registerBackend(BackendBadger, backend{
+		open: func(dir string) (DB, error) {
+			if !exists(dir) {
+				return badger_adaptor.New(badger_adaptor.MustCreateOrOpenBadgerDB(dir)), nil
+			}
+			db, err := badger_adaptor.OpenBadgerDB(dir)
+			if err != nil {
+				return nil, err
+			}
+			return badger_adaptor.New(db), nil
+		},
+		detect: func(dir string) bool {
+			return hasFile(dir, "KEYREGISTRY") || hasFile(dir, "*.vlog")
+		},
+	})
+}
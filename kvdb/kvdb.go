@@ -0,0 +1,145 @@
+package kvdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Key/value database backends of the multi-state DB and the transaction store.
+// Backend is selected with 'database.backend' in the config when database is created.
+// Backend of the existing database is detected from its files
+
+const (
+	BackendBadger = "badger"
+	BackendPebble = "pebble"
+
+	DefaultBackend = BackendBadger
+)
+
+type (
+	// DB is a key/value database usable as the multi-state DB and as the transaction store
+	DB interface {
+		global.StateStore
+		common.KVWriter
+		Close() error
+	}
+
+	backend struct {
+		open func(dir string) (DB, error)
+		// detect returns true if directory contains the database of the backend
+		detect func(dir string) bool
+	}
+)
+
+var backends = make(map[string]backend)
+
+func registerBackend(name string, b backend) {
+	if _, already := backends[name]; already {
+		panic(fmt.Sprintf("kvdb: repeating backend '%s'", name))
+	}
+	backends[name] = b
+}
+
+// Backends returns names of all available backends
+func Backends() []string {
+	ret := make([]string, 0, len(backends))
+	for name := range backends {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func IsBackend(name string) bool {
+	_, ok := backends[name]
+	return ok
+}
+
+// CreateOrOpen opens existing database or creates new empty one with the backend.
+// Empty backend name means default backend
+func CreateOrOpen(backendName, dir string) (DB, error) {
+	if backendName == "" {
+		backendName = DefaultBackend
+	}
+	b, ok := backends[backendName]
+	if !ok {
+		return nil, fmt.Errorf("unknown database backend '%s'. Available: %v", backendName, Backends())
+	}
+	if exists(dir) {
+		detected, err := DetectBackend(dir)
+		if err == nil && detected != backendName {
+			return nil, fmt.Errorf("database '%s' exists and its backend is '%s', not '%s'", dir, detected, backendName)
+		}
+	}
+	return b.open(dir)
+}
+
+func MustCreateOrOpen(backendName, dir string) DB {
+	ret, err := CreateOrOpen(backendName, dir)
+	common.AssertNoError(err)
+	return ret
+}
+
+// Open opens existing database with the detected backend
+func Open(dir string) (DB, error) {
+	if !exists(dir) {
+		return nil, fmt.Errorf("'%s' does not exist, can't open DB", dir)
+	}
+	backendName, err := DetectBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+	return backends[backendName].open(dir)
+}
+
+func MustOpen(dir string) DB {
+	ret, err := Open(dir)
+	common.AssertNoError(err)
+	return ret
+}
+
+// DetectBackend returns name of the backend of the existing database
+func DetectBackend(dir string) (string, error) {
+	for _, name := range Backends() {
+		if backends[name].detect(dir) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("can't detect backend of the database '%s'", dir)
+}
+
+func exists(dir string) bool {
+	_, err := os.Stat(dir)
+	return err == nil
+}
+
+func hasFile(dir, pattern string) bool {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	return err == nil && len(matches) > 0
+}
+
+// Compact reclaims space taken by deleted data, if supported by the backend
+func Compact(db DB) error {
+	switch db := db.(type) {
+	case *badger_adaptor.DB:
+		for {
+			if err := db.RunValueLogGC(0.5); err != nil {
+				if errors.Is(err, badger.ErrNoRewrite) {
+					return nil
+				}
+				return err
+			}
+		}
+	case *PebbleDB:
+		return db.Compact()
+	}
+	return fmt.Errorf("compaction is not supported by the database backend")
+}
@@ -0,0 +1,118 @@
+package kvdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackends(t *testing.T) {
+	for _, backend := range Backends() {
+		t.Run(backend, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "db")
+			db, err := CreateOrOpen(backend, dir)
+			require.NoError(t, err)
+
+			for i := 0; i < 10; i++ {
+				db.Set([]byte(fmt.Sprintf("a%d", i)), []byte(fmt.Sprintf("value%d", i)))
+			}
+			db.Set([]byte("b"), []byte("b"))
+			db.Set([]byte{0xff, 0xff}, []byte("ff"))
+			require.EqualValues(t, "value3", string(db.Get([]byte("a3"))))
+			require.True(t, db.Has([]byte("b")))
+			require.False(t, db.Has([]byte("c")))
+			require.Nil(t, db.Get([]byte("c")))
+
+			batch := db.BatchedWriter()
+			batch.Set([]byte("a0"), nil)
+			batch.Set([]byte("c"), []byte("c"))
+			require.NoError(t, batch.Commit())
+			require.False(t, db.Has([]byte("a0")))
+			require.True(t, db.Has([]byte("c")))
+
+			count := 0
+			db.Iterator([]byte("a")).Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, 'a', k[0])
+				count++
+				return true
+			})
+			require.EqualValues(t, 9, count)
+			count = 0
+			db.Iterator([]byte{0xff}).Iterate(func(k, v []byte) bool {
+				count++
+				return true
+			})
+			require.EqualValues(t, 1, count)
+			count = 0
+			db.Iterator(nil).IterateKeys(func(k []byte) bool {
+				count++
+				return true
+			})
+			require.EqualValues(t, 12, count)
+
+			require.NoError(t, db.Close())
+			require.True(t, db.IsClosed())
+			err = common.CatchPanicOrError(func() error {
+				db.Get([]byte("b"))
+				return nil
+			})
+			require.True(t, errors.Is(err, common.ErrDBUnavailable))
+
+			detected, err := DetectBackend(dir)
+			require.NoError(t, err)
+			require.EqualValues(t, backend, detected)
+
+			for _, other := range Backends() {
+				if other != backend {
+					_, err = CreateOrOpen(other, dir)
+					require.Error(t, err)
+				}
+			}
+			db, err = Open(dir)
+			require.NoError(t, err)
+			require.EqualValues(t, "c", string(db.Get([]byte("c"))))
+			require.NoError(t, Compact(db))
+			require.NoError(t, db.Close())
+		})
+	}
+}
+
+func TestStateInPebble(t *testing.T) {
+	ledger.InitWithTestingLedgerIDData()
+	db, err := CreateOrOpen(BackendPebble, filepath.Join(t.TempDir(), "db"))
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	multistate.InitStateStore(*ledger.L().ID, db)
+	require.EqualValues(t, ledger.L().ID.Bytes(), multistate.LedgerIdentityBytesFromStore(db))
+	numRoots, numNodes, err := multistate.CheckStateTries(db)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, numRoots)
+	require.True(t, numNodes > 0)
+	// node stored under the key of another node is detected
+	rootKey := common.Concat(immutable.PartitionTrieNodes, common.AsKey(multistate.FetchAnyLatestRootRecord(db).Root))
+	db.Iterator([]byte{immutable.PartitionTrieNodes}).IterateKeys(func(k []byte) bool {
+		if bytes.Equal(k, rootKey) {
+			return true
+		}
+		db.Set(rootKey, db.Get(k))
+		return false
+	})
+	_, _, err = multistate.CheckStateTries(db)
+	require.Error(t, err)
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	require.EqualValues(t, []byte{1, 3}, prefixUpperBound([]byte{1, 2}))
+	require.EqualValues(t, []byte{2}, prefixUpperBound([]byte{1, 0xff}))
+	require.Nil(t, prefixUpperBound([]byte{0xff, 0xff}))
+	require.Nil(t, prefixUpperBound(nil))
+}
@@ -0,0 +1,206 @@
+package kvdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// PebbleDB is the adaptor of the Pebble key/value database. Pure Go, no cgo
+type (
+	PebbleDB struct {
+		db     *pebble.DB
+		closed atomic.Bool
+	}
+
+	pebbleBatch struct {
+		a     *PebbleDB
+		batch *pebble.Batch
+	}
+
+	pebbleIterator struct {
+		a      *PebbleDB
+		prefix []byte
+	}
+)
+
+// pebbleWriteOptions are used by both single writes and batch commits: a write is durable when it returns
+var pebbleWriteOptions = pebble.Sync
+
+func init() {
+	registerBackend(BackendPebble, backend{
+		open: func(dir string) (DB, error) {
+			return OpenPebbleDB(dir)
+		},
+		detect: func(dir string) bool {
+			return hasFile(dir, "OPTIONS-*")
+		},
+	})
+}
+
+// OpenPebbleDB opens existing Pebble DB or creates new empty
+func OpenPebbleDB(dir string) (*PebbleDB, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	db, err := pebble.Open(dir, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &PebbleDB{db: db}, nil
+}
+
+func (a *PebbleDB) Close() error {
+	if a.closed.Swap(true) {
+		return nil
+	}
+	return a.db.Close()
+}
+
+func (a *PebbleDB) IsClosed() bool {
+	return a.closed.Load()
+}
+
+func (a *PebbleDB) mustBeOpen() {
+	if a.closed.Load() {
+		panic(common.ErrDBUnavailable)
+	}
+}
+
+// Compact compacts the whole key space
+func (a *PebbleDB) Compact() error {
+	a.mustBeOpen()
+	first, last := []byte{}, []byte{}
+	iter, err := a.db.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	if iter.First() {
+		first = bytes.Clone(iter.Key())
+	}
+	if iter.Last() {
+		last = bytes.Clone(iter.Key())
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+	if len(last) == 0 {
+		return nil
+	}
+	return a.db.Compact(first, append(last, 0), true)
+}
+
+// KVReader
+
+func (a *PebbleDB) Get(key []byte) []byte {
+	a.mustBeOpen()
+	value, closer, err := a.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil
+	}
+	common.AssertNoError(err)
+	ret := bytes.Clone(value)
+	common.AssertNoError(closer.Close())
+	return ret
+}
+
+func (a *PebbleDB) Has(key []byte) bool {
+	a.mustBeOpen()
+	_, closer, err := a.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return false
+	}
+	common.AssertNoError(err)
+	common.AssertNoError(closer.Close())
+	return true
+}
+
+// KVWriter
+
+func (a *PebbleDB) Set(key, value []byte) {
+	a.mustBeOpen()
+	var err error
+	if len(value) > 0 {
+		err = a.db.Set(key, value, pebbleWriteOptions)
+	} else {
+		err = a.db.Delete(key, pebbleWriteOptions)
+	}
+	common.AssertNoError(err)
+}
+
+// BatchedUpdatable
+
+func (a *PebbleDB) BatchedWriter() common.KVBatchedWriter {
+	return &pebbleBatch{
+		a:     a,
+		batch: a.db.NewBatch(),
+	}
+}
+
+// KVBatchedWriter
+
+func (b *pebbleBatch) Set(key, value []byte) {
+	var err error
+	if len(value) > 0 {
+		err = b.batch.Set(key, value, nil)
+	} else {
+		err = b.batch.Delete(key, nil)
+	}
+	common.AssertNoError(err)
+}
+
+func (b *pebbleBatch) Commit() error {
+	if b.a.IsClosed() {
+		return common.ErrDBUnavailable
+	}
+	return b.batch.Commit(pebbleWriteOptions)
+}
+
+// Traversable
+
+func (a *PebbleDB) Iterator(prefix []byte) common.KVIterator {
+	return &pebbleIterator{
+		a:      a,
+		prefix: prefix,
+	}
+}
+
+// KVIterator
+
+func (it *pebbleIterator) Iterate(fun func(k []byte, v []byte) bool) {
+	it.a.mustBeOpen()
+	iter, err := it.a.db.NewIter(&pebble.IterOptions{
+		LowerBound: it.prefix,
+		UpperBound: prefixUpperBound(it.prefix),
+	})
+	common.AssertNoError(err)
+	defer func() { _ = iter.Close() }()
+
+	for valid := iter.First(); valid; valid = iter.Next() {
+		if !fun(iter.Key(), iter.Value()) {
+			return
+		}
+	}
+}
+
+func (it *pebbleIterator) IterateKeys(fun func(k []byte) bool) {
+	it.Iterate(func(k, _ []byte) bool {
+		return fun(k)
+	})
+}
+
+// prefixUpperBound returns the smallest key greater than all keys with the prefix, or nil if there is no such key
+func prefixUpperBound(prefix []byte) []byte {
+	ret := bytes.Clone(prefix)
+	for i := len(ret) - 1; i >= 0; i-- {
+		if ret[i] < 0xff {
+			ret[i]++
+			return ret[:i+1]
+		}
+	}
+	return nil
+}
@@ -41,6 +41,8 @@ type (
 	LockBalance struct {
 		Lock    Lock
 		Balance uint64
+		// Vesting is optional. If not nil, the vesting constraint is added to the output
+		Vesting *Vesting
 	}
 )
 
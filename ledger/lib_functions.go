@@ -0,0 +1,188 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lunfardo314/easyfl"
+)
+
+// FunctionDescriptor describes a function of the ledger library. It is used by tooling
+type FunctionDescriptor struct {
+	Sym     string
+	FunCode uint16
+	// NumParams is -1 for vararg functions
+	NumParams int
+	Embedded  bool
+	// Source is EasyFL source of the extended function. Empty for embedded functions and for
+	// extended functions of the EasyFL base library
+	Source string
+}
+
+type functionRecord struct {
+	numParams int
+	source    string
+}
+
+// The following methods shadow the methods of the easyfl.Library in order to record
+// data of functions added by the ledger. EasyFL does not expose its function table
+
+func (lib *Library) UpgradeWithEmbeddedShort(funList ...*easyfl.EmbeddedFunctionData) {
+	lib.Library.UpgradeWithEmbeddedShort(funList...)
+	lib.recordEmbedded(funList)
+}
+
+func (lib *Library) UpgradeWthEmbeddedLong(funList ...*easyfl.EmbeddedFunctionData) {
+	lib.Library.UpgradeWthEmbeddedLong(funList...)
+	lib.recordEmbedded(funList)
+}
+
+func (lib *Library) UpgradeWithExtensions(funList ...*easyfl.ExtendedFunctionData) {
+	lib.Library.UpgradeWithExtensions(funList...)
+	for _, fun := range funList {
+		lib.functions[fun.Sym] = functionRecord{numParams: -1, source: fun.Source}
+	}
+}
+
+func (lib *Library) MustExtendMany(source string) {
+	lib.Library.MustExtendMany(source)
+	for sym, src := range parseFunctionSources(source) {
+		lib.functions[sym] = functionRecord{numParams: -1, source: src}
+	}
+}
+
+func (lib *Library) recordEmbedded(funList []*easyfl.EmbeddedFunctionData) {
+	for _, fun := range funList {
+		lib.functions[fun.Sym] = functionRecord{numParams: fun.RequiredNumPar}
+	}
+}
+
+// Functions returns descriptors of all functions in the library, sorted by function code.
+// Functions are recovered by parsing call prefixes of all possible function codes
+func (lib *Library) Functions() []*FunctionDescriptor {
+	ret := make([]*FunctionDescriptor, 0)
+	for code := uint16(easyfl.FirstEmbeddedShort); code <= easyfl.LastEmbeddedShort; code++ {
+		if d := lib.shortFunctionDescriptor(byte(code)); d != nil {
+			ret = append(ret, d)
+		}
+	}
+	for code := uint16(easyfl.FirstEmbeddedLongFun); code <= easyfl.LastGlobalFunCode; code++ {
+		if d := lib.longFunctionDescriptor(code); d != nil {
+			ret = append(ret, d)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].FunCode < ret[j].FunCode
+	})
+	return ret
+}
+
+// FunctionByName returns descriptor of the function or nil if function does not exist
+func (lib *Library) FunctionByName(sym string) *FunctionDescriptor {
+	for _, d := range lib.Functions() {
+		if d.Sym == sym {
+			return d
+		}
+	}
+	return nil
+}
+
+// callWithEmptyArgs makes bytecode of the call with the prefix and numArgs empty data arguments
+func callWithEmptyArgs(prefix []byte, numArgs int) []byte {
+	ret := make([]byte, 0, len(prefix)+numArgs)
+	ret = append(ret, prefix...)
+	for i := 0; i < numArgs; i++ {
+		ret = append(ret, easyfl.FirstByteDataMask)
+	}
+	return ret
+}
+
+func (lib *Library) shortFunctionDescriptor(code byte) *FunctionDescriptor {
+	// short functions always have fixed number of parameters
+	for n := 0; n <= easyfl.MaxParameters; n++ {
+		sym, _, _, err := lib.ParseBytecodeOneLevel(callWithEmptyArgs([]byte{code}, n))
+		if err == nil {
+			return lib.makeFunctionDescriptor(sym, uint16(code), n)
+		}
+	}
+	return nil
+}
+
+func (lib *Library) longFunctionDescriptor(code uint16) *FunctionDescriptor {
+	var sym string
+	accepted := make([]int, 0)
+	for n := 0; n <= 15; n++ {
+		prefix := make([]byte, 2)
+		firstByte := easyfl.FirstByteLongCallMask | (byte(n) << 2)
+		binary.BigEndian.PutUint16(prefix, (uint16(firstByte)<<8)|code)
+		s, _, _, err := lib.ParseBytecodeOneLevel(callWithEmptyArgs(prefix, n))
+		if err == nil {
+			sym = s
+			accepted = append(accepted, n)
+		}
+	}
+	switch len(accepted) {
+	case 0:
+		return nil
+	case 1:
+		return lib.makeFunctionDescriptor(sym, code, accepted[0])
+	}
+	// any number of arguments is accepted: vararg or 0-parameter function
+	numParams := -1
+	if rec, ok := lib.functions[sym]; ok && rec.numParams >= 0 || code >= easyfl.FirstExtendedFun {
+		// extended functions are never vararg
+		numParams = 0
+	}
+	return lib.makeFunctionDescriptor(sym, code, numParams)
+}
+
+func (lib *Library) makeFunctionDescriptor(sym string, code uint16, numParams int) *FunctionDescriptor {
+	return &FunctionDescriptor{
+		Sym:       sym,
+		FunCode:   code,
+		NumParams: numParams,
+		Embedded:  code < easyfl.FirstExtendedFun,
+		Source:    lib.functions[sym].source,
+	}
+}
+
+// parseFunctionSources parses function definitions the same way as EasyFL does it.
+// Returns source of each function with spaces stripped
+func parseFunctionSources(source string) map[string]string {
+	ret := make(map[string]string)
+	var sym string
+	var src strings.Builder
+	flush := func() {
+		if sym != "" {
+			ret[sym] = stripSpaces(src.String())
+		}
+		src.Reset()
+	}
+	sc := bufio.NewScanner(strings.NewReader(source))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "//")
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "func ") {
+			flush()
+			s, body, _ := strings.Cut(strings.TrimPrefix(line, "func "), ":")
+			sym = strings.TrimSpace(s)
+			src.WriteString(body)
+			continue
+		}
+		src.WriteString(line)
+	}
+	flush()
+	return ret
+}
+
+func stripSpaces(str string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, str)
+}
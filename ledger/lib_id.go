@@ -19,6 +19,8 @@ type (
 		constraintByPrefix map[string]*constraintRecord
 		constraintNames    map[string]struct{}
 		inlineTests        []func()
+		versions           []LibraryVersion
+		functions          map[string]functionRecord
 	}
 
 	LibraryConst struct {
@@ -57,6 +59,7 @@ func newBaseLibrary() *Library {
 		constraintByPrefix: make(map[string]*constraintRecord),
 		constraintNames:    make(map[string]struct{}),
 		inlineTests:        make([]func(), 0),
+		functions:          make(map[string]functionRecord),
 	}
 	return ret
 }
@@ -145,6 +148,12 @@ func (lib LibraryConst) SlotsPerEpoch() uint32 {
 	return uint32(ret)
 }
 
+// TransactionIDPruningHorizon is the number of slots after which committed transaction IDs without outputs
+// in the ledger state are removed from the state. It is approximately one day
+func (lib LibraryConst) TransactionIDPruningHorizon() Slot {
+	return Slot(lib.ID.SlotsPerDay())
+}
+
 func (lib LibraryConst) MinimumAmountOnSequencer() uint64 {
 	bin, err := lib.EvalFromSource(nil, "constMinimumAmountOnSequencer")
 	util.AssertNoError(err)
@@ -30,7 +30,7 @@ func InitLocally(id *IdentityData, verbose ...bool) *Library {
 		ret.PrintLibraryStats()
 	}
 
-	ret.upgrade0(id)
+	ret.upgradeAll(id)
 
 	if len(verbose) > 0 && verbose[0] {
 		fmt.Printf("------ Extended EasyFL library:\n")
@@ -0,0 +1,179 @@
+package ledger
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lines"
+)
+
+// The ledger library is upgraded incrementally by versions. Version 0 is the base ledger definitions (see upgrade0.go).
+// Each next version only adds new embedded and extended functions with new binary codes, so all bytecodes
+// valid in the previous versions are interpreted exactly the same way.
+// New functions of the version can only be used by transactions with the timestamp in the activation slot of the version
+// or later. Transactions before the activation slot are validated exactly as by the previous version of the library,
+// so the history is replayed with the same results.
+// Nodes with the previous version can't interpret bytecodes of new functions, i.e. the upgrade is a hard fork
+// at the activation slot: all nodes of the network must be upgraded before it
+
+type (
+	// LibraryVersion describes one upgrade of the library
+	LibraryVersion struct {
+		Version        byte
+		ActivationSlot Slot
+		// Hash is the library hash after the upgrade
+		Hash [32]byte
+	}
+
+	libraryUpgrade struct {
+		version byte
+		apply   func(lib *Library, id *IdentityData)
+	}
+)
+
+const (
+	// LatestLibraryVersion must be equal to the version of the last upgrade
+	LatestLibraryVersion = byte(1)
+	// UpgradeNotScheduled is the activation slot of the upgrade which is not scheduled. Functions of such a version
+	// are never active and the ledger state is the same as with the previous version of the library
+	UpgradeNotScheduled = Slot(MaxSlot)
+	// DefaultUpgrade1ActivationSlot upgrade 1 must be scheduled explicitly by the network config.
+	// Activating it from genesis on the existing network would change state roots, i.e. would be a hard fork
+	DefaultUpgrade1ActivationSlot = UpgradeNotScheduled
+	// TxIDPruningLibraryVersion pruning of committed transaction IDs from the state (see multistate/prune.go)
+	// changes state roots, so it is activated together with the library version
+	TxIDPruningLibraryVersion = byte(1)
+)
+
+// upgrades is the list of all library upgrades in the order of versions
+var upgrades = []libraryUpgrade{
+	{version: 0, apply: (*Library).upgrade0},
+	{version: 1, apply: (*Library).upgrade1},
+}
+
+// upgradeActivationSlots activation slots of upgrades. Version 0 is always active
+var upgradeActivationSlots = map[byte]Slot{
+	1: DefaultUpgrade1ActivationSlot,
+}
+
+// SetUpgradeActivationSlot sets activation slot for the library version. Must be called before ledger is initialized.
+// The activation slot must be the same for all nodes of the network, otherwise the network will fork
+func SetUpgradeActivationSlot(version byte, slot Slot) {
+	libraryGlobalMutex.Lock()
+	defer libraryGlobalMutex.Unlock()
+
+	util.Assertf(libraryGlobal == nil, "SetUpgradeActivationSlot: ledger is already initialized")
+	util.Assertf(version > 0 && int(version) < len(upgrades), "SetUpgradeActivationSlot: wrong library version %d", version)
+	upgradeActivationSlots[version] = slot
+}
+
+// upgradeAll applies all upgrades in the order of versions and records versions with activation slots and hashes
+func (lib *Library) upgradeAll(id *IdentityData) {
+	for _, upg := range upgrades {
+		util.Assertf(int(upg.version) == len(lib.versions), "wrong order of library upgrades")
+		upg.apply(lib, id)
+
+		activationSlot := upgradeActivationSlots[upg.version]
+		if upg.version > 0 {
+			prev := lib.versions[upg.version-1].ActivationSlot
+			util.Assertf(prev <= activationSlot, "activation slot of the library version %d (%d) is before activation slot of the previous version (%d)",
+				upg.version, activationSlot, prev)
+		}
+		lib.versions = append(lib.versions, LibraryVersion{
+			Version:        upg.version,
+			ActivationSlot: activationSlot,
+			Hash:           lib.LibraryHash(),
+		})
+	}
+	util.Assertf(lib.LatestVersion() == LatestLibraryVersion, "inconsistency: latest library version must be %d", LatestLibraryVersion)
+}
+
+// LatestVersion returns the latest version of the library known to the node
+func (lib *Library) LatestVersion() byte {
+	return lib.versions[len(lib.versions)-1].Version
+}
+
+// Versions returns all versions of the library
+func (lib *Library) Versions() []LibraryVersion {
+	return slices.Clone(lib.versions)
+}
+
+// VersionData returns data of the library version, if it is known
+func (lib *Library) VersionData(version byte) (LibraryVersion, bool) {
+	if int(version) >= len(lib.versions) {
+		return LibraryVersion{}, false
+	}
+	return lib.versions[version], true
+}
+
+// ActiveVersionAtSlot returns the library version which is active at the slot
+func (lib *Library) ActiveVersionAtSlot(slot Slot) byte {
+	for i := len(lib.versions) - 1; i > 0; i-- {
+		if lib.versions[i].ActivationSlot != UpgradeNotScheduled && lib.versions[i].ActivationSlot <= slot {
+			return lib.versions[i].Version
+		}
+	}
+	return 0
+}
+
+// TxIDPruningActivationSlot returns the first slot, starting from which committed transaction IDs are pruned from the state.
+// Returns false if the library version with the pruning is not scheduled
+func (lib *Library) TxIDPruningActivationSlot() (Slot, bool) {
+	slot := lib.versions[TxIDPruningLibraryVersion].ActivationSlot
+	return slot, slot != UpgradeNotScheduled
+}
+
+// BaseLibraryHash is the hash of the version 0 of the library. All versions of the library are compatible with it
+func (lib *Library) BaseLibraryHash() [32]byte {
+	return lib.versions[0].Hash
+}
+
+// activeLibraryVersion returns library version active at the timestamp of the transaction being validated.
+// Without transaction context, for example in inline tests and library constants, the latest version is active
+func (lib *Library) activeLibraryVersion(ctx *easyfl.CallParams) byte {
+	dc := dataContextOrNil(ctx)
+	if dc == nil || dc.DataTree() == nil {
+		return LatestLibraryVersion
+	}
+	ts, err := TimeFromBytes(dc.DataTree().BytesAtPath(PathToTimestamp))
+	if err != nil {
+		ctx.TracePanic("activeLibraryVersion: %v", err)
+	}
+	return lib.ActiveVersionAtSlot(ts.Slot())
+}
+
+// dataContextOrNil returns nil if the expression is evaluated without global data, e.g. with EvalFromSource(nil, ...).
+// EasyFL does not expose it, so the panic is caught
+func dataContextOrNil(ctx *easyfl.CallParams) (ret *DataContext) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret = nil
+		}
+	}()
+	ret, _ = ctx.DataContext().(*DataContext)
+	return
+}
+
+// mustActiveVersion panics if the library version is not active in the context of the call
+func (lib *Library) mustActiveVersion(ctx *easyfl.CallParams, version byte, sym string) {
+	if active := lib.activeLibraryVersion(ctx); active < version {
+		ctx.TracePanic("'%s' is not active: requires library version %d, active version is %d", sym, version, active)
+	}
+}
+
+func (v *LibraryVersion) String() string {
+	if v.ActivationSlot == UpgradeNotScheduled {
+		return fmt.Sprintf("version %d, activation slot: not scheduled, hash %s", v.Version, easyfl.Fmt(v.Hash[:]))
+	}
+	return fmt.Sprintf("version %d, activation slot %d, hash %s", v.Version, v.ActivationSlot, easyfl.Fmt(v.Hash[:]))
+}
+
+func (lib *Library) VersionLines(prefix ...string) *lines.Lines {
+	ret := lines.New(prefix...)
+	for i := range lib.versions {
+		ret.Add("%s", lib.versions[i].String())
+	}
+	return ret
+}
@@ -289,6 +289,60 @@ func (o *Output) InflationConstraint() (*InflationConstraint, byte) {
 	return nil, 0xff
 }
 
+// VestingConstraint finds and parses vesting constraint. Returns its constraintIndex or 0xff if not found
+func (o *Output) VestingConstraint() (*Vesting, byte) {
+	var ret *Vesting
+	var err error
+	found := byte(0xff)
+	o.ForEachConstraint(func(idx byte, constr []byte) bool {
+		if idx < ConstraintIndexFirstOptionalConstraint {
+			return true
+		}
+		ret, err = VestingFromBytes(constr)
+		if err == nil {
+			found = idx
+			return false
+		}
+		return true
+	})
+	if found != 0xff {
+		return ret, found
+	}
+	return nil, 0xff
+}
+
+// Tokens finds and parses all token constraints in the output. Returns nil if output does not carry tokens
+func (o *Output) Tokens() []*Token {
+	var ret []*Token
+	o.ForEachConstraint(func(idx byte, constr []byte) bool {
+		if idx < ConstraintIndexFirstOptionalConstraint {
+			return true
+		}
+		if tok, err := TokenFromBytes(constr); err == nil {
+			ret = append(ret, tok)
+		}
+		return true
+	})
+	return ret
+}
+
+// TokenBalances returns amounts of tokens carried by the output. Returns error if the token ID is repeated
+func (o *Output) TokenBalances() (TokenBalances, error) {
+	ret := make(TokenBalances)
+	for _, tok := range o.Tokens() {
+		if _, already := ret[tok.ID]; already {
+			return nil, fmt.Errorf("repeating token ID %s in the output", tok.ID.StringShort())
+		}
+		ret[tok.ID] = tok.Amount
+	}
+	return ret, nil
+}
+
+// HasTokens returns true if output carries at least one token constraint
+func (o *Output) HasTokens() bool {
+	return len(o.Tokens()) > 0
+}
+
 func (o *Output) Inflation(branch bool) uint64 {
 	if inflationConstraint, idx := o.InflationConstraint(); idx != 0xff {
 		return inflationConstraint.InflationAmount(branch)
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/analytics"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalytics(t *testing.T) {
+	const (
+		numBranches   = 5
+		outsPerBranch = 3
+		slotInflation = 1000
+	)
+	addrs := []ledger.AddressED25519{
+		ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(101)),
+		ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(102)),
+	}
+	bm := newBranchMaker()
+	store, seqID := bm.store, bm.seqID
+	seqOut := ledger.GenesisOutputID()
+	supply := ledger.L().ID.InitialSupply
+
+	pred := bm.genesis
+	for slot := ledger.Slot(1); slot <= numBranches; slot++ {
+		supply += slotInflation
+		pred = bm.makeBranch(pred, slot, uint64(slot)*100, outsPerBranch, addrs[1], func(b *testBranch, muts *multistate.Mutations, par *multistate.RootRecordParams) {
+			newSeqOut := ledger.NewOutputID(&b.txid, 0)
+			muts.InsertDelOutputMutation(seqOut)
+			muts.InsertAddOutputMutation(newSeqOut, ledger.NewOutput(func(o *ledger.Output) {
+				o.WithAmount(1_000_000).WithLock(addrs[0])
+				_, err := o.PushConstraint(ledger.NewChainConstraint(seqID, 0, 0, 0).Bytes())
+				require.NoError(t, err)
+			}))
+			par.SlotInflation = slotInflation
+			par.Supply = supply
+			par.NumTransactions = outsPerBranch + 1
+			seqOut = newSeqOut
+		})
+	}
+
+	t.Run("series", func(t *testing.T) {
+		report := analytics.Collect(store, analytics.Params{SlotsBack: -1, TopN: 1, ScanStates: true})
+		t.Logf("\n%s", report.Lines("     ").String())
+
+		require.EqualValues(t, numBranches+1, len(report.Series))
+		for i, st := range report.Series {
+			require.EqualValues(t, i, st.Slot)
+			require.EqualValues(t, st.SlotInflation, st.BranchInflationBonus+st.ChainInflation)
+			// genesis output, stem output and outputs of all previous branches
+			require.EqualValues(t, 2+i*outsPerBranch, st.NumUTXOs)
+			require.EqualValues(t, 1, st.NumChains)
+		}
+		latest := report.Latest()
+		require.EqualValues(t, supply, latest.Supply)
+		require.EqualValues(t, slotInflation, latest.ChainInflation)
+
+		require.EqualValues(t, 1, len(report.Sequencers))
+		require.EqualValues(t, seqID, report.Sequencers[0].SequencerID)
+		require.EqualValues(t, numBranches+1, report.Sequencers[0].NumBranches)
+		require.InDelta(t, 1.0, report.Sequencers[0].CoverageShare, 1e-9)
+
+		require.EqualValues(t, 1, len(report.TopAccounts))
+		require.EqualValues(t, addrs[0].String(), report.TopAccounts[0].Lock)
+		require.EqualValues(t, 1_000_000, report.TopAccounts[0].Balance)
+	})
+	t.Run("latest only", func(t *testing.T) {
+		report := analytics.Collect(store, analytics.Params{SlotsBack: 2})
+		require.EqualValues(t, 3, len(report.Series))
+		require.EqualValues(t, -1, report.Series[0].NumUTXOs)
+		require.EqualValues(t, 2+numBranches*outsPerBranch, report.Latest().NumUTXOs)
+		require.EqualValues(t, 0, len(report.TopAccounts))
+	})
+	t.Run("export", func(t *testing.T) {
+		report := analytics.Collect(store, analytics.Params{SlotsBack: -1, TopN: 2})
+
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteCSV(&buf))
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.EqualValues(t, numBranches+2, len(records))
+		require.EqualValues(t, "slot", records[0][0])
+		require.EqualValues(t, report.Latest().BranchID.StringHex(), records[numBranches+1][1])
+
+		buf.Reset()
+		require.NoError(t, report.WriteJSON(&buf))
+		var back struct {
+			Series []struct {
+				Slot     int    `json:"slot"`
+				BranchID string `json:"branch_id"`
+				Supply   uint64 `json:"supply"`
+			} `json:"series"`
+			TopAccounts []*analytics.AccountBalance `json:"top_accounts"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &back))
+		require.EqualValues(t, numBranches+1, len(back.Series))
+		require.EqualValues(t, report.Latest().BranchID.StringHex(), back.Series[numBranches].BranchID)
+		require.EqualValues(t, supply, back.Series[numBranches].Supply)
+		require.EqualValues(t, 2, len(back.TopAccounts))
+	})
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaviestBranchChainInSlotRange(t *testing.T) {
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(2024))
+	bm := newBranchMaker()
+
+	chain := []testBranch{bm.genesis}
+	for slot := ledger.Slot(1); slot <= 8; slot++ {
+		chain = append(chain, bm.makeBranch(chain[slot-1], slot, uint64(slot)*100, 1, addr))
+	}
+	lighterFork := bm.makeBranch(chain[4], 5, 450, 1, addr)
+	heavierFork := bm.makeBranch(chain[5], 6, 650, 1, addr)
+
+	txids := func(branches []*multistate.BranchData) []ledger.TransactionID {
+		ret := make([]ledger.TransactionID, len(branches))
+		for i, bd := range branches {
+			ret[i] = bd.Stem.ID.TransactionID()
+		}
+		return ret
+	}
+	require.EqualValues(t, []ledger.TransactionID{chain[5].txid, chain[4].txid, chain[3].txid, chain[2].txid},
+		txids(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 2, 5)))
+	require.EqualValues(t, []ledger.TransactionID{heavierFork.txid, chain[5].txid},
+		txids(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 5, 6)))
+	require.NotContains(t, txids(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 1, 8)), lighterFork.txid)
+	require.EqualValues(t, 8, len(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 1, 8)))
+	require.EqualValues(t, 0, len(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 9, 10)))
+	require.EqualValues(t, 0, len(multistate.FetchHeaviestBranchChainInSlotRange(bm.store, 5, 4)))
+}
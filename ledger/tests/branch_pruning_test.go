@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchPruning(t *testing.T) {
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(16180))
+	bm := newBranchMaker()
+	store := bm.store
+	// makeBranch commits branch on top of the predecessor with some new outputs, unique for the branch
+	makeBranch := func(pred testBranch, slot ledger.Slot, coverage uint64) testBranch {
+		return bm.makeBranch(pred, slot, coverage, 5, addr)
+	}
+	genesis := bm.genesis
+
+	numKeys := func(root common.VCommitment) int {
+		trie, err := immutable.NewTrieReader(ledger.CommitmentModel, store, root, 0)
+		require.NoError(t, err)
+		ret := 0
+		trie.IterateKeys(func(_ []byte) bool {
+			ret++
+			return true
+		})
+		return ret
+	}
+	numKeysInDB := func() int {
+		ret := 0
+		store.Iterator(nil).IterateKeys(func(_ []byte) bool {
+			ret++
+			return true
+		})
+		return ret
+	}
+
+	mainChain := []testBranch{genesis}
+	for slot := ledger.Slot(1); slot <= 5; slot++ {
+		mainChain = append(mainChain, makeBranch(mainChain[slot-1], slot, uint64(100*slot)))
+	}
+	orphan1 := makeBranch(genesis, 1, 50)
+	orphan2 := makeBranch(mainChain[1], 2, 150)
+	recentOrphan := makeBranch(mainChain[4], 5, 450)
+
+	keysBefore := make(map[ledger.TransactionID]int)
+	for _, b := range append(mainChain, recentOrphan) {
+		keysBefore[b.txid] = numKeys(b.root)
+	}
+	dbKeysBefore := numKeysInDB()
+
+	stats, err := multistate.PruneOrphanedBranches(store, 2)
+	require.NoError(t, err)
+	t.Logf("%s", stats.String())
+	require.EqualValues(t, 2, stats.RootRecordsDeleted)
+	require.True(t, stats.TrieNodesDeleted > 0)
+	require.True(t, stats.BytesReclaimed > 0)
+	require.EqualValues(t, dbKeysBefore-stats.RootRecordsDeleted-stats.TrieNodesDeleted-stats.ValuesDeleted, numKeysInDB())
+
+	_, found := multistate.FetchRootRecord(store, orphan1.txid)
+	require.False(t, found)
+	_, found = multistate.FetchRootRecord(store, orphan2.txid)
+	require.False(t, found)
+
+	// retained states are intact
+	for _, b := range append(mainChain, recentOrphan) {
+		_, found = multistate.FetchRootRecord(store, b.txid)
+		require.True(t, found)
+		require.EqualValues(t, keysBefore[b.txid], numKeys(b.root))
+	}
+	// new branches are committed on top of the retained ones
+	makeBranch(mainChain[5], 6, 600)
+
+	stats, err = multistate.PruneOrphanedBranches(store, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, stats.RootRecordsDeleted)
+	require.EqualValues(t, 0, stats.TrieNodesDeleted)
+
+	// recent orphan is behind the horizon now
+	makeBranch(mainChain[5], 7, 700)
+	stats, err = multistate.PruneOrphanedBranches(store, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stats.RootRecordsDeleted)
+	_, found = multistate.FetchRootRecord(store, recentOrphan.txid)
+	require.False(t, found)
+}
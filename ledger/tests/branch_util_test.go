@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// testBranch is the branch committed to the state store by the branchMaker
+	testBranch struct {
+		txid ledger.TransactionID
+		stem ledger.OutputID
+		root common.VCommitment
+		// outputs produced by the branch, except the stem
+		outputs []ledger.OutputID
+	}
+
+	// branchMaker commits branches with random transaction IDs to the in-memory state store, starting from genesis
+	branchMaker struct {
+		store   *common.InMemoryKVStore
+		seqID   ledger.ChainID
+		genesis testBranch
+	}
+)
+
+func newBranchMaker() *branchMaker {
+	store := common.NewInMemoryKVStore()
+	seqID, genesisRoot := multistate.InitStateStore(*ledger.L().ID, store)
+	return &branchMaker{
+		store: store,
+		seqID: seqID,
+		genesis: testBranch{
+			txid: *ledger.GenesisTransactionID(),
+			stem: ledger.GenesisStemOutputID(),
+			root: genesisRoot,
+		},
+	}
+}
+
+// makeBranch commits branch on top of the predecessor. The branch consumes the stem of the predecessor and
+// commits numOutputs new transactions, each with one output locked in the lock. Optional function adds
+// other mutations of the branch and adjusts parameters of the root record
+func (m *branchMaker) makeBranch(pred testBranch, slot ledger.Slot, coverage uint64, numOutputs int, lock ledger.Lock,
+	fun ...func(b *testBranch, muts *multistate.Mutations, par *multistate.RootRecordParams)) testBranch {
+	randomID := ledger.RandomTransactionID(true)
+	ret := testBranch{
+		txid:    ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 0), randomID.ShortID(), true),
+		outputs: make([]ledger.OutputID, 0, numOutputs),
+	}
+	ret.stem = ledger.NewOutputID(&ret.txid, 1)
+
+	muts := multistate.NewMutations()
+	muts.InsertDelOutputMutation(pred.stem)
+	muts.InsertAddOutputMutation(ret.stem, ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(0).WithLock(&ledger.StemLock{PredecessorOutputID: pred.stem})
+	}))
+	muts.InsertAddTxMutation(ret.txid, slot, 1)
+	for i := 0; i < numOutputs; i++ {
+		randomID = ledger.RandomTransactionID(false)
+		txid := ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 1), randomID.ShortID(), false)
+		oid := ledger.NewOutputID(&txid, 0)
+		muts.InsertAddTxMutation(txid, slot, 0)
+		muts.InsertAddOutputMutation(oid, ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(uint64(1000 + i)).WithLock(lock)
+		}))
+		ret.outputs = append(ret.outputs, oid)
+	}
+	par := &multistate.RootRecordParams{
+		StemOutputID: ret.stem,
+		SeqID:        m.seqID,
+		Coverage:     coverage,
+		Supply:       ledger.L().ID.InitialSupply,
+	}
+	if len(fun) > 0 {
+		fun[0](&ret, muts, par)
+	}
+	upd := multistate.MustNewUpdatable(m.store, pred.root)
+	upd.MustUpdate(muts.Sort(), par)
+	ret.root = upd.Root()
+	return ret
+}
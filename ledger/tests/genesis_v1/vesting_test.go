@@ -0,0 +1,48 @@
+package genesis_v1
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+// tests of the ledger with the library version 1 active from genesis
+
+var genesisPrivateKey ed25519.PrivateKey
+
+func init() {
+	ledger.SetUpgradeActivationSlot(1, 0)
+	genesisPrivateKey = ledger.InitWithTestingLedgerIDData()
+}
+
+func TestGenesisVesting(t *testing.T) {
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(31337))
+	store := common.NewInMemoryKVStore()
+	multistate.InitStateStore(*ledger.L().ID, store)
+
+	v := ledger.NewVesting(1_000_000, 100, 10, 100)
+	_, txid := txbuilder.MustDistributeInitialSupplyExt(store, genesisPrivateKey, []ledger.LockBalance{
+		{Lock: addr, Balance: 2_000_000, Vesting: v},
+	})
+	rdr := multistate.MustNewSugaredReadableState(store, multistate.FetchLatestBranches(store)[0].Root)
+	outs, err := rdr.GetUTXOsLockedInAccount(addr.AccountID())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, len(outs))
+	o := outs[0].MustParse()
+	require.EqualValues(t, txid, o.ID.TransactionID())
+	vBack, _ := o.Output.VestingConstraint()
+	require.EqualValues(t, *v, *vBack)
+	require.EqualValues(t, 2_000_000, o.Output.Amount())
+
+	// vested amount greater than the balance
+	_, err = txbuilder.MakeDistributionTransaction(store, genesisPrivateKey, []ledger.LockBalance{
+		{Lock: addr, Balance: 500_000, Vesting: v},
+	})
+	require.Error(t, err)
+}
@@ -10,6 +10,11 @@ import (
 
 var genesisPrivateKey ed25519.PrivateKey
 
+// upgrade1ActivationSlot library version 1 is activated far enough in the future for all other tests
+// to be validated by the version 0 of the library
+const upgrade1ActivationSlot = ledger.Slot(1000)
+
 func init() {
+	ledger.SetUpgradeActivationSlot(1, upgrade1ActivationSlot)
 	genesisPrivateKey = ledger.InitWithTestingLedgerIDData()
 }
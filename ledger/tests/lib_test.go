@@ -18,8 +18,8 @@ func TestLoad(t *testing.T) {
 	id, _ := ledger.GetTestingIdentityData()
 	lib := ledger.InitLocally(id, true)
 	t.Logf("------------------\n%s", lib.ID.String())
-	t.Logf("------------------\n" + string(lib.ID.YAML()))
-	t.Logf("------------------\n" + lib.ID.TimeConstantsToString())
+	t.Log("------------------\n" + string(lib.ID.YAML()))
+	t.Log("------------------\n" + lib.ID.TimeConstantsToString())
 }
 
 func TestTime(t *testing.T) {
@@ -108,7 +108,7 @@ func TestTime(t *testing.T) {
 func TestLedgerIDYAML(t *testing.T) {
 	id := ledger.L().ID
 	yamlableStr := id.YAMLAble().YAML()
-	t.Logf("\n" + string(yamlableStr))
+	t.Log("\n" + string(yamlableStr))
 
 	idBack, err := ledger.StateIdentityDataFromYAML(yamlableStr)
 	require.NoError(t, err)
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/utxodb"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryVersion(t *testing.T) {
+	t.Run("versions", func(t *testing.T) {
+		require.EqualValues(t, ledger.LatestLibraryVersion, ledger.L().LatestVersion())
+		require.EqualValues(t, 0, ledger.L().ActiveVersionAtSlot(0))
+		require.EqualValues(t, 0, ledger.L().ActiveVersionAtSlot(upgrade1ActivationSlot-1))
+		require.EqualValues(t, 1, ledger.L().ActiveVersionAtSlot(upgrade1ActivationSlot))
+		require.EqualValues(t, 1, ledger.L().ActiveVersionAtSlot(upgrade1ActivationSlot+1))
+
+		v0, ok := ledger.L().VersionData(0)
+		require.True(t, ok)
+		v1, ok := ledger.L().VersionData(1)
+		require.True(t, ok)
+		require.EqualValues(t, ledger.L().BaseLibraryHash(), v0.Hash)
+		require.EqualValues(t, ledger.L().LibraryHash(), v1.Hash)
+		require.NotEqualValues(t, v0.Hash, v1.Hash)
+		_, ok = ledger.L().VersionData(ledger.LatestLibraryVersion + 1)
+		require.False(t, ok)
+		t.Logf("library versions:\n%s", ledger.L().VersionLines("    ").String())
+	})
+	const sha256Script = "equal(sha256(0x616263), 0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad)"
+
+	t.Run("new function before activation fails", func(t *testing.T) {
+		u := utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey, _, addr := u.GenerateAddress(0)
+		err := u.TokensFromFaucet(addr, 10000)
+		require.NoError(t, err)
+
+		script, err := ledger.NewGeneralScriptFromSource(sha256Script)
+		require.NoError(t, err)
+
+		par, err := u.MakeTransferInputData(privKey, nil, ledger.TimeNow())
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(2000).WithTargetLock(addr).WithConstraint(script))
+		easyfl.RequireErrorWith(t, err, "'sha256' is not active")
+	})
+	t.Run("new function after activation", func(t *testing.T) {
+		u := utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey, _, addr := u.GenerateAddress(0)
+		err := u.TokensFromFaucet(addr, 10000)
+		require.NoError(t, err)
+
+		script, err := ledger.NewGeneralScriptFromSource(sha256Script)
+		require.NoError(t, err)
+
+		// transaction without new functions before activation is validated as usual
+		par, err := u.MakeTransferInputData(privKey, nil, ledger.TimeNow())
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(1000).WithTargetLock(addr))
+		require.NoError(t, err)
+
+		ts := ledger.MustNewLedgerTime(upgrade1ActivationSlot, 0)
+		par, err = u.MakeTransferInputData(privKey, nil, ts)
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(2000).WithTargetLock(addr).WithConstraint(script))
+		require.NoError(t, err)
+	})
+	t.Run("library version constant", func(t *testing.T) {
+		u := utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey, _, addr := u.GenerateAddress(0)
+		err := u.TokensFromFaucet(addr, 10000)
+		require.NoError(t, err)
+
+		script, err := ledger.NewGeneralScriptFromSource("equal(libraryVersion, 1)")
+		require.NoError(t, err)
+
+		par, err := u.MakeTransferInputData(privKey, nil, ledger.TimeNow())
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(2000).WithTargetLock(addr).WithConstraint(script))
+		require.Error(t, err)
+
+		ts := ledger.MustNewLedgerTime(upgrade1ActivationSlot, 0)
+		par, err = u.MakeTransferInputData(privKey, nil, ts)
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(2000).WithTargetLock(addr).WithConstraint(script))
+		require.NoError(t, err)
+	})
+	t.Run("replay of pre-upgrade transactions", func(t *testing.T) {
+		u := utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey, _, addr := u.GenerateAddress(0)
+		_, _, addr1 := u.GenerateAddress(1)
+
+		// transactions created before activation of the upgrade and one transaction after activation
+		txBytes, err := u.MakeTransactionFromFaucet(addr, 10000)
+		require.NoError(t, err)
+		err = u.AddTransaction(txBytes)
+		require.NoError(t, err)
+		txs := [][]byte{txBytes}
+		for i := 0; i < 5; i++ {
+			par, err := u.MakeTransferInputData(privKey, nil, ledger.TimeNow())
+			require.NoError(t, err)
+			txBytes, err = u.DoTransferTx(par.WithAmount(100).WithTargetLock(addr1))
+			require.NoError(t, err)
+			txs = append(txs, txBytes)
+		}
+		rootBeforeActivation := u.Root()
+		par, err := u.MakeTransferInputData(privKey, nil, ledger.MustNewLedgerTime(upgrade1ActivationSlot, 0))
+		require.NoError(t, err)
+		txAfterActivation, err := u.DoTransferTx(par.WithAmount(100).WithTargetLock(addr1))
+		require.NoError(t, err)
+
+		// replay on top of the same genesis. Each transaction is committed as a branch, and, for reference,
+		// without root record, i.e. exactly as the state was updated before the upgrade
+		store := common.NewInMemoryKVStore()
+		seqID, genesisRoot := multistate.InitStateStore(*ledger.L().ID, store)
+		distributionTxBytes := txbuilder.MustDistributeInitialSupply(store, genesisPrivateKey, []ledger.LockBalance{
+			{Lock: u.FaucetAddress(), Balance: ledger.L().ID.InitialSupply / 2},
+		})
+		branches := multistate.MustNewUpdatable(store, genesisRoot)
+		reference := multistate.MustNewUpdatable(store, genesisRoot)
+
+		replay := func(txBytes []byte) {
+			tx, err := transaction.FromBytesMainChecksWithOpt(txBytes)
+			require.NoError(t, err)
+			ctx, err := transaction.TxContextFromTransaction(tx, tx.InputLoaderByIndex(branches.Readable().GetUTXO))
+			require.NoError(t, err)
+			require.NoError(t, ctx.Validate())
+
+			err = branches.Update(multistate.MutationsFromTransaction(tx), &multistate.RootRecordParams{
+				StemOutputID: ledger.NewOutputID(tx.ID(), 0),
+				SeqID:        seqID,
+				Coverage:     1,
+				Supply:       ledger.L().ID.InitialSupply,
+			})
+			require.NoError(t, err)
+			err = reference.Update(multistate.MutationsFromTransaction(tx), nil)
+			require.NoError(t, err)
+		}
+		replay(distributionTxBytes)
+		for _, txBytes := range txs {
+			replay(txBytes)
+			require.True(t, ledger.CommitmentModel.EqualCommitments(branches.Root(), reference.Root()))
+			require.EqualValues(t, 0, branches.Readable().LibraryVersion())
+		}
+		require.True(t, ledger.CommitmentModel.EqualCommitments(rootBeforeActivation, reference.Root()))
+
+		// the first branch after activation records the library version
+		replay(txAfterActivation)
+		require.False(t, ledger.CommitmentModel.EqualCommitments(branches.Root(), reference.Root()))
+		require.EqualValues(t, 1, branches.Readable().LibraryVersion())
+	})
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/proof_verify"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputProof(t *testing.T) {
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(2718))
+	bm := newBranchMaker()
+	store := bm.store
+
+	// commit branch with some outputs on top of genesis
+	branch := bm.makeBranch(bm.genesis, 1, 100, 10, addr)
+	branchID, oids := branch.txid, branch.outputs
+
+	// serializes and parses the proof back
+	proofBackAndForth := func(p *trie_blake2b.MerkleProof) *trie_blake2b.MerkleProof {
+		ret, err := trie_blake2b.ProofFromBytes(p.Bytes())
+		require.NoError(t, err)
+		return ret
+	}
+
+	t.Run("inclusion", func(t *testing.T) {
+		for i := range oids {
+			rr, data, proof, found := multistate.GetUTXOWithProofInBranch(store, &branchID, &oids[i])
+			require.True(t, found)
+			require.True(t, len(data) > 0)
+			p := &proof_verify.OutputProof{
+				OutputID:   oids[i],
+				OutputData: data,
+				BranchID:   branchID,
+				RootRecord: &rr,
+				Proof:      proofBackAndForth(proof),
+			}
+			included, err := p.VerifyUnbound()
+			require.NoError(t, err)
+			require.True(t, included)
+			// root record is not bound to the branch without the branch transaction
+			_, err = p.Verify()
+			require.Error(t, err)
+		}
+	})
+	t.Run("absence", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			oid := ledger.NewOutputID(&branchID, byte(i+2))
+			rr, data, proof, found := multistate.GetUTXOWithProofInBranch(store, &branchID, &oid)
+			require.True(t, found)
+			require.True(t, len(data) == 0)
+			p := &proof_verify.OutputProof{
+				OutputID:   oid,
+				BranchID:   branchID,
+				RootRecord: &rr,
+				Proof:      proofBackAndForth(proof),
+			}
+			included, err := p.VerifyUnbound()
+			require.NoError(t, err)
+			require.False(t, included)
+		}
+		// genesis stem output is consumed in the branch
+		oid := ledger.GenesisStemOutputID()
+		rr, _, proof, _ := multistate.GetUTXOWithProofInBranch(store, &branchID, &oid)
+		require.NoError(t, proof_verify.VerifyOutputAbsence(&rr, &oid, proof))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		rr, data, proof, found := multistate.GetUTXOWithProofInBranch(store, &branchID, &oids[0])
+		require.True(t, found)
+
+		// wrong data
+		wrongData := common.Concat(data)
+		wrongData[len(wrongData)-1] ^= 0xff
+		require.Error(t, proof_verify.VerifyOutputInclusion(&rr, &oids[0], wrongData, proof))
+		// proof of another output
+		require.Error(t, proof_verify.VerifyOutputInclusion(&rr, &oids[1], data, proof))
+		// inclusion is not absence
+		require.Error(t, proof_verify.VerifyOutputAbsence(&rr, &oids[0], proof))
+		// wrong root
+		genesisRR, found := multistate.FetchRootRecord(store, *ledger.GenesisTransactionID())
+		require.True(t, found)
+		require.Error(t, proof_verify.VerifyOutputInclusion(&genesisRR, &oids[0], data, proof))
+		// output is absent in genesis, proof of absence is not valid in the branch
+		_, _, proofGenesis, _ := multistate.GetUTXOWithProofInBranch(store, ledger.GenesisTransactionID(), &oids[0])
+		require.NoError(t, proof_verify.VerifyOutputAbsence(&genesisRR, &oids[0], proofGenesis))
+		require.Error(t, proof_verify.VerifyOutputAbsence(&rr, &oids[0], proofGenesis))
+		// wrong branch transaction bytes
+		require.Error(t, proof_verify.VerifyBranchTransaction(&rr, &branchID, []byte("not a transaction"), proof))
+	})
+	t.Run("branch transaction", func(t *testing.T) {
+		distStore := common.NewInMemoryKVStore()
+		multistate.InitStateStore(*ledger.L().ID, distStore)
+		txBytes, distBranchID := txbuilder.MustDistributeInitialSupplyExt(distStore, genesisPrivateKey, []ledger.LockBalance{
+			{Lock: addr, Balance: ledger.L().ID.InitialSupply / 2},
+		})
+		tx, err := transaction.FromBytes(txBytes, transaction.MainTxValidationOptions...)
+		require.NoError(t, err)
+		require.True(t, tx.IsBranchTransaction())
+		stemID := tx.StemOutput().ID
+		distRR, _, stemProof, found := multistate.GetUTXOWithProofInBranch(distStore, &distBranchID, &stemID)
+		require.True(t, found)
+		require.NoError(t, proof_verify.VerifyBranchTransaction(&distRR, &distBranchID, txBytes, stemProof))
+
+		// proof of the output in the branch state carries the branch transaction
+		addrOut := tx.MustProducedOutputWithIDAt(0)
+		_, data, proof, found := multistate.GetUTXOWithProofInBranch(distStore, &distBranchID, &addrOut.ID)
+		require.True(t, found)
+		p := &proof_verify.OutputProof{
+			OutputID:      addrOut.ID,
+			OutputData:    data,
+			BranchID:      distBranchID,
+			RootRecord:    &distRR,
+			Proof:         proof,
+			BranchTxBytes: txBytes,
+			StemProof:     proofBackAndForth(stemProof),
+		}
+		included, err := p.Verify()
+		require.NoError(t, err)
+		require.True(t, included)
+
+		// stem proof and branch transaction are required
+		p.StemProof = nil
+		_, err = p.Verify()
+		require.Error(t, err)
+		p.StemProof, p.BranchTxBytes = proofBackAndForth(stemProof), nil
+		_, err = p.Verify()
+		require.Error(t, err)
+
+		// root record of another branch with the same sequencer is not bound to the branch transaction
+		genesisRR, found := multistate.FetchRootRecord(distStore, *ledger.GenesisTransactionID())
+		require.True(t, found)
+		require.EqualValues(t, genesisRR.SequencerID, distRR.SequencerID)
+		_, _, stemProofGenesis, _ := multistate.GetUTXOWithProofInBranch(distStore, ledger.GenesisTransactionID(), &stemID)
+		require.Error(t, proof_verify.VerifyBranchTransaction(&genesisRR, &distBranchID, txBytes, stemProofGenesis))
+		require.Error(t, proof_verify.VerifyBranchTransaction(&genesisRR, &distBranchID, txBytes, stemProof))
+	})
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	const numTx = 100
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(27182))
+
+	bm := newBranchMaker()
+	store := bm.store
+	branch := bm.makeBranch(bm.genesis, 2, 1337, numTx, addr)
+	branchID := branch.txid
+
+	var buf bytes.Buffer
+	stats, err := multistate.WriteSnapshot(store, branchID, &buf)
+	require.NoError(t, err)
+	require.EqualValues(t, branchID, stats.BranchID)
+	snapshot := buf.Bytes()
+
+	t.Run("ok", func(t *testing.T) {
+		storeBack := common.NewInMemoryKVStore()
+		statsBack, err := multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack)
+		require.NoError(t, err)
+		require.EqualValues(t, stats.NumKeys, statsBack.NumKeys)
+		require.EqualValues(t, stats.Checksum, statsBack.Checksum)
+		require.True(t, ledger.CommitmentModel.EqualCommitments(branch.root, statsBack.RootRecord.Root))
+
+		rr, found := multistate.FetchRootRecord(storeBack, branchID)
+		require.True(t, found)
+		require.EqualValues(t, 1337, rr.LedgerCoverage)
+		require.EqualValues(t, branchID.Slot(), multistate.FetchLatestSlot(storeBack))
+		require.EqualValues(t, ledger.L().ID.Bytes(), multistate.LedgerIdentityBytesFromStore(storeBack))
+
+		rdr := multistate.MustNewSugaredReadableState(storeBack, rr.Root)
+		outs, err := rdr.GetUTXOsLockedInAccount(addr.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, numTx, len(outs))
+
+		_, err = multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack)
+		require.Error(t, err)
+	})
+	t.Run("wrong checksum", func(t *testing.T) {
+		corrupted := bytes.Clone(snapshot)
+		corrupted[len(corrupted)-1] ^= 0xff
+		storeBack := common.NewInMemoryKVStore()
+		_, err := multistate.ReadSnapshot(bytes.NewReader(corrupted), storeBack)
+		require.ErrorContains(t, err, "wrong checksum")
+		_, found := multistate.FetchRootRecord(storeBack, branchID)
+		require.False(t, found)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := multistate.ReadSnapshot(bytes.NewReader(snapshot[:len(snapshot)/2]), common.NewInMemoryKVStore())
+		require.Error(t, err)
+	})
+	t.Run("oversized chunk", func(t *testing.T) {
+		// length prefix of the ledger identity, which follows the magic string and the version byte
+		const identityLenOffset = len("PROXIMA-STATE-SNAPSHOT") + 1
+		corrupted := bytes.Clone(snapshot)
+		copy(corrupted[identityLenOffset:], []byte{0xff, 0xff, 0xff, 0xff})
+		_, err := multistate.ReadSnapshot(bytes.NewReader(corrupted), common.NewInMemoryKVStore())
+		require.ErrorContains(t, err, "exceeds maximum")
+	})
+	t.Run("trusted", func(t *testing.T) {
+		storeBack := common.NewInMemoryKVStore()
+		trusted := &multistate.SnapshotTrusted{BranchID: &branchID, Root: branch.root}
+		_, err := multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack, trusted)
+		require.NoError(t, err)
+		_, found := multistate.FetchRootRecord(storeBack, branchID)
+		require.True(t, found)
+	})
+	t.Run("wrong trusted branch", func(t *testing.T) {
+		storeBack := common.NewInMemoryKVStore()
+		wrongID := ledger.RandomTransactionID(true)
+		_, err := multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack, &multistate.SnapshotTrusted{BranchID: &wrongID})
+		require.ErrorContains(t, err, "trusted branch")
+		// the store is not touched, so the import can be retried
+		_, err = multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack)
+		require.NoError(t, err)
+	})
+	t.Run("wrong trusted root", func(t *testing.T) {
+		storeBack := common.NewInMemoryKVStore()
+		_, err := multistate.ReadSnapshot(bytes.NewReader(snapshot), storeBack, &multistate.SnapshotTrusted{Root: bm.genesis.root})
+		require.ErrorContains(t, err, "trusted root")
+		_, found := multistate.FetchRootRecord(storeBack, branchID)
+		require.False(t, found)
+	})
+	t.Run("header", func(t *testing.T) {
+		header, err := multistate.ReadSnapshotHeader(bytes.NewReader(snapshot))
+		require.NoError(t, err)
+		require.EqualValues(t, branchID, header.BranchID)
+		require.EqualValues(t, ledger.L().ID.Bytes(), header.LedgerIdentity)
+	})
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateDiff(t *testing.T) {
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(31415))
+	bm := newBranchMaker()
+	store := bm.store
+	// makeBranch commits branch on top of the predecessor with n new outputs, unique for the branch
+	makeBranch := func(pred testBranch, slot ledger.Slot, n int) testBranch {
+		return bm.makeBranch(pred, slot, uint64(slot)*100, n, addr)
+	}
+	genesis := bm.genesis
+	// stateDiffBruteForce calculates the diff of outputs and committed transactions by reading
+	// all key/value pairs of both states
+	stateDiffBruteForce := func(t *testing.T, rootA, rootB common.VCommitment) (added, removed map[string][]byte) {
+		readAll := func(root common.VCommitment) map[string][]byte {
+			trie, err := immutable.NewTrieReader(ledger.CommitmentModel, store, root, 0)
+			require.NoError(t, err)
+			ret := make(map[string][]byte)
+			trie.Iterate(func(k, v []byte) bool {
+				if len(k) > 0 && (k[0] == multistate.PartitionLedgerState || k[0] == multistate.PartitionCommittedTransactionID) {
+					ret[string(k)] = v
+				}
+				return true
+			})
+			return ret
+		}
+		kvA, kvB := readAll(rootA), readAll(rootB)
+		added, removed = make(map[string][]byte), make(map[string][]byte)
+		for k, v := range kvB {
+			if _, inA := kvA[k]; !inA {
+				added[k] = v
+			}
+		}
+		for k, v := range kvA {
+			if _, inB := kvB[k]; !inB {
+				removed[k] = v
+			}
+		}
+		return
+	}
+	requireDiffConsistent := func(t *testing.T, a, b testBranch) *multistate.StateDiff {
+		diff, err := multistate.DiffBranches(store, a.txid, b.txid)
+		require.NoError(t, err)
+		added, removed := stateDiffBruteForce(t, a.root, b.root)
+
+		require.EqualValues(t, len(added), len(diff.AddedOutputs)+len(diff.AddedTxIDs))
+		require.EqualValues(t, len(removed), len(diff.RemovedOutputs)+len(diff.RemovedTxIDs))
+		for _, o := range diff.AddedOutputs {
+			require.EqualValues(t, added[string(common.Concat(multistate.PartitionLedgerState, o.ID[:]))], o.OutputData)
+		}
+		for _, o := range diff.RemovedOutputs {
+			require.EqualValues(t, removed[string(common.Concat(multistate.PartitionLedgerState, o.ID[:]))], o.OutputData)
+		}
+		for _, txid := range diff.AddedTxIDs {
+			_, ok := added[string(common.Concat(multistate.PartitionCommittedTransactionID, txid[:]))]
+			require.True(t, ok)
+		}
+		for _, txid := range diff.RemovedTxIDs {
+			_, ok := removed[string(common.Concat(multistate.PartitionCommittedTransactionID, txid[:]))]
+			require.True(t, ok)
+		}
+		return diff
+	}
+
+	chain := []testBranch{genesis}
+	for slot := ledger.Slot(1); slot <= 5; slot++ {
+		chain = append(chain, makeBranch(chain[slot-1], slot, 5*int(slot)))
+	}
+	fork := makeBranch(chain[2], 3, 7)
+
+	t.Run("same branch", func(t *testing.T) {
+		diff, err := multistate.DiffBranches(store, chain[3].txid, chain[3].txid)
+		require.NoError(t, err)
+		require.True(t, diff.IsEmpty())
+	})
+	t.Run("along the chain", func(t *testing.T) {
+		diff := requireDiffConsistent(t, chain[2], chain[3])
+		// 15 new outputs + new stem, old stem removed
+		require.EqualValues(t, 16, len(diff.AddedOutputs))
+		require.EqualValues(t, 1, len(diff.RemovedOutputs))
+		require.EqualValues(t, chain[2].stem, diff.RemovedOutputs[0].ID)
+		require.EqualValues(t, 16, len(diff.AddedTxIDs))
+		require.EqualValues(t, 0, len(diff.RemovedTxIDs))
+		t.Logf("\n%s", diff.Lines("   ").String())
+
+		requireDiffConsistent(t, chain[1], chain[5])
+		requireDiffConsistent(t, genesis, chain[5])
+		requireDiffConsistent(t, chain[5], genesis)
+	})
+	t.Run("forks", func(t *testing.T) {
+		diff := requireDiffConsistent(t, chain[3], fork)
+		require.EqualValues(t, 8, len(diff.AddedOutputs))
+		require.EqualValues(t, 16, len(diff.RemovedOutputs))
+		require.EqualValues(t, 8, len(diff.AddedTxIDs))
+		require.EqualValues(t, 16, len(diff.RemovedTxIDs))
+
+		requireDiffConsistent(t, fork, chain[5])
+	})
+	t.Run("json", func(t *testing.T) {
+		diff := requireDiffConsistent(t, chain[1], fork)
+		back, err := diff.JSONAble().Parse()
+		require.NoError(t, err)
+		require.EqualValues(t, diff, back)
+	})
+	t.Run("limit", func(t *testing.T) {
+		diff := requireDiffConsistent(t, chain[3], fork)
+		numChanges := len(diff.AddedOutputs) + len(diff.RemovedOutputs) + len(diff.AddedTxIDs) + len(diff.RemovedTxIDs) + diff.OtherChanged
+		limited, err := multistate.DiffBranches(store, chain[3].txid, fork.txid, numChanges)
+		require.NoError(t, err)
+		require.EqualValues(t, diff, limited)
+		_, err = multistate.DiffBranches(store, chain[3].txid, fork.txid, numChanges-1)
+		require.Error(t, err)
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, err := multistate.DiffBranches(store, chain[1].txid, ledger.RandomTransactionID(true))
+		require.Error(t, err)
+	})
+}
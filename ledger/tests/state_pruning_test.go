@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxIDPruning(t *testing.T) {
+	horizon := ledger.L().Const().TransactionIDPruningHorizon()
+	// pruning starts at the activation slot of the library version
+	base, scheduled := ledger.L().TxIDPruningActivationSlot()
+	require.True(t, scheduled)
+	require.EqualValues(t, upgrade1ActivationSlot, base)
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(31415))
+	out := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(1000).WithLock(addr)
+	})
+	newTxID := func(slot ledger.Slot) ledger.TransactionID {
+		var hash ledger.TransactionIDShort
+		_, _ = rand.Read(hash[:])
+		return ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 1), hash, false)
+	}
+	bm := newBranchMaker()
+	// makeBranch commits branch on top of the predecessor with the mutations added by the function
+	makeBranch := func(pred testBranch, slot ledger.Slot, fun func(muts *multistate.Mutations)) testBranch {
+		return bm.makeBranch(pred, slot, 1, 0, nil, func(_ *testBranch, muts *multistate.Mutations, _ *multistate.RootRecordParams) {
+			fun(muts)
+		})
+	}
+	noMutations := func(_ *multistate.Mutations) {}
+
+	// txOld is committed before the activation slot
+	txOld := newTxID(1)
+	oidOld := ledger.NewOutputID(&txOld, 0)
+	txA, txB, txC := newTxID(base), newTxID(base), newTxID(base+1)
+	oidA, oidB, oidC := ledger.NewOutputID(&txA, 0), ledger.NewOutputID(&txB, 0), ledger.NewOutputID(&txC, 0)
+
+	tip := makeBranch(bm.genesis, 2, func(muts *multistate.Mutations) {
+		muts.InsertAddTxMutation(txOld, txOld.Slot(), 0)
+		muts.InsertAddOutputMutation(oidOld, out)
+	})
+	// branch transaction without outputs in the state after its stem is consumed by the next branch
+	branch1 := makeBranch(tip, base+1, func(muts *multistate.Mutations) {
+		muts.InsertDelOutputMutation(oidOld)
+		muts.InsertAddTxMutation(txA, txA.Slot(), 0)
+		muts.InsertAddOutputMutation(oidA, out)
+		muts.InsertAddTxMutation(txB, txB.Slot(), 0)
+		muts.InsertAddOutputMutation(oidB, out)
+	})
+	tip = makeBranch(branch1, base+2, func(muts *multistate.Mutations) {
+		muts.InsertDelOutputMutation(oidB)
+		muts.InsertAddTxMutation(txC, txC.Slot(), 0)
+		muts.InsertAddOutputMutation(oidC, out)
+	})
+
+	rdr := multistate.MustNewReadable(bm.store, tip.root)
+	require.True(t, rdr.KnowsCommittedTransaction(&txOld))
+	require.True(t, rdr.KnowsCommittedTransaction(&txA))
+	require.True(t, rdr.KnowsCommittedTransaction(&txB))
+	require.True(t, rdr.KnowsCommittedTransaction(&txC))
+	_, pruned := rdr.TxIDsPrunedUpToSlot()
+	require.False(t, pruned)
+
+	// nothing is pruned until the activation slot passes the horizon
+	tip = makeBranch(tip, base+horizon-1, noMutations)
+	rdr = multistate.MustNewReadable(bm.store, tip.root)
+	require.True(t, rdr.KnowsCommittedTransaction(&txB))
+	_, pruned = rdr.TxIDsPrunedUpToSlot()
+	require.False(t, pruned)
+
+	// txB is spent and passed the horizon. Spent txOld is before the activation slot and is not pruned
+	tip = makeBranch(tip, base+horizon, noMutations)
+	rdr = multistate.MustNewReadable(bm.store, tip.root)
+	require.True(t, rdr.KnowsCommittedTransaction(&txA))
+	require.False(t, rdr.KnowsCommittedTransaction(&txB))
+	require.True(t, rdr.KnowsCommittedTransaction(&txC))
+	require.True(t, rdr.KnowsCommittedTransaction(&txOld))
+	require.True(t, rdr.KnowsCommittedTransaction(ledger.GenesisTransactionID()))
+	upTo, pruned := rdr.TxIDsPrunedUpToSlot()
+	require.True(t, pruned)
+	require.EqualValues(t, base, upTo)
+
+	// txA is behind the horizon and its last output is spent
+	tip = makeBranch(tip, base+horizon, func(muts *multistate.Mutations) {
+		muts.InsertDelOutputMutation(oidA)
+	})
+	rdr = multistate.MustNewReadable(bm.store, tip.root)
+	require.False(t, rdr.KnowsCommittedTransaction(&txA))
+	require.True(t, rdr.KnowsCommittedTransaction(&txC))
+	require.True(t, rdr.TxIDBehindPruningHorizon(&txA))
+	require.False(t, rdr.TxIDBehindPruningHorizon(&txC))
+	// transactions before the activation slot are never treated as pruned
+	txNotCommitted := newTxID(1)
+	require.False(t, rdr.TxIDBehindPruningHorizon(&txNotCommitted))
+
+	// skipping slots. txC is still known because its output is in the state
+	tip = makeBranch(tip, base+horizon+10, noMutations)
+	rdr = multistate.MustNewReadable(bm.store, tip.root)
+	require.True(t, rdr.KnowsCommittedTransaction(&txC))
+	upTo, _ = rdr.TxIDsPrunedUpToSlot()
+	require.EqualValues(t, base+10, upTo)
+	require.True(t, rdr.TxIDBehindPruningHorizon(&txC))
+
+	// branch transaction IDs are never pruned, so ancestry of old branches is known
+	require.True(t, rdr.KnowsCommittedTransaction(&branch1.txid))
+	require.False(t, rdr.TxIDBehindPruningHorizon(&branch1.txid))
+	require.True(t, multistate.BranchIsDescendantOf(&tip.txid, &branch1.txid, func() common.KVReader { return bm.store }))
+
+	// non-branch updates do not prune
+	upd := multistate.MustNewUpdatable(bm.store, tip.root)
+	muts := multistate.NewMutations()
+	muts.InsertDelOutputMutation(oidC)
+	upd.MustUpdate(muts, nil)
+	require.True(t, upd.Readable().KnowsCommittedTransaction(&txC))
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/util/utxodb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	var privKey0, privKey1 ed25519.PrivateKey
+	var addr0, addr1 ledger.AddressED25519
+	var u *utxodb.UTXODB
+	var chainID ledger.ChainID
+	// token constraint is valid only after activation of the library version 1
+	tokenTs := ledger.MustNewLedgerTime(upgrade1ActivationSlot, 0)
+
+	initTest := func() {
+		u = utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey0, _, addr0 = u.GenerateAddress(0)
+		privKey1, _, addr1 = u.GenerateAddress(1)
+		err := u.TokensFromFaucet(addr0, 10000)
+		require.NoError(t, err)
+		err = u.TokensFromFaucet(addr1, 10000)
+		require.NoError(t, err)
+		chainID, err = u.CreateChainOrigin(privKey0, ledger.TimeNow())
+		require.NoError(t, err)
+	}
+	mintAt := func(amount uint64, target ledger.Lock, ts ledger.Time) error {
+		chainOut, _, err := txbuilder.GetChainAccount(chainID, u.StateReader())
+		require.NoError(t, err)
+		txBytes, err := txbuilder.MakeMintTokensTransaction(&txbuilder.MintTokensData{
+			ChainOutput: chainOut,
+			PrivateKey:  privKey0,
+			Target:      target,
+			TokenAmount: amount,
+			Timestamp:   ts,
+		})
+		require.NoError(t, err)
+		return u.AddTransaction(txBytes)
+	}
+	mint := func(amount uint64, target ledger.Lock) error {
+		return mintAt(amount, target, tokenTs)
+	}
+	t.Run("compile", func(t *testing.T) {
+		tok := ledger.NewToken(ledger.RandomChainID(), 1337)
+		back, err := ledger.TokenFromBytes(tok.Bytes())
+		require.NoError(t, err)
+		require.EqualValues(t, *tok, *back)
+		t.Logf("%s", tok.String())
+	})
+	t.Run("mint", func(t *testing.T) {
+		initTest()
+		err := mint(1_000_000, addr1)
+		require.NoError(t, err)
+
+		bal, err := u.StateReader().GetTokenBalancesInAccount(addr1.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 1, len(bal))
+		require.EqualValues(t, 1_000_000, bal[chainID])
+
+		balIdx, err := u.StateReader().GetTokenBalance(&chainID, addr1.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 1_000_000, balIdx)
+
+		err = mint(500, addr1)
+		require.NoError(t, err)
+		balIdx, err = u.StateReader().GetTokenBalance(&chainID, addr1.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 1_000_500, balIdx)
+	})
+	t.Run("transfer", func(t *testing.T) {
+		initTest()
+		err := mint(1_000_000, addr1)
+		require.NoError(t, err)
+
+		outs, err := u.StateReader().GetUTXOsLockedInAccount(addr1.AccountID())
+		require.NoError(t, err)
+		inputs := make([]*ledger.OutputWithID, 0)
+		for _, o := range outs {
+			inputs = append(inputs, o.MustParse())
+		}
+		txBytes, err := txbuilder.MakeTransferTokensTransaction(&txbuilder.TransferTokensData{
+			Inputs:     inputs,
+			PrivateKey: privKey1,
+			TokenID:    chainID,
+			Amount:     300_000,
+			Target:     addr0,
+			Remainder:  addr1,
+			Timestamp:  tokenTs,
+		})
+		require.NoError(t, err)
+		err = u.AddTransaction(txBytes)
+		require.NoError(t, err)
+
+		bal0, err := u.StateReader().GetTokenBalance(&chainID, addr0.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 300_000, bal0)
+		bal1, err := u.StateReader().GetTokenBalance(&chainID, addr1.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 700_000, bal1)
+	})
+	t.Run("mint without chain fails", func(t *testing.T) {
+		initTest()
+		par, err := u.MakeTransferInputData(privKey1, nil, tokenTs)
+		require.NoError(t, err)
+		err = u.DoTransfer(par.
+			WithAmount(2000).
+			WithTargetLock(addr1).
+			WithConstraint(ledger.NewToken(chainID, 1000)),
+		)
+		easyfl.RequireErrorWith(t, err, "unbalanced token")
+	})
+	t.Run("burn without chain fails", func(t *testing.T) {
+		initTest()
+		err := mint(1_000_000, addr1)
+		require.NoError(t, err)
+
+		outs, err := u.StateReader().GetUTXOsLockedInAccount(addr1.AccountID())
+		require.NoError(t, err)
+		inputs := make([]*ledger.OutputWithID, 0)
+		for _, o := range outs {
+			inputs = append(inputs, o.MustParse())
+		}
+		par := txbuilder.NewTransferData(privKey1, addr1, tokenTs).
+			MustWithInputs(inputs...).
+			WithAmount(1000).
+			WithTargetLock(addr0)
+		// simple transfer skips outputs with tokens, so we put them explicitly
+		txb := txbuilder.NewTransactionBuilder()
+		total, ts, err := txb.ConsumeOutputs(par.Inputs...)
+		require.NoError(t, err)
+		require.NoError(t, txb.PutStandardInputUnlocks(len(par.Inputs)))
+		_, err = txb.ProduceOutput(ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(total).WithLock(addr0)
+		}))
+		require.NoError(t, err)
+		txb.TransactionData.Timestamp = ts.AddTicks(ledger.TransactionPace())
+		txb.TransactionData.InputCommitment = txb.InputCommitment()
+		txb.SignED25519(privKey1)
+
+		err = u.AddTransaction(txb.TransactionData.Bytes())
+		easyfl.RequireErrorWith(t, err, "unbalanced token")
+	})
+	t.Run("mint before activation fails", func(t *testing.T) {
+		initTest()
+		err := mintAt(1_000_000, addr1, ledger.TimeNow())
+		easyfl.RequireErrorWith(t, err, "is not active")
+	})
+	t.Run("repeating token ID fails", func(t *testing.T) {
+		initTest()
+		err := mint(1_000_000, addr1)
+		require.NoError(t, err)
+
+		// both token constraints would be indexed with the same key in the state
+		out := ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(2000).WithLock(addr0)
+			_, _ = o.PushConstraint(ledger.NewToken(chainID, 500).Bytes())
+			_, _ = o.PushConstraint(ledger.NewToken(chainID, 500).Bytes())
+		})
+		_, err = out.TokenBalances()
+		require.Error(t, err)
+
+		par, err := u.MakeTransferInputData(privKey1, nil, tokenTs)
+		require.NoError(t, err)
+		err = u.DoTransfer(par.
+			WithAmount(2000).
+			WithTargetLock(addr0).
+			WithConstraint(ledger.NewToken(chainID, 500)).
+			WithConstraint(ledger.NewToken(chainID, 500)),
+		)
+		easyfl.RequireErrorWith(t, err, "repeating token ID")
+
+		bal, err := u.StateReader().GetTokenBalancesInAccount(addr0.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, 0, len(bal))
+	})
+	t.Run("balances in account", func(t *testing.T) {
+		initTest()
+		err := mint(1_000, addr1)
+		require.NoError(t, err)
+		err = mint(2_000, addr1)
+		require.NoError(t, err)
+
+		// the other token is minted by the other chain
+		privKey2, _, addr2 := u.GenerateAddress(2)
+		require.NoError(t, u.TokensFromFaucet(addr2, 10000))
+		chainID0 := chainID
+		chainID, err = u.CreateChainOrigin(privKey2, tokenTs)
+		require.NoError(t, err)
+		chainOut, _, err := txbuilder.GetChainAccount(chainID, u.StateReader())
+		require.NoError(t, err)
+		txBytes, err := txbuilder.MakeMintTokensTransaction(&txbuilder.MintTokensData{
+			ChainOutput: chainOut,
+			PrivateKey:  privKey2,
+			Target:      addr1,
+			TokenAmount: 500,
+			Timestamp:   tokenTs,
+		})
+		require.NoError(t, err)
+		require.NoError(t, u.AddTransaction(txBytes))
+
+		bal, err := u.StateReader().GetTokenBalancesInAccount(addr1.AccountID())
+		require.NoError(t, err)
+		require.EqualValues(t, ledger.TokenBalances{chainID0: 3_000, chainID: 500}, bal)
+	})
+}
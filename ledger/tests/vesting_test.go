@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/proxima/util/utxodb"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVesting(t *testing.T) {
+	const (
+		vestedAmount = 1_000_000
+		cliff        = 10
+		duration     = 100
+	)
+	var privKey0, privKey1 ed25519.PrivateKey
+	var addr0, addr1 ledger.AddressED25519
+	var u *utxodb.UTXODB
+	var vesting *ledger.Vesting
+
+	// vesting constraint is active starting from the activation of the library version 1
+	vestingTs := ledger.MustNewLedgerTime(upgrade1ActivationSlot, 0)
+
+	initTest := func() {
+		u = utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey0, _, addr0 = u.GenerateAddress(0)
+		privKey1, _, addr1 = u.GenerateAddress(1)
+		err := u.TokensFromFaucet(addr0, 3*vestedAmount)
+		require.NoError(t, err)
+
+		vesting = ledger.NewVesting(vestedAmount, vestingTs.Slot(), cliff, duration)
+		par, err := u.MakeTransferInputData(privKey0, nil, vestingTs)
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(vestedAmount).WithTargetLock(addr1).WithConstraint(vesting))
+		require.NoError(t, err)
+	}
+	vestingOutputs := func() []*ledger.OutputWithID {
+		outs, err := u.StateReader().GetUTXOsLockedInAccount(addr1.AccountID())
+		require.NoError(t, err)
+		ret := make([]*ledger.OutputWithID, 0)
+		for _, o := range outs {
+			oParsed := o.MustParse()
+			if _, idx := oParsed.Output.VestingConstraint(); idx != 0xff {
+				ret = append(ret, oParsed)
+			}
+		}
+		return ret
+	}
+	vestingOutput := func() *ledger.OutputWithID {
+		if outs := vestingOutputs(); len(outs) > 0 {
+			return outs[0]
+		}
+		return nil
+	}
+	release := func(slotsFromStart uint32) error {
+		txBytes, err := txbuilder.MakeReleaseVestedTransaction(&txbuilder.ReleaseVestedData{
+			VestingOutput: vestingOutput(),
+			PrivateKey:    privKey1,
+			Target:        addr1,
+			Timestamp:     ledger.MustNewLedgerTime(vesting.StartSlot+ledger.Slot(slotsFromStart), 0),
+		})
+		if err != nil {
+			return err
+		}
+		return u.AddTransaction(txBytes)
+	}
+	t.Run("compile", func(t *testing.T) {
+		v := ledger.NewVesting(1337, 100, 10, 1000)
+		back, err := ledger.VestingFromBytes(v.Bytes())
+		require.NoError(t, err)
+		require.EqualValues(t, *v, *back)
+		t.Logf("%s", v.String())
+
+		require.EqualValues(t, 1337, v.LockedAmount(0))
+		require.EqualValues(t, 1337, v.LockedAmount(109))
+		require.EqualValues(t, 1337-1337*10/1000, v.LockedAmount(110))
+		require.EqualValues(t, 1337-1337*500/1000, v.LockedAmount(600))
+		require.EqualValues(t, 0, v.LockedAmount(1100))
+
+		_, err = ledger.VestingFromBytes(ledger.NewVesting(1337, 100, 10, 0).Bytes())
+		require.Error(t, err)
+		_, err = ledger.VestingFromBytes(ledger.NewVesting(1337, 100, 11, 10).Bytes())
+		require.Error(t, err)
+	})
+	t.Run("create", func(t *testing.T) {
+		initTest()
+		o := vestingOutput()
+		require.NotNil(t, o)
+		v, _ := o.Output.VestingConstraint()
+		require.EqualValues(t, *vesting, *v)
+		require.EqualValues(t, vestedAmount, o.Output.Amount())
+	})
+	t.Run("create before activation fails", func(t *testing.T) {
+		u = utxodb.NewUTXODB(genesisPrivateKey, true)
+		privKey0, _, addr0 = u.GenerateAddress(0)
+		_, _, addr1 = u.GenerateAddress(1)
+		err := u.TokensFromFaucet(addr0, 2*vestedAmount)
+		require.NoError(t, err)
+
+		ts := ledger.TimeNow()
+		par, err := u.MakeTransferInputData(privKey0, nil, ts)
+		require.NoError(t, err)
+		v := ledger.NewVesting(vestedAmount, ts.Slot(), cliff, duration)
+		err = u.DoTransfer(par.WithAmount(vestedAmount).WithTargetLock(addr1).WithConstraint(v))
+		easyfl.RequireErrorWith(t, err, "vesting requires library version 1")
+	})
+	t.Run("create with not enough amount fails", func(t *testing.T) {
+		initTest()
+		par, err := u.MakeTransferInputData(privKey0, nil, vestingTs.AddTicks(ledger.TransactionPace()))
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(vestedAmount / 2).WithTargetLock(addr1).WithConstraint(vesting))
+		easyfl.RequireErrorWith(t, err, "vesting constraint failed")
+	})
+	t.Run("release before cliff fails", func(t *testing.T) {
+		initTest()
+		err := release(cliff - 1)
+		easyfl.RequireErrorWith(t, err, "not enough vested amount")
+	})
+	t.Run("wrong successor fails", func(t *testing.T) {
+		initTest()
+		o := vestingOutput()
+		txb := txbuilder.NewTransactionBuilder()
+		_, err := txb.ConsumeOutputWithID(o)
+		require.NoError(t, err)
+		txb.PutSignatureUnlock(0)
+		_, vestingIdx := o.Output.VestingConstraint()
+		// unlock parameters point to the lock of the produced output instead of the vesting constraint
+		txb.PutUnlockParams(0, vestingIdx, []byte{0, ledger.ConstraintIndexLock})
+		_, err = txb.ProduceOutput(ledger.NewOutput(func(out *ledger.Output) {
+			out.WithAmount(o.Output.Amount()).WithLock(addr1)
+		}))
+		require.NoError(t, err)
+		txb.TransactionData.Timestamp = ledger.MustNewLedgerTime(vesting.StartSlot+duration/2, 0)
+		txb.TransactionData.InputCommitment = txb.InputCommitment()
+		txb.SignED25519(privKey1)
+
+		err = u.AddTransaction(txb.TransactionData.Bytes())
+		easyfl.RequireErrorWith(t, err, "vesting constraint failed")
+	})
+	// releaseTwo consumes two vesting outputs in one transaction. Unlock parameters of both inputs point
+	// to the vesting constraints of the successors with the given indices
+	releaseTwo := func(successorIdx0, successorIdx1 byte, numSuccessors int) error {
+		ins := vestingOutputs()
+		require.EqualValues(t, 2, len(ins))
+
+		ts := ledger.MustNewLedgerTime(vesting.StartSlot+duration/2, 0)
+		locked := vesting.LockedAmount(ts.Slot())
+		txb := txbuilder.NewTransactionBuilder()
+		for i, o := range ins {
+			_, err := txb.ConsumeOutputWithID(o)
+			require.NoError(t, err)
+			if i == 0 {
+				txb.PutSignatureUnlock(0)
+			} else {
+				err = txb.PutUnlockReference(byte(i), ledger.ConstraintIndexLock, 0)
+				require.NoError(t, err)
+			}
+		}
+		_, vestingIdx := ins[0].Output.VestingConstraint()
+		txb.PutUnlockParams(0, vestingIdx, []byte{successorIdx0, vestingIdx})
+		txb.PutUnlockParams(1, vestingIdx, []byte{successorIdx1, vestingIdx})
+		for i := 0; i < numSuccessors; i++ {
+			_, err := txb.ProduceOutput(ins[i].Output.Clone(func(o *ledger.Output) {
+				o.PutAmount(locked)
+			}))
+			require.NoError(t, err)
+		}
+		_, err := txb.ProduceOutput(ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(2*vestedAmount - uint64(numSuccessors)*locked).WithLock(addr1)
+		}))
+		require.NoError(t, err)
+		txb.TransactionData.Timestamp = ts
+		txb.TransactionData.InputCommitment = txb.InputCommitment()
+		txb.SignED25519(privKey1)
+		return u.AddTransaction(txb.TransactionData.Bytes())
+	}
+	initTestTwo := func() {
+		initTest()
+		par, err := u.MakeTransferInputData(privKey0, nil, vestingTs.AddTicks(ledger.TransactionPace()))
+		require.NoError(t, err)
+		err = u.DoTransfer(par.WithAmount(vestedAmount).WithTargetLock(addr1).WithConstraint(vesting))
+		require.NoError(t, err)
+	}
+	t.Run("two vesting outputs with one successor fail", func(t *testing.T) {
+		initTestTwo()
+		err := releaseTwo(0, 0, 1)
+		easyfl.RequireErrorWith(t, err, "vesting constraint failed")
+	})
+	t.Run("two vesting outputs with two successors", func(t *testing.T) {
+		initTestTwo()
+		err := releaseTwo(0, 1, 2)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, len(vestingOutputs()))
+	})
+	t.Run("successor index different from the input index fails", func(t *testing.T) {
+		initTestTwo()
+		err := releaseTwo(1, 0, 2)
+		easyfl.RequireErrorWith(t, err, "vesting constraint failed")
+	})
+	t.Run("release in the middle", func(t *testing.T) {
+		initTest()
+		err := release(duration / 2)
+		require.NoError(t, err)
+
+		o := vestingOutput()
+		require.NotNil(t, o)
+		require.EqualValues(t, vesting.LockedAmount(vesting.StartSlot+duration/2), o.Output.Amount())
+		require.EqualValues(t, vestedAmount, u.Balance(addr1))
+
+		// nothing more is vested in the same slot
+		err = release(duration / 2)
+		easyfl.RequireErrorWith(t, err, "not enough vested amount")
+
+		err = release(duration - 10)
+		require.NoError(t, err)
+		o = vestingOutput()
+		require.NotNil(t, o)
+		require.EqualValues(t, vesting.LockedAmount(vesting.StartSlot+duration-10), o.Output.Amount())
+	})
+	t.Run("release all", func(t *testing.T) {
+		initTest()
+		err := release(duration)
+		require.NoError(t, err)
+		require.Nil(t, vestingOutput())
+		require.EqualValues(t, vestedAmount, u.Balance(addr1))
+		require.EqualValues(t, 1, u.NumUTXOs(addr1))
+	})
+	t.Run("genesis distribution before activation fails", func(t *testing.T) {
+		// vested genesis allocations are tested in the package 'genesis_v1', where the library version 1
+		// is active from genesis
+		addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(31337))
+		store := common.NewInMemoryKVStore()
+		multistate.InitStateStore(*ledger.L().ID, store)
+
+		_, err := txbuilder.MakeDistributionTransaction(store, genesisPrivateKey, []ledger.LockBalance{
+			{Lock: addr, Balance: 2_000_000, Vesting: ledger.NewVesting(1_000_000, 100, cliff, duration)},
+		})
+		easyfl.RequireErrorWith(t, err, "require library version 1")
+	})
+}
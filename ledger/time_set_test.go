@@ -15,6 +15,6 @@ func TestTimeConstSet(t *testing.T) {
 	t.Logf("\n%s", L().ID.TimeConstantsToString())
 	require.EqualValues(t, d, TickDuration())
 	t.Logf("------------------\n%s", id.String())
-	t.Logf("------------------\n" + string(id.YAML()))
-	t.Logf("------------------\n" + L().ID.TimeConstantsToString())
+	t.Log("------------------\n" + string(id.YAML()))
+	t.Log("------------------\n" + L().ID.TimeConstantsToString())
 }
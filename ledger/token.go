@@ -0,0 +1,202 @@
+package ledger
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lazybytes"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Token constraint makes the output carry the specified amount of a native fungible token (colored coin).
+// Token ID is the chain ID of the chain which acts as the minting authority of the token.
+// The constraint enforces balance conservation of its token ID between consumed and produced outputs of the transaction.
+// Minting and burning is only possible in the transaction which consumes the controlling chain.
+// Each output can carry at most one token constraint with the same token ID.
+// The constraint and the embedded functions it uses belong to the library version 1 (see upgrade1.go)
+
+type Token struct {
+	ID     ChainID
+	Amount uint64
+}
+
+const (
+	TokenName     = "token"
+	tokenTemplate = TokenName + "(0x%s, u64/%d)"
+)
+
+const tokenSource = `
+// token($0, $1)
+// $0 - token ID, 32 bytes. It is the chain ID of the minting chain
+// $1 - token amount, 8 bytes big-endian. Must be positive in the produced output
+func token: and(
+	mustSize($0, 32),
+	mustSize($1, 8),
+	or(
+		selfIsConsumedOutput,
+		not(isZero($1)),
+		!!!token_amount_must_be_positive
+	),
+	or(
+		equal(txConsumedTokenAmount($0), txProducedTokenAmount($0)),
+		txConsumesChain($0),
+		!!!unbalanced_token:_minting_and_burning_require_controlling_chain
+	)
+)
+`
+
+func NewToken(id ChainID, amount uint64) *Token {
+	return &Token{
+		ID:     id,
+		Amount: amount,
+	}
+}
+
+func TokenFromBytes(data []byte) (*Token, error) {
+	sym, _, args, err := L().ParseBytecodeOneLevel(data, 2)
+	if err != nil {
+		return nil, err
+	}
+	if sym != TokenName {
+		return nil, fmt.Errorf("not a token constraint")
+	}
+	id, err := ChainIDFromBytes(easyfl.StripDataPrefix(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	amountBin := easyfl.StripDataPrefix(args[1])
+	if len(amountBin) != 8 {
+		return nil, fmt.Errorf("wrong token amount")
+	}
+	return NewToken(id, binary.BigEndian.Uint64(amountBin)), nil
+}
+
+func (t *Token) source() string {
+	return fmt.Sprintf(tokenTemplate, hex.EncodeToString(t.ID[:]), t.Amount)
+}
+
+func (t *Token) Bytes() []byte {
+	return mustBinFromSource(t.source())
+}
+
+func (t *Token) Name() string {
+	return TokenName
+}
+
+func (t *Token) String() string {
+	return fmt.Sprintf("%s(%s, %s)", TokenName, t.ID.StringShort(), util.GoTh(t.Amount))
+}
+
+func addTokenConstraint(lib *Library) {
+	lib.extendWithConstraint(TokenName, tokenSource, 2, func(data []byte) (Constraint, error) {
+		return TokenFromBytes(data)
+	}, initTestTokenConstraint)
+}
+
+func initTestTokenConstraint() {
+	example := NewToken(RandomChainID(), 1337)
+	back, err := TokenFromBytes(example.Bytes())
+	util.AssertNoError(err)
+	util.Assertf(*back == *example, "inconsistency in "+TokenName)
+
+	_, err = L().ParsePrefixBytecode(example.Bytes())
+	util.AssertNoError(err)
+}
+
+// TokenBalances is a balance of each token ID
+type TokenBalances map[ChainID]uint64
+
+// Add adds amount to the token balance. Returns false on arithmetic overflow
+func (tb TokenBalances) Add(id ChainID, amount uint64) bool {
+	prev := tb[id]
+	if amount > math.MaxUint64-prev {
+		return false
+	}
+	tb[id] = prev + amount
+	return true
+}
+
+// evalTxConsumedTokenAmount returns total amount of the token in the consumed outputs of the transaction
+func (lib *Library) evalTxConsumedTokenAmount(ctx *easyfl.CallParams) []byte {
+	lib.mustActiveVersion(ctx, 1, "txConsumedTokenAmount")
+	return txTokenAmount(ctx, PathToConsumedOutputs)
+}
+
+// evalTxProducedTokenAmount returns total amount of the token in the produced outputs of the transaction
+func (lib *Library) evalTxProducedTokenAmount(ctx *easyfl.CallParams) []byte {
+	lib.mustActiveVersion(ctx, 1, "txProducedTokenAmount")
+	return txTokenAmount(ctx, PathToProducedOutputs)
+}
+
+// evalTxConsumesChain returns non-empty value if the transaction consumes output of the chain
+func (lib *Library) evalTxConsumesChain(ctx *easyfl.CallParams) []byte {
+	lib.mustActiveVersion(ctx, 1, "txConsumesChain")
+	chainID := mustTokenIDArg(ctx)
+	tree := mustTxDataTree(ctx)
+	var found bool
+	tree.ForEach(func(i byte, data []byte) bool {
+		out, err := OutputFromBytesReadOnly(data)
+		if err != nil {
+			ctx.TracePanic("txConsumesChain: %v", err)
+		}
+		cc, idx := out.ChainConstraint()
+		if idx == 0xff {
+			return true
+		}
+		id := cc.ID
+		if id == NilChainID {
+			// origin of the chain
+			id = blake2b.Sum256(tree.BytesAtPath(lazybytes.Path(TransactionBranch, TxInputIDs, i)))
+		}
+		found = id == chainID
+		return !found
+	}, PathToConsumedOutputs)
+	if found {
+		return []byte{0xff}
+	}
+	return nil
+}
+
+func txTokenAmount(ctx *easyfl.CallParams, path lazybytes.TreePath) []byte {
+	tokenID := mustTokenIDArg(ctx)
+	var sum uint64
+	mustTxDataTree(ctx).ForEach(func(i byte, data []byte) bool {
+		out, err := OutputFromBytesReadOnly(data)
+		if err != nil {
+			ctx.TracePanic("txTokenAmount: %v", err)
+		}
+		balances, err := out.TokenBalances()
+		if err != nil {
+			ctx.TracePanic("txTokenAmount: output #%d: %v", i, err)
+		}
+		amount := balances[tokenID]
+		if amount > math.MaxUint64-sum {
+			ctx.TracePanic("txTokenAmount: arithmetic overflow")
+		}
+		sum += amount
+		return true
+	}, path)
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], sum)
+	return ret[:]
+}
+
+func mustTokenIDArg(ctx *easyfl.CallParams) ChainID {
+	ret, err := ChainIDFromBytes(ctx.Arg(0))
+	if err != nil {
+		ctx.TracePanic("wrong token ID: %v", err)
+	}
+	return ret
+}
+
+func mustTxDataTree(ctx *easyfl.CallParams) *lazybytes.Tree {
+	dc := dataContextOrNil(ctx)
+	if dc == nil || dc.DataTree() == nil {
+		ctx.TracePanic("transaction context expected")
+	}
+	return dc.DataTree()
+}
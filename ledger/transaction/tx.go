@@ -8,9 +8,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
-	"github.com/lunfardo314/proxima/multistate"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/proxima/util/lazybytes"
 	"github.com/lunfardo314/proxima/util/lines"
@@ -784,12 +782,6 @@ func (tx *Transaction) InputLoaderByIndex(fetchOutput func(oid *ledger.OutputID)
 	}
 }
 
-func (tx *Transaction) InputLoaderFromState(rdr global.StateReader) func(idx byte) (*ledger.Output, error) {
-	return tx.InputLoaderByIndex(func(oid *ledger.OutputID) ([]byte, bool) {
-		return rdr.GetUTXO(oid)
-	})
-}
-
 // SequencerChainPredecessor returns chain predecessor output ID
 // If it is chain origin, it returns nil. Otherwise, it may or may not be a sequencer ID
 // It also returns index of the inout
@@ -858,20 +850,6 @@ func (tx *Transaction) ProducedOutputsToString() string {
 	return strings.Join(ret, "\n")
 }
 
-func (tx *Transaction) StateMutations() *multistate.Mutations {
-	ret := multistate.NewMutations()
-	tx.ForEachInput(func(i byte, oid *ledger.OutputID) bool {
-		ret.InsertDelOutputMutation(*oid)
-		return true
-	})
-	tx.ForEachProducedOutput(func(_ byte, o *ledger.Output, oid *ledger.OutputID) bool {
-		ret.InsertAddOutputMutation(*oid, o)
-		return true
-	})
-	ret.InsertAddTxMutation(*tx.ID(), tx.Slot(), byte(tx.NumProducedOutputs()-1))
-	return ret
-}
-
 func (tx *Transaction) Lines(inputLoaderByIndex func(i byte) (*ledger.Output, error), prefix ...string) *lines.Lines {
 	ctx, err := TxContextFromTransaction(tx, inputLoaderByIndex)
 	if err != nil {
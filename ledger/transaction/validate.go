@@ -45,6 +45,13 @@ func (ctx *TxContext) checkConstraint(constraintData []byte, constraintPath lazy
 	return ret, name, nil
 }
 
+// EvalConstraintAt evaluates constraint bytecode in the transaction context, as if it was located at the path.
+// Returns result of the evaluation. Nil result means constraint failed. Used by tooling
+func (ctx *TxContext) EvalConstraintAt(constraintData []byte, constraintPath lazybytes.TreePath) ([]byte, error) {
+	ret, _, err := ctx.checkConstraint(constraintData, constraintPath)
+	return ret, err
+}
+
 func (ctx *TxContext) Validate() error {
 	var inSum, outSum uint64
 	var err error
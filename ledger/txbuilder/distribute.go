@@ -50,10 +50,26 @@ func MakeDistributionTransaction(stateStore global.StateStore, originPrivateKey
 	}
 	genesisDistributionOutputs := make([]*ledger.Output, len(genesisDistribution))
 	for i := range genesisDistribution {
+		if vesting := genesisDistribution[i].Vesting; vesting != nil {
+			if err = vesting.Valid(); err != nil {
+				return nil, err
+			}
+			err = util.ErrorConditionf(vesting.Amount <= genesisDistribution[i].Balance,
+				"vested amount %d is greater than the balance %d", vesting.Amount, genesisDistribution[i].Balance)
+			if err != nil {
+				return nil, err
+			}
+		}
 		genesisDistributionOutputs[i] = ledger.NewOutput(func(o *ledger.Output) {
 			o.WithAmount(genesisDistribution[i].Balance).
 				WithLock(genesisDistribution[i].Lock)
+			if genesisDistribution[i].Vesting != nil {
+				_, err = o.PushConstraint(genesisDistribution[i].Vesting.Bytes())
+			}
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	rdr, err := multistate.NewSugaredReadableState(stateStore, genesisRoot)
@@ -69,13 +85,19 @@ func MakeDistributionTransaction(stateStore global.StateStore, originPrivateKey
 	}
 
 	// create origin branch transaction at the next slot after genesis time slot
+	ts := ledger.MustNewLedgerTime(genesisStem.Timestamp().Slot()+1, 0)
+	for i := range genesisDistribution {
+		if genesisDistribution[i].Vesting != nil && ledger.L().ActiveVersionAtSlot(ts.Slot()) < 1 {
+			return nil, fmt.Errorf("vested genesis allocations require library version 1 active from slot %d", ts.Slot())
+		}
+	}
 	txBytes, err := MakeSequencerTransaction(MakeSequencerTransactionParams{
 		ChainInput: &ledger.OutputWithChainID{
 			OutputWithID: *initSupplyOutput,
 			ChainID:      bootstrapChainID,
 		},
 		StemInput:           genesisStem,
-		Timestamp:           ledger.MustNewLedgerTime(genesisStem.Timestamp().Slot()+1, 0),
+		Timestamp:           ts,
 		MinimumFee:          0,
 		AdditionalInputs:    nil,
 		AdditionalOutputs:   genesisDistributionOutputs,
@@ -102,12 +124,12 @@ func MustDistributeInitialSupplyExt(stateStore global.StateStore, originPrivateK
 	tx, err := transaction.FromBytesMainChecksWithOpt(txBytes)
 	util.AssertNoError(err)
 
-	err = tx.Validate(transaction.ValidateOptionWithFullContext(tx.InputLoaderFromState(rdr)))
+	err = tx.Validate(transaction.ValidateOptionWithFullContext(tx.InputLoaderByIndex(rdr.GetUTXO)))
 	util.Assertf(err == nil, "%v\n>>>>>>>>>>>>>>>>> %s\n<<<<<<<<<<<<<\n", err, tx.String)
 
 	nextStem := tx.FindStemProducedOutput()
 	util.Assertf(nextStem != nil, "nextStem != nil")
-	muts := tx.StateMutations()
+	muts := multistate.MutationsFromTransaction(tx)
 
 	updatableOrigin := multistate.MustNewUpdatable(stateStore, genesisRoot)
 	updatableOrigin.MustUpdate(muts, &multistate.RootRecordParams{
@@ -0,0 +1,191 @@
+package txbuilder
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+)
+
+// MintTokensData is the parameters of the token minting transaction.
+// Tokens with the token ID equal to the chain ID are minted by transiting the controlling chain.
+// Storage deposit for the token output and the optional tag-along fee are taken from the chain output
+type MintTokensData struct {
+	ChainOutput *ledger.OutputWithChainID
+	PrivateKey  ed25519.PrivateKey
+	Target      ledger.Lock
+	TokenAmount uint64
+	Timestamp   ledger.Time // takes ledger.TimeNow() if ledger.NilLedgerTime
+	TagAlong    *TagAlongData
+}
+
+// MakeMintTokensTransaction creates transaction which mints tokens controlled by the chain and sends them to the target lock
+func MakeMintTokensTransaction(par *MintTokensData) ([]byte, error) {
+	if par.ChainOutput == nil || par.Target == nil || par.TokenAmount == 0 {
+		return nil, fmt.Errorf("MakeMintTokensTransaction: wrong parameters")
+	}
+	tokenOut := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(0).WithLock(par.Target)
+		_, _ = o.PushConstraint(ledger.NewToken(par.ChainOutput.ChainID, par.TokenAmount).Bytes())
+	})
+	deposit := ledger.MinimumStorageDeposit(tokenOut, 0)
+	tokenOut = tokenOut.Clone(func(o *ledger.Output) {
+		o.PutAmount(deposit)
+	})
+
+	var fee uint64
+	if par.TagAlong != nil {
+		fee = par.TagAlong.Amount
+	}
+	chainAmount := par.ChainOutput.Output.Amount()
+	if chainAmount <= deposit+fee {
+		return nil, fmt.Errorf("MakeMintTokensTransaction: not enough tokens on chain %s: needed more than %d, got %d",
+			par.ChainOutput.ChainID.StringShort(), deposit+fee, chainAmount)
+	}
+
+	ts := par.Timestamp
+	if ts == ledger.NilLedgerTime {
+		ts = ledger.TimeNow()
+	}
+	ts = ledger.MaxTime(ts, par.ChainOutput.Timestamp().AddTicks(ledger.TransactionPace()))
+
+	_, predIdx := par.ChainOutput.Output.ChainConstraint()
+	if predIdx == 0xff {
+		return nil, fmt.Errorf("MakeMintTokensTransaction: can't find chain constraint in the output")
+	}
+	txb := NewTransactionBuilder()
+	chainInputIndex, err := txb.ConsumeOutput(par.ChainOutput.Output, par.ChainOutput.ID)
+	if err != nil {
+		return nil, err
+	}
+	chainSuccessor := par.ChainOutput.Output.Clone(func(o *ledger.Output) {
+		o.WithAmount(chainAmount-deposit-fee).
+			PutConstraint(ledger.NewChainConstraint(par.ChainOutput.ChainID, chainInputIndex, predIdx, 0).Bytes(), predIdx)
+	})
+	successorIndex, err := txb.ProduceOutput(chainSuccessor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = txb.ProduceOutput(tokenOut); err != nil {
+		return nil, err
+	}
+	if par.TagAlong != nil {
+		feeOut := ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(par.TagAlong.Amount).WithLock(ledger.ChainLockFromChainID(par.TagAlong.SeqID))
+		})
+		if _, err = txb.ProduceOutput(feeOut); err != nil {
+			return nil, err
+		}
+	}
+	txb.PutSignatureUnlock(chainInputIndex)
+	txb.PutUnlockParams(chainInputIndex, predIdx, []byte{successorIndex, predIdx, 0})
+
+	txb.TransactionData.Timestamp = ts
+	txb.TransactionData.InputCommitment = txb.InputCommitment()
+	txb.SignED25519(par.PrivateKey)
+
+	return txb.TransactionData.Bytes(), nil
+}
+
+// TransferTokensData is the parameters of the token transfer transaction
+type TransferTokensData struct {
+	Inputs     []*ledger.OutputWithID
+	PrivateKey ed25519.PrivateKey
+	TokenID    ledger.ChainID
+	Amount     uint64
+	Target     ledger.Lock
+	Remainder  ledger.Lock
+	Timestamp  ledger.Time // takes ledger.TimeNow() if ledger.NilLedgerTime
+	TagAlong   *TagAlongData
+}
+
+// MakeTransferTokensTransaction creates transaction which sends tokens to the target lock.
+// All inputs must be unlockable with the signature. Base amount of inputs covers storage deposits and the fee,
+// the remainder of the token and of the base amount is sent back to the remainder lock.
+// Other tokens held on inputs are passed to the remainder output unchanged
+func MakeTransferTokensTransaction(par *TransferTokensData) ([]byte, error) {
+	if par.Target == nil || par.Remainder == nil || par.Amount == 0 || len(par.Inputs) == 0 {
+		return nil, fmt.Errorf("MakeTransferTokensTransaction: wrong parameters")
+	}
+	txb := NewTransactionBuilder()
+	inTotal, inTs, err := txb.ConsumeOutputs(par.Inputs...)
+	if err != nil {
+		return nil, err
+	}
+	if err = txb.PutStandardInputUnlocks(len(par.Inputs)); err != nil {
+		return nil, err
+	}
+	tokensIn := make(ledger.TokenBalances)
+	for _, o := range par.Inputs {
+		for _, tok := range o.Output.Tokens() {
+			if !tokensIn.Add(tok.ID, tok.Amount) {
+				return nil, fmt.Errorf("MakeTransferTokensTransaction: token arithmetic overflow")
+			}
+		}
+	}
+	if tokensIn[par.TokenID] < par.Amount {
+		return nil, fmt.Errorf("MakeTransferTokensTransaction: not enough tokens %s: needed %d, got %d",
+			par.TokenID.StringShort(), par.Amount, tokensIn[par.TokenID])
+	}
+	tokensIn[par.TokenID] -= par.Amount
+	if tokensIn[par.TokenID] == 0 {
+		delete(tokensIn, par.TokenID)
+	}
+
+	targetOut := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(0).WithLock(par.Target)
+		_, _ = o.PushConstraint(ledger.NewToken(par.TokenID, par.Amount).Bytes())
+	})
+	targetOut = targetOut.Clone(func(o *ledger.Output) {
+		o.PutAmount(ledger.MinimumStorageDeposit(targetOut, 0))
+	})
+
+	remainderOut := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(0).WithLock(par.Remainder)
+		for _, id := range util.KeysSorted(tokensIn, func(id1, id2 ledger.ChainID) bool { return bytes.Compare(id1[:], id2[:]) < 0 }) {
+			if _, err = o.PushConstraint(ledger.NewToken(id, tokensIn[id]).Bytes()); err != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var fee uint64
+	if par.TagAlong != nil {
+		fee = par.TagAlong.Amount
+	}
+	needed := targetOut.Amount() + ledger.MinimumStorageDeposit(remainderOut, 0) + fee
+	if inTotal < needed {
+		return nil, fmt.Errorf("MakeTransferTokensTransaction: not enough base amount: needed %d, got %d", needed, inTotal)
+	}
+	remainderOut = remainderOut.Clone(func(o *ledger.Output) {
+		o.PutAmount(inTotal - targetOut.Amount() - fee)
+	})
+
+	if _, err = txb.ProduceOutput(targetOut); err != nil {
+		return nil, err
+	}
+	if _, err = txb.ProduceOutput(remainderOut); err != nil {
+		return nil, err
+	}
+	if par.TagAlong != nil {
+		feeOut := ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(par.TagAlong.Amount).WithLock(ledger.ChainLockFromChainID(par.TagAlong.SeqID))
+		})
+		if _, err = txb.ProduceOutput(feeOut); err != nil {
+			return nil, err
+		}
+	}
+	ts := par.Timestamp
+	if ts == ledger.NilLedgerTime {
+		ts = ledger.TimeNow()
+	}
+	txb.TransactionData.Timestamp = ledger.MaxTime(ts, inTs.AddTicks(ledger.TransactionPace()))
+	txb.TransactionData.InputCommitment = txb.InputCommitment()
+	txb.SignED25519(par.PrivateKey)
+
+	return txb.TransactionData.Bytes(), nil
+}
@@ -409,6 +409,14 @@ func outputsToConsumeSimple(par *TransferData, amount uint64) (uint64, []*ledger
 		if numConsumedOutputs >= 256 {
 			return 0, nil, fmt.Errorf("exceeded max number of consumed outputs 256")
 		}
+		if o.Output.HasTokens() {
+			// outputs with tokens are not consumed by base amount transfers, otherwise tokens would be burned
+			continue
+		}
+		if vesting, idx := o.Output.VestingConstraint(); idx != 0xff && vesting.LockedAmount(par.Timestamp.Slot()) > 0 {
+			// outputs with not-yet-vested amount can only be consumed by MakeReleaseVestedTransaction
+			continue
+		}
 		consumedOuts = append(consumedOuts, o)
 		numConsumedOutputs++
 		availableTokens += o.Output.Amount()
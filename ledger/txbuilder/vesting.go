@@ -0,0 +1,88 @@
+package txbuilder
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+)
+
+// ReleaseVestedData is the parameters of the transaction which releases vested amount of the vesting output.
+// The lock of the vesting output must be unlockable with the signature
+type ReleaseVestedData struct {
+	VestingOutput *ledger.OutputWithID
+	PrivateKey    ed25519.PrivateKey
+	Target        ledger.Lock
+	Timestamp     ledger.Time // takes ledger.TimeNow() if ledger.NilLedgerTime
+	TagAlong      *TagAlongData
+}
+
+// MakeReleaseVestedTransaction creates transaction which sends amount vested at the timestamp of the transaction
+// to the target lock. The not-yet-vested amount remains in the successor output with the same lock and the same
+// vesting constraint. The successor is not produced when everything is vested. The optional tag-along fee
+// is taken from the released amount
+func MakeReleaseVestedTransaction(par *ReleaseVestedData) ([]byte, error) {
+	if par.VestingOutput == nil || par.Target == nil {
+		return nil, fmt.Errorf("MakeReleaseVestedTransaction: wrong parameters")
+	}
+	vesting, vestingIdx := par.VestingOutput.Output.VestingConstraint()
+	if vestingIdx == 0xff {
+		return nil, fmt.Errorf("MakeReleaseVestedTransaction: output %s has no vesting constraint", par.VestingOutput.IDShort())
+	}
+	ts := par.Timestamp
+	if ts == ledger.NilLedgerTime {
+		ts = ledger.TimeNow()
+	}
+	ts = ledger.MaxTime(ts, par.VestingOutput.Timestamp().AddTicks(ledger.TransactionPace()))
+
+	txb := NewTransactionBuilder()
+	if _, err := txb.ConsumeOutputWithID(par.VestingOutput); err != nil {
+		return nil, err
+	}
+	txb.PutSignatureUnlock(0)
+
+	inAmount := par.VestingOutput.Output.Amount()
+	var successorAmount uint64
+	if locked := vesting.LockedAmount(ts.Slot()); locked > 0 {
+		successorAmount = max(locked, ledger.MinimumStorageDeposit(par.VestingOutput.Output, 0))
+		successor := par.VestingOutput.Output.Clone(func(o *ledger.Output) {
+			o.PutAmount(successorAmount)
+		})
+		successorIdx, err := txb.ProduceOutput(successor)
+		if err != nil {
+			return nil, err
+		}
+		// unlock parameters of the vesting constraint point to the vesting constraint of the successor
+		txb.PutUnlockParams(0, vestingIdx, []byte{successorIdx, vestingIdx})
+	}
+	var fee uint64
+	if par.TagAlong != nil {
+		fee = par.TagAlong.Amount
+	}
+	targetOut := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(0).WithLock(par.Target)
+	})
+	if inAmount < successorAmount+fee+ledger.MinimumStorageDeposit(targetOut, 0) {
+		return nil, fmt.Errorf("MakeReleaseVestedTransaction: not enough vested amount at %s: vested %d, fee %d",
+			ts.String(), inAmount-successorAmount, fee)
+	}
+	targetOut = targetOut.Clone(func(o *ledger.Output) {
+		o.PutAmount(inAmount - successorAmount - fee)
+	})
+	if _, err := txb.ProduceOutput(targetOut); err != nil {
+		return nil, err
+	}
+	if par.TagAlong != nil {
+		feeOut := ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(par.TagAlong.Amount).WithLock(ledger.ChainLockFromChainID(par.TagAlong.SeqID))
+		})
+		if _, err := txb.ProduceOutput(feeOut); err != nil {
+			return nil, err
+		}
+	}
+	txb.TransactionData.Timestamp = ts
+	txb.TransactionData.InputCommitment = txb.InputCommitment()
+	txb.SignED25519(par.PrivateKey)
+
+	return txb.TransactionData.Bytes(), nil
+}
@@ -0,0 +1,83 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/lunfardo314/easyfl"
+)
+
+// This file contains the "version 1" of the ledger library. It only adds new functions on top of the "version 0".
+// The new embedded functions check if the version is active at the timestamp of the transaction, so
+// extended functions which use them are only valid starting from the activation slot (see lib_version.go)
+// The version 1 also adds the token constraint (see token.go) and the vesting constraint (see vesting.go)
+
+func (lib *Library) upgrade1(_ *IdentityData) {
+	lib.upgrade1WithEmbedded()
+	lib.upgrade1WithExtensions()
+	lib.upgrade1WithConstraints()
+}
+
+//==================================== embedded
+
+func (lib *Library) upgrade1WithEmbedded() {
+	lib.UpgradeWthEmbeddedLong(
+		&easyfl.EmbeddedFunctionData{
+			Sym:            "libraryVersion",
+			RequiredNumPar: 0,
+			EmbeddedFun:    lib.evalLibraryVersion,
+		},
+		&easyfl.EmbeddedFunctionData{
+			Sym:            "sha256",
+			RequiredNumPar: 1,
+			EmbeddedFun:    lib.evalSHA256,
+		},
+		// token balances, used by the token constraint
+		&easyfl.EmbeddedFunctionData{
+			Sym:            "txConsumedTokenAmount",
+			RequiredNumPar: 1,
+			EmbeddedFun:    lib.evalTxConsumedTokenAmount,
+		},
+		&easyfl.EmbeddedFunctionData{
+			Sym:            "txProducedTokenAmount",
+			RequiredNumPar: 1,
+			EmbeddedFun:    lib.evalTxProducedTokenAmount,
+		},
+		&easyfl.EmbeddedFunctionData{
+			Sym:            "txConsumesChain",
+			RequiredNumPar: 1,
+			EmbeddedFun:    lib.evalTxConsumesChain,
+		},
+	)
+}
+
+// evalLibraryVersion returns 1-byte library version active at the timestamp of the transaction
+func (lib *Library) evalLibraryVersion(ctx *easyfl.CallParams) []byte {
+	return []byte{lib.activeLibraryVersion(ctx)}
+}
+
+func (lib *Library) evalSHA256(ctx *easyfl.CallParams) []byte {
+	lib.mustActiveVersion(ctx, 1, "sha256")
+	ret := sha256.Sum256(ctx.Arg(0))
+	return ret[:]
+}
+
+//============================================ extensions
+
+var upgrade1WithFunctions = []*easyfl.ExtendedFunctionData{
+	// returns selfUnlockParameters if sha256 hash of it is equal to the given hash, otherwise nil
+	{"selfSHA256Unlock", "if(equal($0, sha256(selfUnlockParameters)),selfUnlockParameters,nil)"},
+}
+
+func (lib *Library) upgrade1WithExtensions() {
+	lib.UpgradeWithExtensions(upgrade1WithFunctions...)
+
+	// inline tests
+	lib.MustEqual("libraryVersion", fmt.Sprintf("%d", LatestLibraryVersion))
+	lib.MustEqual("sha256(0x616263)", "0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+}
+
+func (lib *Library) upgrade1WithConstraints() {
+	addTokenConstraint(lib)
+	addVestingConstraint(lib)
+}
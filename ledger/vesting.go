@@ -0,0 +1,205 @@
+package ledger
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lunfardo314/easyfl"
+	"github.com/lunfardo314/proxima/util"
+)
+
+// Vesting constraint locks the amount which is released linearly during the vesting period.
+// Nothing is released before the cliff slot (start slot + cliff). After the cliff, the vested amount grows linearly
+// from the start slot until the end of the vesting duration, when everything is vested.
+// The output with the vesting constraint can be consumed only if the successor output repeats the same constraint
+// and holds at least the not-yet-vested amount. When everything is vested, the successor is not required.
+// The successor must have the same index among produced outputs as the consumed vesting output among inputs,
+// so one successor cannot be shared by several vesting outputs.
+// The vesting constraint belongs to the version 1 of the library (see upgrade1.go)
+
+type Vesting struct {
+	// Amount is the total vested amount
+	Amount    uint64
+	StartSlot Slot
+	// Cliff is number of slots from the start slot, before which nothing is vested
+	Cliff uint32
+	// Duration is number of slots from the start slot, after which everything is vested. Must be positive
+	Duration uint32
+}
+
+const (
+	VestingName     = "vesting"
+	vestingTemplate = VestingName + "(u64/%d, u32/%d, u32/%d, u32/%d)"
+)
+
+const vestingSource = `
+// _vestedAmount($0, $1, $2) computes $0 * $1 / $2 without overflow, assuming $1 < $2 < 2^32
+func _vestedAmount : add(
+	mul(div($0, $2), $1),
+	div(mul(mod($0, $2), $1), $2)
+)
+
+// vestingLockedAmount($0, $1, $2, $3, $4) returns 8-byte amount which is not vested yet at the time slot $4
+// $0 - total vested amount
+// $1 - start time slot
+// $2 - cliff in slots. Nothing is vested before $1 + $2
+// $3 - duration in slots. Everything is vested at $1 + $3
+// $4 - time slot
+func vestingLockedAmount : if(
+	lessThanUint($4, add($1, $2)),
+	uint64Bytes($0),
+	if(
+		lessThanUint($4, add($1, $3)),
+		sub($0, _vestedAmount($0, sub($4, $1), $3)),
+		u64/0
+	)
+)
+
+func _selfVestingLockedAmount : vestingLockedAmount($0, $1, $2, $3, txTimeSlot)
+
+// vesting($0, $1, $2, $3)
+// $0 - total vested amount, 8 bytes
+// $1 - start time slot
+// $2 - cliff in slots, 4 bytes
+// $3 - duration in slots, 4 bytes. Must be positive and not less than the cliff
+// The produced output must hold at least the not-yet-vested amount.
+// The 2-byte unlock parameters of the consumed output point to the constraint of the successor:
+// index of the produced output and index of the constraint in it. The index of the successor must be equal to
+// the index of the consumed output, and the successor must repeat the same constraint.
+// Unlock parameters are not needed when everything is vested
+func vesting : and(
+	or(not(isZero(libraryVersion)), !!!vesting_requires_library_version_1),
+	mustSize($0, 8),
+	mustValidTimeSlot($1),
+	mustSize($2, 4),
+	mustSize($3, 4),
+	not(isZero($3)),
+	lessOrEqualThan($2, $3),
+	or(
+		and(
+			selfIsProducedOutput,
+			not(lessThanUint(selfAmountValue, _selfVestingLockedAmount($0, $1, $2, $3)))
+		),
+		and(
+			selfIsConsumedOutput,
+			or(
+				isZero(_selfVestingLockedAmount($0, $1, $2, $3)),
+				and(
+					equalUint(len(selfUnlockParameters), 2),
+					equal(byte(selfUnlockParameters, 0), selfOutputIndex),
+					equal(self, producedConstraintByIndex(selfUnlockParameters))
+				)
+			)
+		),
+		!!!vesting_constraint_failed
+	)
+)
+`
+
+func NewVesting(amount uint64, startSlot Slot, cliff, duration uint32) *Vesting {
+	return &Vesting{
+		Amount:    amount,
+		StartSlot: startSlot,
+		Cliff:     cliff,
+		Duration:  duration,
+	}
+}
+
+func VestingFromBytes(data []byte) (*Vesting, error) {
+	sym, _, args, err := L().ParseBytecodeOneLevel(data, 4)
+	if err != nil {
+		return nil, err
+	}
+	if sym != VestingName {
+		return nil, fmt.Errorf("not a vesting constraint")
+	}
+	amountBin := easyfl.StripDataPrefix(args[0])
+	if len(amountBin) != 8 {
+		return nil, fmt.Errorf("wrong vesting amount")
+	}
+	startSlot, err := SlotFromBytes(easyfl.StripDataPrefix(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	cliffBin := easyfl.StripDataPrefix(args[2])
+	durationBin := easyfl.StripDataPrefix(args[3])
+	if len(cliffBin) != 4 || len(durationBin) != 4 {
+		return nil, fmt.Errorf("wrong vesting cliff or duration")
+	}
+	ret := NewVesting(binary.BigEndian.Uint64(amountBin), startSlot, binary.BigEndian.Uint32(cliffBin), binary.BigEndian.Uint32(durationBin))
+	if err = ret.Valid(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Valid checks parameters of the vesting in the same way as the constraint does
+func (v *Vesting) Valid() error {
+	if v.Duration == 0 {
+		return fmt.Errorf("vesting duration must be positive")
+	}
+	if v.Cliff > v.Duration {
+		return fmt.Errorf("vesting cliff must not be greater than the duration")
+	}
+	return nil
+}
+
+// LockedAmount returns the amount which is not vested yet at the slot. Must be consistent with 'vestingLockedAmount'
+func (v *Vesting) LockedAmount(slot Slot) uint64 {
+	if uint64(slot) < uint64(v.StartSlot)+uint64(v.Cliff) {
+		return v.Amount
+	}
+	if uint64(slot) >= uint64(v.StartSlot)+uint64(v.Duration) {
+		return 0
+	}
+	elapsed := uint64(slot - v.StartSlot)
+	duration := uint64(v.Duration)
+	return v.Amount - (v.Amount/duration*elapsed + v.Amount%duration*elapsed/duration)
+}
+
+// FullyVestedSlot is the first slot when everything is vested
+func (v *Vesting) FullyVestedSlot() Slot {
+	return v.StartSlot + Slot(v.Duration)
+}
+
+func (v *Vesting) source() string {
+	return fmt.Sprintf(vestingTemplate, v.Amount, v.StartSlot, v.Cliff, v.Duration)
+}
+
+func (v *Vesting) Bytes() []byte {
+	return mustBinFromSource(v.source())
+}
+
+func (v *Vesting) Name() string {
+	return VestingName
+}
+
+func (v *Vesting) String() string {
+	return fmt.Sprintf("%s(%s, start: %d, cliff: %d, duration: %d)", VestingName, util.GoTh(v.Amount), v.StartSlot, v.Cliff, v.Duration)
+}
+
+func addVestingConstraint(lib *Library) {
+	lib.extendWithConstraint(VestingName, vestingSource, 4, func(data []byte) (Constraint, error) {
+		return VestingFromBytes(data)
+	}, initTestVestingConstraint)
+}
+
+func initTestVestingConstraint() {
+	example := NewVesting(1_000_000_000_000_000, 100, 10, 1000)
+	back, err := VestingFromBytes(example.Bytes())
+	util.AssertNoError(err)
+	util.Assertf(*back == *example, "inconsistency in "+VestingName)
+
+	_, err = L().ParsePrefixBytecode(example.Bytes())
+	util.AssertNoError(err)
+
+	// EasyFL and Go versions of the locked amount must be consistent
+	for _, slot := range []Slot{0, 99, 100, 109, 110, 111, 555, 1099, 1100, 1101, 10000} {
+		src := fmt.Sprintf("vestingLockedAmount(u64/%d, u32/%d, u32/%d, u32/%d, u32/%d)",
+			example.Amount, example.StartSlot, example.Cliff, example.Duration, slot)
+		res, err := L().EvalFromSource(nil, src)
+		util.AssertNoError(err)
+		util.Assertf(len(res) == 8 && binary.BigEndian.Uint64(res) == example.LockedAmount(slot),
+			"inconsistency in 'vestingLockedAmount' at slot %d", slot)
+	}
+}
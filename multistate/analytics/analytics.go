@@ -0,0 +1,256 @@
+// Package analytics collects time series of supply, inflation and state statistics along the heaviest branch chain
+// of the multi-state DB and exports them as CSV, JSON or Prometheus gauges
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lines"
+)
+
+type (
+	Params struct {
+		// SlotsBack number of slots back from the latest. Negative means all slots in the DB
+		SlotsBack int
+		// TopN number of accounts in the rich list of the latest branch. 0 means no rich list
+		TopN int
+		// ScanStates if true, number of UTXOs and chains is counted for each branch, otherwise only for the latest.
+		// Counting requires scanning of the whole state
+		ScanStates bool
+	}
+
+	// SlotStats statistics of the branch of the heaviest chain
+	SlotStats struct {
+		Slot        ledger.Slot          `json:"slot"`
+		BranchID    ledger.TransactionID `json:"-"`
+		SequencerID ledger.ChainID       `json:"-"`
+		Supply      uint64               `json:"supply"`
+		// SlotInflation total inflation of the slot. It is a sum of branch inflation bonus and chain inflation
+		SlotInflation        uint64 `json:"slot_inflation"`
+		BranchInflationBonus uint64 `json:"branch_inflation_bonus"`
+		ChainInflation       uint64 `json:"chain_inflation"`
+		LedgerCoverage       uint64 `json:"ledger_coverage"`
+		NumTransactions      uint32 `json:"num_transactions"`
+		// -1 if not counted
+		NumUTXOs  int `json:"num_utxos"`
+		NumChains int `json:"num_chains"`
+	}
+
+	AccountBalance struct {
+		Lock       string `json:"lock"`
+		Balance    uint64 `json:"balance"`
+		NumOutputs int    `json:"num_outputs"`
+	}
+
+	// SequencerShare statistics of the sequencer over the branches of the time series
+	SequencerShare struct {
+		SequencerID ledger.ChainID `json:"-"`
+		NumBranches int            `json:"num_branches"`
+		// CoverageShare is ledger coverage of sequencer's branches divided by the total coverage of all branches
+		CoverageShare float64 `json:"coverage_share"`
+	}
+
+	Report struct {
+		// ascending by slot
+		Series []*SlotStats `json:"series"`
+		// rich list in the latest branch, descending by balance
+		TopAccounts []*AccountBalance `json:"top_accounts,omitempty"`
+		// descending by coverage share
+		Sequencers []*SequencerShare `json:"sequencers"`
+	}
+)
+
+// Collect collects statistics along the heaviest branch chain
+func Collect(store global.StateStoreReader, par Params) *Report {
+	branches := multistate.FetchHeaviestBranchChainNSlotsBack(store, par.SlotsBack) // descending
+	ret := &Report{
+		Series:     make([]*SlotStats, 0, len(branches)),
+		Sequencers: make([]*SequencerShare, 0),
+	}
+	if len(branches) == 0 {
+		return ret
+	}
+	seqShares := make(map[ledger.ChainID]*SequencerShare)
+	totalCoverage := uint64(0)
+
+	for i := len(branches) - 1; i >= 0; i-- {
+		bd := branches[i]
+		st := &SlotStats{
+			Slot:            bd.Stem.ID.Slot(),
+			BranchID:        *bd.TxID(),
+			SequencerID:     bd.SequencerID,
+			Supply:          bd.Supply,
+			SlotInflation:   bd.SlotInflation,
+			LedgerCoverage:  bd.LedgerCoverage,
+			NumTransactions: bd.NumTransactions,
+			NumUTXOs:        -1,
+			NumChains:       -1,
+		}
+		// inflation of the branch transaction itself is the branch inflation bonus
+		if bd.SequencerOutput.ID.TransactionID() == st.BranchID {
+			st.BranchInflationBonus = bd.SequencerOutput.Output.Inflation(true)
+		}
+		if st.BranchInflationBonus <= st.SlotInflation {
+			st.ChainInflation = st.SlotInflation - st.BranchInflationBonus
+		}
+		if par.ScanStates || i == 0 {
+			st.NumUTXOs, st.NumChains = multistate.MustNewReadable(store, bd.Root, 0).CountUTXOsAndChains()
+		}
+		ret.Series = append(ret.Series, st)
+
+		share := seqShares[bd.SequencerID]
+		if share == nil {
+			share = &SequencerShare{SequencerID: bd.SequencerID}
+			seqShares[bd.SequencerID] = share
+			ret.Sequencers = append(ret.Sequencers, share)
+		}
+		share.NumBranches++
+		share.CoverageShare += float64(bd.LedgerCoverage)
+		totalCoverage += bd.LedgerCoverage
+	}
+	for _, share := range ret.Sequencers {
+		if totalCoverage > 0 {
+			share.CoverageShare /= float64(totalCoverage)
+		}
+	}
+	sort.SliceStable(ret.Sequencers, func(i, j int) bool {
+		return ret.Sequencers[i].CoverageShare > ret.Sequencers[j].CoverageShare
+	})
+	if par.TopN > 0 {
+		ret.TopAccounts = topAccounts(multistate.MustNewReadable(store, branches[0].Root, 0), par.TopN)
+	}
+	return ret
+}
+
+func topAccounts(rdr *multistate.Readable, topN int) []*AccountBalance {
+	accounts := rdr.AccountsByLocks()
+	ret := make([]*AccountBalance, 0, len(accounts))
+	for lockStr, info := range accounts {
+		ret = append(ret, &AccountBalance{
+			Lock:       lockStr,
+			Balance:    info.Balance,
+			NumOutputs: info.NumOutputs,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Balance == ret[j].Balance {
+			return ret[i].Lock < ret[j].Lock
+		}
+		return ret[i].Balance > ret[j].Balance
+	})
+	if len(ret) > topN {
+		ret = ret[:topN]
+	}
+	return ret
+}
+
+// Latest returns stats of the latest branch or nil if series is empty
+func (r *Report) Latest() *SlotStats {
+	if len(r.Series) == 0 {
+		return nil
+	}
+	return r.Series[len(r.Series)-1]
+}
+
+func (r *Report) Lines(prefix ...string) *lines.Lines {
+	ret := lines.New(prefix...)
+	latest := r.Latest()
+	if latest == nil {
+		return ret.Add("no branches")
+	}
+	first := r.Series[0]
+	var bonus, chainInfl uint64
+	for _, st := range r.Series {
+		bonus += st.BranchInflationBonus
+		chainInfl += st.ChainInflation
+	}
+	ret.Add("Slots from %d to %d, branches: %d", first.Slot, latest.Slot, len(r.Series)).
+		Add("Supply: %s -> %s", util.GoTh(first.Supply), util.GoTh(latest.Supply)).
+		Add("Inflation: branch bonus: %s, chain inflation: %s", util.GoTh(bonus), util.GoTh(chainInfl)).
+		Add("Latest: UTXOs: %d, chains: %d, ledger coverage: %s", latest.NumUTXOs, latest.NumChains, util.GoTh(latest.LedgerCoverage))
+	ret.Add("Sequencers:")
+	for _, s := range r.Sequencers {
+		ret.Add("   %s : branches: %d, coverage share: %.2f%%", s.SequencerID.StringShort(), s.NumBranches, 100*s.CoverageShare)
+	}
+	if len(r.TopAccounts) > 0 {
+		ret.Add("Top %d accounts:", len(r.TopAccounts))
+		for i, a := range r.TopAccounts {
+			ret.Add("   %3d: %s :: balance: %s, outputs: %d", i+1, a.Lock, util.GoTh(a.Balance), a.NumOutputs)
+		}
+	}
+	return ret
+}
+
+var csvHeader = []string{
+	"slot", "branch_id", "sequencer_id", "supply", "slot_inflation", "branch_inflation_bonus", "chain_inflation",
+	"ledger_coverage", "num_transactions", "num_utxos", "num_chains",
+}
+
+// WriteCSV writes time series in CSV format
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, st := range r.Series {
+		err := cw.Write([]string{
+			strconv.Itoa(int(st.Slot)),
+			st.BranchID.StringHex(),
+			st.SequencerID.StringHex(),
+			strconv.FormatUint(st.Supply, 10),
+			strconv.FormatUint(st.SlotInflation, 10),
+			strconv.FormatUint(st.BranchInflationBonus, 10),
+			strconv.FormatUint(st.ChainInflation, 10),
+			strconv.FormatUint(st.LedgerCoverage, 10),
+			strconv.Itoa(int(st.NumTransactions)),
+			strconv.Itoa(st.NumUTXOs),
+			strconv.Itoa(st.NumChains),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the report in JSON format
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// MarshalJSON adds hex-encoded IDs to the JSON form of the stats
+func (st *SlotStats) MarshalJSON() ([]byte, error) {
+	type slotStats SlotStats
+	return json.Marshal(&struct {
+		BranchID    string `json:"branch_id"`
+		SequencerID string `json:"sequencer_id"`
+		*slotStats
+	}{
+		BranchID:    st.BranchID.StringHex(),
+		SequencerID: st.SequencerID.StringHex(),
+		slotStats:   (*slotStats)(st),
+	})
+}
+
+// MarshalJSON adds hex-encoded sequencer ID to the JSON form
+func (s *SequencerShare) MarshalJSON() ([]byte, error) {
+	type sequencerShare SequencerShare
+	return json.Marshal(&struct {
+		SequencerID string `json:"sequencer_id"`
+		*sequencerShare
+	}{
+		SequencerID:    s.SequencerID.StringHex(),
+		sequencerShare: (*sequencerShare)(s),
+	})
+}
@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exposes the latest statistics of the heaviest chain as Prometheus gauges
+type Metrics struct {
+	supply               prometheus.Gauge
+	slotInflation        prometheus.Gauge
+	branchInflationBonus prometheus.Gauge
+	chainInflation       prometheus.Gauge
+	ledgerCoverage       prometheus.Gauge
+	numTransactions      prometheus.Gauge
+	numUTXOs             prometheus.Gauge
+	numChains            prometheus.Gauge
+	sequencerShare       *prometheus.GaugeVec
+	topAccountBalance    *prometheus.GaugeVec
+}
+
+func NewMetrics(reg *prometheus.Registry) *Metrics {
+	ret := &Metrics{
+		supply: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_supply",
+			Help: "total supply in the latest branch of the heaviest chain",
+		}),
+		slotInflation: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_slotInflation",
+			Help: "total inflation in the slot of the latest branch of the heaviest chain",
+		}),
+		branchInflationBonus: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_branchInflationBonus",
+			Help: "branch inflation bonus of the latest branch of the heaviest chain",
+		}),
+		chainInflation: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_chainInflation",
+			Help: "chain inflation in the slot of the latest branch of the heaviest chain",
+		}),
+		ledgerCoverage: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_ledgerCoverage",
+			Help: "ledger coverage of the latest branch of the heaviest chain",
+		}),
+		numTransactions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_numTransactions",
+			Help: "number of new transactions in the slot of the latest branch of the heaviest chain",
+		}),
+		numUTXOs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_numUTXOs",
+			Help: "number of outputs in the state of the latest branch of the heaviest chain",
+		}),
+		numChains: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "analytics_numChains",
+			Help: "number of chains in the state of the latest branch of the heaviest chain",
+		}),
+		sequencerShare: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "analytics_sequencerCoverageShare",
+			Help: "share of the sequencer in the ledger coverage of the heaviest chain branches",
+		}, []string{"sequencer_id"}),
+		topAccountBalance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "analytics_topAccountBalance",
+			Help: "balance of the top accounts in the latest branch of the heaviest chain",
+		}, []string{"lock"}),
+	}
+	reg.MustRegister(
+		ret.supply,
+		ret.slotInflation,
+		ret.branchInflationBonus,
+		ret.chainInflation,
+		ret.ledgerCoverage,
+		ret.numTransactions,
+		ret.numUTXOs,
+		ret.numChains,
+		ret.sequencerShare,
+		ret.topAccountBalance,
+	)
+	return ret
+}
+
+// Update sets gauges from the report
+func (m *Metrics) Update(r *Report) {
+	latest := r.Latest()
+	if latest == nil {
+		return
+	}
+	m.supply.Set(float64(latest.Supply))
+	m.slotInflation.Set(float64(latest.SlotInflation))
+	m.branchInflationBonus.Set(float64(latest.BranchInflationBonus))
+	m.chainInflation.Set(float64(latest.ChainInflation))
+	m.ledgerCoverage.Set(float64(latest.LedgerCoverage))
+	m.numTransactions.Set(float64(latest.NumTransactions))
+	if latest.NumUTXOs >= 0 {
+		m.numUTXOs.Set(float64(latest.NumUTXOs))
+		m.numChains.Set(float64(latest.NumChains))
+	}
+	m.sequencerShare.Reset()
+	for _, s := range r.Sequencers {
+		m.sequencerShare.WithLabelValues(s.SequencerID.StringHex()).Set(s.CoverageShare)
+	}
+	m.topAccountBalance.Reset()
+	for _, a := range r.TopAccounts {
+		m.topAccountBalance.WithLabelValues(a.Lock).Set(float64(a.Balance))
+	}
+}
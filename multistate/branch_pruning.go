@@ -0,0 +1,342 @@
+package multistate
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+// Pruning of orphaned branches in the multi-state DB.
+// Most of the branches become orphaned soon after they are committed: they do not belong to the heaviest chain.
+// Branches which are older than the horizon and are not on the heaviest chain are removed from the DB together with
+// the trie nodes and values which are not reachable from any other (retained) root.
+// Trie nodes are content-addressed and shared among roots, so the garbage collection is "mark and sweep":
+//   - all nodes reachable from the retained roots are marked
+//   - nodes reachable from the pruned roots but not marked are deleted
+// State updates are blocked only during the final phase, when roots committed during the marking are taken into account.
+// Sets of marked and collected keys are kept in separate partitions of the DB, so memory used by the pruning
+// does not depend on the size of the state
+
+// DefaultBranchPruningHorizonSlots branches younger than that are never pruned
+const DefaultBranchPruningHorizonSlots = 1000
+
+// stateCommitMutex prevents commits of new states while garbage is being deleted from the DB
+var stateCommitMutex sync.RWMutex
+
+// branchPruningMutex only one pruning at a time can use the partitions of marked and collected keys
+var branchPruningMutex sync.Mutex
+
+// two partitions of the DB, used only during the pruning
+const (
+	markedKeysDBPartition  = latestSlotDBPartition + 1
+	garbageKeysDBPartition = markedKeysDBPartition + 1
+)
+
+// dbKeySetBatchSize is the maximum number of keys of the key set buffered in memory and written or deleted in one batch
+const dbKeySetBatchSize = 100_000
+
+type BranchPruningStats struct {
+	RootRecordsDeleted int
+	TrieNodesDeleted   int
+	ValuesDeleted      int
+	// BytesReclaimed total size of deleted keys and values
+	BytesReclaimed int
+}
+
+func (s *BranchPruningStats) String() string {
+	return fmt.Sprintf("root records deleted: %d, trie nodes deleted: %d, values deleted: %d, bytes reclaimed: %s",
+		s.RootRecordsDeleted, s.TrieNodesDeleted, s.ValuesDeleted, util.GoTh(s.BytesReclaimed))
+}
+
+// dbKeySet is a set of DB keys kept in the partition of the DB. Inserted keys are buffered in memory
+// and written to the DB in batches of bounded size
+type dbKeySet struct {
+	store     global.StateStore
+	partition byte
+	pending   map[string]struct{}
+}
+
+// PruneOrphanedBranches deletes branches older than horizonSlots from the latest slot, which are not on the heaviest chain.
+// Safe to run concurrently with state updates
+func PruneOrphanedBranches(store global.StateStore, horizonSlots int) (*BranchPruningStats, error) {
+	util.Assertf(horizonSlots > 0, "PruneOrphanedBranches: horizon must be positive")
+
+	branchPruningMutex.Lock()
+	defer branchPruningMutex.Unlock()
+
+	ret := &BranchPruningStats{}
+	latestSlot := FetchLatestSlot(store)
+	if int(latestSlot) <= horizonSlots {
+		return ret, nil
+	}
+	pruneBefore := latestSlot - ledger.Slot(horizonSlots)
+	heaviestChain := heaviestChainBranchIDs(store)
+
+	toPrune := make(map[ledger.TransactionID]RootRecord)
+	retained := make(map[ledger.TransactionID]RootRecord)
+	IterateRootRecords(store, func(branchTxID ledger.TransactionID, rootData RootRecord) bool {
+		if _, onHeaviestChain := heaviestChain[branchTxID]; !onHeaviestChain && branchTxID.Slot() < pruneBefore {
+			toPrune[branchTxID] = rootData
+		} else {
+			retained[branchTxID] = rootData
+		}
+		return true
+	})
+	if len(toPrune) == 0 {
+		return ret, nil
+	}
+	trieNodes := common.MakeReaderPartition(store, immutable.PartitionTrieNodes)
+
+	// mark phase. Key sets may be left by the interrupted pruning
+	marked, err := newDBKeySet(store, markedKeysDBPartition)
+	if err != nil {
+		return nil, err
+	}
+	garbage, err := newDBKeySet(store, garbageKeysDBPartition)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range retained {
+		if err = markNodes(trieNodes, rr.Root, marked); err != nil {
+			return nil, err
+		}
+	}
+	// collect nodes and values of pruned roots, which are not reachable from the retained roots
+	for _, rr := range toPrune {
+		if err = collectGarbage(trieNodes, rr.Root, marked, garbage); err != nil {
+			return nil, err
+		}
+	}
+
+	stateCommitMutex.Lock()
+	defer stateCommitMutex.Unlock()
+
+	// roots committed during marking may reference collected garbage. Nodes reachable from them are marked
+	// and are not deleted by the sweep
+	IterateRootRecords(store, func(branchTxID ledger.TransactionID, rootData RootRecord) bool {
+		if _, pruned := toPrune[branchTxID]; pruned {
+			return true
+		}
+		if _, already := retained[branchTxID]; already {
+			return true
+		}
+		err = markNodes(trieNodes, rootData.Root, marked)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = marked.flush(); err != nil {
+		return nil, err
+	}
+
+	// sweep phase
+	batch := store.BatchedWriter()
+	for branchTxID := range toPrune {
+		key := common.Concat(rootRecordDBPartition, branchTxID[:])
+		ret.BytesReclaimed += len(key) + len(store.Get(key))
+		batch.Set(key, nil)
+		ret.RootRecordsDeleted++
+	}
+	if err = batch.Commit(); err != nil {
+		return nil, err
+	}
+	err = garbage.consume(func(key []byte, batch common.KVWriter) {
+		if marked.has(key) {
+			return
+		}
+		ret.BytesReclaimed += len(key) + len(store.Get(key))
+		batch.Set(key, nil)
+		if key[0] == immutable.PartitionTrieNodes {
+			ret.TrieNodesDeleted++
+		} else {
+			ret.ValuesDeleted++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = marked.clear(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// heaviestChainBranchIDs follows stem predecessors from the heaviest branch of the latest slot
+// until the predecessor is not in the DB
+func heaviestChainBranchIDs(store global.StateStoreReader) map[ledger.TransactionID]struct{} {
+	ret := make(map[ledger.TransactionID]struct{})
+	latest := FetchLatestRootRecords(store)
+	if len(latest) == 0 {
+		return ret
+	}
+	bd := FetchBranchDataByRoot(store, latest[0])
+	for {
+		ret[*bd.TxID()] = struct{}{}
+		stemLock, ok := bd.Stem.Output.StemLock()
+		util.Assertf(ok, "inconsistency: stem output expected")
+		var found bool
+		if bd, found = FetchBranchData(store, stemLock.PredecessorOutputID.TransactionID()); !found {
+			return ret
+		}
+	}
+}
+
+func fetchNode(trieNodes common.KVReader, key []byte) (*common.NodeData, error) {
+	nodeBin := trieNodes.Get(key)
+	if len(nodeBin) == 0 {
+		return nil, fmt.Errorf("can't find trie node %x", key)
+	}
+	noValueStore := func(_ []byte) ([]byte, error) {
+		panic("inconsistency: all terminal commitments must be stored in the trie node")
+	}
+	return common.NodeDataFromBytes(ledger.CommitmentModel, nodeBin, ledger.CommitmentModel.PathArity(), noValueStore)
+}
+
+// nodeDBKeys returns DB key of the node and DB key of its value, if the value is not in the terminal commitment
+func nodeDBKeys(key []byte, n *common.NodeData) (string, string) {
+	nodeKey := string(common.Concat(immutable.PartitionTrieNodes, key))
+	if common.IsNil(n.Terminal) {
+		return nodeKey, ""
+	}
+	if _, valueInCommitment := common.ExtractValue(n.Terminal); valueInCommitment {
+		return nodeKey, ""
+	}
+	return nodeKey, string(common.Concat(immutable.PartitionValues, common.AsKey(n.Terminal)))
+}
+
+// markNodes marks DB keys of all nodes and values reachable from the root. Subtrees of already marked nodes
+// are skipped, because they are marked already
+func markNodes(trieNodes common.KVReader, root common.VCommitment, marked *dbKeySet) error {
+	key := common.AsKey(root)
+	if marked.has(common.Concat(immutable.PartitionTrieNodes, key)) {
+		return nil
+	}
+	n, err := fetchNode(trieNodes, key)
+	if err != nil {
+		return err
+	}
+	nodeKey, valueKey := nodeDBKeys(key, n)
+	for _, k := range []string{nodeKey, valueKey} {
+		if k == "" {
+			continue
+		}
+		if err = marked.insert(k); err != nil {
+			return err
+		}
+	}
+	n.IterateChildren(func(_ byte, child common.VCommitment) bool {
+		err = markNodes(trieNodes, child, marked)
+		return err == nil
+	})
+	return err
+}
+
+// collectGarbage collects DB keys of nodes and values reachable from the root which are not marked
+func collectGarbage(trieNodes common.KVReader, root common.VCommitment, marked, garbage *dbKeySet) error {
+	key := common.AsKey(root)
+	dbKey := common.Concat(immutable.PartitionTrieNodes, key)
+	if marked.has(dbKey) || garbage.has(dbKey) {
+		return nil
+	}
+	n, err := fetchNode(trieNodes, key)
+	if err != nil {
+		return err
+	}
+	nodeKey, valueKey := nodeDBKeys(key, n)
+	if err = garbage.insert(nodeKey); err != nil {
+		return err
+	}
+	if valueKey != "" && !marked.has([]byte(valueKey)) {
+		if err = garbage.insert(valueKey); err != nil {
+			return err
+		}
+	}
+	n.IterateChildren(func(_ byte, child common.VCommitment) bool {
+		err = collectGarbage(trieNodes, child, marked, garbage)
+		return err == nil
+	})
+	return err
+}
+
+// newDBKeySet creates empty key set. Keys left in the partition are deleted
+func newDBKeySet(store global.StateStore, partition byte) (*dbKeySet, error) {
+	ret := &dbKeySet{
+		store:     store,
+		partition: partition,
+		pending:   make(map[string]struct{}),
+	}
+	if err := ret.clear(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *dbKeySet) has(key []byte) bool {
+	if _, ok := s.pending[string(key)]; ok {
+		return true
+	}
+	return s.store.Has(common.Concat(s.partition, key))
+}
+
+func (s *dbKeySet) insert(key string) error {
+	s.pending[key] = struct{}{}
+	if len(s.pending) < dbKeySetBatchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush writes buffered keys to the DB
+func (s *dbKeySet) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	batch := s.store.BatchedWriter()
+	for k := range s.pending {
+		batch.Set(common.Concat(s.partition, []byte(k)), []byte{0xff})
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	s.pending = make(map[string]struct{})
+	return nil
+}
+
+// consume calls the function for each key of the set and deletes keys from the DB. The function can add its own
+// deletions to the batch. Keys are read and deleted in batches of bounded size
+func (s *dbKeySet) consume(fun func(key []byte, batch common.KVWriter)) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	for {
+		keys := make([][]byte, 0)
+		s.store.Iterator([]byte{s.partition}).IterateKeys(func(k []byte) bool {
+			keys = append(keys, bytes.Clone(k))
+			return len(keys) < dbKeySetBatchSize
+		})
+		if len(keys) == 0 {
+			return nil
+		}
+		batch := s.store.BatchedWriter()
+		for _, k := range keys {
+			fun(k[1:], batch)
+			batch.Set(k, nil)
+		}
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+	}
+}
+
+// clear deletes all keys of the set from the DB
+func (s *dbKeySet) clear() error {
+	s.pending = make(map[string]struct{})
+	return s.consume(func(_ []byte, _ common.KVWriter) {})
+}
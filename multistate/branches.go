@@ -1,14 +1,12 @@
 package multistate
 
 import (
-	"encoding/binary"
-	"fmt"
 	"sort"
 
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
 	"github.com/lunfardo314/proxima/util"
-	"github.com/lunfardo314/proxima/util/lazybytes"
 	"github.com/lunfardo314/unitrie/common"
 	"github.com/lunfardo314/unitrie/immutable"
 )
@@ -40,79 +38,6 @@ func FetchLatestSlot(store common.KVReader) ledger.Slot {
 	return ret
 }
 
-const numberOfElementsInRootRecord = 6
-
-func (r *RootRecord) Bytes() []byte {
-	util.Assertf(r.LedgerCoverage > 0, "r.Coverage.LatestDelta() > 0")
-	arr := lazybytes.EmptyArray(numberOfElementsInRootRecord)
-	arr.Push(r.SequencerID.Bytes())
-	arr.Push(r.Root.Bytes())
-
-	var coverage [8]byte
-	binary.BigEndian.PutUint64(coverage[:], r.LedgerCoverage)
-	arr.Push(coverage[:])
-
-	var slotInflationBin, supplyBin [8]byte
-	binary.BigEndian.PutUint64(slotInflationBin[:], r.SlotInflation)
-
-	arr.Push(slotInflationBin[:])
-	binary.BigEndian.PutUint64(supplyBin[:], r.Supply)
-
-	arr.Push(supplyBin[:])
-	var nTxBin [4]byte
-	binary.BigEndian.PutUint32(nTxBin[:], r.NumTransactions)
-
-	arr.Push(nTxBin[:])
-	util.Assertf(arr.NumElements() == numberOfElementsInRootRecord, "arr.NumElements() == 6")
-	return arr.Bytes()
-}
-
-func (r *RootRecord) String() string {
-	return fmt.Sprintf("root record %s, %s, %s, %d",
-		r.SequencerID.StringShort(), util.GoTh(r.LedgerCoverage), r.Root.String(), r.NumTransactions)
-}
-
-func RootRecordFromBytes(data []byte) (RootRecord, error) {
-	arr, err := lazybytes.ParseArrayFromBytesReadOnly(data, numberOfElementsInRootRecord)
-	if err != nil {
-		return RootRecord{}, err
-	}
-	chainID, err := ledger.ChainIDFromBytes(arr.At(0))
-	if err != nil {
-		return RootRecord{}, err
-	}
-	root, err := common.VectorCommitmentFromBytes(ledger.CommitmentModel, arr.At(1))
-	if err != nil {
-		return RootRecord{}, err
-	}
-	if len(arr.At(2)) != 8 || len(arr.At(3)) != 8 || len(arr.At(4)) != 8 || len(arr.At(5)) != 4 {
-		return RootRecord{}, fmt.Errorf("wrong data length")
-	}
-	return RootRecord{
-		Root:            root,
-		SequencerID:     chainID,
-		LedgerCoverage:  binary.BigEndian.Uint64(arr.At(2)),
-		SlotInflation:   binary.BigEndian.Uint64(arr.At(3)),
-		Supply:          binary.BigEndian.Uint64(arr.At(4)),
-		NumTransactions: binary.BigEndian.Uint32(arr.At(5)),
-	}, nil
-}
-
-func ValidInclusionThresholdFraction(numerator, denominator int) bool {
-	return numerator > 0 && denominator > 0 && numerator < denominator && denominator >= 2
-}
-
-func AbsoluteStrongFinalityCoverageThreshold(supply uint64, numerator, denominator int) uint64 {
-	// 2 *supply * theta
-	return ((supply / uint64(denominator)) * uint64(numerator)) << 1 // this order to avoid overflow
-}
-
-// IsCoverageAboveThreshold the root is dominating if coverage last delta is more than numerator/denominator of the double supply
-func (r *RootRecord) IsCoverageAboveThreshold(numerator, denominator int) bool {
-	util.Assertf(ValidInclusionThresholdFraction(numerator, denominator), "IsCoverageAboveThreshold: fraction is wrong")
-	return r.LedgerCoverage > AbsoluteStrongFinalityCoverageThreshold(r.Supply, numerator, denominator)
-}
-
 // TxID transaction ID of the branch, as taken from the stem output ID
 func (br *BranchData) TxID() *ledger.TransactionID {
 	ret := br.Stem.ID.TransactionID()
@@ -124,7 +49,7 @@ func iterateAllRootRecords(store common.Traversable, fun func(branchTxID ledger.
 		txid, err := ledger.TransactionIDFromBytes(k[1:])
 		util.AssertNoError(err)
 
-		rootData, err := RootRecordFromBytes(data)
+		rootData, err := rootrecord.FromBytes(data)
 		util.AssertNoError(err)
 
 		return fun(txid, rootData)
@@ -141,7 +66,7 @@ func iterateRootRecordsOfParticularSlots(store common.Traversable, fun func(bran
 			txid, err := ledger.TransactionIDFromBytes(k[1:])
 			util.AssertNoError(err)
 
-			rootData, err := RootRecordFromBytes(data)
+			rootData, err := rootrecord.FromBytes(data)
 			util.AssertNoError(err)
 
 			return fun(txid, rootData)
@@ -167,7 +92,7 @@ func FetchRootRecord(store common.KVReader, branchTxID ledger.TransactionID) (re
 	if len(data) == 0 {
 		return
 	}
-	ret, err := RootRecordFromBytes(data)
+	ret, err := rootrecord.FromBytes(data)
 	util.AssertNoError(err)
 	found = true
 	return
@@ -335,7 +260,39 @@ func FetchHeaviestBranchChainNSlotsBack(store global.StateStoreReader, nBack int
 	return ret
 }
 
-// BranchIsDescendantOf returns true if predecessor txid is known in the descendents state
+// FetchHeaviestBranchChainInSlotRange returns chain of branches in the range of slots, descending by slot.
+// The chain ends with the heaviest branch of the latest slot in the range which has branches. Only root records
+// of slots in the range are read, so the cost does not depend on the distance from the latest slot
+func FetchHeaviestBranchChainInSlotRange(store global.StateStoreReader, fromSlot, toSlot ledger.Slot) []*BranchData {
+	if fromSlot > toSlot {
+		return nil
+	}
+	// branches by stem output ID
+	branches := make(map[ledger.OutputID]*BranchData)
+	var tip *BranchData
+	IterateRootRecords(store, func(_ ledger.TransactionID, rd RootRecord) bool {
+		bd := FetchBranchDataByRoot(store, rd)
+		branches[bd.Stem.ID] = &bd
+		if tip == nil || bd.Stem.ID.Slot() > tip.Stem.ID.Slot() ||
+			(bd.Stem.ID.Slot() == tip.Stem.ID.Slot() && bd.LedgerCoverage > tip.LedgerCoverage) {
+			tip = &bd
+		}
+		return true
+	}, util.MakeRange(fromSlot, toSlot)...)
+
+	ret := make([]*BranchData, 0)
+	for bd := tip; bd != nil; {
+		ret = append(ret, bd)
+		stemLock, ok := bd.Stem.Output.StemLock()
+		util.Assertf(ok, "stem output expected")
+		// predecessor before the range is not in the map
+		bd = branches[stemLock.PredecessorOutputID]
+	}
+	return ret
+}
+
+// BranchIsDescendantOf returns true if predecessor txid is known in the descendents state.
+// IDs of branch transactions are never pruned from the state, so the result does not depend on the age of the predecessor
 func BranchIsDescendantOf(descendant, predecessor *ledger.TransactionID, getStore func() common.KVReader) bool {
 	util.Assertf(descendant.IsBranchTransaction(), "must be a branch ts")
 
@@ -0,0 +1,89 @@
+package multistate
+
+import (
+	"fmt"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+// CheckStateTries checks the whole trie of each root record: each node reachable from the root is in the store
+// and its commitment, calculated from the node data and the path, is equal to the commitment in the parent node
+// (or the root). Each terminal value, which is not in the terminal commitment, must be in the store and must be
+// committed by the terminal.
+// Nodes are shared among roots, so subtrees of already checked nodes are skipped. Keys of checked nodes are kept
+// in the partition of marked keys, same way as in the branch pruning, so the check can't run together with the pruning.
+// Returns number of checked root records and number of checked trie nodes
+func CheckStateTries(store global.StateStore) (int, int, error) {
+	branchPruningMutex.Lock()
+	defer branchPruningMutex.Unlock()
+
+	checked, err := newDBKeySet(store, markedKeysDBPartition)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := &trieChecker{
+		trieNodes: common.MakeReaderPartition(store, immutable.PartitionTrieNodes),
+		values:    common.MakeReaderPartition(store, immutable.PartitionValues),
+		checked:   checked,
+	}
+	numRoots := 0
+	IterateRootRecords(store, func(branchTxID ledger.TransactionID, rootData RootRecord) bool {
+		if err = c.checkNode(rootData.Root, nil); err != nil {
+			err = fmt.Errorf("branch %s: %w", branchTxID.StringShort(), err)
+			return false
+		}
+		numRoots++
+		return true
+	})
+	if errClear := checked.clear(); err == nil {
+		err = errClear
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return numRoots, c.numNodes, nil
+}
+
+type trieChecker struct {
+	trieNodes common.KVReader
+	values    common.KVReader
+	checked   *dbKeySet
+	numNodes  int
+}
+
+func (c *trieChecker) checkNode(commitment common.VCommitment, nodePath []byte) error {
+	key := common.AsKey(commitment)
+	if c.checked.has(key) {
+		return nil
+	}
+	n, err := fetchNode(c.trieNodes, key)
+	if err != nil {
+		return err
+	}
+	if calculated := ledger.CommitmentModel.CalcNodeCommitment(n, nodePath); !ledger.CommitmentModel.EqualCommitments(calculated, commitment) {
+		return fmt.Errorf("commitment %s is not equal to the commitment calculated from the node data %s", commitment.String(), calculated.String())
+	}
+	if !common.IsNil(n.Terminal) {
+		if _, valueInCommitment := common.ExtractValue(n.Terminal); !valueInCommitment {
+			value := c.values.Get(common.AsKey(n.Terminal))
+			if len(value) == 0 {
+				return fmt.Errorf("can't fetch value of the terminal %s", n.Terminal.String())
+			}
+			if !ledger.CommitmentModel.EqualCommitments(ledger.CommitmentModel.CommitToData(value), n.Terminal) {
+				return fmt.Errorf("value is not committed by the terminal %s", n.Terminal.String())
+			}
+		}
+	}
+	n.IterateChildren(func(childIndex byte, child common.VCommitment) bool {
+		err = c.checkNode(child, common.Concat(nodePath, n.PathFragment, childIndex))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	c.numNodes++
+	return c.checked.insert(string(key))
+}
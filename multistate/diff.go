@@ -0,0 +1,412 @@
+package multistate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lines"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+// Difference between two ledger states.
+// Both tries are walked simultaneously from the roots. Trie nodes are content-addressed and shared among roots,
+// so subtrees with equal commitments are identical and are skipped without reading them from the DB.
+// The cost of the diff is proportional to the size of the difference, not to the size of the states.
+// The number of changed keys can be limited, then the walk stops with an error as soon as the limit is exceeded
+
+type (
+	// StateDiff is the difference of state B with respect to state A
+	StateDiff struct {
+		// AddedOutputs outputs in B which are not in A. Sorted by output ID
+		AddedOutputs []*ledger.OutputDataWithID
+		// RemovedOutputs outputs in A which are not in B. Sorted by output ID
+		RemovedOutputs []*ledger.OutputDataWithID
+		// AddedTxIDs committed transaction IDs in B which are not in A. Sorted
+		AddedTxIDs []ledger.TransactionID
+		// RemovedTxIDs committed transaction IDs in A which are not in B. Sorted
+		RemovedTxIDs []ledger.TransactionID
+		// OtherChanged number of other changed keys (indices, ledger identity, etc.)
+		OtherChanged int
+	}
+
+	StateDiffJSONAble struct {
+		// key is hex-encoded outputID, value is hex-encoded output data
+		AddedOutputs   map[string]string `json:"added_outputs,omitempty"`
+		RemovedOutputs map[string]string `json:"removed_outputs,omitempty"`
+		// hex-encoded transaction IDs
+		AddedTxIDs   []string `json:"added_txids,omitempty"`
+		RemovedTxIDs []string `json:"removed_txids,omitempty"`
+		OtherChanged int      `json:"other_changed"`
+	}
+
+	// trieDiff walks two tries and calls the callback for each key with different values.
+	// nil value means key is absent in the state. Error returned by the callback stops the walk
+	trieDiff struct {
+		trieNodes common.KVReader
+		values    common.KVReader
+		arity     common.PathArity
+		onDiff    func(key, valueA, valueB []byte) error
+	}
+)
+
+// DiffBranches calculates difference between states of two branches.
+// If maxChanges is specified, returns an error when more keys than maxChanges are changed
+func DiffBranches(store common.KVReader, branchA, branchB ledger.TransactionID, maxChanges ...int) (*StateDiff, error) {
+	rrA, found := FetchRootRecord(store, branchA)
+	if !found {
+		return nil, fmt.Errorf("DiffBranches: can't find root record of the branch %s", branchA.StringShort())
+	}
+	rrB, found := FetchRootRecord(store, branchB)
+	if !found {
+		return nil, fmt.Errorf("DiffBranches: can't find root record of the branch %s", branchB.StringShort())
+	}
+	return DiffStates(store, rrA.Root, rrB.Root, maxChanges...)
+}
+
+// DiffStates calculates difference between two states, given by roots.
+// If maxChanges is specified, returns an error when more keys than maxChanges are changed
+func DiffStates(store common.KVReader, rootA, rootB common.VCommitment, maxChanges ...int) (*StateDiff, error) {
+	ret := &StateDiff{}
+	numChanges := 0
+	d := &trieDiff{
+		trieNodes: common.MakeReaderPartition(store, immutable.PartitionTrieNodes),
+		values:    common.MakeReaderPartition(store, immutable.PartitionValues),
+		arity:     ledger.CommitmentModel.PathArity(),
+		onDiff: func(key, valueA, valueB []byte) error {
+			if numChanges++; len(maxChanges) > 0 && numChanges > maxChanges[0] {
+				return fmt.Errorf("DiffStates: more than %d keys are changed", maxChanges[0])
+			}
+			return ret.add(key, valueA, valueB)
+		},
+	}
+	if err := d.diffNodes(rootA, rootB, nil); err != nil {
+		return nil, err
+	}
+	ret.sort()
+	return ret, nil
+}
+
+func (d *StateDiff) add(key, valueA, valueB []byte) error {
+	if len(key) == 0 {
+		d.OtherChanged++
+		return nil
+	}
+	switch key[0] {
+	case PartitionLedgerState:
+		oid, err := ledger.OutputIDFromBytes(key[1:])
+		if err != nil {
+			return fmt.Errorf("wrong output ID in the state: %v", err)
+		}
+		// outputs are immutable, so changed value (should not happen) is treated as removed + added
+		if len(valueA) > 0 {
+			d.RemovedOutputs = append(d.RemovedOutputs, &ledger.OutputDataWithID{ID: oid, OutputData: valueA})
+		}
+		if len(valueB) > 0 {
+			d.AddedOutputs = append(d.AddedOutputs, &ledger.OutputDataWithID{ID: oid, OutputData: valueB})
+		}
+	case PartitionCommittedTransactionID:
+		txid, err := ledger.TransactionIDFromBytes(key[1:])
+		if err != nil {
+			return fmt.Errorf("wrong transaction ID in the state: %v", err)
+		}
+		switch {
+		case len(valueA) == 0:
+			d.AddedTxIDs = append(d.AddedTxIDs, txid)
+		case len(valueB) == 0:
+			d.RemovedTxIDs = append(d.RemovedTxIDs, txid)
+		default:
+			d.OtherChanged++
+		}
+	default:
+		d.OtherChanged++
+	}
+	return nil
+}
+
+func (d *StateDiff) sort() {
+	sortOutputs := func(outs []*ledger.OutputDataWithID) {
+		sort.Slice(outs, func(i, j int) bool {
+			return bytes.Compare(outs[i].ID[:], outs[j].ID[:]) < 0
+		})
+	}
+	sortTxIDs := func(txids []ledger.TransactionID) {
+		sort.Slice(txids, func(i, j int) bool {
+			return bytes.Compare(txids[i][:], txids[j][:]) < 0
+		})
+	}
+	sortOutputs(d.AddedOutputs)
+	sortOutputs(d.RemovedOutputs)
+	sortTxIDs(d.AddedTxIDs)
+	sortTxIDs(d.RemovedTxIDs)
+}
+
+// IsEmpty true if states are equal
+func (d *StateDiff) IsEmpty() bool {
+	return len(d.AddedOutputs) == 0 && len(d.RemovedOutputs) == 0 &&
+		len(d.AddedTxIDs) == 0 && len(d.RemovedTxIDs) == 0 && d.OtherChanged == 0
+}
+
+func (d *StateDiff) Lines(prefix ...string) *lines.Lines {
+	ret := lines.New(prefix...)
+	ret.Add("added outputs: %d", len(d.AddedOutputs))
+	for _, o := range d.AddedOutputs {
+		ret.Add("   + %s", outputDataShort(o))
+	}
+	ret.Add("removed outputs: %d", len(d.RemovedOutputs))
+	for _, o := range d.RemovedOutputs {
+		ret.Add("   - %s", outputDataShort(o))
+	}
+	ret.Add("added committed transactions: %d", len(d.AddedTxIDs))
+	for i := range d.AddedTxIDs {
+		ret.Add("   + %s", d.AddedTxIDs[i].String())
+	}
+	ret.Add("removed committed transactions: %d", len(d.RemovedTxIDs))
+	for i := range d.RemovedTxIDs {
+		ret.Add("   - %s", d.RemovedTxIDs[i].String())
+	}
+	ret.Add("other changed keys: %d", d.OtherChanged)
+	return ret
+}
+
+func outputDataShort(o *ledger.OutputDataWithID) string {
+	out, err := o.Parse()
+	if err != nil {
+		return fmt.Sprintf("%s: can't parse output: %v", o.ID.String(), err)
+	}
+	return fmt.Sprintf("%s: amount %s, lock %s", o.ID.String(), util.GoTh(out.Output.Amount()), out.Output.Lock().String())
+}
+
+func (d *StateDiff) JSONAble() *StateDiffJSONAble {
+	ret := &StateDiffJSONAble{
+		OtherChanged: d.OtherChanged,
+	}
+	outputsJSONAble := func(outs []*ledger.OutputDataWithID) map[string]string {
+		if len(outs) == 0 {
+			return nil
+		}
+		m := make(map[string]string, len(outs))
+		for _, o := range outs {
+			m[o.ID.StringHex()] = hex.EncodeToString(o.OutputData)
+		}
+		return m
+	}
+	txidsJSONAble := func(txids []ledger.TransactionID) []string {
+		if len(txids) == 0 {
+			return nil
+		}
+		s := make([]string, len(txids))
+		for i := range txids {
+			s[i] = txids[i].StringHex()
+		}
+		return s
+	}
+	ret.AddedOutputs = outputsJSONAble(d.AddedOutputs)
+	ret.RemovedOutputs = outputsJSONAble(d.RemovedOutputs)
+	ret.AddedTxIDs = txidsJSONAble(d.AddedTxIDs)
+	ret.RemovedTxIDs = txidsJSONAble(d.RemovedTxIDs)
+	return ret
+}
+
+func (d *StateDiffJSONAble) Parse() (*StateDiff, error) {
+	ret := &StateDiff{
+		OtherChanged: d.OtherChanged,
+	}
+	parseOutputs := func(m map[string]string) ([]*ledger.OutputDataWithID, error) {
+		if len(m) == 0 {
+			return nil, nil
+		}
+		outs := make([]*ledger.OutputDataWithID, 0, len(m))
+		for idStr, dataStr := range m {
+			oid, err := ledger.OutputIDFromHexString(idStr)
+			if err != nil {
+				return nil, err
+			}
+			data, err := hex.DecodeString(dataStr)
+			if err != nil {
+				return nil, err
+			}
+			outs = append(outs, &ledger.OutputDataWithID{ID: oid, OutputData: data})
+		}
+		return outs, nil
+	}
+	parseTxIDs := func(s []string) ([]ledger.TransactionID, error) {
+		if len(s) == 0 {
+			return nil, nil
+		}
+		txids := make([]ledger.TransactionID, len(s))
+		for i := range s {
+			var err error
+			if txids[i], err = ledger.TransactionIDFromHexString(s[i]); err != nil {
+				return nil, err
+			}
+		}
+		return txids, nil
+	}
+	var err error
+	if ret.AddedOutputs, err = parseOutputs(d.AddedOutputs); err != nil {
+		return nil, err
+	}
+	if ret.RemovedOutputs, err = parseOutputs(d.RemovedOutputs); err != nil {
+		return nil, err
+	}
+	if ret.AddedTxIDs, err = parseTxIDs(d.AddedTxIDs); err != nil {
+		return nil, err
+	}
+	if ret.RemovedTxIDs, err = parseTxIDs(d.RemovedTxIDs); err != nil {
+		return nil, err
+	}
+	ret.sort()
+	return ret, nil
+}
+
+func isNilOrEqual(c1, c2 common.Serializable) (bool, bool) {
+	nil1, nil2 := common.IsNil(c1), common.IsNil(c2)
+	if nil1 || nil2 {
+		return nil1 && nil2, true
+	}
+	return ledger.CommitmentModel.EqualCommitments(c1, c2), false
+}
+
+// diffNodes compares subtrees of two nodes with the same (unpacked) trie key
+func (d *trieDiff) diffNodes(rootA, rootB common.VCommitment, nodeKey []byte) error {
+	if equal, _ := isNilOrEqual(rootA, rootB); equal {
+		return nil
+	}
+	nA, err := fetchNode(d.trieNodes, common.AsKey(rootA))
+	if err != nil {
+		return err
+	}
+	nB, err := fetchNode(d.trieNodes, common.AsKey(rootB))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(nA.PathFragment, nB.PathFragment) {
+		// the tries have different shape under the key. Fall back to comparing of all key/value pairs of both subtrees
+		return d.diffSubtrees(nA, nB, nodeKey)
+	}
+	if err = d.diffTerminals(nA.Terminal, nB.Terminal, common.Concat(nodeKey, nA.PathFragment)); err != nil {
+		return err
+	}
+	for i := 0; i < 256; i++ {
+		childIndex := byte(i)
+		childA, inA := nA.ChildCommitments[childIndex]
+		childB, inB := nB.ChildCommitments[childIndex]
+		childKey := common.Concat(nodeKey, nA.PathFragment, childIndex)
+		switch {
+		case inA && inB:
+			err = d.diffNodes(childA, childB, childKey)
+		case inA:
+			err = d.iterateSubtree(childA, childKey, func(key, value []byte) error {
+				return d.onDiff(key, value, nil)
+			})
+		case inB:
+			err = d.iterateSubtree(childB, childKey, func(key, value []byte) error {
+				return d.onDiff(key, nil, value)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *trieDiff) diffTerminals(termA, termB common.TCommitment, unpackedKey []byte) error {
+	if equal, _ := isNilOrEqual(termA, termB); equal {
+		return nil
+	}
+	key, err := common.PackUnpackedBytes(unpackedKey, d.arity)
+	if err != nil {
+		return err
+	}
+	var valueA, valueB []byte
+	if !common.IsNil(termA) {
+		if valueA, err = d.terminalValue(termA); err != nil {
+			return err
+		}
+	}
+	if !common.IsNil(termB) {
+		if valueB, err = d.terminalValue(termB); err != nil {
+			return err
+		}
+	}
+	return d.onDiff(key, valueA, valueB)
+}
+
+// diffSubtrees compares two subtrees by collecting their key/value pairs
+func (d *trieDiff) diffSubtrees(nA, nB *common.NodeData, nodeKey []byte) error {
+	kvA := make(map[string][]byte)
+	if err := d.iterateNode(nA, nodeKey, func(key, value []byte) error {
+		kvA[string(key)] = value
+		return nil
+	}); err != nil {
+		return err
+	}
+	err := d.iterateNode(nB, nodeKey, func(key, value []byte) error {
+		valueA, inA := kvA[string(key)]
+		if !inA {
+			return d.onDiff(key, nil, value)
+		}
+		delete(kvA, string(key))
+		if !bytes.Equal(valueA, value) {
+			return d.onDiff(key, valueA, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, valueA := range kvA {
+		if err = d.onDiff([]byte(k), valueA, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *trieDiff) iterateSubtree(root common.VCommitment, nodeKey []byte, fun func(key, value []byte) error) error {
+	n, err := fetchNode(d.trieNodes, common.AsKey(root))
+	if err != nil {
+		return err
+	}
+	return d.iterateNode(n, nodeKey, fun)
+}
+
+func (d *trieDiff) iterateNode(n *common.NodeData, nodeKey []byte, fun func(key, value []byte) error) error {
+	if !common.IsNil(n.Terminal) {
+		key, err := common.PackUnpackedBytes(common.Concat(nodeKey, n.PathFragment), d.arity)
+		if err != nil {
+			return err
+		}
+		value, err := d.terminalValue(n.Terminal)
+		if err != nil {
+			return err
+		}
+		if err = fun(key, value); err != nil {
+			return err
+		}
+	}
+	var err error
+	n.IterateChildren(func(childIndex byte, child common.VCommitment) bool {
+		err = d.iterateSubtree(child, common.Concat(nodeKey, n.PathFragment, childIndex), fun)
+		return err == nil
+	})
+	return err
+}
+
+func (d *trieDiff) terminalValue(term common.TCommitment) ([]byte, error) {
+	value, inCommitment := common.ExtractValue(term)
+	if inCommitment {
+		return value, nil
+	}
+	value = d.values.Get(common.AsKey(term))
+	if len(value) == 0 {
+		return nil, fmt.Errorf("can't fetch value of the terminal %s", term.String())
+	}
+	return value, nil
+}
@@ -1,10 +1,12 @@
 package multistate
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sort"
 
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/proxima/util/lines"
 	"github.com/lunfardo314/unitrie/common"
@@ -95,6 +97,21 @@ func NewMutations() *Mutations {
 	}
 }
 
+// MutationsFromTransaction returns mutations of the ledger state made by the transaction
+func MutationsFromTransaction(tx *transaction.Transaction) *Mutations {
+	ret := NewMutations()
+	tx.ForEachInput(func(i byte, oid *ledger.OutputID) bool {
+		ret.InsertDelOutputMutation(*oid)
+		return true
+	})
+	tx.ForEachProducedOutput(func(_ byte, o *ledger.Output, oid *ledger.OutputID) bool {
+		ret.InsertAddOutputMutation(*oid, o)
+		return true
+	})
+	ret.InsertAddTxMutation(*tx.ID(), tx.Slot(), byte(tx.NumProducedOutputs()-1))
+	return ret
+}
+
 func (mut *Mutations) Len() int {
 	return len(mut.mut)
 }
@@ -155,6 +172,18 @@ func deleteOutputFromTrie(trie *immutable.TrieUpdatable, oid *ledger.OutputID) e
 		// must exist
 		util.Assertf(existed, "deleteOutputFromTrie: account record for %s wasn't found as expected: output %s", accountable.String(), oid.StringShort())
 	}
+	tokens, err := o.TokenBalances()
+	if err != nil {
+		return fmt.Errorf("deleteOutputFromTrie: %w", err)
+	}
+	for tokenID := range tokens {
+		for _, accountable := range o.Lock().Accounts() {
+			existed = trie.Delete(makeTokenKey(&tokenID, accountable.AccountID(), oid))
+			util.Assertf(existed, "deleteOutputFromTrie: token record for %s wasn't found as expected: output %s", accountable.String(), oid.StringShort())
+			existed = trie.Delete(makeAccountTokenKey(accountable.AccountID(), &tokenID, oid))
+			util.Assertf(existed, "deleteOutputFromTrie: account token record for %s wasn't found as expected: output %s", accountable.String(), oid.StringShort())
+		}
+	}
 	return nil
 }
 
@@ -172,6 +201,22 @@ func addOutputToTrie(trie *immutable.TrieUpdatable, oid *ledger.OutputID, out *l
 			return fmt.Errorf("addOutputToTrie: index key should not exist: %s", oid.StringShort())
 		}
 	}
+	tokens, err := out.TokenBalances()
+	if err != nil {
+		return fmt.Errorf("addOutputToTrie: %w", err)
+	}
+	for tokenID, amount := range tokens {
+		var amountBin [8]byte
+		binary.BigEndian.PutUint64(amountBin[:], amount)
+		for _, accountable := range out.Lock().Accounts() {
+			if trie.Update(makeTokenKey(&tokenID, accountable.AccountID(), oid), amountBin[:]) {
+				return fmt.Errorf("addOutputToTrie: token index key should not exist: %s", oid.StringShort())
+			}
+			if trie.Update(makeAccountTokenKey(accountable.AccountID(), &tokenID, oid), amountBin[:]) {
+				return fmt.Errorf("addOutputToTrie: account token index key should not exist: %s", oid.StringShort())
+			}
+		}
+	}
 	chainConstraint, _ := out.ChainConstraint()
 	if chainConstraint == nil {
 		// not a chain output
@@ -231,6 +276,14 @@ func makeAccountKey(id ledger.AccountID, oid *ledger.OutputID) []byte {
 	return common.ConcatBytes([]byte{PartitionAccounts, byte(len(id))}, id[:], oid[:])
 }
 
+func makeTokenKey(tokenID *ledger.ChainID, id ledger.AccountID, oid *ledger.OutputID) []byte {
+	return common.ConcatBytes([]byte{PartitionTokens}, tokenID[:], []byte{byte(len(id))}, id[:], oid[:])
+}
+
+func makeAccountTokenKey(id ledger.AccountID, tokenID *ledger.ChainID, oid *ledger.OutputID) []byte {
+	return common.ConcatBytes([]byte{PartitionAccountTokens, byte(len(id))}, id[:], tokenID[:], oid[:])
+}
+
 func makeChainIDKey(chainID *ledger.ChainID) []byte {
 	return common.ConcatBytes([]byte{PartitionChainID}, chainID[:])
 }
@@ -243,3 +296,18 @@ func UpdateTrie(trie *immutable.TrieUpdatable, mut *Mutations) (err error) {
 	}
 	return
 }
+
+// updateLibraryVersion records ledger library version active at the slot of the branch.
+// The record is only written when the version changes, so states before any upgrade remain the same
+func updateLibraryVersion(trie *immutable.TrieUpdatable, slot ledger.Slot) {
+	version := ledger.L().ActiveVersionAtSlot(slot)
+	key := []byte{PartitionLibraryVersion}
+	prev := trie.Get(key)
+	if len(prev) == 0 && version == 0 {
+		return
+	}
+	if len(prev) == 1 && prev[0] == version {
+		return
+	}
+	trie.Update(key, []byte{version})
+}
@@ -0,0 +1,28 @@
+package multistate
+
+import (
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+)
+
+// GetUTXOWithProof returns output data and the Merkle proof of its inclusion into the state.
+// If output is not in the state, returns nil data and the proof of absence
+func (r *Readable) GetUTXOWithProof(oid *ledger.OutputID) ([]byte, *trie_blake2b.MerkleProof) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data, _ := r._getUTXO(oid)
+	return data, ledger.CommitmentModel.ProofImmutable(rootrecord.OutputKey(oid), r.trie)
+}
+
+// GetUTXOWithProofInBranch returns output data and the proof of inclusion or absence in the state of the branch
+func GetUTXOWithProofInBranch(store common.KVReader, branchTxID *ledger.TransactionID, oid *ledger.OutputID) (RootRecord, []byte, *trie_blake2b.MerkleProof, bool) {
+	rr, found := FetchRootRecord(store, *branchTxID)
+	if !found {
+		return RootRecord{}, nil, nil, false
+	}
+	data, proof := MustNewReadable(store, rr.Root, 0).GetUTXOWithProof(oid)
+	return rr, data, proof, true
+}
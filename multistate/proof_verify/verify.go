@@ -0,0 +1,137 @@
+// Package proof_verify contains functions for verification of proofs of inclusion (and of absence) of outputs
+// in the ledger state of a branch. It only depends on ledger definitions, transaction parsing, the root record and
+// the trie commitment model, not on the multistate and the node, so it can be used by light clients,
+// which do not have the database.
+//
+// The proof is checked against the root commitment of the branch (the RootRecord). The root is not signed
+// by the sequencer. It is bound to the signed branch transaction by the proof of inclusion of the stem output,
+// produced by the branch transaction, into the state with the root. The stem output is consumed by the next branch,
+// so no other branch of the ledger has a state with it. The binding does not detect a state fabricated by the node
+// together with the stem output, so the light client still must obtain the root record from a source it trusts,
+// for example by querying several nodes
+package proof_verify
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+)
+
+// OutputProof is the proof of inclusion or absence of the output in the state of the branch
+type OutputProof struct {
+	OutputID ledger.OutputID
+	// nil if the proof is a proof of absence
+	OutputData []byte
+	BranchID   ledger.TransactionID
+	RootRecord *rootrecord.RootRecord
+	Proof      *trie_blake2b.MerkleProof
+	// branch transaction with the signature of the sequencer. Required by Verify
+	BranchTxBytes []byte
+	// proof of inclusion of the stem output of the branch transaction into the state. Required by Verify
+	StemProof *trie_blake2b.MerkleProof
+}
+
+// Verify verifies the proof against the root record and binds the root record to the signed branch transaction.
+// Returns true if the output is in the state, false if the proof is a proof of absence.
+// Returns an error if the branch transaction or the stem proof is missing
+func (p *OutputProof) Verify() (bool, error) {
+	if p.RootRecord == nil {
+		return false, fmt.Errorf("OutputProof.Verify: root record is missing")
+	}
+	if len(p.BranchTxBytes) == 0 || p.StemProof == nil {
+		return false, fmt.Errorf("OutputProof.Verify: branch transaction and stem proof are required to bind the root record to the branch %s",
+			p.BranchID.StringShort())
+	}
+	if err := VerifyBranchTransaction(p.RootRecord, &p.BranchID, p.BranchTxBytes, p.StemProof); err != nil {
+		return false, err
+	}
+	return p.VerifyUnbound()
+}
+
+// VerifyUnbound verifies the proof against the root record only. The root record is not bound to the branch,
+// so the caller must have verified it by other means, for example with the branch transaction obtained before
+func (p *OutputProof) VerifyUnbound() (bool, error) {
+	if p.RootRecord == nil {
+		return false, fmt.Errorf("OutputProof.VerifyUnbound: root record is missing")
+	}
+	if len(p.OutputData) == 0 {
+		return false, VerifyOutputAbsence(p.RootRecord, &p.OutputID, p.Proof)
+	}
+	return true, VerifyOutputInclusion(p.RootRecord, &p.OutputID, p.OutputData, p.Proof)
+}
+
+// VerifyOutputInclusion checks if the proof proves inclusion of the output with the data into the state with the root
+func VerifyOutputInclusion(rr *rootrecord.RootRecord, oid *ledger.OutputID, outputData []byte, proof *trie_blake2b.MerkleProof) error {
+	if len(outputData) == 0 {
+		return fmt.Errorf("VerifyOutputInclusion: output data must not be empty")
+	}
+	if err := checkProofKey(oid, proof); err != nil {
+		return err
+	}
+	terminal := ledger.CommitmentModel.CommitToData(outputData)
+	if err := trie_blake2b_verify.ValidateWithTerminal(proof, rr.Root.Bytes(), terminal.Bytes()); err != nil {
+		return fmt.Errorf("VerifyOutputInclusion: %w", err)
+	}
+	return nil
+}
+
+// VerifyOutputAbsence checks if the proof proves the output is not in the state with the root
+func VerifyOutputAbsence(rr *rootrecord.RootRecord, oid *ledger.OutputID, proof *trie_blake2b.MerkleProof) error {
+	if err := checkProofKey(oid, proof); err != nil {
+		return err
+	}
+	if err := trie_blake2b_verify.Validate(proof, rr.Root.Bytes()); err != nil {
+		return fmt.Errorf("VerifyOutputAbsence: %w", err)
+	}
+	if !trie_blake2b_verify.IsProofOfAbsence(proof) {
+		return fmt.Errorf("VerifyOutputAbsence: not a proof of absence of %s", oid.StringShort())
+	}
+	return nil
+}
+
+// VerifyBranchTransaction checks if transaction bytes are a valid branch transaction with the ID, signed by the sequencer
+// of the root record. The stem proof must prove inclusion of the stem output of the transaction into the state with
+// the root of the root record, which binds the root record to the branch
+func VerifyBranchTransaction(rr *rootrecord.RootRecord, branchTxID *ledger.TransactionID, txBytes []byte, stemProof *trie_blake2b.MerkleProof) error {
+	tx, err := transaction.FromBytes(txBytes, transaction.ScanSequencerData(), transaction.CheckSender())
+	if err != nil {
+		return fmt.Errorf("VerifyBranchTransaction: %w", err)
+	}
+	if *tx.ID() != *branchTxID {
+		return fmt.Errorf("VerifyBranchTransaction: transaction ID %s is not equal to the branch ID %s",
+			tx.IDShortString(), branchTxID.StringShort())
+	}
+	if !tx.IsBranchTransaction() {
+		return fmt.Errorf("VerifyBranchTransaction: %s is not a branch transaction", tx.IDShortString())
+	}
+	if tx.SequencerTransactionData().SequencerID != rr.SequencerID {
+		return fmt.Errorf("VerifyBranchTransaction: sequencer ID of %s is not equal to the sequencer ID of the root record",
+			tx.IDShortString())
+	}
+	stemIdx := tx.SequencerTransactionData().StemOutputIndex
+	stemID := tx.OutputID(stemIdx)
+	if err = VerifyOutputInclusion(rr, &stemID, tx.MustOutputDataAt(stemIdx), stemProof); err != nil {
+		return fmt.Errorf("VerifyBranchTransaction: stem output of %s is not in the state of the root record: %w",
+			tx.IDShortString(), err)
+	}
+	return nil
+}
+
+func checkProofKey(oid *ledger.OutputID, proof *trie_blake2b.MerkleProof) error {
+	if proof == nil || len(proof.Path) == 0 {
+		return fmt.Errorf("proof is empty")
+	}
+	if proof.PathArity != ledger.TrieArity || proof.HashSize != ledger.TrieHashSize {
+		return fmt.Errorf("wrong commitment model of the proof")
+	}
+	if !bytes.Equal(proof.Key, common.UnpackBytes(rootrecord.OutputKey(oid), ledger.TrieArity)) {
+		return fmt.Errorf("proof is not about the output %s", oid.StringShort())
+	}
+	return nil
+}
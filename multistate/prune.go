@@ -0,0 +1,138 @@
+package multistate
+
+import (
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+// Deterministic pruning of committed transaction IDs.
+// Transaction ID is kept in the state while the transaction has outputs in the state and, after that,
+// until it is older than the pruning horizon (ledger.L().Const().TransactionIDPruningHorizon()), so replay attempts
+// within the horizon are still detected by KnowsCommittedTransaction.
+// IDs of branch transactions are never pruned, so ancestry of branches can always be checked (see BranchIsDescendantOf).
+// Not known transaction behind the horizon is either never committed or all its outputs are consumed, so
+// its outputs cannot be consumed anymore.
+// Pruning changes state roots, so it is the rule of the ledger library version ledger.TxIDPruningLibraryVersion and
+// is only performed by branches starting from its activation slot. Transaction IDs of slots before the activation slot
+// are never pruned, so the history before the activation is replayed with the same state roots.
+// Pruning is performed with each branch update, so all nodes compute the same root:
+//   - transaction IDs of slots which passed the horizon since the previous pruning are removed if transaction
+//     has no outputs left in the state. The first pruning starts from the activation slot
+//   - transaction IDs of slots already behind the horizon are removed when the last output of the transaction is spent
+// The last slot behind the horizon is stored in the state. The record does not exist before the first pruning,
+// so states before the activation slot plus horizon remain the same
+
+// pruneTransactionIDs is called with mutations of the branch. Trie reads return state before mutations,
+// so deleted outputs are taken from the mutations
+func pruneTransactionIDs(trie *immutable.TrieUpdatable, muts *Mutations, branchSlot ledger.Slot) {
+	activationSlot, scheduled := ledger.L().TxIDPruningActivationSlot()
+	if !scheduled {
+		return
+	}
+	horizon := ledger.L().Const().TransactionIDPruningHorizon()
+	if branchSlot <= horizon || branchSlot-horizon < activationSlot {
+		return
+	}
+	upToSlot := branchSlot - horizon
+	prevUpToSlot, prunedBefore := txidsPrunedUpToSlot(trie.TrieReader)
+	if prunedBefore && prevUpToSlot > upToSlot {
+		// branch is older than the branch of the previous pruning. Should not happen
+		upToSlot = prevUpToSlot
+	}
+	deleted := muts.deletedOutputs()
+	candidates := make(map[ledger.TransactionID]struct{})
+
+	// transaction IDs in slots which newly passed the horizon
+	fromSlot := activationSlot
+	if prunedBefore {
+		fromSlot = prevUpToSlot + 1
+	}
+	for slot := fromSlot; slot <= upToSlot; slot++ {
+		for _, seqFlag := range []bool{false, true} {
+			prefix := ledger.NewTransactionIDPrefix(slot, seqFlag)
+			partitionPrefix := common.Concat(PartitionCommittedTransactionID, prefix[:])
+			trie.Iterator(partitionPrefix).IterateKeys(func(k []byte) bool {
+				txid, err := ledger.TransactionIDFromBytes(k[1:])
+				util.AssertNoError(err)
+				if !txid.IsBranchTransaction() {
+					candidates[txid] = struct{}{}
+				}
+				return true
+			})
+		}
+	}
+	// transaction IDs behind the horizon, which outputs are spent by the branch
+	if prunedBefore {
+		for oid := range deleted {
+			if oid.Slot() >= activationSlot && oid.Slot() <= prevUpToSlot && !oid.IsBranchTransaction() {
+				candidates[oid.TransactionID()] = struct{}{}
+			}
+		}
+	}
+	// iteration order of the map does not matter, the resulting state is the same
+	for txid := range candidates {
+		if !hasOutputsLeft(trie.TrieReader, &txid, deleted) {
+			trie.Delete(common.Concat(PartitionCommittedTransactionID, txid[:]))
+		}
+	}
+	if !prunedBefore || upToSlot > prevUpToSlot {
+		trie.Update([]byte{PartitionTxIDPruning}, upToSlot.Bytes())
+	}
+}
+
+// hasOutputsLeft checks if any output of the transaction remains in the state after deletions
+func hasOutputsLeft(trie *immutable.TrieReader, txid *ledger.TransactionID, deleted map[ledger.OutputID]struct{}) bool {
+	ret := false
+	trie.Iterator(common.Concat(PartitionLedgerState, txid[:])).IterateKeys(func(k []byte) bool {
+		oid, err := ledger.OutputIDFromBytes(k[1:])
+		util.AssertNoError(err)
+		if _, isDeleted := deleted[oid]; !isDeleted {
+			ret = true
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+func txidsPrunedUpToSlot(trie *immutable.TrieReader) (ledger.Slot, bool) {
+	bin := trie.Get([]byte{PartitionTxIDPruning})
+	if len(bin) == 0 {
+		return 0, false
+	}
+	ret, err := ledger.SlotFromBytes(bin)
+	util.AssertNoError(err)
+	return ret, true
+}
+
+func (mut *Mutations) deletedOutputs() map[ledger.OutputID]struct{} {
+	ret := make(map[ledger.OutputID]struct{})
+	for _, m := range mut.mut {
+		if del, ok := m.(*mutationDelOutput); ok {
+			ret[del.ID] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// TxIDsPrunedUpToSlot returns the last slot, transaction IDs of which are pruned from the state
+// (except those with outputs in the state). Returns false if pruning has not been performed yet
+func (r *Readable) TxIDsPrunedUpToSlot() (ledger.Slot, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return txidsPrunedUpToSlot(r.trie)
+}
+
+// TxIDBehindPruningHorizon returns true if the transaction ID could have been pruned from the state.
+// It is always false before the first pruning and for transactions before the activation slot of the pruning
+func (r *Readable) TxIDBehindPruningHorizon(txid *ledger.TransactionID) bool {
+	upToSlot, pruned := r.TxIDsPrunedUpToSlot()
+	if !pruned || txid.IsBranchTransaction() {
+		return false
+	}
+	activationSlot, _ := ledger.L().TxIDPruningActivationSlot()
+	return txid.Slot() >= activationSlot && txid.Slot() <= upToSlot
+}
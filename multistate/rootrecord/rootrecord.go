@@ -0,0 +1,157 @@
+// Package rootrecord contains the root record of the ledger state and the trie key of the output.
+// It only depends on ledger definitions and the trie commitment model, so it is shared by the multistate
+// and by the verifier of proofs used by light clients, which do not have the database
+package rootrecord
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lazybytes"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// RootRecord is a persistent data stored in the DB partition with each state root
+	// It contains deterministic values for that state
+	RootRecord struct {
+		Root        common.VCommitment
+		SequencerID ledger.ChainID
+		// Note: LedgerCoverage, SlotInflation and Supply are deterministic values calculated from the ledger past cone
+		// Each node calculates them itself, and they must be equal on each
+		LedgerCoverage uint64
+		// SlotInflation: total inflation delta from previous root. It is a sum of individual transaction inflation values
+		// of the previous slot/past cone. It includes the branch tx inflation itself and does not include inflation of the previous branch
+		SlotInflation uint64
+		// Supply: total supply at this root (including the branch itself, excluding prev branch).
+		// It is the sum of the Supply of the previous branch and SlotInflation of the current
+		Supply uint64
+		// Number of new transactions in the slot of the branch
+		NumTransactions uint32
+		// TODO probably there's a need for other deterministic values, such as total number of outputs, of transactions, of chains
+	}
+
+	RootRecordJSONAble struct {
+		Root           string `json:"root"`
+		SequencerID    string `json:"sequencer_id"`
+		LedgerCoverage uint64 `json:"ledger_coverage"`
+		SlotInflation  uint64 `json:"slot_inflation"`
+		Supply         uint64 `json:"supply"`
+	}
+)
+
+// PartitionLedgerState is the partition of outputs on the trie of the ledger state
+const PartitionLedgerState = byte(0)
+
+// OutputKey returns key of the output in the trie of the ledger state
+func OutputKey(oid *ledger.OutputID) []byte {
+	return common.Concat(PartitionLedgerState, oid[:])
+}
+
+const numberOfElementsInRootRecord = 6
+
+func (r *RootRecord) Bytes() []byte {
+	util.Assertf(r.LedgerCoverage > 0, "r.Coverage.LatestDelta() > 0")
+	arr := lazybytes.EmptyArray(numberOfElementsInRootRecord)
+	arr.Push(r.SequencerID.Bytes())
+	arr.Push(r.Root.Bytes())
+
+	var coverage [8]byte
+	binary.BigEndian.PutUint64(coverage[:], r.LedgerCoverage)
+	arr.Push(coverage[:])
+
+	var slotInflationBin, supplyBin [8]byte
+	binary.BigEndian.PutUint64(slotInflationBin[:], r.SlotInflation)
+
+	arr.Push(slotInflationBin[:])
+	binary.BigEndian.PutUint64(supplyBin[:], r.Supply)
+
+	arr.Push(supplyBin[:])
+	var nTxBin [4]byte
+	binary.BigEndian.PutUint32(nTxBin[:], r.NumTransactions)
+
+	arr.Push(nTxBin[:])
+	util.Assertf(arr.NumElements() == numberOfElementsInRootRecord, "arr.NumElements() == 6")
+	return arr.Bytes()
+}
+
+func (r *RootRecord) String() string {
+	return fmt.Sprintf("root record %s, %s, %s, %d",
+		r.SequencerID.StringShort(), util.GoTh(r.LedgerCoverage), r.Root.String(), r.NumTransactions)
+}
+
+func FromBytes(data []byte) (RootRecord, error) {
+	arr, err := lazybytes.ParseArrayFromBytesReadOnly(data, numberOfElementsInRootRecord)
+	if err != nil {
+		return RootRecord{}, err
+	}
+	chainID, err := ledger.ChainIDFromBytes(arr.At(0))
+	if err != nil {
+		return RootRecord{}, err
+	}
+	root, err := common.VectorCommitmentFromBytes(ledger.CommitmentModel, arr.At(1))
+	if err != nil {
+		return RootRecord{}, err
+	}
+	if len(arr.At(2)) != 8 || len(arr.At(3)) != 8 || len(arr.At(4)) != 8 || len(arr.At(5)) != 4 {
+		return RootRecord{}, fmt.Errorf("wrong data length")
+	}
+	return RootRecord{
+		Root:            root,
+		SequencerID:     chainID,
+		LedgerCoverage:  binary.BigEndian.Uint64(arr.At(2)),
+		SlotInflation:   binary.BigEndian.Uint64(arr.At(3)),
+		Supply:          binary.BigEndian.Uint64(arr.At(4)),
+		NumTransactions: binary.BigEndian.Uint32(arr.At(5)),
+	}, nil
+}
+
+func ValidInclusionThresholdFraction(numerator, denominator int) bool {
+	return numerator > 0 && denominator > 0 && numerator < denominator && denominator >= 2
+}
+
+func AbsoluteStrongFinalityCoverageThreshold(supply uint64, numerator, denominator int) uint64 {
+	// 2 *supply * theta
+	return ((supply / uint64(denominator)) * uint64(numerator)) << 1 // this order to avoid overflow
+}
+
+// IsCoverageAboveThreshold the root is dominating if coverage last delta is more than numerator/denominator of the double supply
+func (r *RootRecord) IsCoverageAboveThreshold(numerator, denominator int) bool {
+	util.Assertf(ValidInclusionThresholdFraction(numerator, denominator), "IsCoverageAboveThreshold: fraction is wrong")
+	return r.LedgerCoverage > AbsoluteStrongFinalityCoverageThreshold(r.Supply, numerator, denominator)
+}
+
+func (r *RootRecord) JSONAble() *RootRecordJSONAble {
+	return &RootRecordJSONAble{
+		Root:           r.Root.String(),
+		SequencerID:    r.SequencerID.StringHex(),
+		LedgerCoverage: r.LedgerCoverage,
+		SlotInflation:  r.SlotInflation,
+		Supply:         r.Supply,
+	}
+}
+
+func (r *RootRecordJSONAble) Parse() (*RootRecord, error) {
+	ret := &RootRecord{
+		SlotInflation: r.SlotInflation,
+		Supply:        r.Supply,
+	}
+	var err error
+	rootBin, err := hex.DecodeString(r.Root)
+	if err != nil {
+		return nil, err
+	}
+	ret.Root, err = common.VectorCommitmentFromBytes(ledger.CommitmentModel, rootBin)
+	if err != nil {
+		return nil, err
+	}
+	ret.SequencerID, err = ledger.ChainIDFromHexString(r.SequencerID)
+	if err != nil {
+		return nil, err
+	}
+	ret.LedgerCoverage = r.LedgerCoverage
+	return ret, nil
+}
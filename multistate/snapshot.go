@@ -0,0 +1,308 @@
+package multistate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Snapshot of the multi-state is the ledger state committed in one branch. It is portable binary stream:
+//   - magic string and format version byte
+//   - ledger identity bytes
+//   - transaction ID of the branch
+//   - root record of the branch
+//   - all key/value pairs of the state, except the identity. Key of zero length marks the end
+//   - blake2b-256 checksum of all preceding bytes
+// All byte sequences are prefixed with 4 bytes of length, big-endian.
+// The state created from the snapshot contains only the branch of the snapshot and can be used as a baseline
+// for the node to start syncing from.
+// The checksum and the root record only prove that the snapshot is consistent with itself. The snapshot is trusted
+// only if its branch or root is equal to the one the operator obtained from a trusted source, see SnapshotTrusted
+
+const (
+	snapshotMagic   = "PROXIMA-STATE-SNAPSHOT"
+	snapshotVersion = byte(1)
+	// number of key/value pairs committed to the store in one batch while importing the snapshot
+	snapshotImportBatchSize = 10_000
+	// maximum length of one byte sequence of the snapshot. Keys and values of the state are parts of transactions,
+	// which are never bigger. Longer chunk means corrupted snapshot, so it is rejected before allocating memory
+	maxSnapshotChunkSize = math.MaxUint16
+)
+
+type SnapshotHeader struct {
+	LedgerIdentity []byte
+	BranchID       ledger.TransactionID
+	RootRecord     RootRecord
+}
+
+// SnapshotTrusted is the branch ID and the root of the snapshot branch, obtained by the operator from a trusted
+// source, for example from several nodes. Nil fields are not checked
+type SnapshotTrusted struct {
+	BranchID *ledger.TransactionID
+	Root     common.VCommitment
+}
+
+// SnapshotStats is returned by snapshot export and import
+type SnapshotStats struct {
+	SnapshotHeader
+	NumKeys  int
+	Checksum [32]byte
+}
+
+// WriteSnapshot writes snapshot of the state of the branch to the writer
+func WriteSnapshot(store global.StateStoreReader, branchID ledger.TransactionID, w io.Writer) (*SnapshotStats, error) {
+	rr, found := FetchRootRecord(store, branchID)
+	if !found {
+		return nil, fmt.Errorf("WriteSnapshot: root record of the branch %s not found", branchID.StringShort())
+	}
+	trie, err := immutable.NewTrieReader(ledger.CommitmentModel, store, rr.Root, 0)
+	if err != nil {
+		return nil, fmt.Errorf("WriteSnapshot: %w", err)
+	}
+	ret := &SnapshotStats{
+		SnapshotHeader: SnapshotHeader{
+			LedgerIdentity: trie.Get(nil),
+			BranchID:       branchID,
+			RootRecord:     rr,
+		},
+	}
+	hasher, err := blake2b.New256(nil)
+	util.AssertNoError(err)
+	bw := bufio.NewWriter(io.MultiWriter(w, hasher))
+
+	if _, err = bw.Write(append([]byte(snapshotMagic), snapshotVersion)); err != nil {
+		return nil, err
+	}
+	for _, data := range [][]byte{ret.LedgerIdentity, branchID[:], rr.Bytes()} {
+		if err = writeSnapshotChunk(bw, data); err != nil {
+			return nil, err
+		}
+	}
+	trie.Iterate(func(k, v []byte) bool {
+		if len(k) == 0 {
+			// identity is already in the header
+			return true
+		}
+		if err = writeSnapshotChunk(bw, k); err != nil {
+			return false
+		}
+		if err = writeSnapshotChunk(bw, v); err != nil {
+			return false
+		}
+		ret.NumKeys++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// end marker
+	if err = writeSnapshotChunk(bw, nil); err != nil {
+		return nil, err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	copy(ret.Checksum[:], hasher.Sum(nil))
+	if _, err = w.Write(ret.Checksum[:]); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ReadSnapshot creates ledger state from the snapshot in the empty store. The header of the snapshot must match
+// the trusted data, if provided. The root record of the snapshot branch is written only if the checksum is correct
+// and the root of the resulting state is equal to the root in the root record.
+// On error, the store is left partially filled, so it must be discarded
+func ReadSnapshot(r io.Reader, store global.StateStore, trusted ...*SnapshotTrusted) (*SnapshotStats, error) {
+	if !isEmptyStore(store) {
+		return nil, fmt.Errorf("ReadSnapshot: the store must be empty")
+	}
+	hasher, err := blake2b.New256(nil)
+	util.AssertNoError(err)
+	br := bufio.NewReader(r)
+	rdr := io.TeeReader(br, hasher)
+
+	ret, err := readSnapshotHeader(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSnapshot: %w", err)
+	}
+	if len(trusted) > 0 && trusted[0] != nil {
+		if err = trusted[0].Check(&ret.SnapshotHeader); err != nil {
+			return nil, fmt.Errorf("ReadSnapshot: %w", err)
+		}
+	}
+	batch := store.BatchedWriter()
+	root := immutable.MustInitRoot(batch, ledger.CommitmentModel, ret.LedgerIdentity)
+	if err = batch.Commit(); err != nil {
+		return nil, err
+	}
+	trie, err := immutable.NewTrieUpdatable(ledger.CommitmentModel, store, root)
+	if err != nil {
+		return nil, err
+	}
+	commit := func() (err1 error) {
+		batch = store.BatchedWriter()
+		root = trie.Commit(batch)
+		if err1 = batch.Commit(); err1 != nil {
+			return
+		}
+		trie, err1 = immutable.NewTrieUpdatable(ledger.CommitmentModel, store, root)
+		return
+	}
+	var k, v []byte
+	for {
+		if k, err = readSnapshotChunk(rdr); err != nil {
+			return nil, fmt.Errorf("ReadSnapshot: %w", err)
+		}
+		if len(k) == 0 {
+			break
+		}
+		if v, err = readSnapshotChunk(rdr); err != nil {
+			return nil, fmt.Errorf("ReadSnapshot: %w", err)
+		}
+		if len(v) == 0 {
+			return nil, fmt.Errorf("ReadSnapshot: empty value for key %x", k)
+		}
+		trie.Update(k, v)
+		ret.NumKeys++
+		if ret.NumKeys%snapshotImportBatchSize == 0 {
+			if err = commit(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = commit(); err != nil {
+		return nil, err
+	}
+	copy(ret.Checksum[:], hasher.Sum(nil))
+	var checksum [32]byte
+	if _, err = io.ReadFull(br, checksum[:]); err != nil {
+		return nil, fmt.Errorf("ReadSnapshot: can't read checksum: %w", err)
+	}
+	if checksum != ret.Checksum {
+		return nil, fmt.Errorf("ReadSnapshot: wrong checksum")
+	}
+	if !ledger.CommitmentModel.EqualCommitments(root, ret.RootRecord.Root) {
+		return nil, fmt.Errorf("ReadSnapshot: root of the imported state %s is not equal to the root in the snapshot %s",
+			root.String(), ret.RootRecord.Root.String())
+	}
+	batch = store.BatchedWriter()
+	writeRootRecord(batch, ret.BranchID, ret.RootRecord)
+	writeLatestSlot(batch, ret.BranchID.Slot())
+	if err = batch.Commit(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Check returns error if the header of the snapshot does not match trusted data
+func (t *SnapshotTrusted) Check(h *SnapshotHeader) error {
+	if t.BranchID != nil && *t.BranchID != h.BranchID {
+		return fmt.Errorf("branch of the snapshot %s is not equal to the trusted branch %s",
+			h.BranchID.StringShort(), t.BranchID.StringShort())
+	}
+	if !common.IsNil(t.Root) && !ledger.CommitmentModel.EqualCommitments(t.Root, h.RootRecord.Root) {
+		return fmt.Errorf("root of the snapshot %s is not equal to the trusted root %s",
+			h.RootRecord.Root.String(), t.Root.String())
+	}
+	return nil
+}
+
+// ReadSnapshotHeader reads only the header of the snapshot
+func ReadSnapshotHeader(r io.Reader) (*SnapshotHeader, error) {
+	ret, err := readSnapshotHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &ret.SnapshotHeader, nil
+}
+
+func readSnapshotHeader(r io.Reader) (*SnapshotStats, error) {
+	var magic [len(snapshotMagic) + 1]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic[:len(snapshotMagic)], []byte(snapshotMagic)) {
+		return nil, fmt.Errorf("not a state snapshot")
+	}
+	if magic[len(snapshotMagic)] != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", magic[len(snapshotMagic)])
+	}
+	ret := &SnapshotStats{}
+	var err error
+	if ret.LedgerIdentity, err = readSnapshotChunk(r); err != nil {
+		return nil, err
+	}
+	if err = util.CatchPanicOrError(func() error {
+		ledger.MustLedgerIdentityDataFromBytes(ret.LedgerIdentity)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("wrong ledger identity: %w", err)
+	}
+	var data []byte
+	if data, err = readSnapshotChunk(r); err != nil {
+		return nil, err
+	}
+	if ret.BranchID, err = ledger.TransactionIDFromBytes(data); err != nil {
+		return nil, err
+	}
+	if !ret.BranchID.IsBranchTransaction() {
+		return nil, fmt.Errorf("%s is not a branch transaction", ret.BranchID.StringShort())
+	}
+	if data, err = readSnapshotChunk(r); err != nil {
+		return nil, err
+	}
+	if ret.RootRecord, err = rootrecord.FromBytes(data); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func writeSnapshotChunk(w io.Writer, data []byte) error {
+	if len(data) > maxSnapshotChunkSize {
+		return fmt.Errorf("snapshot chunk of %d bytes exceeds maximum %d bytes", len(data), maxSnapshotChunkSize)
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readSnapshotChunk(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxSnapshotChunkSize {
+		return nil, fmt.Errorf("wrong snapshot: chunk of %d bytes exceeds maximum %d bytes", n, maxSnapshotChunkSize)
+	}
+	ret := make([]byte, n)
+	if _, err := io.ReadFull(r, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func isEmptyStore(store common.Traversable) bool {
+	empty := true
+	store.Iterator(nil).IterateKeys(func(_ []byte) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
@@ -1,11 +1,13 @@
 package multistate
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sync"
 
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/unitrie/common"
 	"github.com/lunfardo314/unitrie/immutable"
@@ -28,32 +30,11 @@ type (
 		trie  *immutable.TrieReader
 	}
 
-	// RootRecord is a persistent data stored in the DB partition with each state root
-	// It contains deterministic values for that state
-	RootRecord struct {
-		Root        common.VCommitment
-		SequencerID ledger.ChainID
-		// Note: LedgerCoverage, SlotInflation and Supply are deterministic values calculated from the ledger past cone
-		// Each node calculates them itself, and they must be equal on each
-		LedgerCoverage uint64
-		// SlotInflation: total inflation delta from previous root. It is a sum of individual transaction inflation values
-		// of the previous slot/past cone. It includes the branch tx inflation itself and does not include inflation of the previous branch
-		SlotInflation uint64
-		// Supply: total supply at this root (including the branch itself, excluding prev branch).
-		// It is the sum of the Supply of the previous branch and SlotInflation of the current
-		Supply uint64
-		// Number of new transactions in the slot of the branch
-		NumTransactions uint32
-		// TODO probably there's a need for other deterministic values, such as total number of outputs, of transactions, of chains
-	}
+	// RootRecord is a persistent data stored in the DB partition with each state root.
+	// It is defined in the package without dependencies, shared with the verifier of proofs
+	RootRecord = rootrecord.RootRecord
 
-	RootRecordJSONAble struct {
-		Root           string `json:"root"`
-		SequencerID    string `json:"sequencer_id"`
-		LedgerCoverage uint64 `json:"ledger_coverage"`
-		SlotInflation  uint64 `json:"slot_inflation"`
-		Supply         uint64 `json:"supply"`
-	}
+	RootRecordJSONAble = rootrecord.RootRecordJSONAble
 
 	BranchData struct {
 		RootRecord
@@ -64,10 +45,15 @@ type (
 
 // partitions of the state store on the trie
 const (
-	PartitionLedgerState = byte(iota)
+	// PartitionLedgerState is the partition of outputs, the same as in the keys of outputs in proofs
+	PartitionLedgerState = rootrecord.PartitionLedgerState + byte(iota)
 	PartitionAccounts
 	PartitionChainID
 	PartitionCommittedTransactionID
+	PartitionTokens
+	PartitionLibraryVersion
+	PartitionTxIDPruning
+	PartitionAccountTokens
 )
 
 func LedgerIdentityBytesFromStore(store global.StateStore) []byte {
@@ -136,7 +122,9 @@ func (r *Readable) HasUTXO(oid *ledger.OutputID) bool {
 	return common.MakeReaderPartition(r.trie, PartitionLedgerState).Has(oid[:])
 }
 
-// KnowsCommittedTransaction transaction IDs are purged after some time, so the result may be
+// KnowsCommittedTransaction transaction IDs are purged after some time, so the result may be false for old transactions.
+// Transaction ID is only purged when all outputs of the transaction are spent and the transaction is older than
+// the pruning horizon (see pruneTransactionIDs). IDs of branch transactions are never purged
 func (r *Readable) KnowsCommittedTransaction(txid *ledger.TransactionID) bool {
 	return common.MakeReaderPartition(r.trie, PartitionCommittedTransactionID).Has(txid[:])
 }
@@ -229,6 +217,72 @@ func (r *Readable) _getUTXOForChainID(id *ledger.ChainID) (*ledger.OutputDataWit
 	}, nil
 }
 
+// GetTokenBalance returns balance of the token in the account
+func (r *Readable) GetTokenBalance(tokenID *ledger.ChainID, addr ledger.AccountID) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(addr) > 255 {
+		return 0, fmt.Errorf("accountID length should be <= 255")
+	}
+	prefix := common.Concat(PartitionTokens, tokenID[:], byte(len(addr)), addr)
+	var ret uint64
+	r.trie.Iterator(prefix).Iterate(func(_, v []byte) bool {
+		util.Assertf(len(v) == 8, "GetTokenBalance: wrong token index record")
+		ret += binary.BigEndian.Uint64(v)
+		return true
+	})
+	return ret, nil
+}
+
+// GetTokenBalancesInAccount returns balances of all tokens held in the account
+func (r *Readable) GetTokenBalancesInAccount(addr ledger.AccountID) (ledger.TokenBalances, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(addr) > 255 {
+		return nil, fmt.Errorf("accountID length should be <= 255")
+	}
+	prefix := common.Concat(PartitionAccountTokens, byte(len(addr)), addr)
+	ret := make(ledger.TokenBalances)
+	var err error
+	r.trie.Iterator(prefix).Iterate(func(k, v []byte) bool {
+		util.Assertf(len(v) == 8 && len(k) == len(prefix)+ledger.ChainIDLength+ledger.OutputIDLength,
+			"GetTokenBalancesInAccount: wrong token index record")
+		var tokenID ledger.ChainID
+		copy(tokenID[:], k[len(prefix):])
+		if !ret.Add(tokenID, binary.BigEndian.Uint64(v)) {
+			err = fmt.Errorf("GetTokenBalancesInAccount: token %s arithmetic overflow", tokenID.StringShort())
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// IterateTokenHolders iterates balances of the token per account
+func (r *Readable) IterateTokenHolders(tokenID *ledger.ChainID, fun func(addr ledger.AccountID, balance uint64) bool) {
+	r.mutex.Lock()
+	balances := make(map[string]uint64)
+	prefix := common.Concat(PartitionTokens, tokenID[:])
+	r.trie.Iterator(prefix).Iterate(func(k, v []byte) bool {
+		accLen := int(k[len(prefix)])
+		acc := string(k[len(prefix)+1 : len(prefix)+1+accLen])
+		balances[acc] += binary.BigEndian.Uint64(v)
+		return true
+	})
+	r.mutex.Unlock()
+
+	for acc, balance := range balances {
+		if !fun(ledger.AccountID(acc), balance) {
+			return
+		}
+	}
+}
+
 func (r *Readable) GetStem() (ledger.Slot, []byte) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -309,6 +363,22 @@ func (r *Readable) AccountsByLocks() map[string]LockedAccountInfo {
 	return ret
 }
 
+// CountUTXOsAndChains returns number of outputs and number of chains in the state. Scans the whole state
+func (r *Readable) CountUTXOsAndChains() (numUTXOs int, numChains int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trie.Iterator([]byte{PartitionLedgerState}).IterateKeys(func(_ []byte) bool {
+		numUTXOs++
+		return true
+	})
+	r.trie.Iterator([]byte{PartitionChainID}).IterateKeys(func(_ []byte) bool {
+		numChains++
+		return true
+	})
+	return
+}
+
 func (r *Readable) ChainInfo() map[ledger.ChainID]ChainRecordInfo {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -340,6 +410,20 @@ func (r *Readable) ChainInfo() map[ledger.ChainID]ChainRecordInfo {
 	return ret
 }
 
+// LibraryVersion returns ledger library version recorded in the state. States committed before activation
+// of any upgrade do not contain the record, so version 0 is assumed
+func (r *Readable) LibraryVersion() byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	bin := r.trie.Get([]byte{PartitionLibraryVersion})
+	if len(bin) == 0 {
+		return 0
+	}
+	util.Assertf(len(bin) == 1, "inconsistency: wrong library version record in the state")
+	return bin[0]
+}
+
 func (r *Readable) Root() common.VCommitment {
 	// non need to lock
 	return r.trie.Root()
@@ -369,7 +453,14 @@ type RootRecordParams struct {
 // If par.GenesisStemOutputID != nil, also writes root partition record
 func (u *Updatable) Update(muts *Mutations, rootRecordParams *RootRecordParams) error {
 	return u.updateUTXOLedgerDB(func(trie *immutable.TrieUpdatable) error {
-		return UpdateTrie(u.trie, muts)
+		if err := UpdateTrie(u.trie, muts); err != nil {
+			return err
+		}
+		if rootRecordParams != nil {
+			updateLibraryVersion(trie, rootRecordParams.StemOutputID.Slot())
+			pruneTransactionIDs(trie, muts, rootRecordParams.StemOutputID.Slot())
+		}
+		return nil
 	}, rootRecordParams)
 }
 
@@ -382,6 +473,10 @@ func (u *Updatable) updateUTXOLedgerDB(updateFun func(updatable *immutable.TrieU
 	if err := updateFun(u.trie); err != nil {
 		return err
 	}
+	// new nodes may coincide with the garbage being deleted by the branch pruning
+	stateCommitMutex.RLock()
+	defer stateCommitMutex.RUnlock()
+
 	batch := u.store.BatchedWriter()
 	newRoot := u.trie.Commit(batch)
 	if rootRecordsParams != nil {
@@ -0,0 +1,53 @@
+package node
+
+import (
+	"time"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate/analytics"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultAnalyticsSlotsBack   = 100
+	defaultAnalyticsTopAccounts = 10
+	defaultAnalyticsPeriodSlots = 10
+)
+
+// startAnalyticsIfEnabled periodically collects statistics of the heaviest chain and exposes them as Prometheus gauges
+func (p *ProximaNode) startAnalyticsIfEnabled() {
+	if !viper.GetBool(global.ConfigKeyAnalyticsEnable) {
+		p.Log().Infof("multi-state analytics is disabled")
+		return
+	}
+	par := analytics.Params{
+		SlotsBack: viper.GetInt(global.ConfigKeyAnalyticsSlotsBack),
+		TopN:      viper.GetInt(global.ConfigKeyAnalyticsTopAccounts),
+	}
+	if par.SlotsBack <= 0 {
+		par.SlotsBack = defaultAnalyticsSlotsBack
+	}
+	if par.TopN <= 0 {
+		par.TopN = defaultAnalyticsTopAccounts
+	}
+	periodSlots := viper.GetInt(global.ConfigKeyAnalyticsPeriodSlots)
+	if periodSlots <= 0 {
+		periodSlots = defaultAnalyticsPeriodSlots
+	}
+	period := time.Duration(periodSlots) * ledger.SlotDuration()
+	p.Log().Infof("multi-state analytics is enabled. Slots back: %d, top accounts: %d, period: %v", par.SlotsBack, par.TopN, period)
+
+	metrics := analytics.NewMetrics(p.MetricsRegistry())
+	p.RepeatEvery(period, func() bool {
+		err := util.CatchPanicOrError(func() error {
+			metrics.Update(analytics.Collect(p.multiStateDB, par))
+			return nil
+		})
+		if err != nil {
+			p.Log().Errorf("multi-state analytics failed: %v", err)
+		}
+		return true
+	})
+}
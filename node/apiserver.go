@@ -3,6 +3,7 @@ package node
 import (
 	"fmt"
 
+	"github.com/lunfardo314/proxima/api"
 	"github.com/lunfardo314/proxima/api/server"
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/core/vertex"
@@ -10,6 +11,7 @@ import (
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/multistate"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/spf13/viper"
 )
 
@@ -19,6 +21,13 @@ func (p *ProximaNode) startAPIServer() {
 	p.Log().Infof("starting API server on %s", addr)
 
 	go server.RunOn(addr, p)
+
+	if adminPort := viper.GetInt("api.server.admin_port"); adminPort != 0 {
+		p.Log().Infof("starting admin API server on %s", server.AdminAddr(adminPort))
+		go server.RunAdminOn(adminPort, p)
+	} else {
+		p.Log().Infof("admin API server is not started: 'api.server.admin_port' is not configured")
+	}
 	go func() {
 		<-p.Ctx().Done()
 		p.stopAPIServer()
@@ -32,14 +41,17 @@ func (p *ProximaNode) stopAPIServer() {
 
 // GetNodeInfo TODO not finished
 func (p *ProximaNode) GetNodeInfo() *global.NodeInfo {
-	alivePeers, configuredPeers := p.peers.NumPeers()
+	alivePeers, _ := p.peers.NumPeers()
 	ret := &global.NodeInfo{
 		Name:           "a Proxima node",
 		ID:             p.peers.SelfID(),
-		NumStaticPeers: uint16(configuredPeers),
+		NumStaticPeers: uint16(p.peers.NumStaticPeers()),
 		NumActivePeers: uint16(alivePeers),
 		Sequencers:     make([]ledger.ChainID, len(p.Sequencers)),
 		Branches:       make([]ledger.TransactionID, 0),
+		Addrs:          multiaddrStrings(p.peers.AdvertisedAddrs()),
+		ObservedAddrs:  multiaddrStrings(p.peers.ObservedAddrs()),
+		Reachability:   p.peers.Reachability(),
 	}
 	//for i := range p.Sequencers {
 	//	ret.Sequencers[i] = *p.Sequencers[i].ID()
@@ -47,6 +59,30 @@ func (p *ProximaNode) GetNodeInfo() *global.NodeInfo {
 	return ret
 }
 
+func (p *ProximaNode) GetSyncInfo() *api.SyncInfo {
+	slotsBehind := p.workflow.SlotsBehind()
+	currentSlot := ledger.TimeNow().Slot()
+	ret := &api.SyncInfo{
+		Synced:      p.workflow.IsSynced(),
+		LatestSlot:  uint32(currentSlot) - uint32(slotsBehind),
+		CurrentSlot: uint32(currentSlot),
+	}
+	if progress := p.workflow.SyncProgress(); !progress.Started.IsZero() {
+		ret.BulkSync = &api.BulkSyncInfo{
+			InProgress:         progress.InProgress,
+			PeerID:             progress.Peer.String(),
+			FromSlot:           uint32(progress.FromSlot),
+			ToSlot:             uint32(progress.ToSlot),
+			NumBranches:        progress.NumBranches,
+			NumBranchesFetched: progress.NumBranchesFetched,
+			NumTxReceived:      progress.NumTxReceived,
+			Started:            progress.Started.Unix(),
+			LastError:          progress.LastError,
+		}
+	}
+	return ret
+}
+
 func (p *ProximaNode) HeaviestStateForLatestTimeSlot() multistate.SugaredStateReader {
 	return p.workflow.HeaviestStateForLatestTimeSlot()
 }
@@ -69,3 +105,11 @@ func (p *ProximaNode) QueryTxIDStatusJSONAble(txid *ledger.TransactionID) vertex
 func (p *ProximaNode) GetTxInclusion(txid *ledger.TransactionID, slotsBack int) *multistate.TxInclusion {
 	return p.workflow.GetTxInclusion(txid, slotsBack)
 }
+
+func multiaddrStrings(addrs []multiaddr.Multiaddr) []string {
+	ret := make([]string, len(addrs))
+	for i, a := range addrs {
+		ret[i] = a.String()
+	}
+	return ret
+}
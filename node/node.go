@@ -10,13 +10,13 @@ import (
 
 	"github.com/lunfardo314/proxima/core/workflow"
 	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/multistate"
 	"github.com/lunfardo314/proxima/peering"
 	"github.com/lunfardo314/proxima/sequencer"
 	"github.com/lunfardo314/proxima/txstore"
 	"github.com/lunfardo314/proxima/util"
-	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
@@ -24,8 +24,8 @@ import (
 
 type ProximaNode struct {
 	*global.Global
-	multiStateDB              *badger_adaptor.DB
-	txStoreDB                 *badger_adaptor.DB
+	multiStateDB              kvdb.DB
+	txStoreDB                 kvdb.DB
 	txBytesStore              global.TxBytesStore
 	peers                     *peering.Peers
 	workflow                  *workflow.Workflow
@@ -79,6 +79,10 @@ func (p *ProximaNode) TxBytesStore() global.TxBytesStore {
 	return p.txBytesStore
 }
 
+func (p *ProximaNode) Peers() *peering.Peers {
+	return p.peers
+}
+
 func (p *ProximaNode) readInTraceTags() {
 	p.Global.StartTracingTags(viper.GetStringSlice("trace_tags")...)
 }
@@ -95,6 +99,8 @@ func (p *ProximaNode) Start() {
 		p.initPeering()
 
 		p.startWorkflow()
+		p.startBranchPruningIfEnabled()
+		p.startAnalyticsIfEnabled()
 		p.startSequencers()
 		p.startAPIServer()
 		p.startPProfIfEnabled()
@@ -130,19 +136,28 @@ func (p *ProximaNode) Start() {
 func (p *ProximaNode) initMultiStateLedger() {
 	var err error
 	dbname := global.MultiStateDBName
-	bdb, err := badger_adaptor.OpenBadgerDB(dbname)
+	backend, err := kvdb.DetectBackend(dbname)
 	if err != nil {
-		p.Log().Fatalf("can't open '%s'", dbname)
+		p.Log().Fatalf("can't open '%s': %v", dbname, err)
+	}
+	if configured := viper.GetString(global.ConfigKeyDatabaseBackend); configured != "" && configured != backend {
+		p.Log().Warnf("multi-state DB '%s' backend is '%s', not '%s' as configured", dbname, backend, configured)
+	}
+	if p.multiStateDB, err = kvdb.Open(dbname); err != nil {
+		p.Log().Fatalf("can't open '%s': %v", dbname, err)
 	}
 	p.dbClosedWG.Add(1)
-	p.multiStateDB = badger_adaptor.New(bdb)
-	p.Log().Infof("opened multi-state DB '%s", dbname)
+	p.Log().Infof("opened multi-state DB '%s', backend: %s", dbname, backend)
 
+	// activation slots of ledger library upgrades, if configured, override defaults.
+	// They must be the same on all nodes of the network
+	global.SetUpgradeActivationSlotsFromConfig()
 	// initialize global ledger object with the ledger ID data from DB
 	multistate.InitLedgerFromStore(p.multiStateDB)
 	p.Log().Infof("Ledger identity:\n%s", ledger.L().ID.Lines("       ").String())
 	h := ledger.L().LibraryHash()
 	p.Log().Infof("Ledger constraint library hash: %s", hex.EncodeToString(h[:]))
+	p.Log().Infof("Ledger constraint library versions:\n%s", ledger.L().VersionLines("       ").String())
 
 	go func() {
 		// wait until others will stop
@@ -165,16 +180,48 @@ func (p *ProximaNode) initTxStore() {
 		p.txBytesStore = txstore.NewDummyTxBytesStore()
 
 	case "url":
-		panic("'url' type of transaction store is not supported yet")
+		par := txstore.URLTxBytesStoreParams{
+			URL:       viper.GetString(global.ConfigKeyTxStoreURL),
+			CacheSize: viper.GetInt(global.ConfigKeyTxStoreCacheSize),
+			Retries:   txstore.DefaultURLStoreRetries,
+			Token:     viper.GetString(global.ConfigKeyTxStoreToken),
+		}
+		if viper.IsSet(global.ConfigKeyTxStoreRetries) {
+			par.Retries = viper.GetInt(global.ConfigKeyTxStoreRetries)
+		}
+		util.Assertf(par.URL != "", "'%s' must be specified for the 'url' type of transaction store", global.ConfigKeyTxStoreURL)
+		urlStore := txstore.NewURLTxBytesStore(par, p)
+		err := urlStore.Ping()
+		util.AssertNoError(err, "can't reach transaction store server at "+par.URL)
+		p.txBytesStore = urlStore
+		p.Log().Infof("transaction store is remote server at '%s'", par.URL)
 
 	default:
 		// default option is predefined database name
 		dbname := global.TxStoreDBName
 		p.Log().Infof("transaction store database dbname is '%s'", dbname)
-		p.txStoreDB = badger_adaptor.New(badger_adaptor.MustCreateOrOpenBadgerDB(dbname))
+		configured := viper.GetString(global.ConfigKeyDatabaseBackend)
+		backend, err := kvdb.DetectBackend(dbname)
+		if err == nil {
+			// existing database is opened with its own backend, same as the multi-state DB
+			if configured != "" && configured != backend {
+				p.Log().Warnf("transaction store DB '%s' backend is '%s', not '%s' as configured", dbname, backend, configured)
+			}
+			p.txStoreDB, err = kvdb.Open(dbname)
+		} else {
+			if backend = configured; backend == "" {
+				backend = kvdb.DefaultBackend
+			}
+			p.txStoreDB, err = kvdb.CreateOrOpen(backend, dbname)
+		}
+		if err != nil {
+			p.Log().Fatalf("can't open '%s': %v", dbname, err)
+		}
 		p.dbClosedWG.Add(1)
-		p.txBytesStore = txstore.NewSimpleTxBytesStore(p.txStoreDB, p)
-		p.Log().Infof("opened DB '%s' as transaction store", dbname)
+		simpleTxStore := txstore.NewSimpleTxBytesStore(p.txStoreDB, p)
+		p.txBytesStore = simpleTxStore
+		p.Log().Infof("opened DB '%s' as transaction store, backend: %s", dbname, backend)
+		p.startTxStorePruningIfEnabled(simpleTxStore)
 
 		go func() {
 			<-p.workProcessesStopStepChan
@@ -0,0 +1,83 @@
+package node
+
+import (
+	"time"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/txstore"
+	"github.com/spf13/viper"
+)
+
+const defaultPruningPeriodSlots = 100
+
+// startBranchPruningIfEnabled periodically deletes orphaned branches from the multi-state DB
+func (p *ProximaNode) startBranchPruningIfEnabled() {
+	if !viper.GetBool(global.ConfigKeyMultiStatePruningEnable) {
+		p.Log().Infof("multi-state pruning is disabled")
+		return
+	}
+	horizonSlots := viper.GetInt(global.ConfigKeyMultiStatePruningHorizonSlots)
+	if horizonSlots <= 0 {
+		horizonSlots = multistate.DefaultBranchPruningHorizonSlots
+	}
+	periodSlots := viper.GetInt(global.ConfigKeyMultiStatePruningPeriodSlots)
+	if periodSlots <= 0 {
+		periodSlots = defaultPruningPeriodSlots
+	}
+	period := time.Duration(periodSlots) * ledger.SlotDuration()
+	p.Log().Infof("multi-state pruning is enabled. Horizon: %d slots, period: %v", horizonSlots, period)
+
+	p.RepeatEvery(period, func() bool {
+		start := time.Now()
+		stats, err := multistate.PruneOrphanedBranches(p.multiStateDB, horizonSlots)
+		if err != nil {
+			p.Log().Errorf("multi-state pruning failed: %v", err)
+			return true
+		}
+		p.Log().Infof("multi-state pruning: %s. Took %v", stats.String(), time.Since(start))
+		return true
+	}, true)
+}
+
+// startTxStorePruningIfEnabled periodically deletes transactions, which are not part of the heaviest chain, from the transaction store
+func (p *ProximaNode) startTxStorePruningIfEnabled(txStore *txstore.SimpleTxBytesStore) {
+	if !viper.GetBool(global.ConfigKeyTxStorePruningEnable) {
+		p.Log().Infof("transaction store pruning is disabled")
+		return
+	}
+	par := txstore.DefaultPruningParams()
+	if horizonSlots := viper.GetInt(global.ConfigKeyTxStorePruningHorizonSlots); horizonSlots > 0 {
+		par.HorizonSlots = horizonSlots
+	}
+	if viper.IsSet(global.ConfigKeyTxStorePruningKeepAllFinalized) {
+		par.KeepAllFinalized = viper.GetBool(global.ConfigKeyTxStorePruningKeepAllFinalized)
+	}
+	par.Archive = viper.GetBool(global.ConfigKeyTxStorePruningArchive)
+	par.DryRun = viper.GetBool(global.ConfigKeyTxStorePruningDryRun)
+	if par.Archive {
+		p.Log().Infof("transaction store is in archive mode: transactions are never pruned")
+		return
+	}
+	periodSlots := viper.GetInt(global.ConfigKeyTxStorePruningPeriodSlots)
+	if periodSlots <= 0 {
+		periodSlots = defaultPruningPeriodSlots
+	}
+	period := time.Duration(periodSlots) * ledger.SlotDuration()
+	p.Log().Infof("transaction store pruning is enabled. Horizon: %d slots, keep all finalized: %v, dry run: %v, period: %v",
+		par.HorizonSlots, par.KeepAllFinalized, par.DryRun, period)
+
+	p.RepeatEvery(period, func() bool {
+		start := time.Now()
+		report, err := txStore.Prune(p.multiStateDB, par)
+		if err != nil {
+			p.Log().Errorf("transaction store pruning failed: %v", err)
+			return true
+		}
+		if report != nil {
+			p.Log().Infof("transaction store pruning: %s. Took %v", report.String(), time.Since(start))
+		}
+		return true
+	}, true)
+}
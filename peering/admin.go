@@ -0,0 +1,142 @@
+package peering
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PeerInfo is a snapshot of the peer's state for the node operator
+type PeerInfo struct {
+	ID           peer.ID
+	Name         string
+	Addrs        []string
+	Static       bool
+	Alive        bool
+	LastActivity time.Time
+	HasTxStore   bool
+	// zero if communications are not blocked
+	BlockedUntil time.Time
+	MsgIn        uint64
+	MsgOut       uint64
+	BytesIn      uint64
+	BytesOut     uint64
+	// gossip messages dropped because the peer is slow
+	MsgDropped uint64
+	// reputation score and number of bans of the peer
+	Score   int
+	NumBans int
+}
+
+// PeersInfo returns info of all peers sorted by name
+func (ps *Peers) PeersInfo() []*PeerInfo {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	ret := make([]*PeerInfo, 0, len(ps.peers))
+	for id, p := range ps.peers {
+		info := p.info()
+		rep := ps.reputation.get(id)
+		info.Score, info.NumBans = rep.Score, rep.NumBans
+		for _, ma := range ps.host.Peerstore().Addrs(id) {
+			info.Addrs = append(info.Addrs, ma.String())
+		}
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name == ret[j].Name {
+			return ret[i].ID < ret[j].ID
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func (p *Peer) info() *PeerInfo {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	ret := &PeerInfo{
+		ID:           p.id,
+		Name:         p.name,
+		Addrs:        make([]string, 0),
+		Static:       p.isStatic,
+		Alive:        p._isAlive(),
+		LastActivity: p.lastActivity,
+		HasTxStore:   p.hasTxStore,
+		MsgIn:        p.msgIn,
+		MsgOut:       p.msgOut,
+		BytesIn:      p.bytesIn,
+		BytesOut:     p.bytesOut,
+	}
+	if p.outQueue != nil {
+		ret.MsgDropped = p.outQueue.numDropped()
+	}
+	if p.blockActivityUntil.After(time.Now()) {
+		ret.BlockedUntil = p.blockActivityUntil
+	}
+	return ret
+}
+
+// RemovePeer removes static or dynamic peer and closes connections with it.
+// Removed dynamic peer may be discovered again by auto-peering
+func (ps *Peers) RemovePeer(id peer.ID) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	p, found := ps.peers[id]
+	if !found {
+		return fmt.Errorf("peer %s not found", id.String())
+	}
+	delete(ps.peers, id)
+	p.closeOutQueue()
+	if ps.allowList != nil {
+		ps.allowList.disallow(id)
+	}
+	ps.host.Peerstore().ClearAddrs(id)
+	_ = ps.host.Network().ClosePeer(id)
+	ps.Log().Infof("removed peer %s (%s)", ShortPeerIDString(id), p.name)
+	return nil
+}
+
+// BlockPeer blocks communications with the peer for the duration. Zero duration unblocks the peer, also the banned one
+func (ps *Peers) BlockPeer(id peer.ID, d time.Duration) error {
+	p := ps.getPeer(id)
+	if p == nil {
+		return fmt.Errorf("peer %s not found", id.String())
+	}
+	if d == 0 {
+		ps.reputation.unban(id)
+	}
+	p.blockCommunicationsFor(d)
+	if d > 0 {
+		ps.Log().Warnf("blocked communications with peer %s (%s) for %v", ShortPeerIDString(id), p.name, d)
+	} else {
+		ps.Log().Infof("unblocked communications with peer %s (%s)", ShortPeerIDString(id), p.name)
+	}
+	return nil
+}
+
+func (p *Peer) evidenceMsgIn(size int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.msgIn++
+	p.bytesIn += uint64(size)
+}
+
+func (p *Peer) evidenceMsgOut(size int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.msgOut++
+	p.bytesOut += uint64(size)
+}
+
+func (ps *Peers) evidenceMsgOut(id peer.ID, size int) {
+	if p := ps.getPeer(id); p != nil {
+		p.evidenceMsgOut(size)
+	}
+}
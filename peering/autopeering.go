@@ -0,0 +1,365 @@
+package peering
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Auto-peering. Peers configured in 'peering.peers' are static (trusted): they are never dropped.
+// Other peers are discovered dynamically:
+// - by the peer exchange protocol: the node periodically asks its alive peers for the list of their alive peers
+// - by the incoming heartbeat from the unknown peer
+// - by mDNS in the local network (optional, for local testnets)
+// Dynamic peers which are not alive for some time are dropped. The total number of peers is capped by the maximum.
+// If number of alive peers falls below the minimum, the node asks all alive peers for new peers instead of the random one.
+// Dynamic peers are saved to the file and restored after restart
+
+const (
+	lppProtocolPeers = "/proxima/peers/%d"
+
+	defaultMinPeers        = 3
+	defaultMaxPeers        = 20
+	defaultDiscoveryPeriod = 10 * time.Second
+	// dynamic peer is dropped if it is not alive that long
+	dropInactivePeerAfter = 30 * time.Second
+	peerExchangeTimeout   = 5 * time.Second
+	// maximum number of peers in one peer exchange message
+	maxPeerExchangeNumPeers = 32
+	// mDNS service name. Ledger library hash is appended
+	mdnsServiceName = "proxima-%d"
+)
+
+// peersStreamHandler responds to the peer exchange request with the list of alive peers
+func (ps *Peers) peersStreamHandler(stream network.Stream) {
+	id := stream.Conn().RemotePeer()
+	p := ps.getPeer(id)
+	if p == nil {
+		// peer not found
+		ps.Log().Warnf("unknown peer %s", id.String())
+		_ = stream.Reset()
+		return
+	}
+
+	if !p.isCommunicationOpen() {
+		_ = stream.Reset()
+		return
+	}
+	_ = stream.SetDeadline(time.Now().Add(peerExchangeTimeout))
+
+	msgData, err := readFrame(stream)
+	if err == nil && len(msgData) != 0 {
+		err = fmt.Errorf("peer exchange request must be empty")
+		ps.evidenceReputation(id, eventMalformedFrame)
+	}
+	if err != nil {
+		ps.Log().Errorf("error while reading peer exchange request from peer %s: %v", id.String(), err)
+		_ = stream.Reset()
+		return
+	}
+	defer stream.Close()
+
+	p.evidenceActivity(ps, "peers")
+	p.evidenceMsgIn(len(msgData))
+	msgData = encodePeerExchangeMsg(ps.alivePeerAddrInfos(id))
+	if err = writeFrame(stream, msgData); err != nil {
+		ps.Tracef(TraceTag, "peersStreamHandler.writeFrame to %s: %v", ShortPeerIDString(id), err)
+		return
+	}
+	p.evidenceMsgOut(len(msgData))
+}
+
+// requestPeers asks the peer for the list of its alive peers
+func (ps *Peers) requestPeers(id peer.ID) ([]peer.AddrInfo, error) {
+	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolPeers)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	_ = stream.SetDeadline(time.Now().Add(peerExchangeTimeout))
+	if err = writeFrame(stream, nil); err != nil {
+		return nil, err
+	}
+	ps.evidenceMsgOut(id, 0)
+	msgData, err := readFrame(stream)
+	if err != nil {
+		return nil, err
+	}
+	if p := ps.getPeer(id); p != nil {
+		p.evidenceMsgIn(len(msgData))
+	}
+	ret, err := decodePeerExchangeMsg(msgData)
+	if err != nil {
+		ps.evidenceReputation(id, eventMalformedFrame)
+	}
+	return ret, err
+}
+
+// alivePeerAddrInfos returns addresses of alive peers, except the one
+func (ps *Peers) alivePeerAddrInfos(except peer.ID) []peer.AddrInfo {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	ret := make([]peer.AddrInfo, 0)
+	for id, p := range ps.peers {
+		if id == except || !p.isAlive() || !p.isCommunicationOpen() {
+			continue
+		}
+		if addrs := ps.host.Peerstore().Addrs(id); len(addrs) > 0 {
+			ret = append(ret, peer.AddrInfo{ID: id, Addrs: addrs})
+		}
+		if len(ret) >= maxPeerExchangeNumPeers {
+			break
+		}
+	}
+	return ret
+}
+
+// peer exchange message is 1 byte of number of addresses, followed by addresses.
+// Each address is 2 bytes of length followed by the bytes of the multiaddress with the /p2p/<peer ID> component
+
+func encodePeerExchangeMsg(infos []peer.AddrInfo) []byte {
+	maddrs := make([]multiaddr.Multiaddr, 0, len(infos))
+	for i := range infos {
+		if p2pAddrs, err := peer.AddrInfoToP2pAddrs(&infos[i]); err == nil {
+			maddrs = append(maddrs, p2pAddrs...)
+		}
+	}
+	var buf bytes.Buffer
+	var sizeBin [2]byte
+	n := min(len(maddrs), 255)
+	buf.WriteByte(byte(n))
+	for _, ma := range maddrs[:n] {
+		binary.BigEndian.PutUint16(sizeBin[:], uint16(len(ma.Bytes())))
+		buf.Write(sizeBin[:])
+		buf.Write(ma.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func decodePeerExchangeMsg(data []byte) ([]peer.AddrInfo, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("decodePeerExchangeMsg: empty message")
+	}
+	rdr := bytes.NewReader(data[1:])
+	maddrs := make([]multiaddr.Multiaddr, int(data[0]))
+	var sizeBin [2]byte
+	for i := range maddrs {
+		if _, err := rdr.Read(sizeBin[:]); err != nil {
+			return nil, fmt.Errorf("decodePeerExchangeMsg: %w", err)
+		}
+		maBin := make([]byte, binary.BigEndian.Uint16(sizeBin[:]))
+		if n, err := rdr.Read(maBin); err != nil || n != len(maBin) {
+			return nil, fmt.Errorf("decodePeerExchangeMsg: unexpected end of data")
+		}
+		var err error
+		if maddrs[i], err = multiaddr.NewMultiaddrBytes(maBin); err != nil {
+			return nil, fmt.Errorf("decodePeerExchangeMsg: %w", err)
+		}
+	}
+	if rdr.Len() != 0 {
+		return nil, fmt.Errorf("decodePeerExchangeMsg: not all bytes consumed")
+	}
+	return peer.AddrInfosFromP2pAddrs(maddrs...)
+}
+
+// addDynamicPeer adds discovered peer. Returns false if peer is not added
+func (ps *Peers) addDynamicPeer(info peer.AddrInfo, src string) bool {
+	if info.ID == ps.host.ID() || len(info.Addrs) == 0 {
+		return false
+	}
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if _, already := ps.peers[info.ID]; already || len(ps.peers) >= ps.cfg.MaxPeers {
+		return false
+	}
+	if ps.reputation.isBanned(info.ID) {
+		return false
+	}
+	ps.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	ps.peers[info.ID] = &Peer{
+		name:    "auto-" + src,
+		id:      info.ID,
+		addedAt: time.Now(),
+	}
+	ps.Log().Infof("discovered new peer %s (%s)", ShortPeerIDString(info.ID), src)
+	return true
+}
+
+// acceptInboundPeer adds unknown peer which contacted the node, if there is room for it
+func (ps *Peers) acceptInboundPeer(id peer.ID) *Peer {
+	if !ps.cfg.AutoPeering {
+		return nil
+	}
+	ps.addDynamicPeer(peer.AddrInfo{ID: id, Addrs: ps.host.Peerstore().Addrs(id)}, "inbound")
+	return ps.getPeer(id)
+}
+
+// dropInactivePeers removes dynamic peers which are not alive for some time. Static peers are never dropped
+func (ps *Peers) dropInactivePeers() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	for id, p := range ps.peers {
+		if p.isStatic || p.isAlive() || time.Since(p.lastActiveOrAdded()) < dropInactivePeerAfter {
+			continue
+		}
+		delete(ps.peers, id)
+		p.closeOutQueue()
+		ps.host.Peerstore().ClearAddrs(id)
+		_ = ps.host.Network().ClosePeer(id)
+		ps.Log().Infof("dropped inactive peer %s (%s)", ShortPeerIDString(id), p.name)
+	}
+}
+
+func (p *Peer) lastActiveOrAdded() time.Time {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.lastActivity.After(p.addedAt) {
+		return p.lastActivity
+	}
+	return p.addedAt
+}
+
+// discoverPeers asks alive peers for new peers if there is room for them.
+// If number of alive peers is below the minimum, all alive peers are asked, otherwise the random one
+func (ps *Peers) discoverPeers() {
+	alive, total := ps.NumPeers()
+	if total >= ps.cfg.MaxPeers {
+		return
+	}
+	ids := ps.getAlivePeerIDs()
+	if len(ids) == 0 {
+		return
+	}
+	if alive >= ps.cfg.MinPeers {
+		i := rand.Intn(len(ids))
+		ids = ids[i : i+1]
+	} else {
+		ps.Log().Warnf("node is connected to %d peer(s), less than minimum %d. Looking for new peers", alive, ps.cfg.MinPeers)
+	}
+	for _, id := range ids {
+		infos, err := ps.requestPeers(id)
+		if err != nil {
+			ps.Tracef(TraceTag, "peer exchange with %s failed: %v", ShortPeerIDString(id), err)
+			continue
+		}
+		for _, info := range infos {
+			ps.addDynamicPeer(info, "pex")
+		}
+	}
+}
+
+func (ps *Peers) getAlivePeerIDs() []peer.ID {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	ret := make([]peer.ID, 0)
+	for id, p := range ps.peers {
+		if p.isAlive() && p.isCommunicationOpen() {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+func (ps *Peers) autopeeringLoop() {
+	for {
+		select {
+		case <-ps.stopHeartbeatChan:
+			return
+		case <-time.After(ps.cfg.DiscoveryPeriod):
+		}
+		ps.dropInactivePeers()
+		ps.discoverPeers()
+		ps.saveDynamicPeers()
+	}
+}
+
+// mdnsNotifee adds peers found in the local network
+type mdnsNotifee struct {
+	ps *Peers
+}
+
+func (n mdnsNotifee) HandlePeerFound(info peer.AddrInfo) {
+	n.ps.addDynamicPeer(info, "mdns")
+}
+
+func (ps *Peers) startMDNS(libraryHashUint64 uint64) {
+	ps.mdns = mdns.NewMdnsService(ps.host, fmt.Sprintf(mdnsServiceName, libraryHashUint64), mdnsNotifee{ps})
+	if err := ps.mdns.Start(); err != nil {
+		ps.Log().Errorf("failed to start mDNS discovery: %v", err)
+		ps.mdns = nil
+	}
+}
+
+// saveDynamicPeers saves multiaddresses of dynamic peers to the file, one per line
+func (ps *Peers) saveDynamicPeers() {
+	if ps.cfg.PeersFile == "" {
+		return
+	}
+	ps.mutex.RLock()
+	var buf strings.Builder
+	for id, p := range ps.peers {
+		if p.isStatic {
+			continue
+		}
+		p2pAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: id, Addrs: ps.host.Peerstore().Addrs(id)})
+		if err != nil {
+			continue
+		}
+		for _, ma := range p2pAddrs {
+			buf.WriteString(ma.String())
+			buf.WriteString("\n")
+		}
+	}
+	ps.mutex.RUnlock()
+
+	if err := os.WriteFile(ps.cfg.PeersFile, []byte(buf.String()), 0666); err != nil {
+		ps.Log().Errorf("failed to save peers to %s: %v", ps.cfg.PeersFile, err)
+	}
+}
+
+// loadDynamicPeers adds peers saved to the file by the previous run. Wrong lines are ignored
+func (ps *Peers) loadDynamicPeers() {
+	if ps.cfg.PeersFile == "" {
+		return
+	}
+	data, err := os.ReadFile(ps.cfg.PeersFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ps.Log().Errorf("failed to read peers from %s: %v", ps.cfg.PeersFile, err)
+		}
+		return
+	}
+	maddrs := make([]multiaddr.Multiaddr, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if ma, err := multiaddr.NewMultiaddr(line); err == nil {
+			maddrs = append(maddrs, ma)
+		}
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(maddrs...)
+	if err != nil {
+		ps.Log().Errorf("wrong peers in %s: %v", ps.cfg.PeersFile, err)
+		return
+	}
+	for _, info := range infos {
+		ps.addDynamicPeer(info, "file")
+	}
+}
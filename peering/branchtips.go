@@ -0,0 +1,147 @@
+package peering
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/ledger"
+	"golang.org/x/exp/maps"
+)
+
+// Branch tips exchange is used by the node to catch up after downtime. When peer with txStore is connected,
+// the node requests its latest branches. The peer responds with IDs of branches of its latest slot, which are
+// passed to the node to pull and attach missing ones. Responses which were not requested are ignored
+
+const branchTipsResponseTimeout = 10 * time.Second
+
+// OnReceivePullTipsRequest sets function, which is called when peer requests branch tips of the node.
+// It is expected to respond with SendBranchTipsToPeer
+func (ps *Peers) OnReceivePullTipsRequest(fun func(from peer.ID)) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.onReceivePullTips = fun
+}
+
+// OnReceiveBranchTips sets function, which is called with branch tips received from the peer.
+// Branch tips are requested from peers only if the function is set
+func (ps *Peers) OnReceiveBranchTips(fun func(from peer.ID, txids []ledger.TransactionID)) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.onReceiveBranchTips = fun
+}
+
+func (ps *Peers) wantsBranchTips() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	return ps.onReceiveBranchTips != nil
+}
+
+// PullBranchTipsFromAllPeers requests branch tips from all alive peers with txStore. Returns number of requests sent
+func (ps *Peers) PullBranchTipsFromAllPeers() int {
+	ps.mutex.RLock()
+	all := maps.Values(ps.peers)
+	ps.mutex.RUnlock()
+
+	count := 0
+	for _, idx := range rand.Perm(len(all)) {
+		p := all[idx]
+		if p.isCommunicationOpen() && p.isAlive() && p.HasTxStore() && ps.pullBranchTipsFromPeer(p) {
+			count++
+		}
+	}
+	return count
+}
+
+func (ps *Peers) pullBranchTipsFromPeer(p *Peer) bool {
+	if !ps.wantsBranchTips() {
+		return false
+	}
+	ps.Tracef(TraceTag, "pull branch tips from peer %s", func() any { return ShortPeerIDString(p.id) })
+
+	p.expectBranchTips()
+	return ps.sendMsgOnPullProtocol(p.id, encodePullBranchTipsMsg())
+}
+
+// SendBranchTipsToPeer sends IDs of branches to the peer as response to the branch tips request
+func (ps *Peers) SendBranchTipsToPeer(id peer.ID, txids []ledger.TransactionID) bool {
+	if len(txids) > MaxNumTransactionID {
+		txids = txids[:MaxNumTransactionID]
+	}
+	return ps.sendMsgOnPullProtocol(id, encodeBranchTipsMsg(txids...))
+}
+
+func (ps *Peers) sendMsgOnPullProtocol(id peer.ID, msgData []byte) bool {
+	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolPull)
+	if err != nil {
+		return false
+	}
+	defer stream.Close()
+
+	if err = writeFrame(stream, msgData); err != nil {
+		return false
+	}
+	ps.evidenceMsgOut(id, len(msgData))
+	return true
+}
+
+func (ps *Peers) processBranchTips(p *Peer, txids []ledger.TransactionID) {
+	if !p.takeBranchTipsExpected() {
+		ps.Log().Warnf("ignored branch tips from peer %s (%s): not requested", ShortPeerIDString(p.id), p.name)
+		return
+	}
+	ps.mutex.RLock()
+	fun := ps.onReceiveBranchTips
+	ps.mutex.RUnlock()
+
+	if fun != nil && len(txids) > 0 {
+		fun(p.id, txids)
+	}
+}
+
+func (p *Peer) takeNeedsBranchTips() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ret := p.needsBranchTips
+	p.needsBranchTips = false
+	return ret
+}
+
+func (p *Peer) expectBranchTips() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.branchTipsDeadline = time.Now().Add(branchTipsResponseTimeout)
+}
+
+// takeBranchTipsExpected returns true if branch tips from the peer were requested and are not late
+func (p *Peer) takeBranchTipsExpected() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ret := p.branchTipsDeadline.After(time.Now())
+	p.branchTipsDeadline = time.Time{}
+	return ret
+}
+
+func encodeBranchTipsMsg(txids ...ledger.TransactionID) []byte {
+	return encodeTxIDList(PullResponseBranchTips, txids...)
+}
+
+func decodeBranchTipsMsg(data []byte) ([]ledger.TransactionID, error) {
+	ret, err := decodeTxIDList(PullResponseBranchTips, data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		if !ret[i].IsBranchTransaction() {
+			return nil, fmt.Errorf("decodeBranchTipsMsg: %s is not a branch transaction", ret[i].StringShort())
+		}
+	}
+	return ret, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/util"
 )
 
@@ -16,10 +17,22 @@ const traceHeartbeat = false
 type heartbeatInfo struct {
 	clock      time.Time
 	hasTxStore bool
+	// latest library version of the peer with its activation slot and prefix of the library hash
+	libraryVersion    byte
+	activationSlot    ledger.Slot
+	libraryHashPrefix [8]byte
 }
 
+const (
+	heartbeatInfoSize = 8 + 1 + 1 + 4 + 8
+	// heartbeatInfoSizeLegacy is the size of heartbeat of nodes which do not know library versions: clock and tx store flag.
+	// Such nodes run the version 0 of the library and accept only heartbeats of this size, so they are sent the legacy
+	// heartbeat over the legacy heartbeat protocol
+	heartbeatInfoSizeLegacy = 8 + 1
+)
+
 func heartbeatInfoFromBytes(data []byte) (heartbeatInfo, error) {
-	if len(data) != 8+1 {
+	if len(data) != heartbeatInfoSize && len(data) != heartbeatInfoSizeLegacy {
 		return heartbeatInfo{}, fmt.Errorf("heartbeatInfoFromBytes: wrong data len")
 	}
 	nano := int64(binary.BigEndian.Uint64(data[:8]))
@@ -31,13 +44,24 @@ func heartbeatInfoFromBytes(data []byte) (heartbeatInfo, error) {
 			return heartbeatInfo{}, fmt.Errorf("heartbeatInfoFromBytes: wrong data")
 		}
 	}
+	if len(data) == heartbeatInfoSizeLegacy {
+		return legacyHeartbeatInfo(time.Unix(0, nano), hasTxStore), nil
+	}
 	ret := heartbeatInfo{
-		clock:      time.Unix(0, nano),
-		hasTxStore: hasTxStore,
+		clock:          time.Unix(0, nano),
+		hasTxStore:     hasTxStore,
+		libraryVersion: data[9],
+		activationSlot: ledger.Slot(binary.BigEndian.Uint32(data[10:14])),
 	}
+	copy(ret.libraryHashPrefix[:], data[14:22])
 	return ret, nil
 }
 
+// legacyBytes is the heartbeat for nodes which do not know library versions
+func (hi *heartbeatInfo) legacyBytes() []byte {
+	return hi.Bytes()[:heartbeatInfoSizeLegacy]
+}
+
 func (hi *heartbeatInfo) Bytes() []byte {
 	var buf bytes.Buffer
 	var timeNanoBin [8]byte
@@ -49,9 +73,54 @@ func (hi *heartbeatInfo) Bytes() []byte {
 		boolBin = 0xff
 	}
 	buf.WriteByte(boolBin)
+	buf.WriteByte(hi.libraryVersion)
+	var slotBin [4]byte
+	binary.BigEndian.PutUint32(slotBin[:], uint32(hi.activationSlot))
+	buf.Write(slotBin[:])
+	buf.Write(hi.libraryHashPrefix[:])
 	return buf.Bytes()
 }
 
+// newHeartbeatInfo makes heartbeat info with the latest local library version
+func newHeartbeatInfo(hasTxStore bool) heartbeatInfo {
+	v, ok := ledger.L().VersionData(ledger.L().LatestVersion())
+	util.Assertf(ok, "newHeartbeatInfo: inconsistency")
+	ret := heartbeatInfo{
+		clock:          time.Now(),
+		hasTxStore:     hasTxStore,
+		libraryVersion: v.Version,
+		activationSlot: v.ActivationSlot,
+	}
+	copy(ret.libraryHashPrefix[:], v.Hash[:8])
+	return ret
+}
+
+// legacyHeartbeatInfo makes heartbeat info of the node with the version 0 of the library
+func legacyHeartbeatInfo(clock time.Time, hasTxStore bool) heartbeatInfo {
+	v, ok := ledger.L().VersionData(0)
+	util.Assertf(ok, "legacyHeartbeatInfo: inconsistency")
+	ret := heartbeatInfo{
+		clock:          clock,
+		hasTxStore:     hasTxStore,
+		libraryVersion: 0,
+		activationSlot: v.ActivationSlot,
+	}
+	copy(ret.libraryHashPrefix[:], v.Hash[:8])
+	return ret
+}
+
+// checkLibraryCompatibility checks if the library of the peer is compatible with the local library.
+// Peer's version is compatible if it is the same as the local version of the library with the same number, or
+// if it is not known locally. In the latter case the local node is outdated and will not be able to validate
+// transactions which use functions of the newer version after its activation
+func checkLibraryCompatibility(hi *heartbeatInfo) (compatible bool, remoteIsNewer bool) {
+	v, known := ledger.L().VersionData(hi.libraryVersion)
+	if !known {
+		return true, true
+	}
+	return v.ActivationSlot == hi.activationSlot && bytes.Equal(v.Hash[:8], hi.libraryHashPrefix[:]), false
+}
+
 func (p *Peer) isAlive() bool {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
@@ -78,11 +147,23 @@ func (p *Peer) evidenceActivity(ps *Peers, srcMsg string) {
 	if !p._isAlive() {
 		ps.Log().Infof("libp2p host %s (self) connected to peer %s (%s) (%s)",
 			ShortPeerIDString(ps.host.ID()), ShortPeerIDString(p.id), p.name, srcMsg)
+		// the node may have missed branches while the peer was not connected
+		p.needsBranchTips = true
 	}
 	p.lastActivity = time.Now()
 	p.needsLogLostConnection = true
 }
 
+// evidenceLibraryVersion returns true if library version of the peer changed
+func (p *Peer) evidenceLibraryVersion(version byte) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ret := p.libraryVersion != version
+	p.libraryVersion = version
+	return ret
+}
+
 func (p *Peer) evidenceTxStore(hasTxStore bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -98,10 +179,14 @@ func (p *Peer) isCommunicationOpen() bool {
 }
 
 func (p *Peer) blockCommunications() {
+	p.blockCommunicationsFor(commBlockDuration)
+}
+
+func (p *Peer) blockCommunicationsFor(d time.Duration) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	p.blockActivityUntil = time.Now().Add(commBlockDuration)
+	p.blockActivityUntil = time.Now().Add(d)
 }
 
 func (ps *Peers) blockCommunicationsWithPeer(p *Peer) {
@@ -122,6 +207,19 @@ func (ps *Peers) NumPeers() (alive, configured int) {
 	return
 }
 
+// NumStaticPeers returns number of configured peers. They are never dropped by auto-peering
+func (ps *Peers) NumStaticPeers() (ret int) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	for _, p := range ps.peers {
+		if p.isStatic {
+			ret++
+		}
+	}
+	return
+}
+
 func (ps *Peers) logInactivityIfNeeded(id peer.ID) {
 	p := ps.getPeer(id)
 	if p == nil {
@@ -156,6 +254,7 @@ func checkRemoteClockTolerance(remoteTime time.Time) (bool, bool) {
 // - if peer is alive and
 // - to ensure clocks are synced within tolerance interval
 // - to ensure that ledger genesis is the same
+// - to ensure that versions of the ledger library are compatible
 
 func (ps *Peers) heartbeatStreamHandler(stream network.Stream) {
 	id := stream.Conn().RemotePeer()
@@ -165,10 +264,12 @@ func (ps *Peers) heartbeatStreamHandler(stream network.Stream) {
 
 	p := ps.getPeer(id)
 	if p == nil {
-		// peer not found
-		ps.Log().Warnf("unknown peer %s", id.String())
-		_ = stream.Reset()
-		return
+		// unknown peer is added if auto-peering is enabled and there is room for it
+		if p = ps.acceptInboundPeer(id); p == nil {
+			ps.Log().Warnf("unknown peer %s", id.String())
+			_ = stream.Reset()
+			return
+		}
 	}
 
 	if !p.isCommunicationOpen() {
@@ -181,11 +282,12 @@ func (ps *Peers) heartbeatStreamHandler(stream network.Stream) {
 	var msgData []byte
 
 	if msgData, err = readFrame(stream); err == nil {
+		p.evidenceMsgIn(len(msgData))
 		hbInfo, err = heartbeatInfoFromBytes(msgData)
 	}
 	if err != nil {
 		ps.Log().Errorf("error while reading message from peer %s: %v", id.String(), err)
-		ps.blockCommunicationsWithPeer(p)
+		ps.evidenceReputation(id, eventMalformedFrame)
 		_ = stream.Reset()
 		return
 	}
@@ -196,12 +298,24 @@ func (ps *Peers) heartbeatStreamHandler(stream network.Stream) {
 			b = "behind"
 		}
 		ps.Log().Warnf("clock of the peer %s is %s of the local clock more than tolerance interval %v", id.String(), b, clockTolerance)
+		ps.evidenceReputation(id, eventClockDrift)
+		_ = stream.Reset()
+		return
+	}
+	compatible, remoteIsNewer := checkLibraryCompatibility(&hbInfo)
+	if !compatible {
+		ps.Log().Warnf("ledger library version %d of the peer %s is incompatible with the local library", hbInfo.libraryVersion, id.String())
 		ps.blockCommunicationsWithPeer(p)
 		_ = stream.Reset()
 		return
 	}
 	defer stream.Close()
 
+	if p.evidenceLibraryVersion(hbInfo.libraryVersion) && remoteIsNewer {
+		ps.Log().Warnf("peer %s runs ledger library version %d, which is newer than the local version %d. Local node must be upgraded",
+			id.String(), hbInfo.libraryVersion, ledger.L().LatestVersion())
+	}
+
 	if traceHeartbeat {
 		ps.Tracef(TraceTag, "peer %s is alive: %v, has txStore: %v",
 			func() string { return ShortPeerIDString(id) },
@@ -212,6 +326,9 @@ func (ps *Peers) heartbeatStreamHandler(stream network.Stream) {
 
 	p.evidenceActivity(ps, "heartbeat")
 	p.evidenceTxStore(hbInfo.hasTxStore)
+	if hbInfo.hasTxStore && ps.wantsBranchTips() && p.takeNeedsBranchTips() {
+		go ps.pullBranchTipsFromPeer(p)
+	}
 
 	util.Assertf(p.isAlive(), "isAlive")
 }
@@ -221,17 +338,21 @@ func (ps *Peers) sendHeartbeatToPeer(id peer.ID) {
 		ps.Tracef(TraceTag, "sendHeartbeatToPeer from %s to %s", ps.host.ID().String, id.String)
 	}
 
-	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolHeartbeat)
+	// versioned heartbeat is preferred. Nodes which do not know library versions only support the legacy protocol
+	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolHeartbeatVersioned, ps.lppProtocolHeartbeat)
 	if err != nil {
 		return
 	}
 	defer stream.Close()
 
-	hbInfo := heartbeatInfo{
-		clock:      time.Now(),
-		hasTxStore: true,
+	hbInfo := newHeartbeatInfo(true)
+	msgData := hbInfo.Bytes()
+	if stream.Protocol() == ps.lppProtocolHeartbeat {
+		msgData = hbInfo.legacyBytes()
+	}
+	if writeFrame(stream, msgData) == nil {
+		ps.evidenceMsgOut(id, len(msgData))
 	}
-	_ = writeFrame(stream, hbInfo.Bytes())
 }
 
 const (
@@ -248,7 +369,7 @@ func (ps *Peers) heartbeatLoop() {
 		nowis := time.Now()
 		if nowis.After(logNumPeersDeadline) {
 			alive, configured := ps.NumPeers()
-			ps.Log().Infof("node is connected to %d peer(s) out of %d configured", alive, configured)
+			ps.Log().Infof("node is connected to %d peer(s) out of %d known", alive, configured)
 			logNumPeersDeadline = nowis.Add(logNumPeersPeriod)
 		}
 		for _, id := range ps.getPeerIDsWithOpenComms() {
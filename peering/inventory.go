@@ -0,0 +1,181 @@
+package peering
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/ledger"
+)
+
+// Inventory gossip (announce-then-pull). Instead of pushing full transaction to each peer, the node announces
+// the transaction ID. The peer requests unknown transactions from the announcer with the pull request, which is
+// responded from the cache of recently announced transactions. Sequencer milestones are always pushed in full
+// to minimize latency.
+// Full transaction IDs are announced, because the receiver checks if the transaction is known by its ID
+
+// types of messages in the gossip batch
+const (
+	gossipMsgTx = byte(iota)
+	gossipMsgInventory
+)
+
+const (
+	// announced transactions are kept for responding to requests
+	announcedTTL = time.Minute
+	maxAnnounced = 50_000
+	// transaction is requested from another announcer if it was not received in time
+	inventoryRequestTimeout = 3 * time.Second
+	inventoryPurgePeriod    = 5 * time.Second
+)
+
+type (
+	inventory struct {
+		mutex     sync.Mutex
+		announced map[ledger.TransactionID]announcedTx
+		requested map[ledger.TransactionID]time.Time
+	}
+
+	announcedTx struct {
+		msgData []byte
+		expire  time.Time
+	}
+)
+
+func newInventory() *inventory {
+	return &inventory{
+		announced: make(map[ledger.TransactionID]announcedTx),
+		requested: make(map[ledger.TransactionID]time.Time),
+	}
+}
+
+// announce remembers gossip message of the transaction. Returns false if there is no room for it
+func (inv *inventory) announce(txid *ledger.TransactionID, msgData []byte) bool {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if _, already := inv.announced[*txid]; !already && len(inv.announced) >= maxAnnounced {
+		return false
+	}
+	inv.announced[*txid] = announcedTx{msgData: msgData, expire: time.Now().Add(announcedTTL)}
+	return true
+}
+
+func (inv *inventory) getAnnounced(txid *ledger.TransactionID) []byte {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	return inv.announced[*txid].msgData
+}
+
+// toRequest returns transactions which were not requested recently and marks them as requested
+func (inv *inventory) toRequest(txids []ledger.TransactionID) []ledger.TransactionID {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	nowis := time.Now()
+	ret := make([]ledger.TransactionID, 0, len(txids))
+	for _, txid := range txids {
+		if deadline, already := inv.requested[txid]; already && deadline.After(nowis) {
+			continue
+		}
+		inv.requested[txid] = nowis.Add(inventoryRequestTimeout)
+		ret = append(ret, txid)
+	}
+	return ret
+}
+
+func (inv *inventory) purge() {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	nowis := time.Now()
+	for txid, a := range inv.announced {
+		if a.expire.Before(nowis) {
+			delete(inv.announced, txid)
+		}
+	}
+	for txid, deadline := range inv.requested {
+		if deadline.Before(nowis) {
+			delete(inv.requested, txid)
+		}
+	}
+}
+
+func encodeInventoryMsg(txids ...ledger.TransactionID) []byte {
+	ret := make([]byte, 1, 1+len(txids)*ledger.TransactionIDLength)
+	ret[0] = gossipMsgInventory
+	for i := range txids {
+		ret = append(ret, txids[i][:]...)
+	}
+	return ret
+}
+
+func decodeInventoryMsg(data []byte) ([]ledger.TransactionID, error) {
+	if len(data) < 1 || data[0] != gossipMsgInventory {
+		return nil, fmt.Errorf("not an inventory message")
+	}
+	data = data[1:]
+	if len(data) == 0 || len(data)%ledger.TransactionIDLength != 0 {
+		return nil, fmt.Errorf("decodeInventoryMsg: wrong data length")
+	}
+	ret := make([]ledger.TransactionID, len(data)/ledger.TransactionIDLength)
+	for i := range ret {
+		copy(ret[i][:], data[i*ledger.TransactionIDLength:])
+	}
+	return ret, nil
+}
+
+// OnQueryTxKnown sets function which checks if transaction is known by the node.
+// Announced transactions which are known are not requested
+func (ps *Peers) OnQueryTxKnown(fun func(txid *ledger.TransactionID) bool) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.isKnownTx = fun
+}
+
+// requestAnnounced requests unknown announced transactions from the announcer
+func (ps *Peers) requestAnnounced(from peer.ID, txids []ledger.TransactionID) {
+	unknown := make([]ledger.TransactionID, 0, len(txids))
+	for i := range txids {
+		if !ps.isKnownTx(&txids[i]) {
+			unknown = append(unknown, txids[i])
+		}
+	}
+	unknown = ps.inventory.toRequest(unknown)
+	for len(unknown) > 0 {
+		chunk := unknown[:min(len(unknown), MaxNumTransactionID)]
+		unknown = unknown[len(chunk):]
+
+		ps.reputation.expectPull(from, chunk...)
+		ps.sendPullTransactionsToPeer(from, chunk...)
+	}
+}
+
+// respondFromInventory sends to the peer requested transactions which were announced recently.
+// They are sent as ordinary gossip, so that the receiver announces them further.
+// Returns transactions not found among announced ones
+func (ps *Peers) respondFromInventory(p *Peer, txids []ledger.TransactionID) []ledger.TransactionID {
+	ret := make([]ledger.TransactionID, 0)
+	for i := range txids {
+		if msgData := ps.inventory.getAnnounced(&txids[i]); msgData != nil {
+			p.getOutQueue(ps).push(msgData, false)
+		} else {
+			ret = append(ret, txids[i])
+		}
+	}
+	return ret
+}
+
+func (ps *Peers) inventoryLoop() {
+	for {
+		select {
+		case <-ps.stopHeartbeatChan:
+			return
+		case <-time.After(inventoryPurgePeriod):
+		}
+		ps.inventory.purge()
+	}
+}
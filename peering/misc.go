@@ -43,27 +43,19 @@ func readFrame(stream network.Stream) ([]byte, error) {
 	return msgBuf, nil
 }
 
+// writeFrame writes size prefix and payload with one call, so that the frame is never split between writes
 func writeFrame(stream network.Stream, payload []byte) error {
 	if len(payload) > MaxPayloadSize {
 		return fmt.Errorf("payload size %d exceeds maximum %d bytes", len(payload), MaxPayloadSize)
 	}
-	var sizeBuf [4]byte
-
-	binary.BigEndian.PutUint32(sizeBuf[:], uint32(len(payload)))
-	if n, err := stream.Write(sizeBuf[:]); err != nil || n != 4 {
-		if err == nil {
-			err = errors.New("expected 4 bytes written")
-		}
-		return fmt.Errorf("failed to write size prefix: %v", err)
-	}
-	if len(payload) == 0 {
-		return nil
-	}
-	if n, err := stream.Write(payload); err != nil || n != len(payload) {
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	copy(frame[4:], payload)
+	if n, err := stream.Write(frame); err != nil || n != len(frame) {
 		if err == nil {
-			err = fmt.Errorf("expected %d bytes written", len(payload))
+			err = fmt.Errorf("expected %d bytes written", len(frame))
 		}
-		return fmt.Errorf("failed to write size prefix: %v", err)
+		return fmt.Errorf("failed to write frame: %v", err)
 	}
 	return nil
 }
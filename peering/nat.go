@@ -0,0 +1,170 @@
+package peering
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/multiformats/go-multiaddr"
+	"golang.org/x/exp/slices"
+)
+
+// NAT traversal. A node behind NAT can be reachable by peers in several ways, all of them opt-in:
+// - announce addresses: the node advertises configured public addresses instead of the listen addresses,
+//   e.g. when port is forwarded manually
+// - port mapping: the node asks the router to forward the port with UPnP or NAT-PMP
+// - relays: the node reserves a slot on static relays and advertises relayed address
+//   '/<relay multiaddr>/p2p-circuit/p2p/<host ID>'. Peers reach the node through the relay
+// - hole punching: peers connected through the relay try to upgrade the connection to the direct one
+// Public nodes help others by running AutoNAT service, which tells peers if they are reachable, and relay service.
+// Relay service of the node relays connections without limits, so that peers behind NAT can fully participate
+// even if hole punching fails
+
+type NATConfig struct {
+	// ask the router to map the port with UPnP or NAT-PMP
+	PortMap bool
+	// tell peers if they are reachable from outside
+	AutoNATService bool
+	// upgrade relayed connections to direct ones
+	HolePunching bool
+	// relay connections of peers
+	RelayService bool
+	// static relays to reserve a slot on, if the node is not reachable from outside
+	Relays []peer.AddrInfo
+	// ReachabilityPublic or ReachabilityPrivate overrides detection by AutoNAT of peers. Empty means auto-detection
+	Reachability string
+}
+
+const (
+	ReachabilityPublic  = "public"
+	ReachabilityPrivate = "private"
+)
+
+// natOptions returns libp2p options for announce addresses and NAT traversal
+func natOptions(cfg *Config) ([]libp2p.Option, error) {
+	ret := make([]libp2p.Option, 0)
+	if len(cfg.AnnounceAddrs) > 0 {
+		ret = append(ret, libp2p.AddrsFactory(announceAddrsFactory(cfg.AnnounceAddrs)))
+	}
+	nat := &cfg.NAT
+	if nat.PortMap {
+		ret = append(ret, libp2p.NATPortMap())
+	}
+	if nat.AutoNATService {
+		ret = append(ret, libp2p.EnableNATService())
+	}
+	if nat.HolePunching {
+		ret = append(ret, libp2p.EnableHolePunching())
+	}
+	if nat.RelayService {
+		ret = append(ret, libp2p.EnableRelayService(relay.WithInfiniteLimits()))
+	}
+	if len(nat.Relays) > 0 {
+		// with static relays there is nothing to wait for, reservations are made as soon as the node is found private
+		ret = append(ret, libp2p.EnableAutoRelayWithStaticRelays(nat.Relays,
+			autorelay.WithMinCandidates(len(nat.Relays)),
+			autorelay.WithBootDelay(0),
+		))
+	}
+	switch nat.Reachability {
+	case "":
+	case ReachabilityPublic:
+		ret = append(ret, libp2p.ForceReachabilityPublic())
+	case ReachabilityPrivate:
+		ret = append(ret, libp2p.ForceReachabilityPrivate())
+	default:
+		return nil, fmt.Errorf("unknown reachability '%s'. Must be '%s' or '%s'", nat.Reachability, ReachabilityPublic, ReachabilityPrivate)
+	}
+	return ret, nil
+}
+
+// announceAddrsFactory replaces listen addresses with announce addresses. Relayed addresses are kept
+func announceAddrsFactory(announce []multiaddr.Multiaddr) func([]multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	return func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+		ret := append(make([]multiaddr.Multiaddr, 0, len(announce)), announce...)
+		for _, a := range addrs {
+			if isRelayedAddr(a) {
+				ret = append(ret, a)
+			}
+		}
+		return ret
+	}
+}
+
+func isRelayedAddr(a multiaddr.Multiaddr) bool {
+	_, err := a.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
+
+// reachabilityTracker keeps reachability of the node, as detected by AutoNAT or forced by config
+type reachabilityTracker struct {
+	mutex        sync.RWMutex
+	reachability network.Reachability
+}
+
+func (ps *Peers) trackReachability() error {
+	sub, err := ps.host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer func() { _ = sub.Close() }()
+		for {
+			select {
+			case <-ps.stopHeartbeatChan:
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				r := evt.(event.EvtLocalReachabilityChanged).Reachability
+				ps.reachability.mutex.Lock()
+				ps.reachability.reachability = r
+				ps.reachability.mutex.Unlock()
+				ps.Log().Infof("libp2p host %s (self) reachability: %s", ShortPeerIDString(ps.host.ID()), r.String())
+			}
+		}
+	}()
+	return nil
+}
+
+// Reachability returns reachability of the node from outside: 'Public', 'Private' or 'Unknown'
+func (ps *Peers) Reachability() string {
+	ps.reachability.mutex.RLock()
+	defer ps.reachability.mutex.RUnlock()
+
+	return ps.reachability.reachability.String()
+}
+
+// AdvertisedAddrs returns addresses of the node advertised to peers, including relayed ones
+func (ps *Peers) AdvertisedAddrs() []multiaddr.Multiaddr {
+	return ps.host.Addrs()
+}
+
+// ObservedAddrs returns addresses of the node as observed by peers or mapped by the router,
+// i.e. public addresses of the NAT. Relayed addresses are not included
+func (ps *Peers) ObservedAddrs() []multiaddr.Multiaddr {
+	h, ok := ps.host.(interface{ AllAddrs() []multiaddr.Multiaddr })
+	if !ok {
+		return nil
+	}
+	local, err := ps.host.Network().InterfaceListenAddresses()
+	if err != nil {
+		return nil
+	}
+	ret := make([]multiaddr.Multiaddr, 0)
+	for _, addr := range h.AllAddrs() {
+		if _, err = addr.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+			continue
+		}
+		if !slices.ContainsFunc(local, addr.Equal) {
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,225 @@
+package peering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// outQueue is the outbound gossip queue of the peer. Transactions are sent to the peer in batches over the long-lived
+// stream. Sequencer milestones are sent before ordinary transactions. If the peer is slow, the queue is full and new
+// transactions are rejected. The stream is reset and the batch is dropped if the peer does not read it in time.
+// Dropped transactions will be pulled by the peer, if needed.
+// Peers which do not support batches are sent transactions over the legacy gossip protocol, one per stream
+
+type outQueue struct {
+	ps         *Peers
+	id         peer.ID
+	mutex      sync.Mutex
+	milestones queuedTxBytes
+	ordinary   queuedTxBytes
+	notify     chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	// accessed only by the sending goroutine
+	stream network.Stream
+	// number of transactions dropped because of the full queue or failed write
+	dropped uint64
+}
+
+type queuedTxBytes struct {
+	items    [][]byte
+	numBytes int
+}
+
+const (
+	// maximum size of the queue of each priority in bytes
+	maxOutQueueBytes = 4 << 20
+	// write of the batch must complete in time, otherwise peer is considered slow
+	gossipWriteTimeout = 5 * time.Second
+	gossipDialTimeout  = 5 * time.Second
+)
+
+func newOutQueue(ps *Peers, id peer.ID) *outQueue {
+	ret := &outQueue{
+		ps:     ps,
+		id:     id,
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	go ret.sendLoop()
+	return ret
+}
+
+// push adds gossip message to the queue. Returns false if message is rejected because the queue is full
+func (q *outQueue) push(msgData []byte, milestone bool) bool {
+	q.mutex.Lock()
+	queue := &q.ordinary
+	if milestone {
+		queue = &q.milestones
+	}
+	if queue.numBytes+len(msgData) > maxOutQueueBytes {
+		q.dropped++
+		q.mutex.Unlock()
+		return false
+	}
+	queue.items = append(queue.items, msgData)
+	queue.numBytes += len(msgData)
+	q.mutex.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// nextBatch takes messages from the queue, milestones first, until batch frame is full
+func (q *outQueue) nextBatch() [][]byte {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ret := make([][]byte, 0)
+	size := gossipBatchHeaderSize
+	for _, queue := range []*queuedTxBytes{&q.milestones, &q.ordinary} {
+		for len(queue.items) > 0 && len(ret) < maxGossipBatchItems {
+			item := queue.items[0]
+			if size+gossipBatchItemHeaderSize+len(item) > MaxPayloadSize {
+				return ret
+			}
+			ret = append(ret, item)
+			size += gossipBatchItemHeaderSize + len(item)
+			queue.items[0] = nil
+			queue.items = queue.items[1:]
+			queue.numBytes -= len(item)
+		}
+	}
+	return ret
+}
+
+func (q *outQueue) numQueued() (milestones, ordinary int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.milestones.items), len(q.ordinary.items)
+}
+
+func (q *outQueue) numDropped() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.dropped
+}
+
+func (q *outQueue) close() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+}
+
+func (q *outQueue) sendLoop() {
+	defer func() {
+		if q.stream != nil {
+			_ = q.stream.Close()
+		}
+	}()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.ps.stopHeartbeatChan:
+			return
+		case <-q.notify:
+		}
+		for batch := q.nextBatch(); len(batch) > 0; batch = q.nextBatch() {
+			q.sendBatch(batch)
+		}
+	}
+}
+
+func (q *outQueue) sendBatch(batch [][]byte) {
+	hadStream := q.stream != nil
+	sent, err := q.writeBatch(batch)
+	if err != nil && hadStream && sent == 0 {
+		// long-lived stream could be closed by the peer, try once more with the new one
+		sent, err = q.writeBatch(batch)
+	}
+	if err != nil {
+		q.ps.Tracef(TraceTag, "outQueue.sendBatch to %s: %v (host %s)",
+			func() any { return ShortPeerIDString(q.id) }, err,
+			func() any { return ShortPeerIDString(q.ps.host.ID()) },
+		)
+	}
+	if sent < len(batch) {
+		q.mutex.Lock()
+		q.dropped += uint64(len(batch) - sent)
+		q.mutex.Unlock()
+	}
+	if p := q.ps.getPeer(q.id); p != nil {
+		for _, item := range batch[:sent] {
+			p.evidenceMsgOut(len(item))
+		}
+	}
+}
+
+// writeBatch writes batch to the peer, opening the stream if necessary. Batch gossip protocol is preferred.
+// Peers which support only the legacy gossip protocol are sent messages one per stream.
+// Returns number of messages sent
+func (q *outQueue) writeBatch(batch [][]byte) (int, error) {
+	if err := q.openStream(q.ps.lppProtocolGossip, q.ps.lppProtocolGossipLegacy); err != nil {
+		return 0, err
+	}
+	if q.stream.Protocol() == q.ps.lppProtocolGossipLegacy {
+		return q.writeLegacy(q.ps.legacyGossipMsgs(batch))
+	}
+	if err := q.writeFrame(encodeGossipBatch(batch)); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// writeLegacy sends each transaction in a separate stream without message type, as nodes without batches expect it
+func (q *outQueue) writeLegacy(msgs [][]byte) (int, error) {
+	for i, msgData := range msgs {
+		if err := q.openStream(q.ps.lppProtocolGossipLegacy); err != nil {
+			return i, err
+		}
+		if err := q.writeFrame(msgData[1:]); err != nil {
+			return i, err
+		}
+		_ = q.stream.Close()
+		q.stream = nil
+	}
+	return len(msgs), nil
+}
+
+// openStream opens the stream with one of protocols, if it is not open
+func (q *outQueue) openStream(pids ...protocol.ID) error {
+	if q.stream != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(q.ps.Ctx(), gossipDialTimeout)
+	defer cancel()
+
+	stream, err := q.ps.host.NewStream(ctx, q.id, pids...)
+	if err != nil {
+		return err
+	}
+	q.stream = stream
+	return nil
+}
+
+// writeFrame writes frame to the open stream. On error the stream is reset
+func (q *outQueue) writeFrame(msgData []byte) error {
+	_ = q.stream.SetWriteDeadline(time.Now().Add(gossipWriteTimeout))
+	if err := writeFrame(q.stream, msgData); err != nil {
+		_ = q.stream.Reset()
+		q.stream = nil
+		return err
+	}
+	return nil
+}
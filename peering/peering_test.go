@@ -2,21 +2,34 @@ package peering
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/proxima/util/countdown"
 	"github.com/lunfardo314/proxima/util/set"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
 )
 
 // initializes ledger.Library singleton for all tests and creates testing genesis private key
@@ -51,8 +64,10 @@ func TestBasic(t *testing.T) {
 			t.Logf("%s : %s", name, ma.String())
 		}
 		env := global.NewDefault()
-		_, err := New(env, cfg)
+		peers, err := New(env, cfg)
 		require.NoError(t, err)
+		// host is listening on the port used by other tests
+		require.NoError(t, peers.host.Close())
 	})
 	t.Run("2", func(t *testing.T) {
 		const hostIndex = 2
@@ -65,18 +80,56 @@ func TestBasic(t *testing.T) {
 	})
 }
 
-func makeHosts(t *testing.T, nHosts int, trace bool) []*Peers {
+// hostsOptions modify hosts created by makeHosts. Zero value means hosts on default ports, which know each other
+type hostsOptions struct {
+	// port of host 0. BeginPort if 0
+	beginPort int
+	// hosts do not know each other
+	noKnownPeers bool
+	// hosts are run and stopped when the test finishes
+	run   bool
+	trace bool
+	// modifies config of host i before it is created
+	adjust func(i int, cfg *Config)
+}
+
+func makeHosts(t testing.TB, nHosts int, opt hostsOptions) []*Peers {
+	if opt.beginPort == 0 {
+		opt.beginPort = BeginPort
+	}
 	hosts := make([]*Peers, nHosts)
 	var err error
 	for i := 0; i < nHosts; i++ {
 		cfg := MakeConfigFor(nHosts, i)
+		cfg.HostPort = opt.beginPort + i
+		cfg.KnownPeers = make(map[string]multiaddr.Multiaddr)
+		for j := 0; j < nHosts && !opt.noKnownPeers; j++ {
+			if j != i {
+				ma, err := multiaddr.NewMultiaddr(MultiAddrString(j, opt.beginPort+j))
+				require.NoError(t, err)
+				cfg.KnownPeers[fmt.Sprintf("peer%d", j)] = ma
+			}
+		}
+		if opt.adjust != nil {
+			opt.adjust(i, cfg)
+		}
 		env := global.NewDefault()
 		hosts[i], err = New(env, cfg)
 		require.NoError(t, err)
-		if trace {
+		if opt.trace {
 			env.StartTracingTags(TraceTag)
 		}
 	}
+	if opt.run {
+		for _, h := range hosts {
+			h.Run()
+		}
+		t.Cleanup(func() {
+			for _, h := range hosts {
+				h.Stop()
+			}
+		})
+	}
 	return hosts
 }
 
@@ -85,7 +138,7 @@ func TestHeartbeat(t *testing.T) {
 		numHosts = 5
 		trace    = false
 	)
-	hosts := makeHosts(t, numHosts, trace)
+	hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 	for _, h := range hosts {
 		h.Run()
 	}
@@ -106,13 +159,96 @@ func TestHeartbeat(t *testing.T) {
 	}
 }
 
+func TestHeartbeatInfoLegacy(t *testing.T) {
+	hi := newHeartbeatInfo(true)
+	hiBack, err := heartbeatInfoFromBytes(hi.Bytes())
+	require.NoError(t, err)
+	require.EqualValues(t, ledger.L().LatestVersion(), hiBack.libraryVersion)
+	require.True(t, hiBack.hasTxStore)
+
+	// heartbeat of the node which does not know library versions
+	legacy := hi.Bytes()[:heartbeatInfoSizeLegacy]
+	hiBack, err = heartbeatInfoFromBytes(legacy)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, hiBack.libraryVersion)
+	require.True(t, hiBack.hasTxStore)
+	require.EqualValues(t, hi.clock.UnixNano(), hiBack.clock.UnixNano())
+
+	compatible, remoteIsNewer := checkLibraryCompatibility(&hiBack)
+	require.True(t, compatible)
+	require.False(t, remoteIsNewer)
+
+	_, err = heartbeatInfoFromBytes(legacy[:heartbeatInfoSizeLegacy-1])
+	require.Error(t, err)
+}
+
+func TestHeartbeatLegacyPeer(t *testing.T) {
+	hosts := makeHosts(t, 2, hostsOptions{run: true})
+	// host 1 behaves as the node which does not know library versions: it supports only the legacy heartbeat protocol
+	// and accepts only heartbeats of the legacy size
+	var received, wrongSize atomic.Int32
+	hosts[1].host.RemoveStreamHandler(hosts[1].lppProtocolHeartbeatVersioned)
+	hosts[1].host.SetStreamHandler(hosts[1].lppProtocolHeartbeat, func(stream network.Stream) {
+		defer stream.Close()
+		if data, err := readFrame(stream); err != nil || len(data) != heartbeatInfoSizeLegacy {
+			wrongSize.Add(1)
+			return
+		}
+		received.Add(1)
+	})
+	require.Eventually(t, func() bool {
+		return received.Load() >= 2
+	}, 10*time.Second, 100*time.Millisecond)
+	require.Zero(t, wrongSize.Load())
+}
+
+func TestGossipLegacyPeer(t *testing.T) {
+	hosts := makeHosts(t, 2, hostsOptions{})
+	received := make([]atomic.Int32, 2)
+	for i, h := range hosts {
+		i := i
+		h.OnReceiveTxBytes(func(_ peer.ID, txBytes []byte, _ *txmetadata.TransactionMetadata) {
+			if bytes.Equal(txBytes, []byte{0xff, byte(i)}) {
+				received[i].Add(1)
+			}
+		})
+		h.Run()
+	}
+	defer func() {
+		for _, h := range hosts {
+			h.Stop()
+		}
+	}()
+	// host 1 behaves as the node which does not support gossip batches: it supports only the legacy gossip protocol
+	hosts[1].host.RemoveStreamHandler(hosts[1].lppProtocolGossip)
+	require.Eventually(t, func() bool {
+		alive, _ := hosts[0].NumPeers()
+		return alive == 1
+	}, 10*time.Second, 100*time.Millisecond)
+
+	const numMsg = 10
+	for i := 0; i < numMsg; i++ {
+		require.True(t, hosts[0].SendTxBytesWithMetadataToPeer(hosts[1].host.ID(), []byte{0xff, 1}, nil))
+	}
+	// legacy node sends each transaction in a new stream
+	for i := 0; i < numMsg; i++ {
+		stream, err := hosts[1].host.NewStream(hosts[1].Ctx(), hosts[0].host.ID(), hosts[1].lppProtocolGossipLegacy)
+		require.NoError(t, err)
+		require.NoError(t, writeFrame(stream, common.ConcatBytes((*txmetadata.TransactionMetadata)(nil).Bytes(), []byte{0xff, 0})))
+		_ = stream.Close()
+	}
+	require.Eventually(t, func() bool {
+		return received[0].Load() == numMsg && received[1].Load() == numMsg
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
 func TestSendMsg(t *testing.T) {
 	t.Run("1", func(t *testing.T) {
 		const (
 			numHosts = 5
 			trace    = false
 		)
-		hosts := makeHosts(t, numHosts, trace)
+		hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 
 		for _, h := range hosts {
 			h1 := h
@@ -139,7 +275,7 @@ func TestSendMsg(t *testing.T) {
 			trace    = false
 			numMsg   = 1000
 		)
-		hosts := makeHosts(t, numHosts, trace)
+		hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 		counter := countdown.New(numMsg*(numHosts-1), 2*time.Second)
 		counter1 := 0
 		for _, h := range hosts {
@@ -179,7 +315,7 @@ func TestSendMsg(t *testing.T) {
 			trace    = false
 			numMsg   = 100 // 721 // 720 pass, 721 does not
 		)
-		hosts := makeHosts(t, numHosts, trace)
+		hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 		counter := countdown.New(numHosts*numMsg*(numHosts-1), 10*time.Second)
 		counter1 := 0
 		for _, h := range hosts {
@@ -225,7 +361,7 @@ func TestSendMsg(t *testing.T) {
 			trace    = false
 			numMsg   = 800
 		)
-		hosts := makeHosts(t, numHosts, trace)
+		hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 		counter := countdown.New(numHosts*(numHosts-1)*numMsg, 10*time.Second)
 		t.Logf("sending %d messages", numHosts*(numHosts-1)*numMsg)
 
@@ -264,7 +400,7 @@ func TestSendMsg(t *testing.T) {
 			trace    = false
 			numMsg   = 100
 		)
-		hosts := makeHosts(t, numHosts, trace)
+		hosts := makeHosts(t, numHosts, hostsOptions{trace: trace})
 		counter := countdown.New(numMsg, 15*time.Second)
 
 		txSet := set.New[ledger.TransactionID]()
@@ -331,3 +467,1022 @@ func rndTxIDs() []ledger.TransactionID {
 	}
 	return ret
 }
+
+func TestPeerExchangeMsg(t *testing.T) {
+	infos := make([]peer.AddrInfo, 0)
+	for i := range hostID {
+		ma, err := multiaddr.NewMultiaddr(MultiAddrString(i, BeginPort+i))
+		require.NoError(t, err)
+		info, err := peer.AddrInfoFromP2pAddr(ma)
+		require.NoError(t, err)
+		infos = append(infos, *info)
+	}
+	back, err := decodePeerExchangeMsg(encodePeerExchangeMsg(infos))
+	require.NoError(t, err)
+	require.EqualValues(t, len(infos), len(back))
+	for _, info := range back {
+		require.True(t, slices.ContainsFunc(infos, func(i peer.AddrInfo) bool {
+			return i.ID == info.ID && i.Addrs[0].Equal(info.Addrs[0])
+		}))
+	}
+	back, err = decodePeerExchangeMsg(encodePeerExchangeMsg(nil))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, len(back))
+
+	_, err = decodePeerExchangeMsg(encodePeerExchangeMsg(infos)[:20])
+	require.Error(t, err)
+}
+
+func TestAutoPeering(t *testing.T) {
+	const (
+		numHosts = 3
+		// ports different from other tests
+		beginPort = BeginPort + 100
+	)
+	peersFile := filepath.Join(t.TempDir(), "peers.txt")
+	peer0, err := multiaddr.NewMultiaddr(MultiAddrString(0, beginPort))
+	require.NoError(t, err)
+
+	// hosts know only host 0. Other hosts are discovered via host 0
+	hosts := makeHosts(t, numHosts, hostsOptions{
+		beginPort:    beginPort,
+		noKnownPeers: true,
+		run:          true,
+		adjust: func(i int, cfg *Config) {
+			if i != 0 {
+				cfg.KnownPeers["peer0"] = peer0
+			}
+			cfg.AutoPeering = true
+			cfg.DiscoveryPeriod = time.Second
+			if i == 1 {
+				cfg.PeersFile = peersFile
+			}
+		},
+	})
+	require.Eventually(t, func() bool {
+		for _, h := range hosts {
+			if alive, known := h.NumPeers(); alive != numHosts-1 || known != numHosts-1 {
+				return false
+			}
+		}
+		return true
+	}, 20*time.Second, 500*time.Millisecond)
+	require.EqualValues(t, 0, hosts[0].NumStaticPeers())
+	require.EqualValues(t, 1, hosts[1].NumStaticPeers())
+
+	// host 1 saves host 2 to the file and restores it after restart
+	hosts[1].Stop()
+	data, err := os.ReadFile(peersFile)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(data), hosts[2].host.ID().String()))
+
+	cfg := MakeConfigFor(numHosts, 1)
+	cfg.HostPort = beginPort + 1
+	cfg.KnownPeers = make(map[string]multiaddr.Multiaddr)
+	cfg.AutoPeering = true
+	cfg.PeersFile = peersFile
+	restarted, err := New(global.NewDefault(), cfg)
+	require.NoError(t, err)
+	require.NotNil(t, restarted.getPeer(hosts[2].host.ID()))
+	_ = restarted.host.Close()
+}
+
+func TestTransportSecurity(t *testing.T) {
+	// ports different from other tests
+	const beginPort = BeginPort + 200
+
+	// makeConfig makes config of the host with TCP port beginPort+i, which knows peers with given multiaddresses
+	makeConfig := func(i int, security string, known ...string) *Config {
+		cfg := MakeConfigFor(len(hostID), i)
+		cfg.HostPort = beginPort + i
+		cfg.Security = security
+		cfg.KnownPeers = make(map[string]multiaddr.Multiaddr)
+		for j, s := range known {
+			ma, err := multiaddr.NewMultiaddr(s)
+			require.NoError(t, err)
+			cfg.KnownPeers[fmt.Sprintf("peer%d", j)] = ma
+		}
+		return cfg
+	}
+	tcpAddr := func(i int) string {
+		return MultiAddrString(i, beginPort+i)
+	}
+	// connected checks if hosts see each other alive after some heartbeats
+	connected := func(t *testing.T, cfg0, cfg1 *Config) bool {
+		h0, err := New(global.NewDefault(), cfg0)
+		require.NoError(t, err)
+		h1, err := New(global.NewDefault(), cfg1)
+		require.NoError(t, err)
+		h0.Run()
+		h1.Run()
+		defer h0.Stop()
+		defer h1.Stop()
+
+		time.Sleep(3 * time.Second)
+		return h0.PeerIsAlive(h1.host.ID()) && h1.PeerIsAlive(h0.host.ID())
+	}
+
+	t.Run("noise", func(t *testing.T) {
+		require.True(t, connected(t, makeConfig(0, SecurityNoise, tcpAddr(1)), makeConfig(1, "", tcpAddr(0))))
+	})
+	t.Run("tls", func(t *testing.T) {
+		require.True(t, connected(t, makeConfig(0, SecurityTLS, tcpAddr(1)), makeConfig(1, SecurityTLS, tcpAddr(0))))
+	})
+	t.Run("mixed security rejected", func(t *testing.T) {
+		require.False(t, connected(t, makeConfig(0, SecurityNoise, tcpAddr(1)), makeConfig(1, SecurityNone, tcpAddr(0))))
+		require.False(t, connected(t, makeConfig(0, SecurityNoise, tcpAddr(1)), makeConfig(1, SecurityTLS, tcpAddr(0))))
+	})
+	t.Run("quic", func(t *testing.T) {
+		quicAddr := func(i int) string {
+			return fmt.Sprintf("/ip4/127.0.0.1/udp/%d/quic-v1/p2p/%s", beginPort+100+i, hostID[i])
+		}
+		cfg0, cfg1 := makeConfig(0, SecurityNoise, quicAddr(1)), makeConfig(1, SecurityNoise, quicAddr(0))
+		cfg0.QUICPort, cfg1.QUICPort = beginPort+100, beginPort+101
+		// QUIC requires security
+		cfgNone := *cfg0
+		cfgNone.Security = SecurityNone
+		_, err := New(global.NewDefault(), &cfgNone)
+		require.Error(t, err)
+		require.True(t, connected(t, cfg0, cfg1))
+	})
+	t.Run("wrong security", func(t *testing.T) {
+		_, err := New(global.NewDefault(), makeConfig(0, "wrong"))
+		require.Error(t, err)
+	})
+	t.Run("allow list", func(t *testing.T) {
+		// host 0 allows only host 1. Host 2 knows host 0, but cannot connect
+		cfg0 := makeConfig(0, SecurityNoise, tcpAddr(1))
+		cfg0.AllowKnownPeersOnly = true
+		require.False(t, connected(t, cfg0, makeConfig(2, SecurityNoise, tcpAddr(0))))
+		require.True(t, connected(t, cfg0, makeConfig(1, SecurityNoise, tcpAddr(0))))
+	})
+}
+
+func TestPeersAdmin(t *testing.T) {
+	// ports different from other tests
+	const beginPort = BeginPort + 300
+
+	hosts := makeHosts(t, 2, hostsOptions{beginPort: beginPort, noKnownPeers: true, run: true})
+	for i, h := range hosts {
+		require.EqualValues(t, 0, len(h.PeersInfo()))
+		ma, err := multiaddr.NewMultiaddr(MultiAddrString(1-i, beginPort+1-i))
+		require.NoError(t, err)
+		require.NoError(t, h.AddPeer(ma, "other"))
+	}
+	self, err := multiaddr.NewMultiaddr(MultiAddrString(0, beginPort))
+	require.NoError(t, err)
+	require.Error(t, hosts[0].AddPeer(self, "self"))
+
+	id1 := hosts[1].host.ID()
+	require.Eventually(t, func() bool {
+		return hosts[0].PeerIsAlive(id1) && hosts[1].PeerIsAlive(hosts[0].host.ID())
+	}, 5*time.Second, 100*time.Millisecond)
+
+	info := hosts[0].PeersInfo()
+	require.EqualValues(t, 1, len(info))
+	require.EqualValues(t, id1, info[0].ID)
+	require.EqualValues(t, "other", info[0].Name)
+	require.True(t, info[0].Static)
+	require.True(t, info[0].Alive)
+	require.True(t, info[0].HasTxStore)
+	require.True(t, info[0].BlockedUntil.IsZero())
+	require.True(t, info[0].MsgIn > 0 && info[0].BytesIn > 0)
+	require.True(t, info[0].MsgOut > 0 && info[0].BytesOut > 0)
+	require.True(t, len(info[0].Addrs) > 0)
+
+	require.NoError(t, hosts[0].BlockPeer(id1, time.Minute))
+	require.False(t, hosts[0].PeersInfo()[0].BlockedUntil.IsZero())
+	require.NoError(t, hosts[0].BlockPeer(id1, 0))
+	require.True(t, hosts[0].PeersInfo()[0].BlockedUntil.IsZero())
+
+	require.NoError(t, hosts[0].RemovePeer(id1))
+	require.EqualValues(t, 0, len(hosts[0].PeersInfo()))
+	require.False(t, hosts[0].PeerIsAlive(id1))
+	require.Error(t, hosts[0].RemovePeer(id1))
+	require.Error(t, hosts[0].BlockPeer(id1, time.Minute))
+}
+
+func TestReputation(t *testing.T) {
+	id := mustPeerID(t, 0)
+
+	t.Run("escalating bans", func(t *testing.T) {
+		r := newReputationBook()
+		r.registerMetrics(global.NewDefault().MetricsRegistry())
+		for i := 0; i < maxScore; i++ {
+			require.EqualValues(t, 0, r.apply(id, eventFirstDelivery, false))
+		}
+		require.EqualValues(t, maxScore, r.get(id).Score)
+
+		for _, expected := range []time.Duration{commBlockDuration, 2 * commBlockDuration, 4 * commBlockDuration} {
+			var banFor time.Duration
+			for banFor == 0 {
+				banFor = r.apply(id, eventMalformedFrame, false)
+			}
+			require.EqualValues(t, expected, banFor)
+			require.True(t, r.isBanned(id))
+			require.EqualValues(t, 0, r.get(id).Score)
+			r.unban(id)
+			require.False(t, r.isBanned(id))
+		}
+		require.EqualValues(t, 3, r.get(id).NumBans)
+		require.EqualValues(t, maxBanDuration, banDuration(100))
+	})
+	t.Run("exempt from ban", func(t *testing.T) {
+		r := newReputationBook()
+		for i := 0; i < 10; i++ {
+			require.EqualValues(t, 0, r.apply(id, eventInvalidTx, true))
+		}
+		require.False(t, r.isBanned(id))
+		require.True(t, r.get(id).Score <= banScoreThreshold)
+		// score is kept, so the peer is banned as soon as it is not exempted
+		require.True(t, r.apply(id, eventInvalidTx, false) > 0)
+	})
+	t.Run("decay", func(t *testing.T) {
+		r := newReputationBook()
+		r.apply(id, eventClockDrift, false)
+		for i := 0; i < -reputationEventScores[eventClockDrift]; i++ {
+			r.decay()
+		}
+		require.EqualValues(t, 0, r.get(id).Score)
+		r.decay()
+		require.EqualValues(t, 0, len(r.records))
+	})
+	t.Run("pulls and deliveries", func(t *testing.T) {
+		r := newReputationBook()
+		txid1 := ledger.RandomTransactionID(true)
+		txid2 := ledger.RandomTransactionID(true)
+		r.expectPull(id, txid1, txid2)
+		require.False(t, r.txDelivered(id, &txid1, true))
+		require.True(t, r.txDelivered(id, &txid2, false))
+		require.False(t, r.txDelivered(id, &txid2, false))
+		require.EqualValues(t, 0, len(r.purgeExpired()))
+
+		r.expectPull(id, txid1)
+		r.pendingPulls[txid1] = pendingPull{from: id, deadline: time.Now().Add(-time.Second)}
+		require.EqualValues(t, []peer.ID{id}, r.purgeExpired())
+	})
+	t.Run("persist", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "reputation.json")
+		r := newReputationBook()
+		banned := false
+		for !banned {
+			banned = r.apply(id, eventInvalidTx, false) > 0
+		}
+		require.NoError(t, r.save(fname))
+
+		restored := newReputationBook()
+		require.NoError(t, restored.load(fname))
+		require.True(t, restored.isBanned(id))
+		require.EqualValues(t, 1, restored.get(id).NumBans)
+		require.NoError(t, newReputationBook().load(filepath.Join(t.TempDir(), "nonexistent.json")))
+	})
+}
+
+func mustPeerID(t *testing.T, idx int) peer.ID {
+	ma, err := multiaddr.NewMultiaddr(MultiAddrString(idx, BeginPort+idx))
+	require.NoError(t, err)
+	info, err := peer.AddrInfoFromP2pAddr(ma)
+	require.NoError(t, err)
+	return info.ID
+}
+
+func TestBanMisbehavingPeer(t *testing.T) {
+	// ports different from other tests
+	const beginPort = BeginPort + 400
+
+	hosts := makeHosts(t, 2, hostsOptions{
+		beginPort:    beginPort,
+		noKnownPeers: true,
+		run:          true,
+		adjust: func(_ int, cfg *Config) {
+			cfg.MaxPeers = 2
+		},
+	})
+	// host 1 is a dynamic peer of host 0. Static peers are never banned
+	ma, err := multiaddr.NewMultiaddr(MultiAddrString(0, beginPort))
+	require.NoError(t, err)
+	require.NoError(t, hosts[1].AddPeer(ma, "other"))
+	ma, err = multiaddr.NewMultiaddr(MultiAddrString(1, beginPort+1))
+	require.NoError(t, err)
+	info1, err := peer.AddrInfoFromP2pAddr(ma)
+	require.NoError(t, err)
+	require.True(t, hosts[0].addDynamicPeer(*info1, "test"))
+	id1 := hosts[1].host.ID()
+	require.Eventually(t, func() bool {
+		return hosts[0].PeerIsAlive(id1)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// host 1 sends garbage instead of transactions until it is banned by host 0
+	sendGarbage := func() {
+		stream, err := hosts[1].host.NewStream(hosts[1].Ctx(), hosts[0].host.ID(), hosts[1].lppProtocolGossip)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		_ = writeFrame(stream, []byte("garbage"))
+	}
+	require.Eventually(t, func() bool {
+		sendGarbage()
+		return !hosts[0].PeersInfo()[0].BlockedUntil.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info := hosts[0].PeersInfo()[0]
+	require.EqualValues(t, 1, info.NumBans)
+	require.True(t, time.Until(info.BlockedUntil) > commBlockDuration/2)
+
+	// ban remains after the peer is removed and added again as static
+	require.NoError(t, hosts[0].RemovePeer(id1))
+	require.NoError(t, hosts[0].AddPeer(ma, "other"))
+	require.False(t, hosts[0].PeersInfo()[0].BlockedUntil.IsZero())
+
+	// operator lifts the ban
+	require.NoError(t, hosts[0].BlockPeer(id1, 0))
+	require.True(t, hosts[0].PeersInfo()[0].BlockedUntil.IsZero())
+	require.EqualValues(t, 1, hosts[0].PeersInfo()[0].NumBans)
+
+	// static peer is scored, but not banned
+	require.Eventually(t, func() bool {
+		sendGarbage()
+		return hosts[0].reputation.get(id1).Score <= banScoreThreshold
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, hosts[0].PeersInfo()[0].BlockedUntil.IsZero())
+	require.EqualValues(t, 1, hosts[0].PeersInfo()[0].NumBans)
+}
+
+func TestGossipBatch(t *testing.T) {
+	t.Run("encode decode", func(t *testing.T) {
+		batch := [][]byte{{1}, bytes.Repeat([]byte{2}, 500), {}, {3, 3}}
+		decoded, err := decodeGossipBatch(encodeGossipBatch(batch))
+		require.NoError(t, err)
+		require.EqualValues(t, batch, decoded)
+
+		data := encodeGossipBatch(batch)
+		_, err = decodeGossipBatch(data[:len(data)-1])
+		require.Error(t, err)
+		_, err = decodeGossipBatch(append(data, 0))
+		require.Error(t, err)
+		_, err = decodeGossipBatch(encodeGossipBatch(nil))
+		require.Error(t, err)
+	})
+	t.Run("priority and backpressure", func(t *testing.T) {
+		q := &outQueue{notify: make(chan struct{}, 1)}
+		require.True(t, q.push([]byte{1}, false))
+		require.True(t, q.push([]byte{2}, true))
+		require.True(t, q.push([]byte{3}, false))
+		require.True(t, q.push([]byte{4}, true))
+		require.EqualValues(t, [][]byte{{2}, {4}, {1}, {3}}, q.nextBatch())
+		require.EqualValues(t, 0, len(q.nextBatch()))
+
+		big := bytes.Repeat([]byte{0xff}, maxGossipMsgSize)
+		for i := 0; i < maxOutQueueBytes/maxGossipMsgSize; i++ {
+			require.True(t, q.push(big, false))
+		}
+		// ordinary queue is full, milestones are still accepted
+		require.False(t, q.push(big, false))
+		require.True(t, q.push([]byte{5}, true))
+		require.EqualValues(t, 1, q.numDropped())
+
+		// batch frame fits the maximum payload
+		batch := q.nextBatch()
+		require.EqualValues(t, [][]byte{{5}}, batch)
+		require.True(t, len(encodeGossipBatch(q.nextBatch())) <= MaxPayloadSize)
+	})
+}
+
+// BenchmarkGossip compares gossiping through the outbound queue in batches over the long-lived stream
+// with opening new stream for each transaction
+func BenchmarkGossip(b *testing.B) {
+	// ports different from other tests
+	const (
+		beginPort = BeginPort + 500
+		txSize    = 300
+	)
+	hosts := makeHosts(b, 2, hostsOptions{beginPort: beginPort, noKnownPeers: true, run: true})
+	for i, h := range hosts {
+		ma, err := multiaddr.NewMultiaddr(MultiAddrString(1-i, beginPort+1-i))
+		require.NoError(b, err)
+		require.NoError(b, h.AddPeer(ma, "other"))
+	}
+	id1 := hosts[1].host.ID()
+	require.Eventually(b, func() bool {
+		return hosts[0].PeerIsAlive(id1)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	var received atomic.Int64
+	hosts[1].OnReceiveTxBytes(func(_ peer.ID, _ []byte, _ *txmetadata.TransactionMetadata) {
+		received.Add(1)
+	})
+	const singleProtocol = "/proxima/benchmark/single"
+	hosts[1].host.SetStreamHandler(singleProtocol, func(stream network.Stream) {
+		if _, err := readFrame(stream); err == nil {
+			received.Add(1)
+		}
+		_ = stream.Close()
+	})
+	// waits until all messages are received or no progress for 200 milliseconds. Reports lost messages
+	waitReceived := func(b *testing.B) {
+		last := int64(-1)
+		for received.Load() < int64(b.N) && received.Load() != last {
+			last = received.Load()
+			for i := 0; i < 20 && received.Load() < int64(b.N); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		b.ReportMetric(float64(int64(b.N)-received.Load())/float64(b.N), "lost/op")
+	}
+	txBytes := bytes.Repeat([]byte{0xff}, txSize)
+
+	b.Run("batched", func(b *testing.B) {
+		received.Store(0)
+		for i := 0; i < b.N; i++ {
+			for !hosts[0].SendTxBytesWithMetadataToPeer(id1, txBytes, nil) {
+				// backpressure: peer is slow
+				time.Sleep(time.Millisecond)
+			}
+		}
+		waitReceived(b)
+	})
+	b.Run("stream per tx", func(b *testing.B) {
+		received.Store(0)
+		for i := 0; i < b.N; i++ {
+			stream, err := hosts[0].host.NewStream(hosts[0].Ctx(), id1, singleProtocol)
+			if err != nil {
+				continue
+			}
+			_ = writeFrame(stream, common.ConcatBytes([]byte{0}, txBytes))
+			_ = stream.Close()
+		}
+		waitReceived(b)
+	})
+}
+
+func TestInventoryGossip(t *testing.T) {
+	const (
+		numHosts = 5
+		numTx    = 200
+	)
+	announced := []ledger.TransactionID{ledger.RandomTransactionID(false), ledger.RandomTransactionID(true)}
+	txids, err := decodeInventoryMsg(encodeInventoryMsg(announced...))
+	require.NoError(t, err)
+	require.EqualValues(t, announced, txids)
+	_, err = decodeInventoryMsg([]byte{gossipMsgInventory, 1, 2})
+	require.Error(t, err)
+
+	privKey := testutil.GetTestingPrivateKey()
+	addr := ledger.AddressED25519FromPrivateKey(privKey)
+	firstTxID := ledger.RandomTransactionID(false)
+	firstUTXO := &ledger.OutputWithID{
+		ID: ledger.NewOutputID(&firstTxID, 0),
+		Output: ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(1_000_000).WithLock(addr)
+		}),
+	}
+	txs, err := txbuilder.MakeTransactionSequence(numTx, firstUTXO, privKey)
+	require.NoError(t, err)
+
+	// gossip runs transactions from host 0 through the full mesh of hosts, each re-gossiping new transactions
+	// the way workflow does. Returns total number of bytes sent by all hosts
+	gossip := func(t *testing.T, beginPort int, inventoryGossip bool) uint64 {
+		hosts := makeHosts(t, numHosts, hostsOptions{
+			beginPort: beginPort,
+			adjust: func(_ int, cfg *Config) {
+				cfg.InventoryGossip = inventoryGossip
+			},
+		})
+		defer func() {
+			for _, h := range hosts {
+				h.Stop()
+			}
+		}()
+
+		var mutex sync.Mutex
+		known := make([]set.Set[ledger.TransactionID], numHosts)
+		numKnown := func() (ret int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, k := range known {
+				ret += len(k)
+			}
+			return
+		}
+		// returns true if transaction is new for the host
+		learn := func(i int, txBytes []byte) bool {
+			txid, err := transaction.IDFromTransactionBytes(txBytes)
+			require.NoError(t, err)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if known[i].Contains(txid) {
+				return false
+			}
+			known[i].Insert(txid)
+			return true
+		}
+		for i, h := range hosts {
+			i, h := i, h
+			known[i] = set.New[ledger.TransactionID]()
+			h.OnQueryTxKnown(func(txid *ledger.TransactionID) bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return known[i].Contains(*txid)
+			})
+			h.OnReceiveTxBytes(func(from peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) {
+				if learn(i, txBytes) {
+					h.GossipTxBytesToPeers(txBytes, metadata, from)
+				}
+			})
+			h.Run()
+		}
+		require.Eventually(t, func() bool {
+			for _, h := range hosts {
+				alive, _ := h.NumPeers()
+				if alive != numHosts-1 {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 100*time.Millisecond)
+
+		bytesSent := func() (ret uint64) {
+			for _, h := range hosts {
+				for _, p := range h.PeersInfo() {
+					ret += p.BytesOut
+				}
+			}
+			return
+		}
+		before := bytesSent()
+		for _, txBytes := range txs {
+			learn(0, txBytes)
+			hosts[0].GossipTxBytesToPeers(txBytes, nil)
+		}
+		require.Eventually(t, func() bool {
+			return numKnown() == numHosts*numTx
+		}, 10*time.Second, 50*time.Millisecond)
+		return bytesSent() - before
+	}
+
+	// ports different from other tests
+	pushBytes := gossip(t, BeginPort+600, false)
+	inventoryBytes := gossip(t, BeginPort+650, true)
+	t.Logf("%d hosts, %d transactions: push %s bytes, inventory %s bytes (%.1f%%)", numHosts, numTx,
+		util.GoTh(pushBytes), util.GoTh(inventoryBytes), 100*float64(inventoryBytes)/float64(pushBytes))
+	require.True(t, inventoryBytes < pushBytes/2)
+}
+
+func randomBranchTxID(slot ledger.Slot) ledger.TransactionID {
+	txid := ledger.RandomTransactionID(true)
+	return ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 0), txid.ShortID(), true)
+}
+
+func TestBranchTips(t *testing.T) {
+	const numHosts = 3
+	tips := []ledger.TransactionID{randomBranchTxID(ledger.TimeNow().Slot()), randomBranchTxID(ledger.TimeNow().Slot())}
+	txids, err := decodeBranchTipsMsg(encodeBranchTipsMsg(tips...))
+	require.NoError(t, err)
+	require.EqualValues(t, tips, txids)
+	_, err = decodeBranchTipsMsg(encodeBranchTipsMsg(ledger.RandomTransactionID(false)))
+	require.Error(t, err)
+
+	beginPort := BeginPort + 700
+	hosts := makeHosts(t, numHosts, hostsOptions{beginPort: beginPort})
+	// all hosts respond with the same tips, only host 0 is interested in them
+	var numRequests atomic.Int32
+	for _, h := range hosts {
+		h1 := h
+		h1.OnReceivePullTipsRequest(func(from peer.ID) {
+			numRequests.Add(1)
+			h1.SendBranchTipsToPeer(from, tips)
+		})
+	}
+	received := make(chan peer.ID, numHosts)
+	hosts[0].OnReceiveBranchTips(func(from peer.ID, txids []ledger.TransactionID) {
+		require.EqualValues(t, tips, txids)
+		received <- from
+	})
+	for _, h := range hosts {
+		h.Run()
+	}
+	defer func() {
+		for _, h := range hosts {
+			h.Stop()
+		}
+	}()
+
+	// branch tips are requested from each peer upon connection
+	fromPeers := set.New[peer.ID]()
+	for len(fromPeers) < numHosts-1 {
+		select {
+		case from := <-received:
+			fromPeers.Insert(from)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("branch tips received only from %d peers", len(fromPeers))
+		}
+	}
+	require.EqualValues(t, numHosts-1, numRequests.Load())
+
+	// explicit request
+	require.EqualValues(t, numHosts-1, hosts[0].PullBranchTipsFromAllPeers())
+	for i := 0; i < numHosts-1; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("branch tips not received")
+		}
+	}
+
+	// not requested tips are ignored
+	require.True(t, hosts[1].SendBranchTipsToPeer(hosts[0].host.ID(), tips))
+	select {
+	case <-received:
+		t.Fatalf("unexpected branch tips")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestBulkSync(t *testing.T) {
+	const (
+		numHosts   = 2
+		numBranch  = 8
+		pastCone   = 3000
+		fromSlot   = ledger.Slot(100)
+		toSlot     = fromSlot + MaxSyncSlotsPerRange - 1
+		beginPort  = BeginPort + 800
+		txDataSize = 100
+	)
+	_, _, err := decodeSyncBranchChainMsg(encodeSyncBranchChainMsg(toSlot, fromSlot))
+	require.Error(t, err)
+	_, _, err = decodeSyncBranchChainMsg(encodeSyncBranchChainMsg(fromSlot, toSlot+1))
+	require.Error(t, err)
+	from, to, err := decodeSyncBranchChainMsg(encodeSyncBranchChainMsg(fromSlot, toSlot))
+	require.NoError(t, err)
+	require.EqualValues(t, fromSlot, from)
+	require.EqualValues(t, toSlot, to)
+
+	branches := make([]ledger.TransactionID, numBranch)
+	for i := range branches {
+		branches[i] = randomBranchTxID(fromSlot + ledger.Slot(i))
+	}
+	_, err = decodeSyncPastConeMsg(encodeSyncPastConeMsg(ledger.RandomTransactionID(false)))
+	require.Error(t, err)
+	branchID, err := decodeSyncPastConeMsg(encodeSyncPastConeMsg(branches[0]))
+	require.NoError(t, err)
+	require.EqualValues(t, branches[0], branchID)
+
+	// past cone of each branch is a sequence of numbered items, big enough to be sent in many frames
+	pastConeItem := func(branchIdx, i int) []byte {
+		ret := make([]byte, txDataSize)
+		ret[0] = byte(branchIdx)
+		binary.BigEndian.PutUint32(ret[1:5], uint32(i))
+		return ret
+	}
+
+	hosts := makeHosts(t, numHosts, hostsOptions{beginPort: beginPort})
+	// only host 1 serves sync requests, one at a time. Other requests wait in the queue
+	hosts[1].syncSemaphore = make(chan struct{}, 1)
+	blockedBranch := randomBranchTxID(toSlot)
+	release := make(chan struct{})
+	hosts[1].OnSyncBranchChainRequest(func(fromSlot, toSlot ledger.Slot) []ledger.TransactionID {
+		return branches
+	})
+	hosts[1].OnSyncPastConeRequest(func(branchID ledger.TransactionID, send func(txBytesWithMetadata []byte) bool) {
+		if branchID == blockedBranch {
+			<-release
+			return
+		}
+		idx := slices.Index(branches, branchID)
+		for i := 0; i < pastCone; i++ {
+			if !send(pastConeItem(idx, i)) {
+				return
+			}
+		}
+	})
+	for _, h := range hosts {
+		h.Run()
+	}
+	defer func() {
+		for _, h := range hosts {
+			h.Stop()
+		}
+	}()
+
+	var id peer.ID
+	require.Eventually(t, func() bool {
+		var ok bool
+		id, ok = hosts[0].RandomPeerWithTxStore()
+		return ok
+	}, 5*time.Second, 50*time.Millisecond)
+	require.EqualValues(t, hosts[1].host.ID(), id)
+
+	chain, err := hosts[0].SyncBranchChain(id, fromSlot, toSlot)
+	require.NoError(t, err)
+	require.EqualValues(t, branches, chain)
+
+	// branches outside the requested range are rejected
+	_, err = hosts[0].SyncBranchChain(id, fromSlot+1, toSlot)
+	require.Error(t, err)
+
+	// past cones are downloaded by maximum number of parallel requests of the peer, each in the order of sending
+	idxCh := make(chan int, numBranch)
+	for idx := range branches {
+		idxCh <- idx
+	}
+	close(idxCh)
+	var wg sync.WaitGroup
+	for w := 0; w < MaxSyncRequestsPerPeer; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range idxCh {
+				i := 0
+				n, err := hosts[0].SyncPastCone(id, branches[idx], func(txBytesWithMetadata []byte) {
+					require.EqualValues(t, pastConeItem(idx, i), txBytesWithMetadata)
+					i++
+				})
+				require.NoError(t, err)
+				require.EqualValues(t, pastCone, n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// requests above the limit of the peer are rejected
+	for w := 0; w < MaxSyncRequestsPerPeer; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := hosts[0].SyncPastCone(id, blockedBranch, func([]byte) {})
+			require.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		p := hosts[1].getPeer(hosts[0].host.ID())
+		p.mutex.RLock()
+		defer p.mutex.RUnlock()
+		return p.numSyncRequests == MaxSyncRequestsPerPeer
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = hosts[0].SyncPastCone(id, branches[0], func([]byte) {})
+	require.Error(t, err)
+	close(release)
+	wg.Wait()
+
+	// host 0 does not serve sync requests
+	_, err = hosts[1].SyncBranchChain(hosts[0].host.ID(), fromSlot, toSlot)
+	require.Error(t, err)
+}
+
+func TestNATTraversal(t *testing.T) {
+	const beginPort = BeginPort + 900
+
+	// relayed addresses are advertised only with public addresses of relays
+	announce, err := multiaddr.NewMultiaddr("/ip4/1.2.3.4/tcp/4900")
+	require.NoError(t, err)
+	relayAddr, err := multiaddr.NewMultiaddr(MultiAddrString(0, beginPort))
+	require.NoError(t, err)
+	relayInfo, err := peer.AddrInfoFromP2pAddr(relayAddr)
+	require.NoError(t, err)
+
+	// host 0 is public relay. Hosts 1 and 2 are behind NAT, they know each other only by relayed addresses
+	hosts := makeHosts(t, 3, hostsOptions{
+		beginPort:    beginPort,
+		noKnownPeers: true,
+		adjust: func(i int, cfg *Config) {
+			if i == 0 {
+				cfg.AnnounceAddrs = []multiaddr.Multiaddr{announce}
+				cfg.NAT = NATConfig{AutoNATService: true, RelayService: true, Reachability: ReachabilityPublic}
+				return
+			}
+			cfg.NAT = NATConfig{HolePunching: true, Relays: []peer.AddrInfo{*relayInfo}, Reachability: ReachabilityPrivate}
+			other := 3 - i
+			ma, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/p2p/%s/p2p-circuit/p2p/%s", beginPort, hostID[0], hostID[other]))
+			require.NoError(t, err)
+			cfg.KnownPeers[fmt.Sprintf("peer%d", other)] = ma
+		},
+	})
+	_, err = natOptions(&Config{NAT: NATConfig{Reachability: "wrong"}})
+	require.Error(t, err)
+
+	for _, h := range hosts {
+		h.Run()
+	}
+	defer func() {
+		for _, h := range hosts {
+			h.Stop()
+		}
+	}()
+
+	// relay advertises the announce address instead of the listen address
+	require.EqualValues(t, []multiaddr.Multiaddr{announce}, hosts[0].AdvertisedAddrs())
+	require.Eventually(t, func() bool {
+		return hosts[0].Reachability() == network.ReachabilityPublic.String()
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// hosts behind NAT reserve slots on the relay and advertise relayed addresses
+	for _, h := range hosts[1:] {
+		h1 := h
+		require.Eventually(t, func() bool {
+			return slices.ContainsFunc(h1.AdvertisedAddrs(), isRelayedAddr)
+		}, 10*time.Second, 100*time.Millisecond)
+		require.EqualValues(t, network.ReachabilityPrivate.String(), h1.Reachability())
+	}
+
+	// hosts behind NAT connect to each other through the relay
+	require.Eventually(t, func() bool {
+		alive1, _ := hosts[1].NumPeers()
+		alive2, _ := hosts[2].NumPeers()
+		return alive1 == 1 && alive2 == 1
+	}, 15*time.Second, 100*time.Millisecond)
+	t.Logf("observed addresses of host 1: %v", hosts[1].ObservedAddrs())
+}
+
+func TestSimNet(t *testing.T) {
+	const (
+		numNodes = 50
+		degree   = 3
+		seed     = 12345
+	)
+	link := LinkConfig{Latency: 10 * time.Millisecond, Bandwidth: 1_000_000}
+	sn := NewSimNet(seed, link)
+
+	// random sparse topology: each node knows several random nodes, known peers are symmetric
+	rnd := rand.New(rand.NewSource(seed))
+	cfgs := make([]*Config, numNodes)
+	for i := range cfgs {
+		cfgs[i] = sn.NewConfig()
+	}
+	numKnown := make([]int, numNodes)
+	for i := range cfgs {
+		for _, j := range rnd.Perm(numNodes)[:degree] {
+			name := fmt.Sprintf("peer%d", j)
+			if _, already := cfgs[i].KnownPeers[name]; j == i || already {
+				continue
+			}
+			cfgs[i].KnownPeers[name] = nil
+			cfgs[j].KnownPeers[fmt.Sprintf("peer%d", i)] = nil
+			numKnown[i]++
+			numKnown[j]++
+		}
+	}
+	// addresses are known only after nodes are created
+	hosts := make([]*Peers, numNodes)
+	knownPeers := make([]map[string]multiaddr.Multiaddr, numNodes)
+	for i, cfg := range cfgs {
+		knownPeers[i] = cfg.KnownPeers
+		cfg.KnownPeers = make(map[string]multiaddr.Multiaddr)
+		var err error
+		hosts[i], err = sn.New(global.NewDefault(), cfg)
+		require.NoError(t, err)
+	}
+	for i, h := range hosts {
+		for name := range knownPeers[i] {
+			var j int
+			_, err := fmt.Sscanf(name, "peer%d", &j)
+			require.NoError(t, err)
+			require.NoError(t, h.AddPeer(sn.PeerAddr(hosts[j].SelfID()), name))
+		}
+	}
+
+	// flooding: each node gossips the message to all peers once
+	var mutex sync.Mutex
+	received := make([]set.Set[string], numNodes)
+	for i, h := range hosts {
+		i1, h1 := i, h
+		received[i1] = set.New[string]()
+		h1.OnReceiveTxBytes(func(from peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) {
+			mutex.Lock()
+			seen := received[i1].Contains(string(txBytes))
+			received[i1].Insert(string(txBytes))
+			mutex.Unlock()
+			if !seen {
+				h1.GossipTxBytesToPeers(txBytes, metadata, from)
+			}
+		})
+	}
+	numReceived := func(msg string, idx ...int) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		ret := 0
+		for _, i := range idx {
+			if received[i].Contains(msg) {
+				ret++
+			}
+		}
+		return ret
+	}
+	all := make([]int, numNodes)
+	for i := range all {
+		all[i] = i
+	}
+	// originates the message at the node and measures time until it is received by all nodes from the list
+	flood := func(msg string, origin int, idx ...int) time.Duration {
+		mutex.Lock()
+		received[origin].Insert(msg)
+		mutex.Unlock()
+
+		start := time.Now()
+		hosts[origin].GossipTxBytesToPeers([]byte(msg), nil)
+		require.Eventually(t, func() bool {
+			return numReceived(msg, idx...) == len(idx)
+		}, 10*time.Second, 5*time.Millisecond)
+		return time.Since(start)
+	}
+	allAlive := func(idx ...int) func() bool {
+		return func() bool {
+			for _, i := range idx {
+				if alive, _ := hosts[i].NumPeers(); alive < numKnown[i] {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	for _, h := range hosts {
+		h.Run()
+	}
+	defer func() {
+		for _, h := range hosts {
+			h.Stop()
+		}
+		require.NoError(t, sn.Close())
+	}()
+	require.Eventually(t, allAlive(all...), 10*time.Second, 50*time.Millisecond)
+
+	t.Run("convergence", func(t *testing.T) {
+		d := flood("msg1", 0, all...)
+		t.Logf("%d nodes converged in %v with latency %v", numNodes, d, link.Latency)
+	})
+	t.Run("loss", func(t *testing.T) {
+		const numMsg = 20
+		lossy := link
+		lossy.Loss = 0.1
+		for i := 1; i < numNodes; i++ {
+			sn.SetLink(hosts[0].SelfID(), hosts[i].SelfID(), lossy)
+		}
+		framesBefore, droppedBefore := sn.Stats()
+		for i := 0; i < numMsg; i++ {
+			msg := fmt.Sprintf("lossy%d", i)
+			mutex.Lock()
+			received[0].Insert(msg)
+			mutex.Unlock()
+			hosts[0].GossipTxBytesToPeers([]byte(msg), nil)
+			// not batched, each message is sent in its own frame
+			time.Sleep(20 * time.Millisecond)
+		}
+		// message which left the node through at least one link is delivered to all nodes by redundancy of flooding
+		time.Sleep(500 * time.Millisecond)
+		delivered := 0
+		for i := 0; i < numMsg; i++ {
+			if n := numReceived(fmt.Sprintf("lossy%d", i), all...); n > 1 {
+				require.EqualValues(t, numNodes, n)
+				delivered++
+			}
+		}
+		frames, dropped := sn.Stats()
+		require.True(t, dropped > droppedBefore)
+		t.Logf("delivered %d messages of %d. Frames: %d, dropped: %d", delivered, numMsg, frames-framesBefore, dropped-droppedBefore)
+		for i := 1; i < numNodes; i++ {
+			sn.SetLink(hosts[0].SelfID(), hosts[i].SelfID(), link)
+		}
+	})
+	t.Run("reproducible losses", func(t *testing.T) {
+		// losses of the link depend only on the seed and on the number of frames sent over the link
+		const numFrames = 1000
+		lossy := link
+		lossy.Loss = 0.3
+		losses := func(sn1 *SimNet, interleave bool) []bool {
+			ret := make([]bool, numFrames)
+			for i := range ret {
+				if interleave {
+					sn1.dropFrame(hosts[2].SelfID(), hosts[1].SelfID())
+				}
+				ret[i] = sn1.dropFrame(hosts[0].SelfID(), hosts[1].SelfID())
+			}
+			return ret
+		}
+		seq := losses(NewSimNet(seed, lossy), false)
+		require.EqualValues(t, seq, losses(NewSimNet(seed, lossy), true))
+		require.NotEqualValues(t, seq, losses(NewSimNet(seed+1, lossy), false))
+		require.Contains(t, seq, true)
+		require.Contains(t, seq, false)
+	})
+	t.Run("partition", func(t *testing.T) {
+		half := make([]peer.ID, 0, numNodes/2)
+		for i := 0; i < numNodes/2; i++ {
+			half = append(half, hosts[i].SelfID())
+		}
+		require.NoError(t, sn.Partition(half))
+
+		// message originated in one partition does not reach the other one
+		d := flood("msg2", 0)
+		time.Sleep(500 * time.Millisecond)
+		t.Logf("message is known to %d nodes of %d after %v", numReceived("msg2", all...), numNodes, d)
+		require.EqualValues(t, 0, numReceived("msg2", all[numNodes/2:]...))
+
+		require.NoError(t, sn.Heal())
+		require.Eventually(t, allAlive(all...), 10*time.Second, 50*time.Millisecond)
+		d = flood("msg3", numNodes-1, all...)
+		t.Logf("%d nodes converged in %v after healing", numNodes, d)
+	})
+}
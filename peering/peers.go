@@ -14,7 +14,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
-	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
@@ -34,6 +34,31 @@ type (
 		HostID           peer.ID
 		HostPort         int
 		KnownPeers       map[string]multiaddr.Multiaddr // name -> PeerAddr
+		// transport security: SecurityNoise (default), SecurityTLS or SecurityNone
+		Security string
+		// if not 0, QUIC transport is enabled on the UDP port in addition to TCP
+		QUICPort int
+		// if not empty, advertised to peers instead of listen addresses
+		AnnounceAddrs []multiaddr.Multiaddr
+		// NAT traversal, all opt-in
+		NAT NATConfig
+		// if true, only known peers are allowed to connect
+		AllowKnownPeersOnly bool
+		// auto-peering. Known peers are static, they are never dropped
+		AutoPeering bool
+		// if number of alive peers is below MinPeers, discovery asks all alive peers
+		MinPeers int
+		// maximum number of peers, including static
+		MaxPeers int
+		// discovery of peers in the local network
+		MDNS bool
+		// file where discovered peers are saved. Empty means discovered peers are not saved
+		PeersFile       string
+		DiscoveryPeriod time.Duration
+		// file where reputation of peers is saved. Empty means reputation is not saved
+		ReputationFile string
+		// if true, transactions are announced to peers by ID and pulled by peers. Sequencer milestones are always pushed
+		InventoryGossip bool
 	}
 
 	Peers struct {
@@ -47,10 +72,31 @@ type (
 		onReceiveTx       func(from peer.ID, txBytes []byte, mdata *txmetadata.TransactionMetadata)
 		onReceivePullTx   func(from peer.ID, txids []ledger.TransactionID)
 		onReceivePullTips func(from peer.ID)
+		// nil if the node is not interested in branch tips of peers
+		onReceiveBranchTips func(from peer.ID, txids []ledger.TransactionID)
+		isKnownTx           func(txid *ledger.TransactionID) bool
+		// nil if the node does not serve sync requests
+		onSyncBranchChain func(fromSlot, toSlot ledger.Slot) []ledger.TransactionID
+		onSyncPastCone    func(branchID ledger.TransactionID, send func(txBytesWithMetadata []byte) bool)
+		syncSemaphore     chan struct{}
 		// lpp protocol names
 		lppProtocolGossip    protocol.ID
 		lppProtocolPull      protocol.ID
 		lppProtocolHeartbeat protocol.ID
+		// heartbeat with library version. Nodes which do not know library versions only support lppProtocolHeartbeat
+		lppProtocolHeartbeatVersioned protocol.ID
+		lppProtocolPeers              protocol.ID
+		lppProtocolSync               protocol.ID
+		// gossip with one transaction per stream. Nodes which do not support batches only support lppProtocolGossipLegacy
+		lppProtocolGossipLegacy protocol.ID
+		// hash of the base library, used in protocol and mDNS service names
+		libraryHashUint64 uint64
+		mdns              mdns.Service
+		// nil if any peer is allowed to connect
+		allowList    *allowListGater
+		reputation   *reputationBook
+		inventory    *inventory
+		reachability reachabilityTracker
 	}
 
 	Peer struct {
@@ -60,7 +106,24 @@ type (
 		lastActivity           time.Time
 		blockActivityUntil     time.Time
 		hasTxStore             bool
+		libraryVersion         byte
 		needsLogLostConnection bool
+		// static peers are configured. Dynamic peers are discovered by auto-peering
+		isStatic bool
+		addedAt  time.Time
+		// traffic counters
+		msgIn    uint64
+		msgOut   uint64
+		bytesIn  uint64
+		bytesOut uint64
+		// outbound gossip queue, created on first send
+		outQueue *outQueue
+		// branch tips are requested from the peer when it is connected
+		needsBranchTips bool
+		// branch tips response is expected from the peer until the deadline
+		branchTipsDeadline time.Time
+		// number of sync requests of the peer being served or waiting to be served
+		numSyncRequests int
 	}
 )
 
@@ -70,14 +133,18 @@ const (
 )
 
 const (
-	// protocol name templates. Last component is first 8 bytes of ledger constraint library hash, interpreted as bigendian uint64
-	// Peering is only possible between same versions of the ledger.
-	// Nodes with different versions of the ledger constraints will just ignore each other
-	lppProtocolGossip    = "/proxima/gossip/%d"
+	// protocol name templates. Last component is first 8 bytes of the hash of the version 0 of the ledger constraint library,
+	// interpreted as bigendian uint64. Nodes with different base library will just ignore each other.
+	// Nodes with different versions of the library on top of the same base negotiate compatibility via heartbeat
+	lppProtocolGossip    = "/proxima/gossip/batch/%d"
 	lppProtocolPull      = "/proxima/pull/%d"
 	lppProtocolHeartbeat = "/proxima/heartbeat/%d"
+	// heartbeat protocol with library version. Protocol of the legacy heartbeat is negotiated with nodes which don't support it
+	lppProtocolHeartbeatVersioned = "/proxima/heartbeat/versioned/%d"
+	// gossip protocol without batches. It is negotiated with nodes which don't support the batch gossip protocol
+	lppProtocolGossipLegacy = "/proxima/gossip/%d"
 
-	// blocking communications with the peer which violates the protocol
+	// blocking communications with the peer with incompatible library. Also duration of the first ban of misbehaving peer
 	commBlockDuration = time.Minute
 
 	// clockTolerance is how big the difference between local and remote clocks is tolerated
@@ -90,6 +157,9 @@ func NewPeersDummy() *Peers {
 		onReceiveTx:       func(_ peer.ID, _ []byte, _ *txmetadata.TransactionMetadata) {},
 		onReceivePullTx:   func(_ peer.ID, _ []ledger.TransactionID) {},
 		onReceivePullTips: func(_ peer.ID) {},
+		isKnownTx:         func(_ *ledger.TransactionID) bool { return false },
+		reputation:        newReputationBook(),
+		inventory:         newInventory(),
 	}
 }
 
@@ -98,31 +168,71 @@ func New(env Environment, cfg *Config) (*Peers, error) {
 	if err != nil {
 		return nil, fmt.Errorf("wrong private key: %w", err)
 	}
-	lppHost, err := libp2p.New(
-		libp2p.Identity(hostIDPrivateKey),
-		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", cfg.HostPort)),
-		libp2p.Transport(tcp.NewTCPTransport),
-		libp2p.NoSecurity,
-	)
+	opts, allowList, err := transportOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lppHost, err := libp2p.New(append(opts, libp2p.Identity(hostIDPrivateKey))...)
 	if err != nil {
 		return nil, fmt.Errorf("unable create libp2p host: %w", err)
 	}
+	return newPeers(env, cfg, lppHost, allowList)
+}
 
-	ledgerLibraryHash := ledger.L().Library.LibraryHash()
+// newPeers creates Peers on top of the libp2p host, real or simulated
+func newPeers(env Environment, cfg *Config, lppHost host.Host, allowList *allowListGater) (*Peers, error) {
+	// protocol names are based on the version 0 of the library, so that nodes with different versions can
+	// talk to each other. Compatibility of versions is checked by the heartbeat protocol
+	ledgerLibraryHash := ledger.L().BaseLibraryHash()
 	ledgerIDUint64 := binary.BigEndian.Uint64(ledgerLibraryHash[:8])
 
 	ret := &Peers{
-		Environment:          env,
-		cfg:                  cfg,
-		stopHeartbeatChan:    make(chan struct{}),
-		host:                 lppHost,
-		peers:                make(map[peer.ID]*Peer),
-		onReceiveTx:          func(_ peer.ID, _ []byte, _ *txmetadata.TransactionMetadata) {},
-		onReceivePullTx:      func(_ peer.ID, _ []ledger.TransactionID) {},
-		onReceivePullTips:    func(_ peer.ID) {},
-		lppProtocolGossip:    protocol.ID(fmt.Sprintf(lppProtocolGossip, ledgerIDUint64)),
-		lppProtocolPull:      protocol.ID(fmt.Sprintf(lppProtocolPull, ledgerIDUint64)),
-		lppProtocolHeartbeat: protocol.ID(fmt.Sprintf(lppProtocolHeartbeat, ledgerIDUint64)),
+		Environment:                   env,
+		cfg:                           cfg,
+		stopHeartbeatChan:             make(chan struct{}),
+		host:                          lppHost,
+		peers:                         make(map[peer.ID]*Peer),
+		onReceiveTx:                   func(_ peer.ID, _ []byte, _ *txmetadata.TransactionMetadata) {},
+		onReceivePullTx:               func(_ peer.ID, _ []ledger.TransactionID) {},
+		onReceivePullTips:             func(_ peer.ID) {},
+		isKnownTx:                     func(_ *ledger.TransactionID) bool { return false },
+		lppProtocolGossip:             protocol.ID(fmt.Sprintf(lppProtocolGossip, ledgerIDUint64)),
+		lppProtocolPull:               protocol.ID(fmt.Sprintf(lppProtocolPull, ledgerIDUint64)),
+		lppProtocolHeartbeat:          protocol.ID(fmt.Sprintf(lppProtocolHeartbeat, ledgerIDUint64)),
+		lppProtocolHeartbeatVersioned: protocol.ID(fmt.Sprintf(lppProtocolHeartbeatVersioned, ledgerIDUint64)),
+		lppProtocolPeers:              protocol.ID(fmt.Sprintf(lppProtocolPeers, ledgerIDUint64)),
+		lppProtocolSync:               protocol.ID(fmt.Sprintf(lppProtocolSync, ledgerIDUint64)),
+		lppProtocolGossipLegacy:       protocol.ID(fmt.Sprintf(lppProtocolGossipLegacy, ledgerIDUint64)),
+		syncSemaphore:                 make(chan struct{}, maxConcurrentSyncRequests),
+		libraryHashUint64:             ledgerIDUint64,
+		allowList:                     allowList,
+		reputation:                    newReputationBook(),
+		inventory:                     newInventory(),
+	}
+	var err error
+	if err = ret.trackReachability(); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to reachability events: %w", err)
+	}
+	ret.reputation.registerMetrics(env.MetricsRegistry())
+	if cfg.ReputationFile != "" {
+		if err = ret.reputation.load(cfg.ReputationFile); err != nil {
+			return nil, fmt.Errorf("failed to load reputation of peers from %s: %w", cfg.ReputationFile, err)
+		}
+	}
+	if cfg.AllowKnownPeersOnly {
+		// only known peers can connect, so there is nothing to discover
+		cfg.AutoPeering = false
+	}
+	if cfg.AutoPeering {
+		if cfg.MaxPeers <= 0 {
+			cfg.MaxPeers = defaultMaxPeers
+		}
+		if cfg.MinPeers <= 0 || cfg.MinPeers > cfg.MaxPeers {
+			cfg.MinPeers = min(defaultMinPeers, cfg.MaxPeers)
+		}
+		if cfg.DiscoveryPeriod <= 0 {
+			cfg.DiscoveryPeriod = defaultDiscoveryPeriod
+		}
 	}
 
 	for name, maddr := range cfg.KnownPeers {
@@ -130,6 +240,9 @@ func New(env Environment, cfg *Config) (*Peers, error) {
 			return nil, err
 		}
 	}
+	if cfg.AutoPeering {
+		ret.loadDynamicPeers()
+	}
 	return ret, nil
 }
 
@@ -150,6 +263,35 @@ func readPeeringConfig() (*Config, error) {
 		return nil, fmt.Errorf("host.private_key: wrong host id private key size")
 	}
 	cfg.HostIDPrivateKey = pkBin
+	cfg.Security = viper.GetString("peering.host.security")
+	cfg.QUICPort = viper.GetInt("peering.host.quic_port")
+	cfg.AllowKnownPeersOnly = viper.GetBool("peering.allow_known_peers_only")
+	for _, addrString := range viper.GetStringSlice("peering.host.announce_addrs") {
+		maddr, err := multiaddr.NewMultiaddr(addrString)
+		if err != nil {
+			return nil, fmt.Errorf("peering.host.announce_addrs: can't parse multiaddress: %w", err)
+		}
+		cfg.AnnounceAddrs = append(cfg.AnnounceAddrs, maddr)
+	}
+	cfg.NAT.PortMap = viper.GetBool("peering.nat.port_map")
+	cfg.NAT.AutoNATService = viper.GetBool("peering.nat.autonat_service")
+	cfg.NAT.HolePunching = viper.GetBool("peering.nat.hole_punching")
+	cfg.NAT.RelayService = viper.GetBool("peering.nat.relay_service")
+	cfg.NAT.Reachability = viper.GetString("peering.nat.reachability")
+	relayNames := util.KeysSorted(viper.GetStringMap("peering.nat.relays"), func(k1, k2 string) bool {
+		return k1 < k2
+	})
+	for _, name := range relayNames {
+		maddr, err := multiaddr.NewMultiaddr(viper.GetString("peering.nat.relays." + name))
+		if err != nil {
+			return nil, fmt.Errorf("peering.nat.relays: can't parse multiaddress: %w", err)
+		}
+		info, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("peering.nat.relays: %w", err)
+		}
+		cfg.NAT.Relays = append(cfg.NAT.Relays, *info)
+	}
 
 	encodedHostID := viper.GetString("peering.host.id")
 	cfg.HostID, err = peer.Decode(encodedHostID)
@@ -175,6 +317,15 @@ func readPeeringConfig() (*Config, error) {
 			return nil, fmt.Errorf("can't parse multiaddress: %w", err)
 		}
 	}
+
+	cfg.AutoPeering = viper.GetBool("peering.autopeering.enable")
+	cfg.MinPeers = viper.GetInt("peering.autopeering.min_peers")
+	cfg.MaxPeers = viper.GetInt("peering.autopeering.max_peers")
+	cfg.MDNS = viper.GetBool("peering.autopeering.mdns")
+	cfg.PeersFile = viper.GetString("peering.autopeering.peers_file")
+	cfg.DiscoveryPeriod = time.Duration(viper.GetInt("peering.autopeering.period_sec")) * time.Second
+	cfg.ReputationFile = viper.GetString("peering.reputation_file")
+	cfg.InventoryGossip = viper.GetBool("peering.inventory_gossip")
 	return cfg, nil
 }
 
@@ -195,16 +346,31 @@ func (ps *Peers) Run() {
 	ps.Environment.MarkWorkProcessStarted(Name)
 
 	ps.host.SetStreamHandler(ps.lppProtocolGossip, ps.gossipStreamHandler)
+	ps.host.SetStreamHandler(ps.lppProtocolGossipLegacy, ps.legacyGossipStreamHandler)
 	ps.host.SetStreamHandler(ps.lppProtocolPull, ps.pullStreamHandler)
 	ps.host.SetStreamHandler(ps.lppProtocolHeartbeat, ps.heartbeatStreamHandler)
+	ps.host.SetStreamHandler(ps.lppProtocolHeartbeatVersioned, ps.heartbeatStreamHandler)
+	ps.host.SetStreamHandler(ps.lppProtocolSync, ps.syncStreamHandler)
 
 	go ps.heartbeatLoop()
+	go ps.reputationLoop()
+	if ps.cfg.InventoryGossip {
+		go ps.inventoryLoop()
+	}
+	if ps.cfg.AutoPeering {
+		ps.host.SetStreamHandler(ps.lppProtocolPeers, ps.peersStreamHandler)
+		go ps.autopeeringLoop()
+		if ps.cfg.MDNS {
+			ps.startMDNS(ps.libraryHashUint64)
+		}
+	}
 	go func() {
 		<-ps.Environment.Ctx().Done()
 		ps.Stop()
 	}()
 
-	ps.Log().Infof("libp2p host %s (self) started on %v with %d configured known peers", ShortPeerIDString(ps.host.ID()), ps.host.Addrs(), len(ps.cfg.KnownPeers))
+	ps.Log().Infof("libp2p host %s (self) started on %v with %d configured known peers, auto-peering: %v, inventory gossip: %v, relays: %d",
+		ShortPeerIDString(ps.host.ID()), ps.host.Addrs(), len(ps.cfg.KnownPeers), ps.cfg.AutoPeering, ps.cfg.InventoryGossip, len(ps.cfg.NAT.Relays))
 	_ = ps.Log().Sync()
 }
 
@@ -214,6 +380,13 @@ func (ps *Peers) Stop() {
 
 		ps.Log().Infof("stopping libp2p host %s (self)..", ShortPeerIDString(ps.host.ID()))
 		_ = ps.Log().Sync()
+		if ps.cfg.AutoPeering {
+			ps.saveDynamicPeers()
+		}
+		ps.saveReputation()
+		if ps.mdns != nil {
+			_ = ps.mdns.Close()
+		}
 		close(ps.stopHeartbeatChan)
 		_ = ps.host.Close()
 		ps.Log().Infof("libp2p host %s (self) has been stopped", ShortPeerIDString(ps.host.ID()))
@@ -228,11 +401,26 @@ func (ps *Peers) AddPeer(maddr multiaddr.Multiaddr, name string) error {
 	if err != nil {
 		return fmt.Errorf("can't get multiaddress info: %v", err)
 	}
+	if info.ID == ps.host.ID() {
+		return fmt.Errorf("can't add self as a peer")
+	}
 	ps.host.Peerstore().AddAddr(info.ID, maddr, peerstore.PermanentAddrTTL)
-	if _, already := ps.peers[info.ID]; !already {
+	if ps.allowList != nil {
+		ps.allowList.allow(info.ID)
+	}
+	if p, already := ps.peers[info.ID]; already {
+		// dynamic peer becomes static
+		p.mutex.Lock()
+		p.name = name
+		p.isStatic = true
+		p.mutex.Unlock()
+	} else {
 		ps.peers[info.ID] = &Peer{
-			name: name,
-			id:   info.ID,
+			name:     name,
+			id:       info.ID,
+			isStatic: true,
+			// ban of the misbehaving peer remains in force
+			blockActivityUntil: ps.reputation.bannedUntil(info.ID),
 		}
 	}
 	return nil
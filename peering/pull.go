@@ -22,6 +22,7 @@ const (
 
 	PullRequestTransactions = byte(iota)
 	PullRequestBranchTips
+	PullResponseBranchTips
 )
 
 func (ps *Peers) pullStreamHandler(stream network.Stream) {
@@ -45,11 +46,12 @@ func (ps *Peers) pullStreamHandler(stream network.Stream) {
 		_ = stream.Reset()
 		return
 	}
+	p.evidenceMsgIn(len(msgData))
 	if err = ps.processPullFrame(msgData, p); err != nil {
 		ps.Log().Errorf("error while decoding message from peer %s: %v", id.String(), err)
+		ps.evidenceReputation(id, eventMalformedFrame)
 		_ = stream.Reset()
 		return
-
 	}
 	_ = stream.Close()
 }
@@ -65,7 +67,10 @@ func (ps *Peers) processPullFrame(msgData []byte, p *Peer) error {
 			return err
 		}
 		p.evidenceActivity(ps, "pullTx")
-		ps.onReceivePullTx(p.id, txLst)
+		// recently announced transactions are responded immediately, the rest is passed to the pull server
+		if txLst = ps.respondFromInventory(p, txLst); len(txLst) > 0 {
+			ps.onReceivePullTx(p.id, txLst)
+		}
 
 	case PullRequestBranchTips:
 		if err := decodePullBranchTipsMsg(msgData); err != nil {
@@ -74,6 +79,14 @@ func (ps *Peers) processPullFrame(msgData []byte, p *Peer) error {
 		p.evidenceActivity(ps, "pullTips")
 		ps.onReceivePullTips(p.id)
 
+	case PullResponseBranchTips:
+		txids, err := decodeBranchTipsMsg(msgData)
+		if err != nil {
+			return err
+		}
+		p.evidenceActivity(ps, "branchTips")
+		ps.processBranchTips(p, txids)
+
 	default:
 		return fmt.Errorf("unsupported type of the pull message %d", msgData[0])
 	}
@@ -81,13 +94,7 @@ func (ps *Peers) processPullFrame(msgData []byte, p *Peer) error {
 }
 
 func (ps *Peers) sendPullTransactionsToPeer(id peer.ID, txLst ...ledger.TransactionID) {
-	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolPull)
-	if err != nil {
-		return
-	}
-	defer stream.Close()
-
-	_ = writeFrame(stream, encodePullTransactionsMsg(txLst...))
+	ps.sendMsgOnPullProtocol(id, encodePullTransactionsMsg(txLst...))
 }
 
 // PullTransactionsFromRandomPeer sends pull request to the random peer which has txStore
@@ -108,6 +115,7 @@ func (ps *Peers) PullTransactionsFromRandomPeer(txids ...ledger.TransactionID) b
 				func() any { return _txidLst(txids...) },
 			)
 
+			ps.reputation.expectPull(rndID, txids...)
 			ps.sendPullTransactionsToPeer(rndID, txids...)
 			return true
 		}
@@ -124,11 +132,20 @@ func _txidLst(txids ...ledger.TransactionID) string {
 }
 
 func encodePullTransactionsMsg(txids ...ledger.TransactionID) []byte {
+	return encodeTxIDList(PullRequestTransactions, txids...)
+}
+
+func decodePullTransactionsMsg(data []byte) ([]ledger.TransactionID, error) {
+	return decodeTxIDList(PullRequestTransactions, data)
+}
+
+// encodeTxIDList encodes message of the given type with the list of transaction IDs
+func encodeTxIDList(msgType byte, txids ...ledger.TransactionID) []byte {
 	util.Assertf(len(txids) <= MaxNumTransactionID, "number of transactions IDS %d exceed maximum %d", len(txids), MaxNumTransactionID)
 
 	var buf bytes.Buffer
 	// write request type byte
-	buf.WriteByte(PullRequestTransactions)
+	buf.WriteByte(msgType)
 	// write number of transactions
 	var size [2]byte
 	binary.BigEndian.PutUint16(size[:], uint16(len(txids)))
@@ -140,9 +157,9 @@ func encodePullTransactionsMsg(txids ...ledger.TransactionID) []byte {
 	return buf.Bytes()
 }
 
-func decodePullTransactionsMsg(data []byte) ([]ledger.TransactionID, error) {
-	if len(data) < 3 || data[0] != PullRequestTransactions {
-		return nil, fmt.Errorf("not a pull txransactions message")
+func decodeTxIDList(msgType byte, data []byte) ([]ledger.TransactionID, error) {
+	if len(data) < 3 || data[0] != msgType {
+		return nil, fmt.Errorf("not a transaction ID list message of type %d", msgType)
 	}
 	// read size of array
 	ret := make([]ledger.TransactionID, binary.BigEndian.Uint16(data[1:3]))
@@ -151,7 +168,7 @@ func decodePullTransactionsMsg(data []byte) ([]ledger.TransactionID, error) {
 	for i := range ret {
 		n, err := rdr.Read(txid[:])
 		if err != nil || n != ledger.TransactionIDLength {
-			return nil, fmt.Errorf("DecodePeerMessageQueryTransactions: wrong msg data")
+			return nil, fmt.Errorf("decodeTxIDList: wrong msg data")
 		}
 		ret[i], err = ledger.TransactionIDFromBytes(txid[:])
 		common.AssertNoError(err)
@@ -0,0 +1,385 @@
+package peering
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reputation of peers. Each peer has a score, which is decreased on misbehavior and increased on useful activity.
+// When score drops to banScoreThreshold, communications with the peer are blocked. Each next ban lasts twice as long
+// as the previous one. Static (configured) peers are trusted by the operator, so they are never banned, only scored. Reputation is kept by peer ID, also for peers which were dropped, so that misbehaving peer
+// is not trusted again after being re-discovered. Reputation is persisted in the file, if configured
+
+type (
+	reputationEvent byte
+
+	reputation struct {
+		Score       int       `json:"score"`
+		NumBans     int       `json:"num_bans"`
+		BannedUntil time.Time `json:"banned_until"`
+	}
+
+	pendingPull struct {
+		from     peer.ID
+		deadline time.Time
+	}
+
+	reputationBook struct {
+		mutex   sync.Mutex
+		records map[peer.ID]*reputation
+		// pull requests waiting for response
+		pendingPulls map[ledger.TransactionID]pendingPull
+		// transactions delivered by gossip. Used to detect first deliveries
+		delivered map[ledger.TransactionIDVeryShort4]time.Time
+		metrics   *reputationMetrics
+	}
+
+	reputationMetrics struct {
+		events      *prometheus.CounterVec
+		bans        prometheus.Counter
+		scores      *prometheus.GaugeVec
+		bannedPeers prometheus.Gauge
+	}
+)
+
+const (
+	eventInvalidTx = reputationEvent(iota)
+	eventMalformedFrame
+	eventClockDrift
+	eventUnansweredPull
+	eventFirstDelivery
+)
+
+var reputationEventNames = [...]string{
+	eventInvalidTx:      "invalid_tx",
+	eventMalformedFrame: "malformed_frame",
+	eventClockDrift:     "clock_drift",
+	eventUnansweredPull: "unanswered_pull",
+	eventFirstDelivery:  "first_delivery",
+}
+
+var reputationEventScores = [...]int{
+	eventInvalidTx:      -20,
+	eventMalformedFrame: -20,
+	eventClockDrift:     -10,
+	eventUnansweredPull: -2,
+	eventFirstDelivery:  1,
+}
+
+const (
+	maxScore          = 100
+	banScoreThreshold = -50
+	// first ban lasts commBlockDuration, each next one twice as long
+	maxBanDuration = 24 * time.Hour
+	// scores drift back to 0 by one point each period
+	scoreDecayPeriod     = time.Minute
+	reputationLoopPeriod = time.Second
+	pullResponseTimeout  = 5 * time.Second
+	maxPendingPulls      = 10_000
+	deliveredTTL         = time.Minute
+)
+
+func (e reputationEvent) String() string {
+	return reputationEventNames[e]
+}
+
+func newReputationBook() *reputationBook {
+	return &reputationBook{
+		records:      make(map[peer.ID]*reputation),
+		pendingPulls: make(map[ledger.TransactionID]pendingPull),
+		delivered:    make(map[ledger.TransactionIDVeryShort4]time.Time),
+	}
+}
+
+func (r *reputationBook) registerMetrics(reg *prometheus.Registry) {
+	r.metrics = &reputationMetrics{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "peering_reputationEvents",
+			Help: "number of reputation events by type",
+		}, []string{"event"}),
+		bans: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "peering_bans",
+			Help: "number of bans of misbehaving peers",
+		}),
+		scores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "peering_peerScore",
+			Help: "reputation score of the peer",
+		}, []string{"peer_id"}),
+		bannedPeers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "peering_bannedPeers",
+			Help: "number of currently banned peers",
+		}),
+	}
+	reg.MustRegister(r.metrics.events, r.metrics.bans, r.metrics.scores, r.metrics.bannedPeers)
+}
+
+// apply updates score of the peer. Returns ban duration if the peer was banned by the event, otherwise 0.
+// Peer exempted from bans keeps its score
+func (r *reputationBook) apply(id peer.ID, evt reputationEvent, exemptFromBan bool) time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rep := r.records[id]
+	if rep == nil {
+		rep = &reputation{}
+		r.records[id] = rep
+	}
+	rep.Score = min(rep.Score+reputationEventScores[evt], maxScore)
+
+	var banFor time.Duration
+	if rep.Score <= banScoreThreshold && !exemptFromBan && !rep.BannedUntil.After(time.Now()) {
+		banFor = banDuration(rep.NumBans)
+		rep.NumBans++
+		rep.BannedUntil = time.Now().Add(banFor)
+		// after the ban the peer starts from scratch, but the next ban will be longer
+		rep.Score = 0
+	}
+	if r.metrics != nil {
+		r.metrics.events.WithLabelValues(evt.String()).Inc()
+		r.metrics.scores.WithLabelValues(id.String()).Set(float64(rep.Score))
+		if banFor > 0 {
+			r.metrics.bans.Inc()
+		}
+	}
+	return banFor
+}
+
+func banDuration(numPreviousBans int) time.Duration {
+	ret := commBlockDuration
+	for i := 0; i < numPreviousBans && ret < maxBanDuration; i++ {
+		ret *= 2
+	}
+	return min(ret, maxBanDuration)
+}
+
+func (r *reputationBook) get(id peer.ID) reputation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if rep := r.records[id]; rep != nil {
+		return *rep
+	}
+	return reputation{}
+}
+
+func (r *reputationBook) bannedUntil(id peer.ID) time.Time {
+	return r.get(id).BannedUntil
+}
+
+func (r *reputationBook) isBanned(id peer.ID) bool {
+	return r.bannedUntil(id).After(time.Now())
+}
+
+// unban lifts the ban and resets score. History of bans remains
+func (r *reputationBook) unban(id peer.ID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if rep := r.records[id]; rep != nil {
+		rep.BannedUntil = time.Time{}
+		rep.Score = 0
+		if r.metrics != nil {
+			r.metrics.scores.WithLabelValues(id.String()).Set(0)
+		}
+	}
+}
+
+// expectPull remembers pull request, which is expected to be answered by the peer within pullResponseTimeout
+func (r *reputationBook) expectPull(from peer.ID, txids ...ledger.TransactionID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deadline := time.Now().Add(pullResponseTimeout)
+	for i := range txids {
+		if len(r.pendingPulls) >= maxPendingPulls {
+			return
+		}
+		r.pendingPulls[txids[i]] = pendingPull{from: from, deadline: deadline}
+	}
+}
+
+// txDelivered registers transaction received from the peer. Returns true if it is the first delivery of it by gossip
+func (r *reputationBook) txDelivered(from peer.ID, txid *ledger.TransactionID, responseToPull bool) (firstDelivery bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if pending, found := r.pendingPulls[*txid]; found && pending.from == from {
+		delete(r.pendingPulls, *txid)
+	}
+	vsID := txid.VeryShortID4()
+	if _, already := r.delivered[vsID]; already {
+		return false
+	}
+	r.delivered[vsID] = time.Now().Add(deliveredTTL)
+	return !responseToPull
+}
+
+// purgeExpired removes expired pending pulls and delivered transactions.
+// Returns peers which did not respond to pulls in time, one for each unanswered pull request
+func (r *reputationBook) purgeExpired() []peer.ID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	nowis := time.Now()
+	ret := make([]peer.ID, 0)
+	for txid, pending := range r.pendingPulls {
+		if pending.deadline.Before(nowis) {
+			ret = append(ret, pending.from)
+			delete(r.pendingPulls, txid)
+		}
+	}
+	for vsID, ttl := range r.delivered {
+		if ttl.Before(nowis) {
+			delete(r.delivered, vsID)
+		}
+	}
+	return ret
+}
+
+// decay moves scores one point towards 0 and forgets neutral records
+func (r *reputationBook) decay() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	nowis := time.Now()
+	numBanned := 0
+	for id, rep := range r.records {
+		switch {
+		case rep.Score > 0:
+			rep.Score--
+		case rep.Score < 0:
+			rep.Score++
+		}
+		banned := rep.BannedUntil.After(nowis)
+		if banned {
+			numBanned++
+		}
+		if rep.Score == 0 && rep.NumBans == 0 && !banned {
+			delete(r.records, id)
+			if r.metrics != nil {
+				r.metrics.scores.DeleteLabelValues(id.String())
+			}
+			continue
+		}
+		if r.metrics != nil {
+			r.metrics.scores.WithLabelValues(id.String()).Set(float64(rep.Score))
+		}
+	}
+	if r.metrics != nil {
+		r.metrics.bannedPeers.Set(float64(numBanned))
+	}
+}
+
+func (r *reputationBook) save(fname string) error {
+	r.mutex.Lock()
+	records := make(map[string]reputation, len(r.records))
+	for id, rep := range r.records {
+		records[id.String()] = *rep
+	}
+	r.mutex.Unlock()
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, data, 0666)
+}
+
+// load reads reputation saved by the previous run. Non-existent file is not an error
+func (r *reputationBook) load(fname string) error {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	records := make(map[string]reputation)
+	if err = json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for idStr, rep := range records {
+		id, err := peer.Decode(idStr)
+		if err != nil {
+			return err
+		}
+		repCopy := rep
+		r.records[id] = &repCopy
+	}
+	return nil
+}
+
+// evidenceReputation updates reputation of the peer and bans it if necessary. Static peers are not banned
+func (ps *Peers) evidenceReputation(id peer.ID, evt reputationEvent) {
+	p := ps.getPeer(id)
+	banFor := ps.reputation.apply(id, evt, p != nil && p.isStaticPeer())
+	if banFor == 0 {
+		return
+	}
+	name := "(unknown peer)"
+	if p != nil {
+		p.blockCommunicationsFor(banFor)
+		name = p.name
+	}
+	ps.Log().Warnf("banned peer %s (%s) for %v: reputation score dropped to %d, last event: %s",
+		ShortPeerIDString(id), name, banFor, banScoreThreshold, evt.String())
+}
+
+// ReportInvalidTx is called when transaction bytes sent by the peer can't be parsed or pre-validated.
+// Must not be called for relayed transactions which fail later, e.g. in the attacher: the peer gossips
+// transactions after pre-validation only, so it can't know the outcome
+func (ps *Peers) ReportInvalidTx(from peer.ID) {
+	ps.evidenceReputation(from, eventInvalidTx)
+}
+
+// evidenceTxDelivered is called on each transaction received by gossip
+func (ps *Peers) evidenceTxDelivered(from peer.ID, txid *ledger.TransactionID, responseToPull bool) {
+	if ps.reputation.txDelivered(from, txid, responseToPull) {
+		ps.evidenceReputation(from, eventFirstDelivery)
+	}
+}
+
+func (p *Peer) isStaticPeer() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.isStatic
+}
+
+func (ps *Peers) saveReputation() {
+	if ps.cfg.ReputationFile == "" {
+		return
+	}
+	if err := ps.reputation.save(ps.cfg.ReputationFile); err != nil {
+		ps.Log().Errorf("failed to save reputation of peers to %s: %v", ps.cfg.ReputationFile, err)
+	}
+}
+
+func (ps *Peers) reputationLoop() {
+	lastDecay := time.Now()
+	for {
+		select {
+		case <-ps.stopHeartbeatChan:
+			return
+		case <-time.After(reputationLoopPeriod):
+		}
+		for _, id := range ps.reputation.purgeExpired() {
+			ps.evidenceReputation(id, eventUnansweredPull)
+		}
+		if time.Since(lastDecay) >= scoreDecayPeriod {
+			ps.reputation.decay()
+			ps.saveReputation()
+			lastDecay = time.Now()
+		}
+	}
+}
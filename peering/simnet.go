@@ -0,0 +1,321 @@
+package peering
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// SimNet is the in-memory network for testing of many nodes in one process. Each node is the usual Peers,
+// running on the simulated libp2p host instead of the TCP one, so gossip, pull, heartbeat and sync protocols
+// are the same as in the real network. Links between nodes have configurable latency, bandwidth and loss.
+// Loss is simulated by dropping whole writes to the stream. Each frame is written with one write (see writeFrame),
+// so whole messages are lost and framing of the stream is never broken.
+// Nodes can be split into partitions and healed.
+// All randomness of the network is derived from the seed: identities of nodes and, for each directed link,
+// the sequence of losses, i.e. n-th frame sent over the link is lost or delivered the same way in each run.
+// Latency and bandwidth of links are not random.
+//
+// NOT IMPLEMENTED: deterministic runs. Runs with the same seed are NOT reproducible. Nodes, the workflow and
+// sequencers run on the real clock (time.Now() is called directly in many places, and ledger time is derived from it)
+// and goroutines are scheduled by the Go runtime, so the relative order of frames of different links and timing
+// of nodes differ from run to run, and so does the ledger produced by sequencers. Deterministic runs need a virtual
+// clock injected into the node, the workflow and the sequencer, and the scheduler of the simulated network driven by it.
+// See TODO.md.
+//
+// Transport security, QUIC, NAT traversal and allow-list of the config are ignored by simulated nodes
+
+type (
+	SimNet struct {
+		mutex sync.Mutex
+		mn    mocknet.Mocknet
+		seed  int64
+		// identities of nodes
+		rnd *rand.Rand
+		// losses of each directed link
+		lossRnd     map[simLinkKey]*rand.Rand
+		defaultLink LinkConfig
+		links       map[simLinkKey]LinkConfig
+		// index of the partition of the node. All nodes are in the partition 0 unless partitioned
+		partition map[peer.ID]int
+		addrs     map[peer.ID]multiaddr.Multiaddr
+		nodes     []peer.ID
+		// frames written to the network and dropped by losses
+		numFrames  int
+		numDropped int
+	}
+
+	LinkConfig struct {
+		// one-way delay of each write
+		Latency time.Duration
+		// bytes per second. 0 means not limited
+		Bandwidth float64
+		// probability of each frame to be lost, from 0 to 1
+		Loss float64
+	}
+
+	simLinkKey struct {
+		a, b peer.ID
+	}
+
+	// simHost wraps streams, so that writes to them are lost according to losses of links
+	simHost struct {
+		host.Host
+		sn *SimNet
+	}
+
+	simStream struct {
+		network.Stream
+		sn *SimNet
+	}
+)
+
+// simBeginPort is used only to make distinct addresses of simulated nodes
+const simBeginPort = 10000
+
+// NewSimNet creates empty simulated network. The link config is used for all links unless overridden with SetLink
+func NewSimNet(seed int64, defaultLink LinkConfig) *SimNet {
+	ret := &SimNet{
+		mn:          mocknet.New(),
+		seed:        seed,
+		rnd:         rand.New(rand.NewSource(seed)),
+		lossRnd:     make(map[simLinkKey]*rand.Rand),
+		defaultLink: defaultLink,
+		links:       make(map[simLinkKey]LinkConfig),
+		partition:   make(map[peer.ID]int),
+		addrs:       make(map[peer.ID]multiaddr.Multiaddr),
+	}
+	ret.mn.SetLinkDefaults(mocknet.LinkOptions{Latency: defaultLink.Latency, Bandwidth: defaultLink.Bandwidth})
+	return ret
+}
+
+// NewConfig makes config of the new simulated node with identity derived from the seed of the network.
+// Known peers can be added with PeerAddr
+func (sn *SimNet) NewConfig() *Config {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	seed := make([]byte, ed25519.SeedSize)
+	sn.rnd.Read(seed)
+	pk := ed25519.NewKeyFromSeed(seed)
+	pklpp, err := crypto.UnmarshalEd25519PrivateKey(pk)
+	util.AssertNoError(err)
+	hid, err := peer.IDFromPrivateKey(pklpp)
+	util.AssertNoError(err)
+	return &Config{
+		HostIDPrivateKey: pk,
+		HostID:           hid,
+		HostPort:         simBeginPort + len(sn.addrs),
+		KnownPeers:       make(map[string]multiaddr.Multiaddr),
+	}
+}
+
+// New creates Peers of the simulated node. The node is linked with all nodes of the same partition
+func (sn *SimNet) New(env Environment, cfg *Config) (*Peers, error) {
+	if cfg.AllowKnownPeersOnly {
+		return nil, fmt.Errorf("SimNet: allow-list of known peers is not supported by simulated nodes")
+	}
+	pk, err := crypto.UnmarshalEd25519PrivateKey(cfg.HostIDPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrong private key: %w", err)
+	}
+	addr, err := multiaddr.NewMultiaddr(simAddrString(cfg.HostPort))
+	if err != nil {
+		return nil, err
+	}
+	h, err := sn.mn.AddPeer(pk, addr)
+	if err != nil {
+		return nil, fmt.Errorf("SimNet: unable create simulated host: %w", err)
+	}
+
+	sn.mutex.Lock()
+	sn.addrs[h.ID()] = addr
+	sn.partition[h.ID()] = 0
+	for _, id := range sn.nodes {
+		if sn.partition[id] == 0 {
+			if err = sn.link(h.ID(), id); err != nil {
+				sn.mutex.Unlock()
+				return nil, err
+			}
+		}
+	}
+	sn.nodes = append(sn.nodes, h.ID())
+	sn.mutex.Unlock()
+
+	return newPeers(env, cfg, &simHost{Host: h, sn: sn}, nil)
+}
+
+// PeerAddr returns multiaddress of the simulated node to be used as known peer
+func (sn *SimNet) PeerAddr(id peer.ID) multiaddr.Multiaddr {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	addr, ok := sn.addrs[id]
+	if !ok {
+		return nil
+	}
+	return addr.Encapsulate(multiaddr.StringCast("/p2p/" + id.String()))
+}
+
+// SetLink overrides config of the link between two nodes. Applies to both directions
+func (sn *SimNet) SetLink(a, b peer.ID, cfg LinkConfig) {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	sn.links[makeSimLinkKey(a, b)] = cfg
+	for _, l := range sn.mn.LinksBetweenPeers(a, b) {
+		l.SetOptions(mocknet.LinkOptions{Latency: cfg.Latency, Bandwidth: cfg.Bandwidth})
+	}
+}
+
+// Partition splits nodes into isolated partitions: nodes of each group and the rest of nodes.
+// Links between partitions are removed and connections are closed. Previous partitioning is replaced
+func (sn *SimNet) Partition(groups ...[]peer.ID) error {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	for _, id := range sn.nodes {
+		sn.partition[id] = 0
+	}
+	for i, group := range groups {
+		for _, id := range group {
+			if _, ok := sn.partition[id]; !ok {
+				return fmt.Errorf("SimNet: unknown node %s", id.String())
+			}
+			sn.partition[id] = i + 1
+		}
+	}
+	return sn.relinkAll()
+}
+
+// Heal removes partitions
+func (sn *SimNet) Heal() error {
+	return sn.Partition()
+}
+
+// Stats returns number of frames written to the network and number of frames dropped by losses
+func (sn *SimNet) Stats() (numFrames, numDropped int) {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	return sn.numFrames, sn.numDropped
+}
+
+// Close closes all simulated hosts. Peers must be stopped before
+func (sn *SimNet) Close() error {
+	return sn.mn.Close()
+}
+
+func (sn *SimNet) relinkAll() error {
+	for i, a := range sn.nodes {
+		for _, b := range sn.nodes[i+1:] {
+			linked := len(sn.mn.LinksBetweenPeers(a, b)) > 0
+			switch {
+			case sn.partition[a] == sn.partition[b] && !linked:
+				if err := sn.link(a, b); err != nil {
+					return err
+				}
+			case sn.partition[a] != sn.partition[b] && linked:
+				if err := sn.mn.UnlinkPeers(a, b); err != nil {
+					return err
+				}
+				if err := sn.mn.DisconnectPeers(a, b); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (sn *SimNet) link(a, b peer.ID) error {
+	l, err := sn.mn.LinkPeers(a, b)
+	if err != nil {
+		return err
+	}
+	if cfg, ok := sn.links[makeSimLinkKey(a, b)]; ok {
+		l.SetOptions(mocknet.LinkOptions{Latency: cfg.Latency, Bandwidth: cfg.Bandwidth})
+	}
+	return nil
+}
+
+// dropFrame decides if the frame written from one node to another is lost
+func (sn *SimNet) dropFrame(from, to peer.ID) bool {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	sn.numFrames++
+	cfg, ok := sn.links[makeSimLinkKey(from, to)]
+	if !ok {
+		cfg = sn.defaultLink
+	}
+	if cfg.Loss <= 0 || sn.linkLossRnd(from, to).Float64() >= cfg.Loss {
+		return false
+	}
+	sn.numDropped++
+	return true
+}
+
+// linkLossRnd returns random generator of losses of the directed link. It is seeded with the seed of the network
+// and IDs of nodes, so sequence of losses of the link does not depend on traffic of other links
+func (sn *SimNet) linkLossRnd(from, to peer.ID) *rand.Rand {
+	key := simLinkKey{a: from, b: to}
+	ret, ok := sn.lossRnd[key]
+	if !ok {
+		h := fnv.New64a()
+		_ = binary.Write(h, binary.BigEndian, sn.seed)
+		h.Write([]byte(from))
+		h.Write([]byte(to))
+		ret = rand.New(rand.NewSource(int64(h.Sum64())))
+		sn.lossRnd[key] = ret
+	}
+	return ret
+}
+
+func makeSimLinkKey(a, b peer.ID) simLinkKey {
+	if a > b {
+		a, b = b, a
+	}
+	return simLinkKey{a: a, b: b}
+}
+
+func simAddrString(port int) string {
+	idx := port - simBeginPort
+	return fmt.Sprintf("/ip4/10.%d.%d.1/tcp/%d", (idx>>8)&0xff, idx&0xff, port)
+}
+
+func (h *simHost) NewStream(ctx context.Context, id peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	stream, err := h.Host.NewStream(ctx, id, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return &simStream{Stream: stream, sn: h.sn}, nil
+}
+
+func (h *simHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, func(stream network.Stream) {
+		handler(&simStream{Stream: stream, sn: h.sn})
+	})
+}
+
+// Write loses the whole write or passes it to the stream
+func (s *simStream) Write(p []byte) (int, error) {
+	if s.sn.dropFrame(s.Conn().LocalPeer(), s.Conn().RemotePeer()) {
+		return len(p), nil
+	}
+	return s.Stream.Write(p)
+}
@@ -0,0 +1,352 @@
+package peering
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/ledger"
+	"golang.org/x/exp/maps"
+)
+
+// Bulk sync protocol is used by the node which is many slots behind the network. Each request is served on its own stream.
+// Requests wait in the queue when all slots of the server are busy. Each peer can have at most MaxSyncRequestsPerPeer
+// requests being served or waiting at once, excess requests are rejected:
+// - branch chain request: the peer responds with one frame, the list of branches of its heaviest chain in the range
+//   of slots, in ascending order
+// - past cone request: the peer responds with transactions of the past cone of the branch, which are not included
+//   in the predecessor branch, in topological order, i.e. each transaction after its inputs and endorsements.
+//   Transactions are sent in frames of the same format as gossip batches. The response is terminated by the empty frame
+// Only nodes with transaction store respond to sync requests
+
+const lppProtocolSync = "/proxima/sync/%d"
+
+const (
+	syncRequestBranchChain = byte(iota)
+	syncRequestPastCone
+)
+
+const (
+	// MaxSyncSlotsPerRange is the maximum number of slots in one branch chain request. Serving the request walks
+	// the heaviest chain, so bigger requests are rejected as malformed
+	MaxSyncSlotsPerRange = 100
+	// MaxSyncRequestsPerPeer is the maximum number of sync requests of one peer served or waiting at once.
+	// Clients must not send more requests in parallel
+	MaxSyncRequestsPerPeer = 2
+	// maximum number of concurrently served sync requests of all peers
+	maxConcurrentSyncRequests = 8
+	// request waiting in the queue longer is rejected
+	syncQueueTimeout = 10 * time.Second
+	// each response frame must arrive in time
+	syncFrameTimeout = 30 * time.Second
+)
+
+// OnSyncBranchChainRequest sets function which returns branches of the heaviest chain in the range of slots
+func (ps *Peers) OnSyncBranchChainRequest(fun func(fromSlot, toSlot ledger.Slot) []ledger.TransactionID) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.onSyncBranchChain = fun
+}
+
+// OnSyncPastConeRequest sets function which sends past cone of the branch in topological order.
+// Function send returns false if the transaction cannot be sent, then sending must be stopped
+func (ps *Peers) OnSyncPastConeRequest(fun func(branchID ledger.TransactionID, send func(txBytesWithMetadata []byte) bool)) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.onSyncPastCone = fun
+}
+
+// RandomPeerWithTxStore returns random alive peer with txStore
+func (ps *Peers) RandomPeerWithTxStore() (peer.ID, bool) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	all := maps.Keys(ps.peers)
+	for _, idx := range rand.Perm(len(all)) {
+		p := ps.peers[all[idx]]
+		if p.isCommunicationOpen() && p.isAlive() && p.HasTxStore() {
+			return p.id, true
+		}
+	}
+	return "", false
+}
+
+func (ps *Peers) syncStreamHandler(stream network.Stream) {
+	id := stream.Conn().RemotePeer()
+	p := ps.getPeer(id)
+	if p == nil || !p.isCommunicationOpen() {
+		_ = stream.Reset()
+		return
+	}
+	if !p.takeSyncRequestSlot() {
+		ps.Log().Warnf("peer %s exceeded %d concurrent sync requests", id.String(), MaxSyncRequestsPerPeer)
+		_ = stream.Reset()
+		return
+	}
+	defer p.releaseSyncRequestSlot()
+
+	select {
+	case ps.syncSemaphore <- struct{}{}:
+		defer func() { <-ps.syncSemaphore }()
+	case <-time.After(syncQueueTimeout):
+		ps.Log().Warnf("sync request from peer %s was not served in %v", id.String(), syncQueueTimeout)
+		_ = stream.Reset()
+		return
+	case <-ps.Ctx().Done():
+		_ = stream.Reset()
+		return
+	}
+
+	msgData, err := readFrame(stream)
+	if err != nil {
+		ps.Log().Errorf("error while reading sync request from peer %s: %v", id.String(), err)
+		_ = stream.Reset()
+		return
+	}
+	p.evidenceMsgIn(len(msgData))
+	p.evidenceActivity(ps, "sync")
+
+	ps.mutex.RLock()
+	onBranchChain, onPastCone := ps.onSyncBranchChain, ps.onSyncPastCone
+	ps.mutex.RUnlock()
+
+	if len(msgData) == 0 {
+		err = errMalformedSyncRequest{fmt.Errorf("expected sync request, got empty frame")}
+	} else {
+		switch msgData[0] {
+		case syncRequestBranchChain:
+			var fromSlot, toSlot ledger.Slot
+			if fromSlot, toSlot, err = decodeSyncBranchChainMsg(msgData); err == nil {
+				if onBranchChain == nil {
+					_ = stream.Reset()
+					return
+				}
+				err = ps.respondBranchChain(stream, onBranchChain(fromSlot, toSlot))
+			}
+		case syncRequestPastCone:
+			var branchID ledger.TransactionID
+			if branchID, err = decodeSyncPastConeMsg(msgData); err == nil {
+				if onPastCone == nil {
+					_ = stream.Reset()
+					return
+				}
+				err = ps.respondPastCone(stream, branchID, onPastCone)
+			}
+		default:
+			err = errMalformedSyncRequest{fmt.Errorf("unsupported type of the sync message %d", msgData[0])}
+		}
+	}
+	if err != nil {
+		ps.Log().Errorf("error while serving sync request from peer %s: %v", id.String(), err)
+		if errors.As(err, new(errMalformedSyncRequest)) {
+			ps.evidenceReputation(id, eventMalformedFrame)
+		}
+		_ = stream.Reset()
+		return
+	}
+	_ = stream.Close()
+}
+
+type errMalformedSyncRequest struct{ error }
+
+// takeSyncRequestSlot returns false if the peer already has maximum number of sync requests
+func (p *Peer) takeSyncRequestSlot() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.numSyncRequests >= MaxSyncRequestsPerPeer {
+		return false
+	}
+	p.numSyncRequests++
+	return true
+}
+
+func (p *Peer) releaseSyncRequestSlot() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.numSyncRequests--
+}
+
+func (ps *Peers) respondBranchChain(stream network.Stream, txids []ledger.TransactionID) error {
+	if len(txids) > MaxNumTransactionID {
+		txids = txids[:MaxNumTransactionID]
+	}
+	return ps.writeSyncFrame(stream, encodeTxIDList(syncRequestBranchChain, txids...))
+}
+
+func (ps *Peers) respondPastCone(stream network.Stream, branchID ledger.TransactionID, onPastCone func(ledger.TransactionID, func([]byte) bool)) error {
+	var err error
+	batch := make([][]byte, 0)
+	size := gossipBatchHeaderSize
+
+	flush := func() {
+		if len(batch) > 0 && err == nil {
+			err = ps.writeSyncFrame(stream, encodeGossipBatch(batch))
+		}
+		batch = batch[:0]
+		size = gossipBatchHeaderSize
+	}
+	onPastCone(branchID, func(txBytesWithMetadata []byte) bool {
+		if len(txBytesWithMetadata) > maxGossipMsgSize {
+			err = fmt.Errorf("transaction size %d exceeds maximum %d bytes", len(txBytesWithMetadata), maxGossipMsgSize)
+			return false
+		}
+		if size+gossipBatchItemHeaderSize+len(txBytesWithMetadata) > MaxPayloadSize || len(batch) >= maxGossipBatchItems {
+			flush()
+		}
+		batch = append(batch, txBytesWithMetadata)
+		size += gossipBatchItemHeaderSize + len(txBytesWithMetadata)
+		return err == nil
+	})
+	flush()
+	if err != nil {
+		return err
+	}
+	// empty frame terminates the response
+	return ps.writeSyncFrame(stream, nil)
+}
+
+func (ps *Peers) writeSyncFrame(stream network.Stream, msgData []byte) error {
+	_ = stream.SetWriteDeadline(time.Now().Add(syncFrameTimeout))
+	if err := writeFrame(stream, msgData); err != nil {
+		return err
+	}
+	ps.evidenceMsgOut(stream.Conn().RemotePeer(), len(msgData))
+	return nil
+}
+
+func (ps *Peers) readSyncFrame(stream network.Stream) ([]byte, error) {
+	_ = stream.SetReadDeadline(time.Now().Add(syncFrameTimeout))
+	msgData, err := readFrame(stream)
+	if err != nil {
+		return nil, err
+	}
+	if p := ps.getPeer(stream.Conn().RemotePeer()); p != nil {
+		p.evidenceMsgIn(len(msgData))
+	}
+	return msgData, nil
+}
+
+func (ps *Peers) openSyncStream(id peer.ID, msgData []byte) (network.Stream, error) {
+	ctx, cancel := context.WithTimeout(ps.Ctx(), gossipDialTimeout)
+	defer cancel()
+
+	stream, err := ps.host.NewStream(ctx, id, ps.lppProtocolSync)
+	if err != nil {
+		return nil, err
+	}
+	if err = ps.writeSyncFrame(stream, msgData); err != nil {
+		_ = stream.Reset()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// SyncBranchChain requests from the peer branches of its heaviest chain in the range of slots.
+// Branches are returned in ascending order of slots
+func (ps *Peers) SyncBranchChain(id peer.ID, fromSlot, toSlot ledger.Slot) ([]ledger.TransactionID, error) {
+	stream, err := ps.openSyncStream(id, encodeSyncBranchChainMsg(fromSlot, toSlot))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.Close() }()
+
+	msgData, err := ps.readSyncFrame(stream)
+	if err != nil {
+		_ = stream.Reset()
+		return nil, err
+	}
+	ret, err := decodeTxIDList(syncRequestBranchChain, msgData)
+	if err != nil {
+		ps.evidenceReputation(id, eventMalformedFrame)
+		_ = stream.Reset()
+		return nil, err
+	}
+	for i := range ret {
+		if !ret[i].IsBranchTransaction() || ret[i].Slot() < fromSlot || ret[i].Slot() > toSlot || (i > 0 && ret[i].Slot() <= ret[i-1].Slot()) {
+			ps.evidenceReputation(id, eventMalformedFrame)
+			_ = stream.Reset()
+			return nil, fmt.Errorf("SyncBranchChain: wrong branch %s in the response", ret[i].StringShort())
+		}
+	}
+	return ret, nil
+}
+
+// SyncPastCone requests from the peer past cone of the branch. Function fun is called for each transaction
+// in the order of receiving. Returns number of transactions received
+func (ps *Peers) SyncPastCone(id peer.ID, branchID ledger.TransactionID, fun func(txBytesWithMetadata []byte)) (int, error) {
+	stream, err := ps.openSyncStream(id, encodeSyncPastConeMsg(branchID))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = stream.Close() }()
+
+	count := 0
+	for {
+		msgData, err := ps.readSyncFrame(stream)
+		if err != nil {
+			_ = stream.Reset()
+			return count, err
+		}
+		if len(msgData) == 0 {
+			// end of the response
+			return count, nil
+		}
+		batch, err := decodeGossipBatch(msgData)
+		if err != nil {
+			ps.evidenceReputation(id, eventMalformedFrame)
+			_ = stream.Reset()
+			return count, err
+		}
+		for _, txBytesWithMetadata := range batch {
+			fun(txBytesWithMetadata)
+			count++
+		}
+	}
+}
+
+func encodeSyncBranchChainMsg(fromSlot, toSlot ledger.Slot) []byte {
+	var ret [9]byte
+	ret[0] = syncRequestBranchChain
+	binary.BigEndian.PutUint32(ret[1:5], uint32(fromSlot))
+	binary.BigEndian.PutUint32(ret[5:9], uint32(toSlot))
+	return ret[:]
+}
+
+func decodeSyncBranchChainMsg(data []byte) (ledger.Slot, ledger.Slot, error) {
+	if len(data) != 9 || data[0] != syncRequestBranchChain {
+		return 0, 0, errMalformedSyncRequest{fmt.Errorf("not a sync branch chain message")}
+	}
+	fromSlot := ledger.Slot(binary.BigEndian.Uint32(data[1:5]))
+	toSlot := ledger.Slot(binary.BigEndian.Uint32(data[5:9]))
+	if fromSlot > toSlot || toSlot-fromSlot >= MaxSyncSlotsPerRange {
+		return 0, 0, errMalformedSyncRequest{fmt.Errorf("wrong range of slots [%d, %d]", fromSlot, toSlot)}
+	}
+	return fromSlot, toSlot, nil
+}
+
+func encodeSyncPastConeMsg(branchID ledger.TransactionID) []byte {
+	return append([]byte{syncRequestPastCone}, branchID[:]...)
+}
+
+func decodeSyncPastConeMsg(data []byte) (ledger.TransactionID, error) {
+	if len(data) != 1+ledger.TransactionIDLength || data[0] != syncRequestPastCone {
+		return ledger.TransactionID{}, errMalformedSyncRequest{fmt.Errorf("not a sync past cone message")}
+	}
+	ret, err := ledger.TransactionIDFromBytes(data[1:])
+	if err != nil {
+		return ledger.TransactionID{}, errMalformedSyncRequest{err}
+	}
+	if !ret.IsBranchTransaction() {
+		return ledger.TransactionID{}, errMalformedSyncRequest{fmt.Errorf("%s is not a branch transaction", ret.StringShort())}
+	}
+	return ret, nil
+}
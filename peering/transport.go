@@ -0,0 +1,121 @@
+package peering
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/lunfardo314/proxima/util/set"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// security of the libp2p transport. Nodes with different security settings cannot connect to each other
+const (
+	// SecurityNoise is the default: Noise protocol handshake, encrypted and authenticated by the host ID key
+	SecurityNoise = "noise"
+	// SecurityTLS TLS 1.3 with the certificate derived from the host ID key
+	SecurityTLS = "tls"
+	// SecurityNone plaintext and not authenticated. For testing only
+	SecurityNone = "none"
+)
+
+// transportOptions returns libp2p options for listen addresses, transports, security, NAT traversal and connection gating.
+// Returns connection gater if only known peers are allowed to connect
+func transportOptions(cfg *Config) ([]libp2p.Option, *allowListGater, error) {
+	listenAddrs := []string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", cfg.HostPort)}
+	ret := []libp2p.Option{libp2p.Transport(tcp.NewTCPTransport)}
+
+	switch cfg.Security {
+	case SecurityNoise, "":
+		ret = append(ret, libp2p.Security(noise.ID, noise.New))
+	case SecurityTLS:
+		ret = append(ret, libp2p.Security(libp2ptls.ID, libp2ptls.New))
+	case SecurityNone:
+		if cfg.QUICPort != 0 {
+			return nil, nil, fmt.Errorf("QUIC transport cannot be used without security")
+		}
+		ret = append(ret, libp2p.NoSecurity)
+	default:
+		return nil, nil, fmt.Errorf("unknown transport security '%s'. Must be one of: '%s', '%s' or '%s'",
+			cfg.Security, SecurityNoise, SecurityTLS, SecurityNone)
+	}
+
+	if cfg.QUICPort != 0 {
+		// QUIC has built-in TLS security
+		listenAddrs = append(listenAddrs, fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", cfg.QUICPort))
+		ret = append(ret, libp2p.Transport(quic.NewTransport))
+	}
+	ret = append(ret, libp2p.ListenAddrStrings(listenAddrs...))
+
+	natOpts, err := natOptions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	ret = append(ret, natOpts...)
+
+	var gater *allowListGater
+	if cfg.AllowKnownPeersOnly {
+		gater = &allowListGater{allowed: set.New[peer.ID]()}
+		// configured relays are known peers
+		for _, r := range cfg.NAT.Relays {
+			gater.allow(r.ID)
+		}
+		ret = append(ret, libp2p.ConnectionGater(gater))
+	}
+	return ret, gater, nil
+}
+
+// allowListGater allows connections only with peers added by Peers.AddPeer.
+// The peer ID is authenticated by the transport security, so allow-list is meaningless with SecurityNone
+type allowListGater struct {
+	mutex   sync.RWMutex
+	allowed set.Set[peer.ID]
+}
+
+func (g *allowListGater) allow(id peer.ID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.allowed.Insert(id)
+}
+
+func (g *allowListGater) disallow(id peer.ID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.allowed.Remove(id)
+}
+
+func (g *allowListGater) isAllowed(id peer.ID) bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.allowed.Contains(id)
+}
+
+func (g *allowListGater) InterceptPeerDial(id peer.ID) bool {
+	return g.isAllowed(id)
+}
+
+func (g *allowListGater) InterceptAddrDial(id peer.ID, _ multiaddr.Multiaddr) bool {
+	return g.isAllowed(id)
+}
+
+func (g *allowListGater) InterceptAccept(_ network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *allowListGater) InterceptSecured(_ network.Direction, id peer.ID, _ network.ConnMultiaddrs) bool {
+	return g.isAllowed(id)
+}
+
+func (g *allowListGater) InterceptUpgraded(_ network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
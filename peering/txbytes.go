@@ -1,12 +1,31 @@
 package peering
 
 import (
+	"encoding/binary"
+	"fmt"
+
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
 	"github.com/lunfardo314/unitrie/common"
 )
 
+// Gossip stream is long-lived. Each frame is a batch of gossip messages:
+// - 2 bytes of the number of messages
+// - each message is prefixed with 2 bytes of its size. First byte of the message is its type:
+//   - gossipMsgTx: followed by metadata bytes concatenated with transaction bytes
+//   - gossipMsgInventory: followed by announced transaction IDs
+
+const (
+	gossipBatchHeaderSize     = 2
+	gossipBatchItemHeaderSize = 2
+	maxGossipBatchItems       = 1024
+	// maximum size of the transaction bytes with metadata, which can be gossiped
+	maxGossipMsgSize = MaxPayloadSize - gossipBatchHeaderSize - gossipBatchItemHeaderSize
+)
+
 func (ps *Peers) gossipStreamHandler(stream network.Stream) {
 	id := stream.Conn().RemotePeer()
 	p := ps.getPeer(id)
@@ -17,37 +36,114 @@ func (ps *Peers) gossipStreamHandler(stream network.Stream) {
 		return
 	}
 
+	for {
+		if !p.isCommunicationOpen() {
+			_ = stream.Reset()
+			return
+		}
+		msgData, err := readFrame(stream)
+		if err != nil {
+			// long-lived stream is closed or reset by the peer
+			ps.Tracef(TraceTag, "gossip stream from %s ended: %v", ShortPeerIDString(id), err)
+			_ = stream.Reset()
+			return
+		}
+		batch, err := decodeGossipBatch(msgData)
+		if err != nil {
+			ps.Log().Errorf("error while parsing gossip batch from peer %s: %v", id.String(), err)
+			ps.evidenceReputation(id, eventMalformedFrame)
+			_ = stream.Reset()
+			return
+		}
+		p.evidenceActivity(ps, "gossip")
+		announced := make([]ledger.TransactionID, 0)
+		for _, msg := range batch {
+			p.evidenceMsgIn(len(msg))
+			if len(msg) == 0 {
+				err = fmt.Errorf("empty gossip message")
+			} else {
+				switch msg[0] {
+				case gossipMsgTx:
+					err = ps.processGossipMsg(id, msg[1:])
+				case gossipMsgInventory:
+					var txids []ledger.TransactionID
+					if txids, err = decodeInventoryMsg(msg); err == nil {
+						announced = append(announced, txids...)
+					}
+				default:
+					err = fmt.Errorf("unsupported type of the gossip message %d", msg[0])
+				}
+			}
+			if err != nil {
+				ps.Log().Errorf("error while parsing gossip message from peer %s: %v", id.String(), err)
+				ps.evidenceReputation(id, eventMalformedFrame)
+				_ = stream.Reset()
+				return
+			}
+		}
+		if len(announced) > 0 {
+			go ps.requestAnnounced(id, announced)
+		}
+	}
+}
+
+// legacyGossipStreamHandler receives transaction from the node which does not support gossip batches.
+// Such node opens new stream for each transaction and sends one frame with metadata and transaction bytes
+func (ps *Peers) legacyGossipStreamHandler(stream network.Stream) {
+	id := stream.Conn().RemotePeer()
+	p := ps.getPeer(id)
+	if p == nil {
+		// peer not found
+		ps.Log().Warnf("unknown peer %s", id.String())
+		_ = stream.Reset()
+		return
+	}
 	if !p.isCommunicationOpen() {
 		_ = stream.Reset()
 		return
 	}
-
 	txBytesWithMetadata, err := readFrame(stream)
 	if err != nil {
 		ps.Log().Errorf("error while reading message from peer %s: %v", id.String(), err)
 		_ = stream.Reset()
 		return
 	}
-	metadataBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
-	if err != nil {
+	p.evidenceMsgIn(len(txBytesWithMetadata))
+	if err = ps.processGossipMsg(id, txBytesWithMetadata); err != nil {
 		ps.Log().Errorf("error while parsing tx message from peer %s: %v", id.String(), err)
+		ps.evidenceReputation(id, eventMalformedFrame)
 		_ = stream.Reset()
 		return
 	}
+	_ = stream.Close()
+	p.evidenceActivity(ps, "gossip")
+}
+
+func (ps *Peers) processGossipMsg(id peer.ID, txBytesWithMetadata []byte) error {
+	metadataBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+	if err != nil {
+		return err
+	}
 	metadata, err := txmetadata.TransactionMetadataFromBytes(metadataBytes)
 	if err != nil {
-		ps.Log().Errorf("error while parsing tx message metadata from peer %s: %v", id.String(), err)
-		_ = stream.Reset()
-		return
+		return fmt.Errorf("wrong metadata: %w", err)
+	}
+	// invalid transaction bytes are reported by the receiver of the transaction
+	if txid, err := transaction.IDFromTransactionBytes(txBytes); err == nil {
+		ps.evidenceTxDelivered(id, &txid, metadata != nil && metadata.IsResponseToPull)
 	}
-
-	defer stream.Close()
-
-	p.evidenceActivity(ps, "gossip")
 	ps.onReceiveTx(id, txBytes, metadata)
+	return nil
 }
 
+// GossipTxBytesToPeers sends transaction to alive peers. If inventory gossip is enabled, only ID of the transaction
+// is announced, except sequencer milestones, which are always sent in full
 func (ps *Peers) GossipTxBytesToPeers(txBytes []byte, metadata *txmetadata.TransactionMetadata, except ...peer.ID) int {
+	msgData, txid, milestone := gossipMsg(txBytes, metadata)
+	if ps.cfg != nil && ps.cfg.InventoryGossip && txid != nil && !milestone && ps.inventory.announce(txid, msgData) {
+		msgData = encodeInventoryMsg(*txid)
+	}
+
 	ps.mutex.RLock()
 	defer ps.mutex.RUnlock()
 
@@ -62,13 +158,15 @@ func (ps *Peers) GossipTxBytesToPeers(txBytes []byte, metadata *txmetadata.Trans
 		if !p.isAlive() {
 			continue
 		}
-		if ps.SendTxBytesWithMetadataToPeer(id, txBytes, metadata) {
+		if ps.sendGossipMsgToPeer(p, msgData, milestone) {
 			countSent++
 		}
 	}
 	return countSent
 }
 
+// SendTxBytesWithMetadataToPeer puts transaction to the outbound queue of the peer.
+// Returns false if peer is not available or its queue is full
 func (ps *Peers) SendTxBytesWithMetadataToPeer(id peer.ID, txBytes []byte, metadata *txmetadata.TransactionMetadata) bool {
 	ps.Tracef(TraceTag, "SendTxBytesWithMetadataToPeer to %s, length: %d (host %s)",
 		func() any { return ShortPeerIDString(id) },
@@ -76,22 +174,117 @@ func (ps *Peers) SendTxBytesWithMetadataToPeer(id peer.ID, txBytes []byte, metad
 		func() any { return ShortPeerIDString(ps.host.ID()) },
 	)
 
-	if p := ps.getPeer(id); p == nil || !p.isCommunicationOpen() {
+	p := ps.getPeer(id)
+	if p == nil || !p.isCommunicationOpen() {
 		return false
 	}
+	msgData, _, milestone := gossipMsg(txBytes, metadata)
+	return ps.sendGossipMsgToPeer(p, msgData, milestone)
+}
 
-	stream, err := ps.host.NewStream(ps.Ctx(), id, ps.lppProtocolGossip)
-	if err != nil {
-		ps.Tracef(TraceTag, "SendTxBytesWithMetadataToPeer to %s: %v (host %s)",
-			func() any { return ShortPeerIDString(id) }, err,
-			func() any { return ShortPeerIDString(ps.host.ID()) },
-		)
+func (ps *Peers) sendGossipMsgToPeer(p *Peer, msgData []byte, milestone bool) bool {
+	if len(msgData) > maxGossipMsgSize {
+		ps.Log().Errorf("can't gossip transaction: message size %d exceeds maximum %d bytes", len(msgData), maxGossipMsgSize)
 		return false
 	}
-	defer stream.Close()
+	return p.getOutQueue(ps).push(msgData, milestone)
+}
+
+// gossipMsg returns gossip message, transaction ID and flag if it is a sequencer milestone, which is sent with priority.
+// Transaction ID is nil if bytes cannot be parsed as transaction
+func gossipMsg(txBytes []byte, metadata *txmetadata.TransactionMetadata) ([]byte, *ledger.TransactionID, bool) {
+	var txid *ledger.TransactionID
+	milestone := false
+	if tx, err := transaction.FromBytes(txBytes); err == nil {
+		txid = tx.ID()
+		milestone = tx.IsSequencerMilestone()
+	}
+	return common.ConcatBytes([]byte{gossipMsgTx}, metadata.Bytes(), txBytes), txid, milestone
+}
+
+// legacyGossipMsgs converts batch of gossip messages for the peer which supports only legacy gossip: transactions
+// are sent in full, announced transactions are taken from the inventory. Announcements which expired are skipped
+func (ps *Peers) legacyGossipMsgs(batch [][]byte) [][]byte {
+	ret := make([][]byte, 0, len(batch))
+	for _, msg := range batch {
+		switch msg[0] {
+		case gossipMsgTx:
+			ret = append(ret, msg)
+		case gossipMsgInventory:
+			txids, err := decodeInventoryMsg(msg)
+			if err != nil {
+				continue
+			}
+			for i := range txids {
+				if msgData := ps.inventory.getAnnounced(&txids[i]); len(msgData) > 0 {
+					ret = append(ret, msgData)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func (p *Peer) getOutQueue(ps *Peers) *outQueue {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-	if err = writeFrame(stream, common.ConcatBytes(metadata.Bytes(), txBytes)); err != nil {
-		ps.Tracef("SendTxBytesWithMetadataToPeer.writeFrame to %s: %v (host %s)", ShortPeerIDString(id), err, ShortPeerIDString(ps.host.ID()))
+	if p.outQueue == nil {
+		p.outQueue = newOutQueue(ps, p.id)
+	}
+	return p.outQueue
+}
+
+func (p *Peer) closeOutQueue() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.outQueue != nil {
+		p.outQueue.close()
+		p.outQueue = nil
+	}
+}
+
+func encodeGossipBatch(batch [][]byte) []byte {
+	size := gossipBatchHeaderSize
+	for _, item := range batch {
+		size += gossipBatchItemHeaderSize + len(item)
+	}
+	ret := make([]byte, gossipBatchHeaderSize, size)
+	binary.BigEndian.PutUint16(ret, uint16(len(batch)))
+	var itemSize [gossipBatchItemHeaderSize]byte
+	for _, item := range batch {
+		binary.BigEndian.PutUint16(itemSize[:], uint16(len(item)))
+		ret = append(ret, itemSize[:]...)
+		ret = append(ret, item...)
+	}
+	return ret
+}
+
+func decodeGossipBatch(data []byte) ([][]byte, error) {
+	if len(data) < gossipBatchHeaderSize {
+		return nil, fmt.Errorf("decodeGossipBatch: wrong data length")
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if n == 0 || n > maxGossipBatchItems {
+		return nil, fmt.Errorf("decodeGossipBatch: wrong number of messages %d", n)
+	}
+	data = data[gossipBatchHeaderSize:]
+	ret := make([][]byte, n)
+	for i := range ret {
+		if len(data) < gossipBatchItemHeaderSize {
+			return nil, fmt.Errorf("decodeGossipBatch: unexpected end of data")
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		data = data[gossipBatchItemHeaderSize:]
+		if len(data) < size {
+			return nil, fmt.Errorf("decodeGossipBatch: unexpected end of data")
+		}
+		ret[i] = data[:size]
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("decodeGossipBatch: not all bytes consumed")
 	}
-	return err == nil
+	return ret, nil
 }
@@ -0,0 +1,58 @@
+package db_cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/lunfardo314/proxima/multistate/analytics"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	analyticsPar     analytics.Params
+	analyticsCSVFile string
+	analyticsJSON    string
+)
+
+func initAnalyticsCmd() *cobra.Command {
+	analyticsCmd := &cobra.Command{
+		Use:   "analytics",
+		Short: "displays supply, inflation and state statistics along the heaviest chain",
+		Long: `displays time series of supply, inflation (branch bonus and chain inflation), ledger coverage,
+number of outputs and chains along the heaviest chain, share of sequencers and the rich list of the latest branch.
+Time series can be exported as CSV or JSON`,
+		Args: cobra.NoArgs,
+		Run:  runAnalyticsCmd,
+	}
+	analyticsCmd.PersistentFlags().IntVarP(&analyticsPar.SlotsBack, "slots", "s", 100, "maximum slots back. -1 means all")
+	analyticsCmd.PersistentFlags().IntVarP(&analyticsPar.TopN, "top", "t", 10, "number of accounts in the rich list")
+	analyticsCmd.PersistentFlags().BoolVarP(&analyticsPar.ScanStates, "scan", "a", false, "count outputs and chains in each branch (slow)")
+	analyticsCmd.PersistentFlags().StringVar(&analyticsCSVFile, "csv", "", "export time series to the CSV file")
+	analyticsCmd.PersistentFlags().StringVar(&analyticsJSON, "json", "", "export report to the JSON file")
+	return analyticsCmd
+}
+
+func runAnalyticsCmd(_ *cobra.Command, _ []string) {
+	glb.InitLedger()
+	defer glb.CloseDatabases()
+
+	report := analytics.Collect(glb.StateStore(), analyticsPar)
+	glb.Infof("%s", report.Lines().String())
+
+	if analyticsCSVFile != "" {
+		writeToFile(analyticsCSVFile, report.WriteCSV)
+		glb.Infof("time series saved to %s", analyticsCSVFile)
+	}
+	if analyticsJSON != "" {
+		writeToFile(analyticsJSON, report.WriteJSON)
+		glb.Infof("report saved to %s", analyticsJSON)
+	}
+}
+
+func writeToFile(fname string, write func(w io.Writer) error) {
+	f, err := os.Create(fname)
+	glb.AssertNoError(err)
+	defer func() { _ = f.Close() }()
+	glb.AssertNoError(write(f))
+}
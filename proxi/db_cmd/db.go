@@ -20,6 +20,12 @@ func Init() *cobra.Command {
 		initMainChainCmd(),
 		initAccountsCmd(),
 		initBranchesCmd(),
+		initSnapshotCmd(),
+		initPruneCmd(),
+		initPruneTxStoreCmd(),
+		initMigrateCmd(),
+		initDiffCmd(),
+		initAnalyticsCmd(),
 	)
 	return dbCmd
 }
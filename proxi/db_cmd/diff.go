@@ -0,0 +1,53 @@
+package db_cmd
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+
+func initDiffCmd() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff <branch A> <branch B>",
+		Short: "displays difference of the ledger state of branch B with respect to the state of branch A",
+		Long: `displays outputs and committed transaction IDs which were added or removed in the state of branch B with respect to the state of branch A.
+Branches are given as hex-encoded transaction IDs`,
+		Args: cobra.ExactArgs(2),
+		Run:  runDiffCmd,
+	}
+	diffCmd.PersistentFlags().BoolVarP(&diffJSON, "json", "j", false, "output in JSON format")
+	return diffCmd
+}
+
+func runDiffCmd(_ *cobra.Command, args []string) {
+	glb.InitLedger()
+	defer glb.CloseDatabases()
+
+	var branches [2]ledger.TransactionID
+	for i := range branches {
+		var err error
+		branches[i], err = ledger.TransactionIDFromHexString(args[i])
+		glb.AssertNoError(err)
+		glb.Assertf(branches[i].IsBranchTransaction(), "%s is not a branch transaction ID", branches[i].StringShort())
+	}
+
+	start := time.Now()
+	diff, err := multistate.DiffBranches(glb.StateStore(), branches[0], branches[1])
+	glb.AssertNoError(err)
+
+	if diffJSON {
+		jsonData, err := json.MarshalIndent(diff.JSONAble(), "", "  ")
+		glb.AssertNoError(err)
+		glb.Infof("%s", string(jsonData))
+		return
+	}
+	glb.Infof("state diff %s -> %s:", branches[0].StringShort(), branches[1].StringShort())
+	glb.Infof("%s", diff.Lines("   ").String())
+	glb.Infof("took %v", time.Since(start))
+}
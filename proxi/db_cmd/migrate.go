@@ -0,0 +1,156 @@
+package db_cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateToBackend string
+	migrateTxStore   bool
+)
+
+const migrateBatchSize = 10_000
+
+func initMigrateCmd() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "copies the multi-state DB to the database with another backend",
+		Long: fmt.Sprintf(`copies the multi-state DB '%s' to the new database '%s.<backend>' with the database backend specified by --to.
+With --txstore the transaction store '%s' is copied to '%s.<backend>' too.
+All key/value pairs are compared after copying and state tries of all branches are verified.
+The original databases are not changed and nothing is replaced automatically. To start the node with the new backend,
+stop the node, move the original database away and rename the new one to the original name, for example:
+   mv %s %s.old && mv %s.<backend> %s
+The backend of the renamed database is detected when it is opened.
+Should not be run while the node is using the databases.
+Available backends: %v`,
+			global.MultiStateDBName, global.MultiStateDBName, global.TxStoreDBName, global.TxStoreDBName,
+			global.MultiStateDBName, global.MultiStateDBName, global.MultiStateDBName, global.MultiStateDBName, kvdb.Backends()),
+		Args: cobra.NoArgs,
+		Run:  runMigrateCmd,
+	}
+	migrateCmd.PersistentFlags().StringVarP(&migrateToBackend, "to", "t", "", "target database backend")
+	migrateCmd.PersistentFlags().BoolVarP(&migrateTxStore, "txstore", "x", false,
+		fmt.Sprintf("also copy the transaction store database '%s'", global.TxStoreDBName))
+	return migrateCmd
+}
+
+func runMigrateCmd(_ *cobra.Command, _ []string) {
+	glb.Assertf(kvdb.IsBackend(migrateToBackend), "target backend must be one of %v", kvdb.Backends())
+
+	dbNames := []string{global.MultiStateDBName}
+	if migrateTxStore {
+		dbNames = append(dbNames, global.TxStoreDBName)
+	}
+	for _, dbName := range dbNames {
+		glb.FileMustExist(dbName)
+		backend, err := kvdb.DetectBackend(dbName)
+		glb.AssertNoError(err)
+		glb.Assertf(backend != migrateToBackend, "backend of '%s' is already '%s'", dbName, backend)
+		glb.FileMustNotExist(targetDBName(dbName))
+	}
+
+	for _, dbName := range dbNames {
+		migrateDB(dbName, dbName == global.MultiStateDBName)
+	}
+	glb.Infof("migration completed successfully. Rename databases to the original names before starting the node")
+}
+
+func targetDBName(dbName string) string {
+	return dbName + "." + migrateToBackend
+}
+
+func migrateDB(dbName string, verifyRoots bool) {
+	targetName := targetDBName(dbName)
+	glb.Infof("copying '%s' to '%s'..", dbName, targetName)
+
+	src, err := kvdb.Open(dbName)
+	glb.AssertNoError(err)
+	defer func() { _ = src.Close() }()
+
+	dst, err := kvdb.CreateOrOpen(migrateToBackend, targetName)
+	glb.AssertNoError(err)
+	defer func() { _ = dst.Close() }()
+
+	err = util.CatchPanicOrError(func() error {
+		start := time.Now()
+		numKeys, err := copyDB(src, dst)
+		if err != nil {
+			return err
+		}
+		glb.Infof("%s keys copied in %v. Comparing..", util.GoTh(numKeys), time.Since(start))
+
+		if err = compareDB(src, dst, numKeys); err != nil {
+			return err
+		}
+		if !verifyRoots {
+			return nil
+		}
+		numRoots, numNodes, err := multistate.CheckStateTries(dst)
+		if err != nil {
+			return err
+		}
+		glb.Infof("state tries of %d branches verified, %d trie nodes checked", numRoots, numNodes)
+		return nil
+	})
+	if err != nil {
+		_ = dst.Close()
+		_ = os.RemoveAll(targetName)
+		glb.Fatalf("failed to migrate '%s': %v", dbName, err)
+	}
+	glb.Infof("'%s' has been migrated to '%s' successfully", dbName, targetName)
+}
+
+func copyDB(src, dst kvdb.DB) (int, error) {
+	numKeys := 0
+	batch := dst.BatchedWriter()
+	inBatch := 0
+	var err error
+	src.Iterator(nil).Iterate(func(k, v []byte) bool {
+		batch.Set(bytes.Clone(k), bytes.Clone(v))
+		numKeys++
+		if inBatch++; inBatch >= migrateBatchSize {
+			if err = batch.Commit(); err != nil {
+				return false
+			}
+			batch, inBatch = dst.BatchedWriter(), 0
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return numKeys, batch.Commit()
+}
+
+func compareDB(src, dst kvdb.DB, numKeys int) error {
+	var err error
+	src.Iterator(nil).Iterate(func(k, v []byte) bool {
+		if !bytes.Equal(dst.Get(k), v) {
+			err = fmt.Errorf("value of the key %x is different after copying", k)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	numKeysDst := 0
+	dst.Iterator(nil).Iterate(func(_, _ []byte) bool {
+		numKeysDst++
+		return true
+	})
+	if numKeysDst != numKeys {
+		return fmt.Errorf("number of keys is different after copying: %d vs %d", numKeys, numKeysDst)
+	}
+	return nil
+}
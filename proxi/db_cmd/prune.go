@@ -0,0 +1,49 @@
+package db_cmd
+
+import (
+	"time"
+
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneHorizonSlots int
+	pruneCompact      bool
+)
+
+func initPruneCmd() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "deletes orphaned branches older than the horizon from the multi-state DB",
+		Long: `deletes branches which are not on the heaviest chain and are older than the horizon from the multi-state DB.
+Trie nodes and values, which are not reachable from any of the remaining roots, are deleted too.
+Should not be run while the node is using the database`,
+		Args: cobra.NoArgs,
+		Run:  runPruneCmd,
+	}
+	pruneCmd.PersistentFlags().IntVarP(&pruneHorizonSlots, "horizon", "z", multistate.DefaultBranchPruningHorizonSlots,
+		"branches younger than horizon slots are not pruned")
+	pruneCmd.PersistentFlags().BoolVarP(&pruneCompact, "gc", "g", false, "compact the DB after pruning to reclaim disk space")
+	return pruneCmd
+}
+
+func runPruneCmd(_ *cobra.Command, _ []string) {
+	glb.InitLedger()
+	defer glb.CloseDatabases()
+
+	glb.Assertf(pruneHorizonSlots > 0, "horizon must be positive")
+	glb.Infof("pruning orphaned branches older than %d slots from the latest slot %d",
+		pruneHorizonSlots, multistate.FetchLatestSlot(glb.StateStore()))
+
+	start := time.Now()
+	stats, err := multistate.PruneOrphanedBranches(glb.StateStore(), pruneHorizonSlots)
+	glb.AssertNoError(err)
+	glb.Infof("%s. Took %v", stats.String(), time.Since(start))
+
+	if pruneCompact {
+		glb.Infof("compacting the DB..")
+		glb.AssertNoError(glb.CompactStateDB())
+	}
+}
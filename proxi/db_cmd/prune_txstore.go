@@ -0,0 +1,58 @@
+package db_cmd
+
+import (
+	"time"
+
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/txstore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneTxStoreHorizonSlots     int
+	pruneTxStoreKeepAllFinalized bool
+	pruneTxStoreDryRun           bool
+)
+
+func initPruneTxStoreCmd() *cobra.Command {
+	pruneTxStoreCmd := &cobra.Command{
+		Use:     "prune_txstore",
+		Aliases: []string{"prune-txstore"},
+		Short:   "deletes transactions older than the horizon, which are not part of the heaviest chain, from the transaction store",
+		Long: `deletes transactions older than the horizon, which are not part of the heaviest chain, from the transaction store.
+With --keep_finalized=false only transactions known in the latest heaviest state are kept.
+Should not be run while the node is using the databases`,
+		Args: cobra.NoArgs,
+		Run:  runPruneTxStoreCmd,
+	}
+	pruneTxStoreCmd.PersistentFlags().IntVarP(&pruneTxStoreHorizonSlots, "horizon", "z", txstore.DefaultTxStorePruningHorizonSlots,
+		"transactions younger than horizon slots are not pruned")
+	pruneTxStoreCmd.PersistentFlags().BoolVarP(&pruneTxStoreKeepAllFinalized, "keep_finalized", "k", true,
+		"keep all transactions included into the heaviest chain")
+	pruneTxStoreCmd.PersistentFlags().BoolVarP(&pruneTxStoreDryRun, "dry_run", "d", false, "only report what would be deleted")
+	return pruneTxStoreCmd
+}
+
+func runPruneTxStoreCmd(_ *cobra.Command, _ []string) {
+	glb.InitLedger()
+	glb.InitTxStoreDB()
+	defer glb.CloseDatabases()
+
+	txStore, ok := glb.TxBytesStore().(*txstore.SimpleTxBytesStore)
+	glb.Assertf(ok, "transaction store does not support pruning")
+
+	par := txstore.DefaultPruningParams()
+	par.HorizonSlots = pruneTxStoreHorizonSlots
+	par.KeepAllFinalized = pruneTxStoreKeepAllFinalized
+	par.DryRun = pruneTxStoreDryRun
+	glb.Assertf(par.HorizonSlots > 0, "horizon must be positive")
+
+	start := time.Now()
+	report, err := txStore.Prune(glb.StateStore(), par)
+	glb.AssertNoError(err)
+	if report == nil {
+		glb.Infof("nothing to prune")
+		return
+	}
+	glb.Infof("%s. Took %v", report.String(), time.Since(start))
+}
@@ -0,0 +1,115 @@
+package db_cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotSlot       int
+	snapshotBranch     string
+	snapshotOutputFile string
+)
+
+func initSnapshotCmd() *cobra.Command {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot [<subcommand>]",
+		Short: "multi-state snapshot subcommands",
+		Args:  cobra.NoArgs,
+		Run:   func(_ *cobra.Command, _ []string) {},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "writes snapshot of the ledger state of the branch into the file",
+		Long: `writes snapshot of the ledger state of the branch into the file.
+By default, the heaviest branch of the latest slot is taken. With --slot, the heaviest branch of the slot is taken.
+The snapshot contains ledger identity, root record of the branch and all key/value pairs of the state.
+It can be used to initialize the multi-state database of a new node with 'proxi init from_snapshot'`,
+		Args: cobra.NoArgs,
+		Run:  runSnapshotExportCmd,
+	}
+	exportCmd.PersistentFlags().IntVarP(&snapshotSlot, "slot", "s", -1, "slot of the branch")
+	exportCmd.PersistentFlags().StringVarP(&snapshotBranch, "branch", "b", "", "hex-encoded transaction ID of the branch")
+	exportCmd.PersistentFlags().StringVarP(&snapshotOutputFile, "output", "o", "", "output file")
+
+	infoCmd := &cobra.Command{
+		Use:   "info <snapshot file>",
+		Short: "displays header of the snapshot file",
+		Args:  cobra.ExactArgs(1),
+		Run:   runSnapshotInfoCmd,
+	}
+	snapshotCmd.AddCommand(exportCmd, infoCmd)
+	snapshotCmd.InitDefaultHelpCmd()
+	return snapshotCmd
+}
+
+func runSnapshotExportCmd(_ *cobra.Command, _ []string) {
+	glb.InitLedger()
+	defer glb.CloseDatabases()
+
+	var branchID ledger.TransactionID
+	var err error
+	switch {
+	case snapshotBranch != "":
+		branchID, err = ledger.TransactionIDFromHexString(snapshotBranch)
+		glb.AssertNoError(err)
+	default:
+		slot := multistate.FetchLatestSlot(glb.StateStore())
+		if snapshotSlot >= 0 {
+			slot = ledger.Slot(snapshotSlot)
+		}
+		branchID = heaviestBranchInSlot(slot)
+	}
+	fname := snapshotOutputFile
+	if fname == "" {
+		fname = fmt.Sprintf("proxima.snapshot.%d.%s", branchID.Slot(), hex.EncodeToString(branchID[:])[:16])
+	}
+	glb.FileMustNotExist(fname)
+
+	f, err := os.Create(fname)
+	glb.AssertNoError(err)
+	defer func() { _ = f.Close() }()
+
+	glb.Infof("writing snapshot of the branch %s to '%s'", branchID.String(), fname)
+	stats, err := multistate.WriteSnapshot(glb.StateStore(), branchID, f)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(fname)
+		glb.Fatalf("failed to write snapshot: %v", err)
+	}
+	glb.Infof("snapshot has been written successfully. Number of keys: %s, root: %s, checksum: %s",
+		util.GoTh(stats.NumKeys), stats.RootRecord.Root.String(), hex.EncodeToString(stats.Checksum[:]))
+}
+
+func heaviestBranchInSlot(slot ledger.Slot) (ret ledger.TransactionID) {
+	var maxCoverage uint64
+	found := false
+	multistate.IterateRootRecords(glb.StateStore(), func(branchTxID ledger.TransactionID, rootData multistate.RootRecord) bool {
+		if !found || rootData.LedgerCoverage > maxCoverage {
+			ret, maxCoverage, found = branchTxID, rootData.LedgerCoverage, true
+		}
+		return true
+	}, slot)
+	glb.Assertf(found, "no branches found in the slot %d", slot)
+	return
+}
+
+func runSnapshotInfoCmd(_ *cobra.Command, args []string) {
+	f, err := os.Open(args[0])
+	glb.AssertNoError(err)
+	defer func() { _ = f.Close() }()
+
+	header, err := multistate.ReadSnapshotHeader(f)
+	glb.AssertNoError(err)
+
+	glb.Infof("branch: %s", header.BranchID.String())
+	glb.Infof("%s", header.RootRecord.String())
+	glb.Infof("ledger identity:\n%s", ledger.MustLedgerIdentityDataFromBytes(header.LedgerIdentity).Lines("     ").String())
+}
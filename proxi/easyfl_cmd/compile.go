@@ -0,0 +1,34 @@
+package easyfl_cmd
+
+import (
+	"encoding/hex"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+func initCompileCmd() *cobra.Command {
+	compileCmd := &cobra.Command{
+		Use:   "compile <EasyFL expression>",
+		Short: "compiles EasyFL expression against the ledger library and displays the bytecode",
+		Args:  cobra.ExactArgs(1),
+		Run:   runCompileCmd,
+	}
+	compileCmd.InitDefaultHelpCmd()
+	return compileCmd
+}
+
+func runCompileCmd(_ *cobra.Command, args []string) {
+	initLedger()
+
+	_, numParams, bytecode, err := ledger.L().CompileExpression(args[0])
+	glb.AssertNoError(err)
+
+	glb.Infof("bytecode (%d bytes): %s", len(bytecode), hex.EncodeToString(bytecode))
+	glb.Infof("number of parameters: %d", numParams)
+	decompiled, err := ledger.L().DecompileBytecode(bytecode)
+	glb.AssertNoError(err)
+	glb.Infof("decompiled: %s", decompiled)
+	displayConstraint(bytecode)
+}
@@ -0,0 +1,30 @@
+package easyfl_cmd
+
+import (
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+func initDecompileCmd() *cobra.Command {
+	decompileCmd := &cobra.Command{
+		Use:   "decompile <hex bytecode>",
+		Short: "decompiles EasyFL bytecode to the EasyFL expression",
+		Args:  cobra.ExactArgs(1),
+		Run:   runDecompileCmd,
+	}
+	decompileCmd.InitDefaultHelpCmd()
+	return decompileCmd
+}
+
+func runDecompileCmd(_ *cobra.Command, args []string) {
+	initLedger()
+
+	bytecode, err := decodeHex(args[0])
+	glb.AssertNoError(err)
+
+	decompiled, err := ledger.L().DecompileBytecode(bytecode)
+	glb.AssertNoError(err)
+	glb.Infof("%s", decompiled)
+	displayConstraint(bytecode)
+}
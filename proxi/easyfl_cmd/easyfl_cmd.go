@@ -0,0 +1,81 @@
+package easyfl_cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const ledgerIDFileName = "proxi.genesis.id.yaml"
+
+func Init() *cobra.Command {
+	easyflCmd := &cobra.Command{
+		Use:   "easyfl [<subcommand>]",
+		Short: "EasyFL tools for the current ledger library",
+		Long: `EasyFL tools for the current ledger library.
+The ledger identity is taken from the file '` + ledgerIDFileName + `' if it exists, otherwise from the node
+specified by the 'api.endpoint' in the profile. If neither is available, the default ledger identity is used`,
+		Args: cobra.NoArgs,
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			glb.ReadInConfig()
+		},
+	}
+
+	easyflCmd.PersistentFlags().StringP("config", "c", "", "proxi config profile name")
+	err := viper.BindPFlag("config", easyflCmd.PersistentFlags().Lookup("config"))
+	glb.AssertNoError(err)
+
+	easyflCmd.InitDefaultHelpCmd()
+	easyflCmd.AddCommand(
+		initCompileCmd(),
+		initDecompileCmd(),
+		initEvalCmd(),
+		initListCmd(),
+	)
+	return easyflCmd
+}
+
+// initLedger initializes ledger library. Only library is needed, so the ledger identity
+// without genesis controller key is enough
+func initLedger() {
+	if glb.FileExists(ledgerIDFileName) {
+		yamlData, err := os.ReadFile(ledgerIDFileName)
+		glb.AssertNoError(err)
+		id, err := ledger.StateIdentityDataFromYAML(yamlData)
+		glb.AssertNoError(err)
+		ledger.Init(id)
+		glb.Verbosef("ledger identity loaded from '%s'", ledgerIDFileName)
+		return
+	}
+	if viper.GetString("api.endpoint") != "" {
+		glb.InitLedgerFromNode()
+		return
+	}
+	glb.Infof("ledger identity file '%s' not found and node API endpoint not specified. Using default ledger identity", ledgerIDFileName)
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	glb.AssertNoError(err)
+	ledger.Init(ledger.DefaultIdentityData(privKey))
+}
+
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return hex.DecodeString(s)
+}
+
+// displayConstraint displays constraint if bytecode is recognized as one of known constraints
+func displayConstraint(bytecode []byte) {
+	constr, err := ledger.ConstraintFromBytes(bytecode)
+	if err != nil {
+		glb.Verbosef("not a known constraint: %v", err)
+		return
+	}
+	glb.Infof("constraint: %s", constr.String())
+}
@@ -0,0 +1,96 @@
+package easyfl_cmd
+
+import (
+	"encoding/hex"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixtureFile string
+	traceEval   bool
+)
+
+func initEvalCmd() *cobra.Command {
+	evalCmd := &cobra.Command{
+		Use:   "eval <EasyFL expression> [<hex argument>...]",
+		Short: "evaluates EasyFL expression with the ledger library",
+		Long: `Evaluates EasyFL expression with the ledger library. Hex arguments are passed as $0, $1, ...
+Without the fixture, the expression is evaluated without transaction context.
+With the fixture, the expression is evaluated as a constraint located at the 'self' path
+of the synthetic transaction built from the YAML fixture file. Example of the fixture:
+
+timestamp:
+  slot: 100
+  tick: 10
+private_key: <hex encoded ED25519 private key, random if not specified>
+consumed:
+  - amount: 1000000
+    constraints:
+      - "timelock(u32/50)"
+    unlock_params:
+      2: "0x01"
+produced:
+  - amount: 1000000
+    lock: "addressED25519(0x...)"
+self:
+  consumed: true
+  output: 0
+  constraint: 2
+
+Locks and constraints are EasyFL sources. The default lock is the address of the private key.
+If unlock parameters for the lock of the consumed output are not specified, the signature unlock is used`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runEvalCmd,
+	}
+	evalCmd.PersistentFlags().StringVar(&fixtureFile, "fixture", "", "YAML file with the synthetic transaction context")
+	evalCmd.PersistentFlags().BoolVar(&traceEval, "trace", false, "trace evaluation in the transaction context")
+
+	evalCmd.InitDefaultHelpCmd()
+	return evalCmd
+}
+
+func runEvalCmd(_ *cobra.Command, args []string) {
+	initLedger()
+
+	var res []byte
+	var err error
+	if fixtureFile == "" {
+		evalArgs := make([][]byte, len(args)-1)
+		for i := range evalArgs {
+			evalArgs[i], err = decodeHex(args[i+1])
+			glb.AssertNoError(err)
+		}
+		res, err = ledger.L().EvalFromSource(nil, args[0], evalArgs...)
+		glb.AssertNoError(err)
+	} else {
+		glb.Assertf(len(args) == 1, "arguments are not allowed in the transaction context")
+		res, err = evalInFixture(args[0])
+		glb.AssertNoError(err)
+	}
+	if len(res) == 0 {
+		glb.Infof("result: nil (false)")
+		return
+	}
+	glb.Infof("result: 0x%s", hex.EncodeToString(res))
+}
+
+func evalInFixture(src string) ([]byte, error) {
+	traceOption := transaction.TraceOptionNone
+	if traceEval {
+		traceOption = transaction.TraceOptionAll
+	}
+	fx, err := fixtureFromFile(fixtureFile, traceOption)
+	if err != nil {
+		return nil, err
+	}
+	_, _, bytecode, err := ledger.L().CompileExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	glb.Verbosef("transaction context:\n%s", fx.ctx.String())
+	return fx.ctx.EvalConstraintAt(bytecode, fx.path)
+}
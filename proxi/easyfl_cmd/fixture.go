@@ -0,0 +1,174 @@
+package easyfl_cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/lazybytes"
+	"gopkg.in/yaml.v2"
+)
+
+// fixtureYAMLAble is the YAML fixture of the synthetic transaction context. See 'proxi easyfl eval --help' for an example.
+// All constraints and locks are EasyFL sources. Default lock is the address of the private key
+type (
+	fixtureYAMLAble struct {
+		Timestamp struct {
+			Slot uint32 `yaml:"slot"`
+			Tick uint8  `yaml:"tick"`
+		} `yaml:"timestamp"`
+		// PrivateKey hex-encoded ED25519 private key which signs the transaction. Random if not specified
+		PrivateKey string          `yaml:"private_key"`
+		Consumed   []fixtureOutput `yaml:"consumed"`
+		Produced   []fixtureOutput `yaml:"produced"`
+		// Self is the location of the evaluated constraint
+		Self struct {
+			Consumed   bool `yaml:"consumed"`
+			Output     byte `yaml:"output"`
+			Constraint byte `yaml:"constraint"`
+		} `yaml:"self"`
+	}
+
+	fixtureOutput struct {
+		Amount      uint64   `yaml:"amount"`
+		Lock        string   `yaml:"lock"`
+		Constraints []string `yaml:"constraints"`
+		// UnlockParams hex-encoded unlock parameters by constraint index. Only for consumed outputs.
+		// If unlock parameters for the lock are not specified, the signature unlock is used
+		UnlockParams map[byte]string `yaml:"unlock_params"`
+	}
+
+	fixture struct {
+		ctx  *transaction.TxContext
+		path lazybytes.TreePath
+	}
+)
+
+func fixtureFromFile(fname string, traceOption int) (*fixture, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var fy fixtureYAMLAble
+	if err = yaml.Unmarshal(data, &fy); err != nil {
+		return nil, fmt.Errorf("wrong fixture file '%s': %v", fname, err)
+	}
+	return fy.fixture(ledger.HashTransactionBytes(data), traceOption)
+}
+
+// fixture builds synthetic transaction and its context. Consumed outputs are identified by fake
+// output IDs. The transaction is not validated
+func (fy *fixtureYAMLAble) fixture(fakeTxHash ledger.TransactionIDShort, traceOption int) (*fixture, error) {
+	if len(fy.Consumed) == 0 || len(fy.Produced) == 0 {
+		return nil, fmt.Errorf("fixture must contain at least one consumed and one produced output")
+	}
+	if !ledger.Tick(fy.Timestamp.Tick).Valid() {
+		return nil, fmt.Errorf("wrong tick value %d", fy.Timestamp.Tick)
+	}
+	ts := ledger.MustNewLedgerTime(ledger.Slot(fy.Timestamp.Slot), ledger.Tick(fy.Timestamp.Tick))
+	privKey, err := fy.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	defaultLock := ledger.AddressED25519FromPrivateKey(privKey)
+
+	txb := txbuilder.NewTransactionBuilder()
+	fakeTxID := ledger.NewTransactionID(ts, fakeTxHash, false)
+	for i := range fy.Consumed {
+		o, err := fy.Consumed[i].output(defaultLock)
+		if err != nil {
+			return nil, fmt.Errorf("consumed output #%d: %v", i, err)
+		}
+		idx, err := txb.ConsumeOutput(o, ledger.NewOutputID(&fakeTxID, byte(i)))
+		if err != nil {
+			return nil, err
+		}
+		if _, hasLockUnlock := fy.Consumed[i].UnlockParams[ledger.ConstraintIndexLock]; !hasLockUnlock {
+			txb.PutSignatureUnlock(idx)
+		}
+		for constrIdx, paramsHex := range fy.Consumed[i].UnlockParams {
+			params, err := decodeHex(paramsHex)
+			if err != nil {
+				return nil, fmt.Errorf("consumed output #%d, unlock params #%d: %v", i, constrIdx, err)
+			}
+			txb.PutUnlockParams(idx, constrIdx, params)
+		}
+	}
+	for i := range fy.Produced {
+		o, err := fy.Produced[i].output(defaultLock)
+		if err != nil {
+			return nil, fmt.Errorf("produced output #%d: %v", i, err)
+		}
+		if _, err = txb.ProduceOutput(o); err != nil {
+			return nil, fmt.Errorf("produced output #%d: %v", i, err)
+		}
+	}
+	txb.TransactionData.Timestamp = ts
+	txb.TransactionData.InputCommitment = txb.InputCommitment()
+	txb.SignED25519(privKey)
+
+	tx, err := transaction.FromBytes(txb.TransactionData.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := transaction.TxContextFromTransaction(tx, func(i byte) (*ledger.Output, error) {
+		return txb.ConsumedOutputs[i], nil
+	}, traceOption)
+	if err != nil {
+		return nil, err
+	}
+	return &fixture{ctx: ctx, path: fy.selfPath()}, nil
+}
+
+func (fy *fixtureYAMLAble) privateKey() (ed25519.PrivateKey, error) {
+	if fy.PrivateKey != "" {
+		return util.ED25519PrivateKeyFromHexString(fy.PrivateKey)
+	}
+	_, ret, err := ed25519.GenerateKey(rand.Reader)
+	return ret, err
+}
+
+func (fy *fixtureYAMLAble) selfPath() lazybytes.TreePath {
+	if fy.Self.Consumed {
+		return lazybytes.Path(ledger.PathToConsumedOutputs, fy.Self.Output, fy.Self.Constraint)
+	}
+	return lazybytes.Path(ledger.PathToProducedOutputs, fy.Self.Output, fy.Self.Constraint)
+}
+
+func (fo *fixtureOutput) output(defaultLock ledger.Lock) (*ledger.Output, error) {
+	lockBytecode := defaultLock.Bytes()
+	if fo.Lock != "" {
+		_, _, bytecode, err := ledger.L().CompileExpression(fo.Lock)
+		if err != nil {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+		if _, err = ledger.LockFromBytes(bytecode); err != nil {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+		lockBytecode = bytecode
+	}
+	constraints := make([][]byte, len(fo.Constraints))
+	for i, src := range fo.Constraints {
+		_, _, bytecode, err := ledger.L().CompileExpression(src)
+		if err != nil {
+			return nil, fmt.Errorf("constraint '%s': %v", src, err)
+		}
+		constraints[i] = bytecode
+	}
+	var err error
+	ret := ledger.NewOutput(func(o *ledger.Output) {
+		o.WithAmount(fo.Amount)
+		o.PutConstraint(lockBytecode, ledger.ConstraintIndexLock)
+		for _, c := range constraints {
+			if _, err = o.PushConstraint(c); err != nil {
+				return
+			}
+		}
+	})
+	return ret, err
+}
@@ -0,0 +1,54 @@
+package easyfl_cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/spf13/cobra"
+)
+
+func initListCmd() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list [<function name>]",
+		Short: "lists functions of the ledger library with the function code, arity and source",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   runListCmd,
+	}
+	listCmd.InitDefaultHelpCmd()
+	return listCmd
+}
+
+func runListCmd(_ *cobra.Command, args []string) {
+	initLedger()
+
+	if len(args) == 1 {
+		fun := ledger.L().FunctionByName(args[0])
+		glb.Assertf(fun != nil, "function '%s' not found in the library", args[0])
+		glb.Infof("%s", functionString(fun))
+		return
+	}
+	funs := ledger.L().Functions()
+	for _, fun := range funs {
+		glb.Infof("%s", functionString(fun))
+	}
+	h := ledger.L().LibraryHash()
+	glb.Infof("total %d functions. Library hash: %s", len(funs), hex.EncodeToString(h[:]))
+}
+
+func functionString(fun *ledger.FunctionDescriptor) string {
+	arity := "vararg"
+	if fun.NumParams >= 0 {
+		arity = fmt.Sprintf("%d", fun.NumParams)
+	}
+	kind := "extended"
+	if fun.Embedded {
+		kind = "embedded"
+	}
+	ret := fmt.Sprintf("%4d %-30s %-7s %s", fun.FunCode, fun.Sym, arity, kind)
+	if fun.Source != "" {
+		ret += ": " + fun.Source
+	}
+	return ret
+}
@@ -1,31 +1,45 @@
 package glb
 
 import (
-	"github.com/dgraph-io/badger/v4"
 	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
 	"github.com/lunfardo314/proxima/multistate"
 	"github.com/lunfardo314/proxima/txstore"
-	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
+	"github.com/spf13/viper"
 )
 
 var (
-	stateDB      *badger.DB
-	stateStore   global.StateStore
-	txBytesDB    *badger.DB
+	stateDB      kvdb.DB
+	txBytesDB    kvdb.DB
 	txBytesStore global.TxBytesStore
 )
 
+// DBBackend returns database backend of new databases from the profile, or default
+func DBBackend() string {
+	if ret := viper.GetString(global.ConfigKeyDatabaseBackend); ret != "" {
+		return ret
+	}
+	return kvdb.DefaultBackend
+}
+
 func InitLedger(verbose ...bool) {
 	dbName := global.MultiStateDBName
 	Infof("Multi-state store database: %s", dbName)
 	FileMustExist(dbName)
-	stateDB = badger_adaptor.MustCreateOrOpenBadgerDB(dbName)
-	stateStore = badger_adaptor.New(stateDB)
-	multistate.InitLedgerFromStore(stateStore, verbose...)
+	var err error
+	stateDB, err = kvdb.Open(dbName)
+	AssertNoError(err)
+	global.SetUpgradeActivationSlotsFromConfig()
+	multistate.InitLedgerFromStore(stateDB, verbose...)
 }
 
 func StateStore() global.StateStore {
-	return stateStore
+	return stateDB
+}
+
+// CompactStateDB reclaims space of deleted data in the multi-state DB
+func CompactStateDB() error {
+	return kvdb.Compact(stateDB)
 }
 
 func CloseDatabases() {
@@ -42,8 +56,10 @@ func InitTxStoreDB() {
 	txDBName := global.TxStoreDBName
 	Infof("Transaction store database: %s", txDBName)
 
-	txBytesDB = badger_adaptor.MustCreateOrOpenBadgerDB(txDBName)
-	txBytesStore = txstore.NewSimpleTxBytesStore(badger_adaptor.New(txBytesDB))
+	var err error
+	txBytesDB, err = kvdb.CreateOrOpen(DBBackend(), txDBName)
+	AssertNoError(err)
+	txBytesStore = txstore.NewSimpleTxBytesStore(txBytesDB)
 }
 
 func TxBytesStore() global.TxBytesStore {
@@ -4,7 +4,9 @@ import (
 	"sync"
 
 	"github.com/lunfardo314/proxima/api/client"
+	"github.com/lunfardo314/proxima/api/lightclient"
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
 	"github.com/spf13/viper"
 )
 
@@ -19,9 +21,46 @@ func GetClient() *client.APIClient {
 	return client.New(endpoint)
 }
 
+// GetAdminClient returns client of the admin API of the node. The admin API is served on the node's host only
+func GetAdminClient() *client.APIClient {
+	endpoint := viper.GetString("api.admin_endpoint")
+	Assertf(endpoint != "", "admin API endpoint of the node 'api.admin_endpoint' not specified")
+	return client.New(endpoint)
+}
+
 func InitLedgerFromNode() {
 	ledgerID, err := GetClient().GetLedgerID()
 	AssertNoError(err)
+	// transactions are validated with the library versions scheduled in the node
+	activationSlots, err := GetClient().GetUpgradeActivationSlots()
+	AssertNoError(err)
+	for v, slot := range activationSlots {
+		Assertf(v <= ledger.LatestLibraryVersion, "node runs ledger library version %d, which is newer than the version %d of proxi. proxi must be upgraded",
+			v, ledger.LatestLibraryVersion)
+		ledger.SetUpgradeActivationSlot(v, slot)
+	}
 	ledger.Init(ledgerID)
 	Infof("successfully connected to the node at %s", viper.GetString("api.endpoint"))
 }
+
+// LightMode if true, data from the node is verified by the light client
+func LightMode() bool {
+	return viper.GetBool("light")
+}
+
+// GetLightClient returns light client synced with the heaviest branch chain confirmed by the majority of nodes
+func GetLightClient() *lightclient.LightClient {
+	others := make([]*client.APIClient, 0)
+	for _, endpoint := range viper.GetStringSlice("api.light_client_endpoints") {
+		others = append(others, client.New(endpoint))
+	}
+	if len(others) == 0 {
+		Infof("light client: no other nodes are configured in 'api.light_client_endpoints', state root and ledger coverage reported by the node are not confirmed")
+	}
+	lc := lightclient.New(GetClient(), others...)
+	AssertNoError(lc.Sync())
+	tip := lc.LatestBranch()
+	Infof("light client: following branch %s confirmed by %d nodes, ledger coverage: %s",
+		tip.ID.StringShort(), lc.Quorum(), util.GoTh(tip.LedgerCoverage))
+	return lc
+}
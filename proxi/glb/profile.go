@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/lunfardo314/proxima/ledger"
-	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -148,7 +148,7 @@ func ReportTxInclusion(txid ledger.TransactionID, poll time.Duration) {
 func GetInclusionThreshold() (int, int) {
 	numerator := viper.GetInt("finality.inclusion_threshold.numerator")
 	denominator := viper.GetInt("finality.inclusion_threshold.denominator")
-	Assertf(multistate.ValidInclusionThresholdFraction(numerator, denominator), "wrong or missing inclusion threshold")
+	Assertf(rootrecord.ValidInclusionThresholdFraction(numerator, denominator), "wrong or missing inclusion threshold")
 	return numerator, denominator
 }
 
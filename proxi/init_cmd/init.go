@@ -18,6 +18,7 @@ func CmdInit() *cobra.Command {
 		initGenesisDBCmd(),
 		initBootstrapAccountCmd(),
 		initNodeConfigCmd(),
+		initFromSnapshotCmd(),
 	)
 	initCmd.InitDefaultHelpCmd()
 	return initCmd
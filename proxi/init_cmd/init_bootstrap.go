@@ -3,16 +3,15 @@ package init_cmd
 import (
 	"strconv"
 
-	"github.com/dgraph-io/badger/v4"
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/ledger/txbuilder"
 	"github.com/lunfardo314/proxima/multistate"
 	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/lunfardo314/proxima/txstore"
 	"github.com/lunfardo314/proxima/util"
-	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
 	"github.com/spf13/cobra"
 )
 
@@ -37,9 +36,9 @@ const (
 func runBootstrapAccount(_ *cobra.Command, args []string) {
 	// initialize ledger
 	glb.FileMustExist(global.MultiStateDBName)
-	stateDb := badger_adaptor.MustCreateOrOpenBadgerDB(global.MultiStateDBName, badger.DefaultOptions(global.MultiStateDBName))
-	stateStore := badger_adaptor.New(stateDb)
-	defer func() { _ = stateDb.Close() }()
+	stateStore, err := kvdb.Open(global.MultiStateDBName)
+	glb.AssertNoError(err)
+	defer func() { _ = stateStore.Close() }()
 
 	multistate.InitLedgerFromStore(stateStore)
 	privKey := glb.MustGetPrivateKey()
@@ -63,12 +62,13 @@ func runBootstrapAccount(_ *cobra.Command, args []string) {
 		glb.Fatalf("exit: bootstrap account wasn't created")
 	}
 
-	txStoreDB := badger_adaptor.New(badger_adaptor.MustCreateOrOpenBadgerDB(global.TxStoreDBName, badger.DefaultOptions(global.TxStoreDBName)))
+	txStoreDB, err := kvdb.CreateOrOpen(glb.DBBackend(), global.TxStoreDBName)
+	glb.AssertNoError(err)
 	txStore := txstore.NewSimpleTxBytesStore(txStoreDB)
 	defer func() { _ = txStoreDB.Close() }()
 
 	txBytesBootstrapBalance, txid, err := txbuilder.DistributeInitialSupplyExt(stateStore, privKey, []ledger.LockBalance{
-		{addr, bootstrapBalance},
+		{Lock: addr, Balance: bootstrapBalance},
 	})
 	glb.AssertNoError(err)
 
@@ -0,0 +1,115 @@
+package init_cmd
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trustedSnapshotBranch string
+	trustedSnapshotRoot   string
+)
+
+func initFromSnapshotCmd() *cobra.Command {
+	fromSnapshotCmd := &cobra.Command{
+		Use:     "from_snapshot <snapshot file>",
+		Aliases: []string{"from-snapshot"},
+		Short:   "creates multi-state DB from the snapshot file. The branch of the snapshot becomes the baseline of the node",
+		Long: `creates multi-state DB from the snapshot file. The branch of the snapshot becomes the baseline of the node.
+The checksum and the root of the snapshot only prove the snapshot is consistent with itself.
+Provide the branch ID or the state root obtained from a trusted source with --branch or --root, so that the snapshot is checked against them.
+The DB is created in a temporary directory and is moved into place only after the snapshot is verified`,
+		Args: cobra.ExactArgs(1),
+		Run:  runFromSnapshot,
+	}
+	fromSnapshotCmd.Flags().StringVar(&trustedSnapshotBranch, "branch", "", "hex-encoded trusted transaction ID of the snapshot branch")
+	fromSnapshotCmd.Flags().StringVar(&trustedSnapshotRoot, "root", "", "hex-encoded trusted state root of the snapshot branch")
+	return fromSnapshotCmd
+}
+
+func runFromSnapshot(_ *cobra.Command, args []string) {
+	glb.FileMustNotExist(global.MultiStateDBName)
+
+	trusted := &multistate.SnapshotTrusted{}
+	if trustedSnapshotBranch != "" {
+		branchID, err := ledger.TransactionIDFromHexString(trustedSnapshotBranch)
+		glb.AssertNoError(err)
+		trusted.BranchID = &branchID
+	}
+	if trustedSnapshotRoot != "" {
+		rootBin, err := hex.DecodeString(trustedSnapshotRoot)
+		glb.AssertNoError(err)
+		trusted.Root, err = common.VectorCommitmentFromBytes(ledger.CommitmentModel, rootBin)
+		glb.AssertNoError(err)
+	}
+
+	f, err := os.Open(args[0])
+	glb.AssertNoError(err)
+	defer func() { _ = f.Close() }()
+
+	header, err := multistate.ReadSnapshotHeader(f)
+	glb.AssertNoError(err)
+	idData := ledger.MustLedgerIdentityDataFromBytes(header.LedgerIdentity)
+	global.SetUpgradeActivationSlotsFromConfig()
+	ledger.Init(idData)
+
+	glb.Infof("Will be creating multi-state DB '%s' from the snapshot '%s'", global.MultiStateDBName, args[0])
+	glb.Infof("Ledger identity:\n%s", idData.Lines("      ").String())
+	glb.Infof("Branch: %s", header.BranchID.String())
+	glb.Infof("%s", header.RootRecord.String())
+
+	if trusted.BranchID == nil && trusted.Root == nil {
+		glb.Infof("WARNING: trusted branch ID or root is not provided (flags --branch and --root). The snapshot will be verified only against itself")
+	} else {
+		glb.AssertNoError(trusted.Check(header))
+		glb.Infof("the snapshot matches the trusted branch ID and root")
+	}
+
+	if glb.FileExists(ledgerIDFileName) {
+		idDataYAML, err := os.ReadFile(ledgerIDFileName)
+		glb.AssertNoError(err)
+		idDataFromFile, err := ledger.StateIdentityDataFromYAML(idDataYAML)
+		glb.AssertNoError(err)
+		glb.Assertf(idDataFromFile.Hash() == idData.Hash(),
+			"ledger identity in the snapshot is different from the one in '%s'", ledgerIDFileName)
+	}
+
+	if !glb.YesNoPrompt("Proceed?", true) {
+		glb.Fatalf("exit: multi-state database wasn't created")
+	}
+
+	_, err = f.Seek(0, 0)
+	glb.AssertNoError(err)
+
+	// the DB is moved into place only after verification, so a failed import does not leave the DB behind
+	tmpDir, err := os.MkdirTemp(filepath.Dir(global.MultiStateDBName), filepath.Base(global.MultiStateDBName)+".import-")
+	glb.AssertNoError(err)
+	stateStore, err := kvdb.CreateOrOpen(glb.DBBackend(), tmpDir)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		glb.Fatalf("failed to create temporary multi-state DB: %v", err)
+	}
+	stats, err := multistate.ReadSnapshot(f, stateStore, trusted)
+	_ = stateStore.Close()
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		glb.Fatalf("failed to create multi-state DB from the snapshot: %v", err)
+	}
+	if err = os.Rename(tmpDir, global.MultiStateDBName); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		glb.Fatalf("failed to move multi-state DB into place: %v", err)
+	}
+	glb.Infof("multi-state DB '%s' has been created successfully from the snapshot. Number of keys: %s, checksum: %s",
+		global.MultiStateDBName, util.GoTh(stats.NumKeys), hex.EncodeToString(stats.Checksum[:]))
+	glb.Infof("root commitment %s has been verified", stats.RootRecord.Root.String())
+}
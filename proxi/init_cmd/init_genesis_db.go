@@ -3,12 +3,11 @@ package init_cmd
 import (
 	"os"
 
-	"github.com/dgraph-io/badger/v4"
 	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/multistate"
 	"github.com/lunfardo314/proxima/proxi/glb"
-	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
 	"github.com/spf13/cobra"
 )
 
@@ -35,7 +34,7 @@ func runGenesis(_ *cobra.Command, _ []string) {
 
 	glb.Infof("Will be creating genesis from the ledger identity data:")
 	glb.Infof(idData.Lines("      ").String())
-	glb.Infof("Multi-state database name: '%s'", global.MultiStateDBName)
+	glb.Infof("Multi-state database name: '%s', backend: %s", global.MultiStateDBName, glb.DBBackend())
 	//glb.Infof("Transaction store database name: '%s'", global.TxStoreDBName)
 
 	if !glb.YesNoPrompt("Proceed?", true) {
@@ -43,8 +42,8 @@ func runGenesis(_ *cobra.Command, _ []string) {
 	}
 
 	// create state store and initialize genesis state
-	stateDb := badger_adaptor.MustCreateOrOpenBadgerDB(global.MultiStateDBName, badger.DefaultOptions(global.MultiStateDBName))
-	stateStore := badger_adaptor.New(stateDb)
+	stateStore, err := kvdb.CreateOrOpen(glb.DBBackend(), global.MultiStateDBName)
+	glb.AssertNoError(err)
 	defer func() { _ = stateStore.Close() }()
 
 	bootstrapChainID, _ := multistate.InitStateStore(*idData, stateStore)
@@ -33,6 +33,7 @@ const (
 	deterministicSeedForTestingNodes = 31415926535 + 2718281828
 	peeringPort                      = 4000
 	apiPortStart                     = 8000
+	adminAPIPortStart                = 8100
 )
 
 func runNodeConfigCommand(_ *cobra.Command, args []string) {
@@ -51,6 +52,7 @@ func runNodeConfigCommand(_ *cobra.Command, args []string) {
 
 	hostPort := peeringPort
 	apiPort := apiPortStart
+	adminAPIPort := adminAPIPortStart
 	var intro string
 	if generatePeering {
 		intro = "# Testing configuration of the Proxima node with 4 other peers on the same machine\n" +
@@ -75,6 +77,7 @@ func runNodeConfigCommand(_ *cobra.Command, args []string) {
 				hostPrivateKey = idPrivateKeys[i]
 				hostPort = peeringPort + i
 				apiPort = apiPortStart + i
+				adminAPIPort = adminAPIPortStart + i
 			}
 		}
 		peerConfig = peeringCfgLines.String()
@@ -99,6 +102,7 @@ func runNodeConfigCommand(_ *cobra.Command, args []string) {
 		hostPort,
 		peerConfig,
 		apiPort,
+		adminAPIPort,
 	)
 	err = os.WriteFile(proximaNodeProfile, []byte(yamlStr), 0666)
 	glb.AssertNoError(err)
@@ -119,19 +123,129 @@ peering:
     id: %s
     # port to connect from other peers
     port: %d
+    # transport security: 'noise' (default), 'tls' or 'none' (plaintext, for testing only).
+    # Nodes with different security cannot connect to each other
+    security: noise
+    # if not 0, QUIC transport is enabled on the UDP port in addition to TCP. Requires security
+    # quic_port: 0
+    # addresses advertised to peers instead of the listen addresses, e.g. public address of the NAT with forwarded port
+    # announce_addrs:
+    #   - /ip4/<public IP>/tcp/<port>
+
+  # NAT traversal. All options are disabled by default
+  nat:
+    # ask the router to forward the port with UPnP or NAT-PMP
+    port_map: false
+    # tell peers if they are reachable from outside. Enable on nodes with public address
+    autonat_service: false
+    # upgrade relayed connections to direct ones
+    hole_punching: false
+    # relay connections of peers behind NAT. Enable on nodes with public address
+    relay_service: false
+    # 'public' or 'private' overrides detection of reachability. Empty means auto-detection
+    # reachability: private
+    # static relays used when the node is not reachable from outside. Each relay is <name>: <multiaddr> with host ID
+    # relays:
+    #   relay1: /ip4/<IP addr>/tcp/<port>/p2p/<hostID>
+
+  # if true, only configured known peers are allowed to connect. Auto-peering is disabled
+  allow_known_peers_only: false
+
+  # peers are scored by their behavior. Misbehaving peers are banned, each next ban lasts twice as long.
+  # Scores and bans are saved to the file and restored after restart. Not saved if empty
+  reputation_file: peers_reputation.json
+
+  # if true, transactions are announced to peers by ID and peers pull unknown ones. Saves bandwidth.
+  # Sequencer milestones are always sent in full
+  inventory_gossip: true
 
   # configuration of known peers. Each known peer is specified as a pair <name>: <multiaddr>, where:
   # - <name> is unique mnemonic name used for convenience locally
   # - <multiaddr> is the libp2p multi-address in the form '/ip4/<IPaddr ir URL>/<port>/tcp/p2p/<hostID>'
   peers:
-%s	
+%s
+  # auto-peering: discovery of new peers from the known ones. Configured known peers are static, they are never dropped
+  autopeering:
+    enable: true
+    # if number of alive peers is below min_peers, all alive peers are asked for new peers. Default: 3
+    # min_peers: 3
+    # maximum number of peers, including static ones. Default: 20
+    # max_peers: 20
+    # discovery of peers in the local network. Default: false
+    # mdns: false
+    # discovered peers are saved to the file and restored after restart. Not saved if empty
+    peers_file: discovered_peers.txt
+    # discovery period in seconds. Default: 10
+    # period_sec: 10
 
 # Node's API config
 api:
   server:
     # server port
     port: %d
+    # port of the admin API (peer management). It is served on 127.0.0.1 only, never expose it with a proxy.
+    # Admin API is not served if 0 or omitted
+    admin_port: %d
+
+
+# Ledger config
+ledger:
+  # activation slots of ledger library upgrades. Must be the same on all nodes of the network.
+  # Upgrade which is not configured is not scheduled, i.e. its functions are never active
+  upgrades:
+    v1:
+      # activation_slot: 0
+
+# Database config
+database:
+  # backend of new databases: 'badger' (default) or 'pebble'. Backend of the existing database is detected
+  backend: badger
+
+# Transaction store config
+txstore:
+  # 'db' (default) - local database, 'dummy' - no transaction store, 'url' - remote transaction store server
+  type: db
+  # URL of the transaction store server, used with 'type: url'
+  # url: http://localhost:4500
+  # number of locally cached transactions, used with 'type: url'
+  # cache_size: 10000
+  # number of retries of failed requests to the server, used with 'type: url'
+  # retries: 3
+  # token of the server, required to persist transactions, used with 'type: url'
+  # token: <persist token of the server>
+  # pruning of transactions which are not part of any surviving branch. Used with 'type: db'
+  pruning:
+    enable: false
+    # transactions younger than horizon are never pruned. Default: 1000 slots
+    # horizon_slots: 1000
+    # if true (default), all transactions included into the heaviest chain are kept.
+    # If false, only transactions known in the latest heaviest state are kept
+    # keep_all_finalized: true
+    # archive mode: transactions are never deleted
+    # archive: false
+    # if true, only reports what would be deleted
+    # dry_run: false
+    # pruning is run every period_slots. Default: 100 slots
+    # period_slots: 100
 
+# Multi-state DB config
+multistate:
+  pruning:
+    # if enabled, branches not on the heaviest chain and older than the horizon are periodically deleted from the DB
+    enable: false
+    # branches younger than horizon are never pruned. Default: 1000 slots
+    # horizon_slots: 1000
+    # pruning is run every period_slots. Default: 100 slots
+    # period_slots: 100
+  # supply, inflation and state statistics along the heaviest chain, exposed as Prometheus gauges
+  analytics:
+    enable: false
+    # statistics are collected over slots_back slots. Default: 100 slots
+    # slots_back: 100
+    # number of accounts in the rich list. Default: 10
+    # top_accounts: 10
+    # statistics are collected every period_slots. Default: 10 slots
+    # period_slots: 10
 
 # map of maps of sequencers <seq name>: <seq config>
 # usually none or 1 sequencer is configured for the node
@@ -35,6 +35,14 @@ wallet:
     sequencer: 
 api:
     endpoint:
+    # admin API endpoint of the node, e.g. http://127.0.0.1:8100. Available on the node's host only
+    admin_endpoint:
+    # API endpoints of other nodes. In light mode, data is verified with the chain confirmed by the majority
+    # of all nodes
+    light_client_endpoints: []
+# backend of databases created by proxi: 'badger' (default) or 'pebble'
+database:
+    backend: badger
 `
 
 func runInitProfileCommand(_ *cobra.Command, args []string) {
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/lunfardo314/proxima/proxi/db_cmd"
+	"github.com/lunfardo314/proxima/proxi/easyfl_cmd"
 	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/lunfardo314/proxima/proxi/init_cmd"
 	"github.com/lunfardo314/proxima/proxi/node_cmd"
@@ -23,6 +24,7 @@ func main() {
       - database level access to the Proxima ledger for admin purposes, including genesis creation
       - access to ledger via the Proxima node API. This includes simple wallet functions to access usual accounts 
 and withdraw funds from the sequencer chain
+      - EasyFL tools for the ledger library: compile, decompile and evaluate expressions, list library functions
 `,
 		Run: func(cmd *cobra.Command, _ []string) {
 			_ = cmd.Help()
@@ -41,6 +43,7 @@ and withdraw funds from the sequencer chain
 		init_cmd.CmdInit(),
 		db_cmd.Init(),
 		node_cmd.Init(),
+		easyfl_cmd.Init(),
 	)
 	rootCmd.InitDefaultHelpCmd()
 	if err = rootCmd.Execute(); err != nil {
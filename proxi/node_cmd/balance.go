@@ -1,6 +1,7 @@
 package node_cmd
 
 import (
+	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/spf13/cobra"
 )
@@ -22,7 +23,13 @@ func runBalanceCmd(_ *cobra.Command, _ []string) {
 	glb.InitLedgerFromNode()
 	accountable := glb.MustGetTarget()
 
-	outs, err := glb.GetClient().GetAccountOutputs(accountable)
+	var outs []*ledger.OutputWithID
+	var err error
+	if glb.LightMode() {
+		outs, err = glb.GetLightClient().GetAccountOutputs(accountable)
+	} else {
+		outs, err = glb.GetClient().GetAccountOutputs(accountable)
+	}
 	glb.AssertNoError(err)
 	glb.Infof("TOTALS:")
 	displayTotals(outs)
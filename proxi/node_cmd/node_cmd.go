@@ -39,6 +39,10 @@ func Init() *cobra.Command {
 	err = viper.BindPFlag("finality.weak", nodeCmd.PersistentFlags().Lookup("finality.weak"))
 	glb.AssertNoError(err)
 
+	nodeCmd.PersistentFlags().BoolP("light", "l", false, "verify data received from the node with the light client (balance and transfer)")
+	err = viper.BindPFlag("light", nodeCmd.PersistentFlags().Lookup("light"))
+	glb.AssertNoError(err)
+
 	nodeCmd.InitDefaultHelpCmd()
 	nodeCmd.AddCommand(
 		initGetOutputsCmd(),
@@ -52,6 +56,8 @@ func Init() *cobra.Command {
 		initNodeInfoCmd(),
 		seq_cmd.Init(),
 		initScoreCmd(),
+		initTokensCmd(),
+		initPeersCmd(),
 	)
 
 	//node_cmd.Init(nodeCmd) ????
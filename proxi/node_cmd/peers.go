@@ -0,0 +1,90 @@
+package node_cmd
+
+import (
+	"time"
+
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/spf13/cobra"
+)
+
+var blockPeerDurationSec int
+
+func initPeersCmd() *cobra.Command {
+	peersCmd := &cobra.Command{
+		Use:   "peers",
+		Short: `displays peers of the node. Subcommands manage peers at runtime. Available only on the node's host`,
+		Args:  cobra.NoArgs,
+		Run:   runPeersCmd,
+	}
+	addCmd := &cobra.Command{
+		Use:   "add <name> <multiaddr>",
+		Short: `adds static peer. Multiaddress must contain /p2p/<peer ID> component`,
+		Args:  cobra.ExactArgs(2),
+		Run:   runAddPeerCmd,
+	}
+	removeCmd := &cobra.Command{
+		Use:   "remove <peer ID>",
+		Short: `removes peer`,
+		Args:  cobra.ExactArgs(1),
+		Run:   runRemovePeerCmd,
+	}
+	blockCmd := &cobra.Command{
+		Use:   "block <peer ID>",
+		Short: `blocks communications with the peer. Duration 0 unblocks the peer`,
+		Args:  cobra.ExactArgs(1),
+		Run:   runBlockPeerCmd,
+	}
+	blockCmd.Flags().IntVarP(&blockPeerDurationSec, "duration", "d", 600, "duration of the block in seconds")
+
+	peersCmd.AddCommand(addCmd, removeCmd, blockCmd)
+	peersCmd.InitDefaultHelpCmd()
+	return peersCmd
+}
+
+func runPeersCmd(_ *cobra.Command, _ []string) {
+	peers, err := glb.GetAdminClient().GetPeersInfo()
+	glb.AssertNoError(err)
+
+	glb.Infof("%d peer(s):", len(peers))
+	for _, p := range peers {
+		kind := "dynamic"
+		if p.Static {
+			kind = "static"
+		}
+		glb.Infof("  %s (%s, %s)", p.ID, p.Name, kind)
+		lastActivity := "never"
+		if p.LastActivity != 0 {
+			lastActivity = time.UnixMilli(p.LastActivity).Format(time.DateTime)
+		}
+		glb.Infof("      alive: %v, last activity: %s, has tx store: %v", p.Alive, lastActivity, p.HasTxStore)
+		glb.Infof("      reputation score: %d, bans: %d", p.Score, p.NumBans)
+		if p.BlockedUntil != 0 {
+			glb.Infof("      blocked until: %s", time.UnixMilli(p.BlockedUntil).Format(time.DateTime))
+		}
+		glb.Infof("      messages in: %s (%s bytes), out: %s (%s bytes), dropped: %s",
+			util.GoTh(p.MsgIn), util.GoTh(p.BytesIn), util.GoTh(p.MsgOut), util.GoTh(p.BytesOut), util.GoTh(p.MsgDropped))
+		for _, a := range p.Addrs {
+			glb.Infof("      %s", a)
+		}
+	}
+}
+
+func runAddPeerCmd(_ *cobra.Command, args []string) {
+	glb.AssertNoError(glb.GetAdminClient().AddPeer(args[0], args[1]))
+	glb.Infof("peer '%s' has been added", args[0])
+}
+
+func runRemovePeerCmd(_ *cobra.Command, args []string) {
+	glb.AssertNoError(glb.GetAdminClient().RemovePeer(args[0]))
+	glb.Infof("peer %s has been removed", args[0])
+}
+
+func runBlockPeerCmd(_ *cobra.Command, args []string) {
+	glb.AssertNoError(glb.GetAdminClient().BlockPeer(args[0], time.Duration(blockPeerDurationSec)*time.Second))
+	if blockPeerDurationSec > 0 {
+		glb.Infof("peer %s has been blocked for %d seconds", args[0], blockPeerDurationSec)
+	} else {
+		glb.Infof("peer %s has been unblocked", args[0])
+	}
+}
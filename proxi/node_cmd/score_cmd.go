@@ -3,7 +3,7 @@ package node_cmd
 import (
 	"github.com/lunfardo314/proxima/api"
 	"github.com/lunfardo314/proxima/ledger"
-	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/multistate/rootrecord"
 	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/lunfardo314/proxima/util"
 	"github.com/spf13/cobra"
@@ -67,6 +67,6 @@ func runScoreCmd(_ *cobra.Command, args []string) {
 		glb.Infof(" %s%s %20s  %s  %s  (> %s)",
 			in, dominating,
 			util.GoTh(incl.RootRecord.LedgerCoverage), incl.BranchID.StringShort(), incl.RootRecord.SequencerID.StringShort(),
-			util.GoTh(multistate.AbsoluteStrongFinalityCoverageThreshold(incl.RootRecord.Supply, inclusionThresholdNumerator, inclusionThresholdDenominator)))
+			util.GoTh(rootrecord.AbsoluteStrongFinalityCoverageThreshold(incl.RootRecord.Supply, inclusionThresholdNumerator, inclusionThresholdDenominator)))
 	}
 }
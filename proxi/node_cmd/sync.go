@@ -1,6 +1,9 @@
 package node_cmd
 
 import (
+	"time"
+
+	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/spf13/cobra"
 )
 
@@ -17,22 +20,22 @@ func initSyncInfoCmd() *cobra.Command {
 }
 
 func runSyncInfoCmd(_ *cobra.Command, _ []string) {
-	//InitLedgerFromNode()
-	//
-	//syncInfo, err := getClient().GetSyncInfo()
-	//glb.AssertNoError(err)
-	//glb.Infof("  node synced: %v", syncInfo.Synced)
-	//glb.Infof("  in the sync window: %v", syncInfo.InSyncWindow)
-	//glb.Infof("  activity by sequencer:")
-	//sorted := util.KeysSorted(syncInfo.PerSequencer, func(k1, k2 ledger.ChainID) bool {
-	//	return bytes.Compare(k1[:], k2[:]) < 0
-	//})
-	//for _, seqID := range sorted {
-	//	si := syncInfo.PerSequencer[seqID]
-	//	seenBack := time.Since(ledger.MustNewLedgerTime(ledger.Slot(si.LatestSeenSlot), 0).Time())
-	//	bookedBack := time.Since(ledger.MustNewLedgerTime(ledger.Slot(si.LatestBookedSlot), 0).Time())
-	//	active := seenBack < ledger.SlotDuration()
-	//	glb.Infof("        %s : active/synced: %v/%v, last seen slot: %d (%v back), last booked slot: %d (%v back)",
-	//		seqID.StringShort(), active, si.Synced, si.LatestSeenSlot, seenBack, si.LatestBookedSlot, bookedBack)
-	//}
+	glb.InitLedgerFromNode()
+
+	syncInfo, err := glb.GetClient().GetSyncInfo()
+	glb.AssertNoError(err)
+	glb.Infof("  node synced: %v", syncInfo.Synced)
+	glb.Infof("  latest slot in the state: %d, current slot: %d (%d slots behind)",
+		syncInfo.LatestSlot, syncInfo.CurrentSlot, syncInfo.CurrentSlot-syncInfo.LatestSlot)
+	bs := syncInfo.BulkSync
+	if bs == nil {
+		glb.Infof("  bulk sync: never started")
+		return
+	}
+	glb.Infof("  bulk sync: in progress: %v, started %v ago, peer: %s", bs.InProgress, time.Since(time.Unix(bs.Started, 0)).Round(time.Second), bs.PeerID)
+	glb.Infof("      slots [%d, %d], branches fetched: %d/%d, transactions received: %d",
+		bs.FromSlot, bs.ToSlot, bs.NumBranchesFetched, bs.NumBranches, bs.NumTxReceived)
+	if bs.LastError != "" {
+		glb.Infof("      last error: %s", bs.LastError)
+	}
 }
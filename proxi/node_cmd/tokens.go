@@ -0,0 +1,158 @@
+package node_cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lunfardo314/proxima/api/client"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/proxi/glb"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/spf13/cobra"
+)
+
+func initTokensCmd() *cobra.Command {
+	tokensCmd := &cobra.Command{
+		Use:   "tokens [<subcommand>]",
+		Short: `native token subcommands`,
+		Args:  cobra.NoArgs,
+	}
+	glb.AddFlagTarget(tokensCmd)
+
+	balanceCmd := &cobra.Command{
+		Use:     "balance",
+		Aliases: []string{"bal"},
+		Short:   `displays token balances of the target account`,
+		Args:    cobra.NoArgs,
+		Run:     runTokensBalanceCmd,
+	}
+
+	mintCmd := &cobra.Command{
+		Use:   "mint <chain id> <amount>",
+		Short: `mints tokens controlled by the chain and sends them to the target. Token ID is the chain ID`,
+		Args:  cobra.ExactArgs(2),
+		Run:   runTokensMintCmd,
+	}
+	glb.AddFlagTraceTx(mintCmd)
+
+	transferCmd := &cobra.Command{
+		Use:   "transfer <token id> <amount>",
+		Short: `sends tokens from the wallet's account to the target`,
+		Args:  cobra.ExactArgs(2),
+		Run:   runTokensTransferCmd,
+	}
+	glb.AddFlagTraceTx(transferCmd)
+
+	tokensCmd.AddCommand(balanceCmd, mintCmd, transferCmd)
+	tokensCmd.InitDefaultHelpCmd()
+	return tokensCmd
+}
+
+func runTokensBalanceCmd(_ *cobra.Command, _ []string) {
+	glb.InitLedgerFromNode()
+	accountable := glb.MustGetTarget()
+
+	balances, err := glb.GetClient().GetTokenBalances(accountable)
+	glb.AssertNoError(err)
+
+	glb.Infof("token balances of %s:", accountable.String())
+	if len(balances) == 0 {
+		glb.Infof("   (none)")
+		return
+	}
+	for id, amount := range balances {
+		glb.Infof("   %s: %s", id.StringHex(), util.GoTh(amount))
+	}
+}
+
+func runTokensMintCmd(_ *cobra.Command, args []string) {
+	glb.InitLedgerFromNode()
+	walletData := glb.GetWalletData()
+
+	chainID, err := ledger.ChainIDFromHexString(args[0])
+	glb.AssertNoError(err)
+	amount, err := strconv.ParseUint(args[1], 10, 64)
+	glb.AssertNoError(err)
+	target := glb.MustGetTarget()
+
+	tagAlongSeqID, feeAmount := mustGetTagAlongSequencerAndFee()
+	prompt := fmt.Sprintf("mint %s tokens %s to %s. It will cost %d of fees paid to the tag-along sequencer %s. Proceed?",
+		util.GoTh(amount), chainID.StringShort(), target.String(), feeAmount, tagAlongSeqID.StringShort())
+	if !glb.YesNoPrompt(prompt, true) {
+		glb.Infof("exit")
+		os.Exit(0)
+	}
+
+	txCtx, err := glb.GetClient().MintTokens(client.MintTokensParams{
+		WalletPrivateKey: walletData.PrivateKey,
+		ChainID:          chainID,
+		TagAlongSeqID:    tagAlongSeqID,
+		TagAlongFee:      feeAmount,
+		Amount:           amount,
+		Target:           target.AsLock(),
+		TraceTx:          glb.TraceTx(),
+	})
+	reportTokenTx(txCtx, err)
+}
+
+func runTokensTransferCmd(_ *cobra.Command, args []string) {
+	glb.InitLedgerFromNode()
+	walletData := glb.GetWalletData()
+
+	tokenID, err := ledger.ChainIDFromHexString(args[0])
+	glb.AssertNoError(err)
+	amount, err := strconv.ParseUint(args[1], 10, 64)
+	glb.AssertNoError(err)
+	target := glb.MustGetTarget()
+
+	tagAlongSeqID, feeAmount := mustGetTagAlongSequencerAndFee()
+	prompt := fmt.Sprintf("transfer %s tokens %s to %s. It will cost %d of fees paid to the tag-along sequencer %s. Proceed?",
+		util.GoTh(amount), tokenID.StringShort(), target.String(), feeAmount, tagAlongSeqID.StringShort())
+	if !glb.YesNoPrompt(prompt, true) {
+		glb.Infof("exit")
+		os.Exit(0)
+	}
+
+	txCtx, err := glb.GetClient().TransferTokens(client.TransferTokensParams{
+		WalletPrivateKey: walletData.PrivateKey,
+		TokenID:          tokenID,
+		TagAlongSeqID:    tagAlongSeqID,
+		TagAlongFee:      feeAmount,
+		Amount:           amount,
+		Target:           target.AsLock(),
+		TraceTx:          glb.TraceTx(),
+	})
+	reportTokenTx(txCtx, err)
+}
+
+func mustGetTagAlongSequencerAndFee() (*ledger.ChainID, uint64) {
+	feeAmount := getTagAlongFee()
+	glb.Assertf(feeAmount > 0, "tag-along fee is configured 0. Fee-less option not supported yet")
+	tagAlongSeqID := GetTagAlongSequencerID()
+	glb.Assertf(tagAlongSeqID != nil, "tag-along sequencer not specified")
+
+	md, err := glb.GetClient().GetMilestoneDataFromHeaviestState(*tagAlongSeqID)
+	glb.AssertNoError(err)
+
+	if md != nil && md.MinimumFee > feeAmount {
+		feeAmount = md.MinimumFee
+	}
+	return tagAlongSeqID, feeAmount
+}
+
+func reportTokenTx(txCtx *transaction.TxContext, err error) {
+	if txCtx != nil {
+		glb.Verbosef("-------- token transaction ---------\n%s\n----------------", txCtx.String())
+	}
+	glb.AssertNoError(err)
+	glb.Assertf(txCtx != nil, "inconsistency: txCtx == nil")
+	glb.Infof("transaction submitted successfully")
+
+	if glb.NoWait() {
+		return
+	}
+	glb.ReportTxInclusion(*txCtx.TransactionID(), time.Second)
+}
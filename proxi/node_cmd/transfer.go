@@ -8,6 +8,7 @@ import (
 
 	"github.com/lunfardo314/proxima/api/client"
 	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
 	"github.com/lunfardo314/proxima/proxi/glb"
 	"github.com/spf13/cobra"
 )
@@ -61,14 +62,20 @@ func runTransferCmd(_ *cobra.Command, args []string) {
 		os.Exit(0)
 	}
 
-	txCtx, err := glb.GetClient().TransferFromED25519Wallet(client.TransferFromED25519WalletParams{
+	par := client.TransferFromED25519WalletParams{
 		WalletPrivateKey: walletData.PrivateKey,
 		TagAlongSeqID:    tagAlongSeqID,
 		TagAlongFee:      feeAmount,
 		Amount:           amount,
 		Target:           target.AsLock(),
 		TraceTx:          glb.TraceTx(),
-	})
+	}
+	var txCtx *transaction.TxContext
+	if glb.LightMode() {
+		txCtx, err = glb.GetLightClient().TransferFromED25519Wallet(par)
+	} else {
+		txCtx, err = glb.GetClient().TransferFromED25519Wallet(par)
+	}
 
 	if txCtx != nil {
 		glb.Verbosef("-------- transfer transaction ---------\n%s\n----------------", txCtx.String())
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/lunfardo314/proxima/core/attacher"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/peering"
+	"github.com/lunfardo314/proxima/sequencer"
+	"github.com/lunfardo314/proxima/util/set"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// simNetTestData is the network of nodes, each running the workflow on the simulated network.
+// All nodes start from the same genesis
+type simNetTestData struct {
+	t     *testing.T
+	sn    *peering.SimNet
+	nodes []*workflowTestData
+	peers []*peering.Peers
+	// sequencers[i] runs on nodes[i]. sequencers[0] is the bootstrap sequencer
+	sequencers []*sequencer.Sequencer
+}
+
+func initSimNetTest(t *testing.T, numNodes, nSequencers, degree int, link peering.LinkConfig, seed int64) *simNetTestData {
+	ret := &simNetTestData{
+		t:     t,
+		sn:    peering.NewSimNet(seed, link),
+		nodes: make([]*workflowTestData, numNodes),
+		peers: make([]*peering.Peers, numNodes),
+	}
+	// identity contains genesis time, so it is created once. Otherwise, nodes initialized in different seconds
+	// would have different genesis states
+	stateID := ledger.DefaultIdentityData(testutil.GetTestingPrivateKey())
+	for i := range ret.nodes {
+		cfg := ret.sn.NewConfig()
+		ret.nodes[i] = initWorkflowTestWithPeers(t, nSequencers, stateID, func(env *workflowDummyEnvironment) *peering.Peers {
+			var err error
+			ret.peers[i], err = ret.sn.New(env, cfg)
+			require.NoError(t, err)
+			return ret.peers[i]
+		})
+		require.NoError(t, attacher.EnsureLatestBranches(ret.nodes[i].wrk))
+	}
+	// random sparse topology, known peers are symmetric. The ring ensures the network is connected
+	rnd := rand.New(rand.NewSource(seed))
+	known := set.New[[2]int]()
+	addPeer := func(i, j int) {
+		require.NoError(t, ret.peers[i].AddPeer(ret.sn.PeerAddr(ret.peers[j].SelfID()), fmt.Sprintf("node%d", j)))
+		known.Insert([2]int{i, j})
+	}
+	for i := range ret.nodes {
+		for _, j := range append(rnd.Perm(numNodes)[:degree], (i+1)%numNodes) {
+			if j == i || known.Contains([2]int{i, j}) {
+				continue
+			}
+			addPeer(i, j)
+			addPeer(j, i)
+		}
+	}
+	for i, peers := range ret.peers {
+		peers.Run()
+		env, peers1 := ret.nodes[i].env, peers
+		go func() {
+			<-env.Ctx().Done()
+			peers1.Stop()
+		}()
+	}
+	return ret
+}
+
+// startSequencers starts bootstrap sequencer on the node 0 and nSequencers sequencers on nodes 1..nSequencers
+func (sd *simNetTestData) startSequencers(nSequencers int) {
+	boot := sd.nodes[0]
+	boot.makeChainOrigins(nSequencers)
+
+	var err error
+	sd.sequencers = make([]*sequencer.Sequencer, nSequencers+1)
+	sd.sequencers[0], err = sequencer.New(boot.wrk, boot.bootstrapChainID, boot.genesisPrivKey,
+		sequencer.WithName("boot"),
+		sequencer.WithMaxTagAlongInputs(30),
+		sequencer.WithPace(5),
+	)
+	require.NoError(sd.t, err)
+	sd.sequencers[0].Start()
+
+	// chain origins are submitted after the bootstrap sequencer starts listening to its account. Otherwise, the
+	// tag-along output is missed by its backlog when the network is started long after the genesis
+	chainOriginsTxID, err := boot.wrk.TxBytesIn(boot.chainOriginsTx.Bytes())
+	require.NoError(sd.t, err)
+
+	for i := 1; i <= nSequencers; i++ {
+		// chain origin reaches the node with branches of the bootstrap sequencer
+		_, err = sd.nodes[i].wrk.WaitUntilTransactionInHeaviestState(*chainOriginsTxID, 20*time.Second)
+		require.NoError(sd.t, err)
+
+		sd.sequencers[i], err = sequencer.New(sd.nodes[i].wrk, boot.chainOrigins[i-1].ChainID, boot.privKeyAux,
+			sequencer.WithName(fmt.Sprintf("seq%d", i)),
+			sequencer.WithMaxTagAlongInputs(30),
+			sequencer.WithPace(5),
+		)
+		require.NoError(sd.t, err)
+		sd.sequencers[i].Start()
+	}
+}
+
+func (sd *simNetTestData) stopSequencers() {
+	for _, seq := range sd.sequencers {
+		seq.Stop()
+	}
+}
+
+// heaviestBranches returns heaviest branch of the latest slot in the state of each node.
+// Branches with equal coverage are ordered by transaction ID, so that the choice does not depend on the node
+func (sd *simNetTestData) heaviestBranches() []ledger.TransactionID {
+	ret := make([]ledger.TransactionID, len(sd.nodes))
+	for i, node := range sd.nodes {
+		var heaviest *multistate.BranchData
+		for _, br := range multistate.FetchLatestBranches(node.wrk.StateStore()) {
+			if heaviest == nil || br.LedgerCoverage > heaviest.LedgerCoverage ||
+				(br.LedgerCoverage == heaviest.LedgerCoverage && ledger.LessTxID(*br.TxID(), *heaviest.TxID())) {
+				heaviest = br
+			}
+		}
+		ret[i] = *heaviest.TxID()
+	}
+	return ret
+}
+
+// converged waits until all nodes have the same heaviest branch and returns the time it took
+func (sd *simNetTestData) converged(timeout time.Duration) time.Duration {
+	start := time.Now()
+	require.Eventually(sd.t, func() bool {
+		branches := sd.heaviestBranches()
+		for _, txid := range branches[1:] {
+			if txid != branches[0] {
+				return false
+			}
+		}
+		return true
+	}, timeout, 50*time.Millisecond)
+	return time.Since(start)
+}
+
+func (sd *simNetTestData) stopAndWait() {
+	for _, node := range sd.nodes {
+		node.stop()
+	}
+	for _, node := range sd.nodes {
+		node.waitStop(5 * time.Second)
+	}
+	require.NoError(sd.t, sd.sn.Close())
+}
+
+func TestSimNetSequencers(t *testing.T) {
+	const (
+		numNodes    = 10
+		degree      = 2
+		nSequencers = 2 // in addition to bootstrap
+		seed        = 12345
+		runSlots    = 10
+	)
+	link := peering.LinkConfig{Latency: 20 * time.Millisecond, Bandwidth: 1_000_000}
+
+	// genesis is created when the package is initialized, so all phases run on one network
+	sd := initSimNetTest(t, numNodes, nSequencers, degree, link, seed)
+	sd.startSequencers(nSequencers)
+	defer sd.stopAndWait()
+
+	t.Run("convergence", func(t *testing.T) {
+		time.Sleep(runSlots * ledger.SlotDuration())
+
+		d := sd.converged(10 * time.Second)
+		t.Logf("%d nodes converged to the heaviest branch %s in %v", numNodes, sd.heaviestBranches()[0].StringShort(), d)
+	})
+	t.Run("partition", func(t *testing.T) {
+		// nodes without sequencers are isolated and catch up with the heaviest chain after healing
+		isolated := make([]peer.ID, 0, numNodes/2)
+		for _, peers := range sd.peers[numNodes/2:] {
+			isolated = append(isolated, peers.SelfID())
+		}
+		require.NoError(t, sd.sn.Partition(isolated))
+		time.Sleep(runSlots * ledger.SlotDuration())
+		require.NoError(t, sd.sn.Heal())
+		time.Sleep(5 * ledger.SlotDuration())
+		sd.stopSequencers()
+
+		// isolated nodes commit missed branches slot by slot, so the time to converge grows with the missed slots
+		d := sd.converged(2 * (runSlots + 5) * ledger.SlotDuration())
+		t.Logf("%d nodes converged to the heaviest branch %s in %v after healing of the partition",
+			numNodes, sd.heaviestBranches()[0].StringShort(), d)
+	})
+}
+
+// TestSimNetSequencers50 runs consensus of several sequencers on 50 nodes with lossy links.
+// All nodes run in one process, so the test needs several CPUs: on a single CPU goroutines of the attachers
+// are starved and the node stops on the timeout of the attachment callback
+func TestSimNetSequencers50(t *testing.T) {
+	const (
+		numNodes    = 50
+		degree      = 3
+		nSequencers = 4 // in addition to bootstrap
+		seed        = 12345
+		runSlots    = 10
+		minCPUs     = 4
+	)
+	if runtime.NumCPU() < minCPUs {
+		t.Skipf("%d nodes with sequencers need at least %d CPUs, %d available", numNodes, minCPUs, runtime.NumCPU())
+	}
+	link := peering.LinkConfig{Latency: 20 * time.Millisecond, Bandwidth: 1_000_000, Loss: 0.01}
+
+	sd := initSimNetTest(t, numNodes, nSequencers, degree, link, seed)
+	sd.startSequencers(nSequencers)
+	defer sd.stopAndWait()
+
+	time.Sleep(runSlots * ledger.SlotDuration())
+	sd.stopSequencers()
+
+	d := sd.converged(2 * runSlots * ledger.SlotDuration())
+	numFrames, numDropped := sd.sn.Stats()
+	t.Logf("%d nodes with %d sequencers converged to the heaviest branch %s in %v. Frames: %d, lost: %d",
+		numNodes, nSequencers+1, sd.heaviestBranches()[0].StringShort(), d, numFrames, numDropped)
+}
@@ -95,9 +95,17 @@ const (
 )
 
 func initWorkflowTest(t *testing.T, nChains int, startPruner ...bool) *workflowTestData {
+	stateID := ledger.DefaultIdentityData(testutil.GetTestingPrivateKey())
+	return initWorkflowTestWithPeers(t, nChains, stateID, func(_ *workflowDummyEnvironment) *peering.Peers {
+		return peering.NewPeersDummy()
+	}, startPruner...)
+}
+
+// initWorkflowTestWithPeers creates the genesis state and starts the workflow with the peering created by newPeers.
+// Genesis is the same for the same nChains and state identity, so nodes of the simulated network can be initialized independently
+func initWorkflowTestWithPeers(t *testing.T, nChains int, stateID *ledger.IdentityData, newPeers func(env *workflowDummyEnvironment) *peering.Peers, startPruner ...bool) *workflowTestData {
 	util.Assertf(nChains > 0, "nChains > 0")
 	genesisPrivKey := testutil.GetTestingPrivateKey()
-	stateID := ledger.DefaultIdentityData(genesisPrivKey)
 	t.Logf("genesis state ID: %s", stateID.String())
 
 	distrib, privKeys, addrs := inittest.GenesisParamsWithPreDistribution(initBalance, uint64(nChains*initBalance+tagAlongFee), initBalance)
@@ -141,9 +149,9 @@ func initWorkflowTest(t *testing.T, nChains int, startPruner ...bool) *workflowT
 
 	ret.env = newWorkflowDummyEnvironment(stateStore, ret.txStore)
 	if len(startPruner) > 0 && startPruner[0] {
-		ret.wrk = workflow.New(ret.env, peering.NewPeersDummy())
+		ret.wrk = workflow.New(ret.env, newPeers(ret.env))
 	} else {
-		ret.wrk = workflow.New(ret.env, peering.NewPeersDummy(), workflow.OptionDoNotStartPruner)
+		ret.wrk = workflow.New(ret.env, newPeers(ret.env), workflow.OptionDoNotStartPruner)
 	}
 	ret.wrk.Start()
 
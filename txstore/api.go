@@ -0,0 +1,60 @@
+package txstore
+
+import "math"
+
+// HTTP API of the remote transaction store. The same API is used by the standalone transaction store server
+// and by the 'url' transaction store client of the node
+
+const (
+	PathPersistTx = "/txstore/persist"
+	PathGetTx     = "/txstore/get"
+	PathHasTx     = "/txstore/has"
+	PathTxIDs     = "/txstore/txids"
+	PathBranches  = "/txstore/branches"
+	PathSequencer = "/txstore/sequencer"
+	PathPing      = "/txstore/ping"
+)
+
+// MaxSlotSpanTxIDs is the maximum number of slots in one 'txids', 'branches' or 'sequencer' request
+const MaxSlotSpanTxIDs = 100
+
+// MaxPersistRequestSize is the maximum size of the body of the 'persist' request. Transactions with metadata
+// exchanged between peers are never bigger
+const MaxPersistRequestSize = math.MaxUint16
+
+// 'persist' request must carry the token of the server in the header 'Authorization: Bearer <token>'
+const authorizationBearerPrefix = "Bearer "
+
+type (
+	Error struct {
+		// empty string when no error
+		Error string `json:"error,omitempty"`
+	}
+
+	// PersistTxResponse is returned by 'persist'
+	PersistTxResponse struct {
+		Error
+		// hex-encoded transaction ID
+		TxID string `json:"txid,omitempty"`
+	}
+
+	// GetTxResponse is returned by 'get'
+	GetTxResponse struct {
+		Error
+		// hex-encoded metadata bytes concatenated with transaction bytes. Empty if transaction is not in the store
+		Data string `json:"data,omitempty"`
+	}
+
+	// HasTxResponse is returned by 'has'
+	HasTxResponse struct {
+		Error
+		Has bool `json:"has"`
+	}
+
+	// TxIDsResponse is returned by 'txids', 'branches' and 'sequencer'
+	TxIDsResponse struct {
+		Error
+		// hex-encoded transaction IDs
+		TxIDs []string `json:"txids,omitempty"`
+	}
+)
@@ -0,0 +1,218 @@
+package txstore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Indexes of the transaction store.
+// Transaction ID starts with the timestamp and the sequencer flag, so transaction IDs stored as keys are already
+// ordered by slot and branch transactions of the slot have common prefix: slot with sequencer flag and tick 0.
+// Those are used as slot and branch indexes.
+// Sequencer milestones are indexed by sequencer ID with the secondary index maintained by PersistTxBytesWithMetadata:
+//   <index prefix> 's' <sequencer ID> <transaction ID>
+// Index prefix is never a prefix of a valid transaction ID: maximum slot with sequencer flag followed by invalid tick 0xff
+
+var indexPrefix = []byte{0xff, 0xff, 0xff, 0xff, 0xff}
+
+const (
+	indexSequencer = byte('s')
+	indexVersion   = byte('v')
+	// indexPruningCursor is not an index, the key stores the state of pruning
+	indexPruningCursor = byte('p')
+
+	currentIndexVersion = byte(1)
+
+	// indexBatchSize maximum number of index entries written in one batch when indexes are built
+	indexBatchSize = 1000
+)
+
+func sequencerIndexPrefix(seqID *ledger.ChainID) []byte {
+	return common.Concat(indexPrefix, indexSequencer, seqID[:])
+}
+
+func sequencerIndexKey(seqID *ledger.ChainID, txid *ledger.TransactionID) []byte {
+	return common.Concat(sequencerIndexPrefix(seqID), txid[:])
+}
+
+func indexVersionKey() []byte {
+	return common.Concat(indexPrefix, indexVersion)
+}
+
+// indexKeys returns keys of the secondary index entries of the transaction
+func indexKeys(tx *transaction.Transaction) [][]byte {
+	if !tx.IsSequencerMilestone() {
+		return nil
+	}
+	if tx.SequencerTransactionData() == nil {
+		if err := tx.Validate(transaction.ScanSequencerData()); err != nil {
+			// malformed milestones are not indexed
+			return nil
+		}
+	}
+	return [][]byte{sequencerIndexKey(&tx.SequencerTransactionData().SequencerID, tx.ID())}
+}
+
+// indexKeysOfStored returns keys of the secondary index entries of the stored transaction
+func indexKeysOfStored(txid *ledger.TransactionID, txBytesWithMetadata []byte) [][]byte {
+	if !txid.IsSequencerMilestone() || len(txBytesWithMetadata) == 0 {
+		return nil
+	}
+	_, txBytes, err := txmetadata.SplitTxBytesWithMetadata(txBytesWithMetadata)
+	if err != nil {
+		return nil
+	}
+	tx, err := transaction.FromBytes(txBytes)
+	if err != nil {
+		return nil
+	}
+	return indexKeys(tx)
+}
+
+// ensureIndexes builds secondary indexes of transactions stored before the indexes were introduced.
+// Milestones are read slot by slot and index entries are written in batches of bounded size
+func (s *SimpleTxBytesStore) ensureIndexes() error {
+	if version := s.s.Get(indexVersionKey()); len(version) == 1 && version[0] == currentIndexVersion {
+		return nil
+	}
+	fromSlot, toSlot, found, err := s.storedSlotRange()
+	if err != nil {
+		return fmt.Errorf("ensureIndexes: %w", err)
+	}
+	batch := s.batchedWriter()
+	inBatch := 0
+	if found {
+		err = iterateSlots(fromSlot, toSlot, func(slot ledger.Slot) (bool, error) {
+			var errCommit error
+			prefix := ledger.NewTransactionIDPrefix(slot, true)
+			// transaction IDs of the slot are collected before the callback is called, so it can read and write
+			exit, errIter := s.iterateTxIDs(prefix[:], 0, func(txid ledger.TransactionID) bool {
+				for _, k := range indexKeysOfStored(&txid, s.s.Get(txid[:])) {
+					batch.Set(k, indexValue)
+					inBatch++
+				}
+				if inBatch >= indexBatchSize {
+					if errCommit = batch.Commit(); errCommit != nil {
+						return false
+					}
+					batch, inBatch = s.batchedWriter(), 0
+				}
+				return true
+			})
+			if errIter != nil {
+				return true, errIter
+			}
+			return exit, errCommit
+		})
+		if err != nil {
+			return fmt.Errorf("ensureIndexes: %w", err)
+		}
+	}
+	batch.Set(indexVersionKey(), []byte{currentIndexVersion})
+	return batch.Commit()
+}
+
+// storedSlotRange scans all keys of the store and returns the earliest and the latest slot of stored transactions
+func (s *SimpleTxBytesStore) storedSlotRange() (fromSlot, toSlot ledger.Slot, found bool, err error) {
+	trav, ok := s.s.(common.Traversable)
+	if !ok {
+		return 0, 0, false, fmt.Errorf("transaction store is not traversable")
+	}
+	trav.Iterator(nil).IterateKeys(func(k []byte) bool {
+		txid, errParse := ledger.TransactionIDFromBytes(k)
+		if errParse != nil {
+			// index entry
+			return true
+		}
+		if !found {
+			fromSlot, toSlot, found = txid.Slot(), txid.Slot(), true
+		}
+		fromSlot, toSlot = min(fromSlot, txid.Slot()), max(toSlot, txid.Slot())
+		return true
+	})
+	return
+}
+
+// indexValue is the value of index entries. Empty value would mean deletion
+var indexValue = []byte{1}
+
+// iterateTxIDs iterates transaction IDs in the keys with the prefix in the order of transaction IDs.
+// Keys of other length are skipped. Prefix is expected to cover one slot, so transaction IDs are sorted in memory,
+// because not all key/value stores iterate in the order of keys
+func (s *SimpleTxBytesStore) iterateTxIDs(prefix []byte, keyOffset int, fun func(txid ledger.TransactionID) bool) (bool, error) {
+	trav, ok := s.s.(common.Traversable)
+	if !ok {
+		return false, fmt.Errorf("transaction store is not traversable")
+	}
+	txids := make([]ledger.TransactionID, 0)
+	// Iterate instead of IterateKeys: key iterator of the badger adaptor does not seek to the prefix
+	trav.Iterator(prefix).Iterate(func(k, _ []byte) bool {
+		if len(k) == keyOffset+ledger.TransactionIDLength {
+			txid, _ := ledger.TransactionIDFromBytes(k[keyOffset:])
+			txids = append(txids, txid)
+		}
+		return true
+	})
+	sort.Slice(txids, func(i, j int) bool {
+		return bytes.Compare(txids[i][:], txids[j][:]) < 0
+	})
+	for _, txid := range txids {
+		if !fun(txid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IterateTxIDsInSlots iterates IDs of all stored transactions in the slot range [fromSlot, toSlot], slot by slot.
+// Sequencer transactions of the slot go first
+func (s *SimpleTxBytesStore) IterateTxIDsInSlots(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	return iterateSlots(fromSlot, toSlot, func(slot ledger.Slot) (bool, error) {
+		for _, seqFlag := range []bool{true, false} {
+			prefix := ledger.NewTransactionIDPrefix(slot, seqFlag)
+			if exit, err := s.iterateTxIDs(prefix[:], 0, fun); exit || err != nil {
+				return exit, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// IterateBranchTxIDs iterates IDs of stored branch transactions in the slot range [fromSlot, toSlot]
+func (s *SimpleTxBytesStore) IterateBranchTxIDs(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	return iterateSlots(fromSlot, toSlot, func(slot ledger.Slot) (bool, error) {
+		prefix := ledger.NewTransactionIDPrefix(slot, true)
+		return s.iterateTxIDs(common.Concat(prefix[:], byte(0)), 0, fun)
+	})
+}
+
+// IterateSequencerMilestones iterates IDs of stored milestones of the sequencer in the slot range [fromSlot, toSlot],
+// in the order of timestamps
+func (s *SimpleTxBytesStore) IterateSequencerMilestones(seqID ledger.ChainID, fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	seqPrefix := sequencerIndexPrefix(&seqID)
+	return iterateSlots(fromSlot, toSlot, func(slot ledger.Slot) (bool, error) {
+		prefix := ledger.NewTransactionIDPrefix(slot, true)
+		return s.iterateTxIDs(common.Concat(seqPrefix, prefix[:]), len(seqPrefix), fun)
+	})
+}
+
+// iterateSlots calls fun for each slot in the range until it returns exit flag or error
+func iterateSlots(fromSlot, toSlot ledger.Slot, fun func(slot ledger.Slot) (bool, error)) error {
+	for slot := fromSlot; slot <= toSlot; slot++ {
+		exit, err := fun(slot)
+		if exit || err != nil {
+			return err
+		}
+		if slot == toSlot {
+			// prevent overflow
+			break
+		}
+	}
+	return nil
+}
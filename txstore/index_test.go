@@ -0,0 +1,152 @@
+package txstore
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/ledger/txbuilder"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/proxima/util/utxodb"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+// makeIndexTestTransactions makes chains of sequencer milestones, one branch and transfers.
+// Transactions are not validated in the ledger state, because only their IDs and sequencer data matter for the indexes
+func makeIndexTestTransactions(t *testing.T, nChains, howLong int) (seqChains [][]*transaction.Transaction, chainIDs []ledger.ChainID, branch *transaction.Transaction, others [][]byte) {
+	u := utxodb.NewUTXODB(genesisPrivateKey)
+	addrs := make([]ledger.AddressED25519, nChains)
+	chainIDs = make([]ledger.ChainID, nChains)
+	seqChains = make([][]*transaction.Transaction, nChains)
+	// branch on the genesis chain
+	genesisOut, err := u.StateReader().GetUTXOForChainID(u.GenesisChainID())
+	require.NoError(t, err)
+	genesisChainOut, _, err := genesisOut.ParseAsChainOutput()
+	require.NoError(t, err)
+	stemOut := multistate.MakeSugared(u.StateReader()).GetStemOutput()
+	txBytes, err := txbuilder.MakeSequencerTransaction(txbuilder.MakeSequencerTransactionParams{
+		SeqName:    "boot",
+		ChainInput: genesisChainOut,
+		StemInput:  stemOut,
+		Timestamp:  ledger.MustNewLedgerTime(stemOut.Timestamp().Slot()+1, 0),
+		PrivateKey: genesisPrivateKey,
+	})
+	require.NoError(t, err)
+	branch, err = transaction.FromBytes(txBytes, transaction.MainTxValidationOptions...)
+	require.NoError(t, err)
+	require.True(t, branch.IsBranchTransaction())
+
+	ts := ledger.TimeNow()
+	for i := range chainIDs {
+		privKey := testutil.GetTestingPrivateKey(100 + i)
+		addrs[i] = ledger.AddressED25519FromPrivateKey(privKey)
+		require.NoError(t, u.TokensFromFaucet(addrs[i], ledger.L().ID.MinimumAmountOnSequencer))
+		var err error
+		chainIDs[i], err = u.CreateChainOrigin(privKey, ts)
+		require.NoError(t, err)
+
+		o, err := u.StateReader().GetUTXOForChainID(&chainIDs[i])
+		require.NoError(t, err)
+		chainOut, _, err := o.ParseAsChainOutput()
+		require.NoError(t, err)
+
+		seqChains[i] = make([]*transaction.Transaction, howLong)
+		for j := range seqChains[i] {
+			// first milestone endorses the branch, the rest extend the chain
+			var endorse []*ledger.TransactionID
+			if j == 0 {
+				endorse = util.List(branch.ID())
+			}
+			txBytes, err := txbuilder.MakeSequencerTransaction(txbuilder.MakeSequencerTransactionParams{
+				SeqName:      "seq",
+				ChainInput:   chainOut,
+				Timestamp:    ledger.MaxTime(chainOut.Timestamp(), branch.Timestamp()).AddTicks(ledger.TransactionPaceSequencer()),
+				Endorsements: endorse,
+				PrivateKey:   privKey,
+			})
+			require.NoError(t, err)
+			seqChains[i][j], err = transaction.FromBytes(txBytes, transaction.MainTxValidationOptions...)
+			require.NoError(t, err)
+			chainOut = seqChains[i][j].SequencerOutput().MustAsChainOutput()
+		}
+	}
+	for i := range addrs {
+		txBytes, err := u.MakeTransactionFromFaucet(addrs[i])
+		require.NoError(t, err)
+		require.NoError(t, u.AddTransaction(txBytes))
+		others = append(others, txBytes)
+	}
+	return
+}
+
+func TestIndexes(t *testing.T) {
+	const (
+		nChains = 3
+		howLong = 5
+	)
+	seqChains, chainIDs, branch, others := makeIndexTestTransactions(t, nChains, howLong)
+
+	kvStore := common.NewInMemoryKVStore()
+	store := NewSimpleTxBytesStore(kvStore)
+	allTxs := []*transaction.Transaction{branch}
+	for _, seqChain := range seqChains {
+		allTxs = append(allTxs, seqChain...)
+	}
+	for _, txBytes := range others {
+		tx, err := transaction.FromBytes(txBytes)
+		require.NoError(t, err)
+		allTxs = append(allTxs, tx)
+	}
+	fromSlot, toSlot := allTxs[0].Slot(), allTxs[0].Slot()
+	for i, tx := range allTxs {
+		var err error
+		if i%2 == 0 {
+			_, err = store.PersistTxWithMetadata(tx, nil)
+		} else {
+			_, err = store.PersistTxBytesWithMetadata(tx.Bytes(), nil)
+		}
+		require.NoError(t, err)
+		fromSlot, toSlot = min(fromSlot, tx.Slot()), max(toSlot, tx.Slot())
+	}
+
+	collect := func(iterate func(fun func(txid ledger.TransactionID) bool) error) []ledger.TransactionID {
+		ret := make([]ledger.TransactionID, 0)
+		require.NoError(t, iterate(func(txid ledger.TransactionID) bool {
+			ret = append(ret, txid)
+			return true
+		}))
+		return ret
+	}
+	checkIndexes := func(store *SimpleTxBytesStore) {
+		for i, seqChain := range seqChains {
+			milestones := collect(func(fun func(txid ledger.TransactionID) bool) error {
+				return store.IterateSequencerMilestones(chainIDs[i], fromSlot, toSlot, fun)
+			})
+			require.EqualValues(t, len(seqChain), len(milestones))
+			for j, tx := range seqChain {
+				require.EqualValues(t, *tx.ID(), milestones[j])
+			}
+		}
+		branches := collect(func(fun func(txid ledger.TransactionID) bool) error {
+			return store.IterateBranchTxIDs(fromSlot, toSlot, fun)
+		})
+		require.EqualValues(t, util.List(*branch.ID()), branches)
+
+		txids := collect(func(fun func(txid ledger.TransactionID) bool) error {
+			return store.IterateTxIDsInSlots(fromSlot, toSlot, fun)
+		})
+		require.EqualValues(t, len(allTxs), len(txids))
+	}
+	checkIndexes(store)
+
+	// indexes are built for the store without indexes
+	noIndexStore := common.NewInMemoryKVStore()
+	for _, tx := range allTxs {
+		txid := tx.ID()
+		noIndexStore.Set(txid[:], kvStore.Get(txid[:]))
+	}
+	checkIndexes(NewSimpleTxBytesStore(noIndexStore))
+}
@@ -0,0 +1,293 @@
+package txstore
+
+import (
+	"fmt"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util"
+	"github.com/lunfardo314/proxima/util/set"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Pruning of the transaction store.
+// Most of the stored transactions are sequencer milestones which never make it into the heaviest chain.
+// Transaction older than the horizon is deleted from the store when it is not needed anymore:
+//   - with KeepAllFinalized, transaction is kept if it is committed by any branch of the heaviest chain or is known in
+//     the heaviest latest state. The heaviest chain is walked back once per pruning run. Transactions committed by each
+//     branch in slots [slot of the tx, slot of the tx + txid pruning horizon] are taken from the difference with the state
+//     of its predecessor. Transaction older than the txid pruning horizon is not expected to be included by sequencers.
+//     The decision is final, so each slot is inspected only once
+//   - without KeepAllFinalized, transaction is kept only while it is known in the heaviest state of the latest slot,
+//     i.e. while it has unspent outputs or its ID is not pruned from the state yet. All slots from the earliest slot
+//     with kept transactions are inspected each time
+//   - in archive mode nothing is deleted
+//
+// Pruning cursor is persisted in the store under the index prefix: the earliest slot with possibly kept transactions
+// and the last inspected slot. The whole key space is scanned only once, when the cursor is not in the store yet.
+// Transactions stored later in already inspected slots are not inspected again
+
+const (
+	DefaultTxStorePruningHorizonSlots = 1000
+	DefaultTxStorePruningBatchSize    = 1000
+)
+
+type (
+	PruningParams struct {
+		// HorizonSlots transactions younger than that are never pruned
+		HorizonSlots int
+		// KeepAllFinalized keeps all transactions included into the heaviest chain
+		KeepAllFinalized bool
+		// Archive disables pruning
+		Archive bool
+		// DryRun only reports what would be deleted
+		DryRun bool
+		// BatchSize number of transactions deleted in one DB batch
+		BatchSize int
+	}
+
+	PruningReport struct {
+		DryRun   bool
+		FromSlot ledger.Slot
+		ToSlot   ledger.Slot
+		// NumCandidates number of transactions in the inspected slots
+		NumCandidates int
+		NumKept       int
+		// NumDeleted number of deleted transactions, or number of transactions to be deleted in dry run
+		NumDeleted   int
+		BytesDeleted int
+	}
+)
+
+func DefaultPruningParams() PruningParams {
+	return PruningParams{
+		HorizonSlots:     DefaultTxStorePruningHorizonSlots,
+		KeepAllFinalized: true,
+		BatchSize:        DefaultTxStorePruningBatchSize,
+	}
+}
+
+func (r *PruningReport) String() string {
+	dryRun := ""
+	if r.DryRun {
+		dryRun = " (dry run)"
+	}
+	return fmt.Sprintf("slots [%d, %d]: transactions inspected: %d, kept: %d, deleted: %d, bytes deleted: %s%s",
+		r.FromSlot, r.ToSlot, r.NumCandidates, r.NumKept, r.NumDeleted, util.GoTh(r.BytesDeleted), dryRun)
+}
+
+// Prune deletes transactions which are not part of the heaviest chain of the multi-state DB behind the horizon.
+// Returns nil report if there is nothing to inspect
+func (s *SimpleTxBytesStore) Prune(stateStore global.StateStoreReader, par PruningParams) (*PruningReport, error) {
+	s.pruningMutex.Lock()
+	defer s.pruningMutex.Unlock()
+
+	if par.Archive {
+		return nil, nil
+	}
+	util.Assertf(par.HorizonSlots > 0, "Prune: horizon must be positive")
+	if par.BatchSize <= 0 {
+		par.BatchSize = DefaultTxStorePruningBatchSize
+	}
+	latestSlot := multistate.FetchLatestSlot(stateStore)
+	if int(latestSlot) <= par.HorizonSlots {
+		return nil, nil
+	}
+	toSlot := latestSlot - ledger.Slot(par.HorizonSlots) - 1
+	cursor, err := s.pruningCursor()
+	if err != nil {
+		return nil, err
+	}
+	fromSlot := cursor.keptFromSlot
+	if par.KeepAllFinalized && cursor.inspected {
+		if cursor.inspectedUpToSlot >= toSlot {
+			return nil, nil
+		}
+		fromSlot = cursor.inspectedUpToSlot + 1
+	}
+	if fromSlot > toSlot {
+		return nil, nil
+	}
+	candidates, err := s.TxIDsInSlots(fromSlot, toSlot)
+	if err != nil {
+		return nil, err
+	}
+	ret := &PruningReport{
+		DryRun:        par.DryRun,
+		FromSlot:      fromSlot,
+		ToSlot:        toSlot,
+		NumCandidates: len(candidates),
+	}
+	isNeeded, err := finalizedFilter(stateStore, fromSlot, toSlot, par.KeepAllFinalized)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch common.KVBatchedWriter
+	inBatch := 0
+	firstKeptSlot, keptAny := ledger.Slot(0), false
+	for i := range candidates {
+		if isNeeded(&candidates[i]) {
+			ret.NumKept++
+			if !keptAny {
+				firstKeptSlot, keptAny = candidates[i].Slot(), true
+			}
+			continue
+		}
+		ret.NumDeleted++
+		data := s.s.Get(candidates[i][:])
+		ret.BytesDeleted += len(data)
+		if par.DryRun {
+			continue
+		}
+		if batch == nil {
+			batch = s.batchedWriter()
+		}
+		batch.Set(candidates[i][:], nil)
+		for _, k := range indexKeysOfStored(&candidates[i], data) {
+			batch.Set(k, nil)
+		}
+		if inBatch++; inBatch >= par.BatchSize {
+			if err = batch.Commit(); err != nil {
+				return nil, err
+			}
+			batch, inBatch = nil, 0
+		}
+	}
+	if par.DryRun {
+		return ret, nil
+	}
+	if batch == nil {
+		batch = s.batchedWriter()
+	}
+	// candidates are in the order of slots. When inspection started from the earliest slot with kept transactions,
+	// the earliest slot moves forward. Otherwise, kept transactions behind the inspected slots remain
+	if fromSlot == cursor.keptFromSlot {
+		cursor.keptFromSlot = toSlot + 1
+		if keptAny {
+			cursor.keptFromSlot = firstKeptSlot
+		}
+	}
+	cursor.inspected, cursor.inspectedUpToSlot = true, toSlot
+	batch.Set(pruningCursorKey(), cursor.Bytes())
+	if err = batch.Commit(); err != nil {
+		return nil, err
+	}
+	if s.metricsEnabled {
+		s.prunedTxCounter.Add(float64(ret.NumDeleted))
+		s.prunedTxBytesCounter.Add(float64(ret.BytesDeleted))
+	}
+	return ret, nil
+}
+
+// pruningCursor is the state of pruning persisted in the store
+type pruningCursor struct {
+	// keptFromSlot no transactions are stored before this slot, except those stored after inspection
+	keptFromSlot ledger.Slot
+	// inspectedUpToSlot all slots up to this one were inspected at least once
+	inspectedUpToSlot ledger.Slot
+	inspected         bool
+}
+
+func pruningCursorKey() []byte {
+	return common.Concat(indexPrefix, indexPruningCursor)
+}
+
+func (c *pruningCursor) Bytes() []byte {
+	return common.Concat(c.keptFromSlot.Bytes(), c.inspectedUpToSlot.Bytes())
+}
+
+// pruningCursor reads the cursor from the store. If it is absent, scans all keys once to find the earliest stored slot
+func (s *SimpleTxBytesStore) pruningCursor() (ret pruningCursor, err error) {
+	if data := s.s.Get(pruningCursorKey()); len(data) > 0 {
+		if len(data) != 8 {
+			return ret, fmt.Errorf("Prune: wrong pruning cursor data length %d", len(data))
+		}
+		if ret.keptFromSlot, err = ledger.SlotFromBytes(data[:4]); err != nil {
+			return
+		}
+		if ret.inspectedUpToSlot, err = ledger.SlotFromBytes(data[4:]); err != nil {
+			return
+		}
+		ret.inspected = true
+		return
+	}
+	fromSlot, _, found, err := s.storedSlotRange()
+	if err != nil {
+		return ret, fmt.Errorf("Prune: %w", err)
+	}
+	if found {
+		ret.keptFromSlot = fromSlot
+	}
+	return ret, nil
+}
+
+// finalizedFilter returns function which checks if transaction of slots [fromSlot, toSlot] must be kept in the store
+func finalizedFilter(stateStore global.StateStoreReader, fromSlot, toSlot ledger.Slot, keepAllFinalized bool) (func(txid *ledger.TransactionID) bool, error) {
+	latestBranches := multistate.FetchLatestBranches(stateStore)
+	if len(latestBranches) == 0 {
+		return nil, fmt.Errorf("Prune: no latest branches found")
+	}
+	heaviest := latestBranches[0]
+	rdr, err := multistate.NewReadable(stateStore, heaviest.Root)
+	if err != nil {
+		return nil, err
+	}
+	if !keepAllFinalized {
+		return rdr.KnowsCommittedTransaction, nil
+	}
+	committed, err := heaviestChainTxIDs(stateStore, heaviest, fromSlot, toSlot)
+	if err != nil {
+		return nil, err
+	}
+	return func(txid *ledger.TransactionID) bool {
+		return committed.Contains(*txid) || rdr.KnowsCommittedTransaction(txid)
+	}, nil
+}
+
+// heaviestChainTxIDs walks the heaviest chain back from the branch until slot before fromSlot and returns IDs of transactions
+// of slots [fromSlot, toSlot] committed by the branches of the chain. Only branches not younger than the txid pruning horizon
+// after toSlot are inspected. The cost of the state difference is proportional to the number of changes in the slot.
+// If the root record of the predecessor is not in the multi-state DB anymore, the oldest found state is iterated instead
+func heaviestChainTxIDs(stateStore global.StateStoreReader, branch *multistate.BranchData, fromSlot, toSlot ledger.Slot) (set.Set[ledger.TransactionID], error) {
+	ret := set.New[ledger.TransactionID]()
+	inRange := func(txid *ledger.TransactionID) bool {
+		return txid.Slot() >= fromSlot && txid.Slot() <= toSlot
+	}
+	maxSlot := toSlot + ledger.L().Const().TransactionIDPruningHorizon()
+	for branch.Stem.ID.Slot() >= fromSlot {
+		var pred *multistate.BranchData
+		if stemLock, ok := branch.Stem.Output.StemLock(); ok && stemLock.PredecessorOutputID.Slot() < branch.Stem.ID.Slot() {
+			if bd, found := multistate.FetchBranchData(stateStore, stemLock.PredecessorOutputID.TransactionID()); found {
+				pred = &bd
+			}
+		}
+		if pred == nil {
+			rdr, err := multistate.NewReadable(stateStore, branch.Root)
+			if err != nil {
+				return nil, err
+			}
+			rdr.IterateKnownCommittedTransactions(func(txid *ledger.TransactionID, _ ledger.Slot) bool {
+				if inRange(txid) {
+					ret.Insert(*txid)
+				}
+				return true
+			})
+			break
+		}
+		if branch.Stem.ID.Slot() <= maxSlot {
+			diff, err := multistate.DiffStates(stateStore, pred.Root, branch.Root)
+			if err != nil {
+				return nil, err
+			}
+			for i := range diff.AddedTxIDs {
+				if inRange(&diff.AddedTxIDs[i]) {
+					ret.Insert(diff.AddedTxIDs[i])
+				}
+			}
+		}
+		branch = pred
+	}
+	return ret, nil
+}
@@ -0,0 +1,217 @@
+package txstore
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/util"
+)
+
+type (
+	// Server exposes transaction store over HTTP, so it can be shared by several nodes and other clients
+	Server struct {
+		global.Logging
+		store global.TxBytesStore
+		mux   *http.ServeMux
+		// 'persist' is only served if the token is not empty
+		persistToken string
+	}
+)
+
+const TraceTagServer = "txStoreServer"
+
+// NewServer creates the server. Requests which write to the store are only accepted with the persist token.
+// If the token is empty, the server is read-only
+func NewServer(store global.TxBytesStore, log global.Logging, persistToken string) *Server {
+	ret := &Server{
+		Logging:      log,
+		store:        store,
+		mux:          http.NewServeMux(),
+		persistToken: persistToken,
+	}
+	// POST request format: 'persist' with the header 'Authorization: Bearer <persist token>'.
+	// Body is metadata bytes concatenated with transaction bytes, not bigger than MaxPersistRequestSize
+	ret.mux.HandleFunc(PathPersistTx, ret.persistTx)
+	// GET request format: 'get?txid=<hex-encoded transaction ID>'
+	ret.mux.HandleFunc(PathGetTx, ret.getTx)
+	// GET request format: 'has?txid=<hex-encoded transaction ID>'
+	ret.mux.HandleFunc(PathHasTx, ret.hasTx)
+	// GET request format: 'txids?from=<slot>[&to=<slot>]'
+	ret.mux.HandleFunc(PathTxIDs, ret.txIDs)
+	// GET request format: 'branches?from=<slot>[&to=<slot>]'
+	ret.mux.HandleFunc(PathBranches, ret.branchTxIDs)
+	// GET request format: 'sequencer?seq=<hex-encoded sequencer ID>&from=<slot>[&to=<slot>]'
+	ret.mux.HandleFunc(PathSequencer, ret.sequencerMilestones)
+	// GET request format: 'ping'
+	ret.mux.HandleFunc(PathPing, func(w http.ResponseWriter, _ *http.Request) {
+		writeResponse(w, &Error{})
+	})
+	return ret
+}
+
+// Handler returns handler of all transaction store requests
+func (srv *Server) Handler() http.Handler {
+	return srv.mux
+}
+
+// RunOn starts the server on the address. Blocks until server stops
+func (srv *Server) RunOn(addr string) error {
+	srv.Log().Infof("starting transaction store server on %s", addr)
+	return http.ListenAndServe(addr, srv.mux)
+}
+
+func (srv *Server) persistTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, "persist: POST expected")
+		return
+	}
+	if srv.persistToken == "" {
+		writeErr(w, "persist: transaction store server is read-only")
+		return
+	}
+	if !srv.persistAuthorized(r) {
+		writeErr(w, "persist: not authorized")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxPersistRequestSize))
+	if err != nil {
+		writeErr(w, fmt.Sprintf("persist: %v", err))
+		return
+	}
+	metadataBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(data)
+	if err != nil {
+		writeErr(w, fmt.Sprintf("persist: %v", err))
+		return
+	}
+	metadata, err := txmetadata.TransactionMetadataFromBytes(metadataBytes)
+	if err != nil {
+		writeErr(w, fmt.Sprintf("persist: %v", err))
+		return
+	}
+	txid, err := srv.store.PersistTxBytesWithMetadata(txBytes, metadata)
+	if err != nil {
+		writeErr(w, fmt.Sprintf("persist: %v", err))
+		return
+	}
+	srv.Tracef(TraceTagServer, "persisted %s", txid.StringShort())
+	writeResponse(w, &PersistTxResponse{TxID: txid.StringHex()})
+}
+
+func (srv *Server) persistAuthorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), authorizationBearerPrefix)
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(srv.persistToken)) == 1
+}
+
+func (srv *Server) getTx(w http.ResponseWriter, r *http.Request) {
+	txid, err := txidFromRequest(r)
+	if err != nil {
+		writeErr(w, fmt.Sprintf("get: %v", err))
+		return
+	}
+	writeResponse(w, &GetTxResponse{Data: hex.EncodeToString(srv.store.GetTxBytesWithMetadata(&txid))})
+}
+
+func (srv *Server) hasTx(w http.ResponseWriter, r *http.Request) {
+	txid, err := txidFromRequest(r)
+	if err != nil {
+		writeErr(w, fmt.Sprintf("has: %v", err))
+		return
+	}
+	writeResponse(w, &HasTxResponse{Has: srv.store.HasTxBytes(&txid)})
+}
+
+func (srv *Server) txIDs(w http.ResponseWriter, r *http.Request) {
+	srv.writeTxIDs(w, r, "txids", srv.store.IterateTxIDsInSlots)
+}
+
+func (srv *Server) branchTxIDs(w http.ResponseWriter, r *http.Request) {
+	srv.writeTxIDs(w, r, "branches", srv.store.IterateBranchTxIDs)
+}
+
+func (srv *Server) sequencerMilestones(w http.ResponseWriter, r *http.Request) {
+	lst, ok := r.URL.Query()["seq"]
+	if !ok || len(lst) != 1 {
+		writeErr(w, "sequencer: wrong or missing parameter 'seq'")
+		return
+	}
+	seqID, err := ledger.ChainIDFromHexString(lst[0])
+	if err != nil {
+		writeErr(w, fmt.Sprintf("sequencer: %v", err))
+		return
+	}
+	srv.writeTxIDs(w, r, "sequencer", func(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+		return srv.store.IterateSequencerMilestones(seqID, fromSlot, toSlot, fun)
+	})
+}
+
+func (srv *Server) writeTxIDs(w http.ResponseWriter, r *http.Request, name string, iterate func(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error) {
+	fromSlot, err := slotFromRequest(r, "from")
+	if err != nil {
+		writeErr(w, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	toSlot := fromSlot
+	if r.URL.Query().Has("to") {
+		if toSlot, err = slotFromRequest(r, "to"); err != nil {
+			writeErr(w, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+	}
+	if toSlot < fromSlot || toSlot-fromSlot >= MaxSlotSpanTxIDs {
+		writeErr(w, fmt.Sprintf("%s: wrong slot range [%d, %d]. Maximum %d slots are allowed", name, fromSlot, toSlot, MaxSlotSpanTxIDs))
+		return
+	}
+	resp := &TxIDsResponse{TxIDs: make([]string, 0)}
+	err = iterate(fromSlot, toSlot, func(txid ledger.TransactionID) bool {
+		resp.TxIDs = append(resp.TxIDs, txid.StringHex())
+		return true
+	})
+	if err != nil {
+		writeErr(w, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	writeResponse(w, resp)
+}
+
+func txidFromRequest(r *http.Request) (ledger.TransactionID, error) {
+	lst, ok := r.URL.Query()["txid"]
+	if !ok || len(lst) != 1 {
+		return ledger.TransactionID{}, fmt.Errorf("wrong or missing parameter 'txid'")
+	}
+	return ledger.TransactionIDFromHexString(lst[0])
+}
+
+func slotFromRequest(r *http.Request, par string) (ledger.Slot, error) {
+	lst, ok := r.URL.Query()[par]
+	if !ok || len(lst) != 1 {
+		return 0, fmt.Errorf("wrong or missing parameter '%s'", par)
+	}
+	slot, err := strconv.ParseUint(lst[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("wrong parameter '%s': %v", par, err)
+	}
+	return ledger.Slot(slot), nil
+}
+
+func writeResponse(w http.ResponseWriter, resp any) {
+	respBin, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(respBin)
+	util.AssertNoError(err)
+}
+
+func writeErr(w http.ResponseWriter, errStr string) {
+	writeResponse(w, &Error{Error: errStr})
+}
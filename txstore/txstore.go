@@ -1,10 +1,14 @@
 package txstore
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/lunfardo314/proxima/core/txmetadata"
 	"github.com/lunfardo314/proxima/global"
 	"github.com/lunfardo314/proxima/ledger"
 	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/proxima/util"
 	"github.com/lunfardo314/unitrie/common"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -14,6 +18,10 @@ type SimpleTxBytesStore struct {
 	metricsEnabled bool
 	txCounter      prometheus.Counter
 	txBytesCounter prometheus.Counter
+	// pruning
+	pruningMutex         sync.Mutex
+	prunedTxCounter      prometheus.Counter
+	prunedTxBytesCounter prometheus.Counter
 }
 
 type DummyTxBytesStore struct {
@@ -22,6 +30,9 @@ type DummyTxBytesStore struct {
 
 func NewSimpleTxBytesStore(store common.KVStore, metricsRegistry ...global.Metrics) *SimpleTxBytesStore {
 	ret := &SimpleTxBytesStore{s: store}
+	if _, traversable := store.(common.Traversable); traversable {
+		util.AssertNoError(ret.ensureIndexes())
+	}
 	if len(metricsRegistry) > 0 {
 		ret.registerMetrics(metricsRegistry[0].MetricsRegistry())
 	}
@@ -41,19 +52,46 @@ func (s *SimpleTxBytesStore) registerMetrics(reg *prometheus.Registry) {
 		Help: "new transaction bytes (cumulative size) counter in SimpleTxBytesStore",
 	})
 	reg.MustRegister(s.txBytesCounter)
+
+	s.prunedTxCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "txStore_prunedTxCounter",
+		Help: "pruned transaction counter in SimpleTxBytesStore",
+	})
+	reg.MustRegister(s.prunedTxCounter)
+
+	s.prunedTxBytesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "txStore_prunedTxBytesCounter",
+		Help: "pruned transaction bytes (cumulative size) counter in SimpleTxBytesStore",
+	})
+	reg.MustRegister(s.prunedTxBytesCounter)
 }
 
 func (s *SimpleTxBytesStore) PersistTxBytesWithMetadata(txBytes []byte, metadata *txmetadata.TransactionMetadata) (ledger.TransactionID, error) {
-	txid, err := transaction.IDFromTransactionBytes(txBytes)
+	tx, err := transaction.FromBytes(txBytes)
 	if err != nil {
 		return ledger.TransactionID{}, err
 	}
+	return s.PersistTxWithMetadata(tx, metadata)
+}
+
+// PersistTxWithMetadata persists the already parsed transaction. Index entries are made from the parsed sequencer
+// data of the transaction, so the transaction bytes are not parsed again
+func (s *SimpleTxBytesStore) PersistTxWithMetadata(tx *transaction.Transaction, metadata *txmetadata.TransactionMetadata) (ledger.TransactionID, error) {
+	txid := *tx.ID()
+	txBytes := tx.Bytes()
 	if metadata != nil {
 		mdTmp := *metadata
 		mdTmp.IsResponseToPull = false // saving without the irrelevant metadata flag
 		metadata = &mdTmp
 	}
-	s.s.Set(txid[:], common.ConcatBytes(metadata.Bytes(), txBytes))
+	batch := s.batchedWriter()
+	batch.Set(txid[:], common.ConcatBytes(metadata.Bytes(), txBytes))
+	for _, k := range indexKeys(tx) {
+		batch.Set(k, indexValue)
+	}
+	if err := batch.Commit(); err != nil {
+		return ledger.TransactionID{}, err
+	}
 
 	if s.metricsEnabled {
 		s.txCounter.Inc()
@@ -70,6 +108,35 @@ func (s *SimpleTxBytesStore) HasTxBytes(txid *ledger.TransactionID) bool {
 	return s.s.Has(txid[:])
 }
 
+// TxIDsInSlots returns IDs of all stored transactions in the slot range [fromSlot, toSlot], in the order of slots.
+// The underlying key/value store must be traversable
+func (s *SimpleTxBytesStore) TxIDsInSlots(fromSlot, toSlot ledger.Slot) ([]ledger.TransactionID, error) {
+	ret := make([]ledger.TransactionID, 0)
+	err := s.IterateTxIDsInSlots(fromSlot, toSlot, func(txid ledger.TransactionID) bool {
+		ret = append(ret, txid)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("TxIDsInSlots: %w", err)
+	}
+	return ret, nil
+}
+
+func (s *SimpleTxBytesStore) batchedWriter() common.KVBatchedWriter {
+	if bu, ok := s.s.(common.BatchedUpdatable); ok {
+		return bu.BatchedWriter()
+	}
+	return &unbatchedWriter{s.s}
+}
+
+type unbatchedWriter struct {
+	common.KVWriter
+}
+
+func (w *unbatchedWriter) Commit() error {
+	return nil
+}
+
 func NewDummyTxBytesStore() DummyTxBytesStore {
 	return DummyTxBytesStore{}
 }
@@ -85,3 +152,15 @@ func (d DummyTxBytesStore) GetTxBytesWithMetadata(_ *ledger.TransactionID) []byt
 func (s DummyTxBytesStore) HasTxBytes(txid *ledger.TransactionID) bool {
 	return false
 }
+
+func (d DummyTxBytesStore) IterateTxIDsInSlots(_, _ ledger.Slot, _ func(txid ledger.TransactionID) bool) error {
+	return nil
+}
+
+func (d DummyTxBytesStore) IterateBranchTxIDs(_, _ ledger.Slot, _ func(txid ledger.TransactionID) bool) error {
+	return nil
+}
+
+func (d DummyTxBytesStore) IterateSequencerMilestones(_ ledger.ChainID, _, _ ledger.Slot, _ func(txid ledger.TransactionID) bool) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+// Standalone transaction store server. Transaction store can be shared by several nodes (with 'txstore.type: url')
+// and by other clients, such as explorer.
+// Configuration is read from the optional 'txstore_server.yaml' in the current directory:
+//
+//	db: proximadb.txstore  # directory of the transaction store database
+//	port: 4500             # server port
+//	persist_token: <token> # token required to persist transactions. If empty, the server is read-only
+//	database:
+//	  backend: badger      # database backend of the new database: 'badger' (default) or 'pebble'
+//	logger:
+//	  level: info
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/kvdb"
+	"github.com/lunfardo314/proxima/txstore"
+	"github.com/spf13/viper"
+)
+
+const (
+	configName  = "txstore_server"
+	defaultPort = 4500
+)
+
+func main() {
+	viper.SetConfigName(configName)
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	viper.SetDefault("db", global.TxStoreDBName)
+	viper.SetDefault("port", defaultPort)
+	if err := viper.ReadInConfig(); err != nil {
+		if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound {
+			fmt.Fprintf(os.Stderr, "error while reading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	log := global.NewFromConfig()
+
+	dbname := viper.GetString("db")
+	db := kvdb.MustCreateOrOpen(viper.GetString(global.ConfigKeyDatabaseBackend), dbname)
+	log.Log().Infof("opened DB '%s' as transaction store", dbname)
+
+	killChan := make(chan os.Signal, 1)
+	signal.Notify(killChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-killChan
+		_ = db.Close()
+		log.Log().Infof("transaction store database has been closed")
+		os.Exit(0)
+	}()
+
+	persistToken := viper.GetString("persist_token")
+	if persistToken == "" {
+		log.Log().Warnf("'persist_token' is not set, transaction store server is read-only")
+	}
+	srv := txstore.NewServer(txstore.NewSimpleTxBytesStore(db), log, persistToken)
+	err := srv.RunOn(fmt.Sprintf(":%d", viper.GetInt("port")))
+	_ = db.Close()
+	log.Log().Fatalf("transaction store server stopped: %v", err)
+}
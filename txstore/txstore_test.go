@@ -0,0 +1,217 @@
+package txstore
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/multistate"
+	"github.com/lunfardo314/proxima/util/testutil"
+	"github.com/lunfardo314/proxima/util/utxodb"
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+)
+
+var genesisPrivateKey ed25519.PrivateKey
+
+func init() {
+	genesisPrivateKey = ledger.InitWithTestingLedgerIDData()
+}
+
+func TestURLTxBytesStore(t *testing.T) {
+	u := utxodb.NewUTXODB(genesisPrivateKey)
+	addr := ledger.AddressED25519FromPrivateKey(testutil.GetTestingPrivateKey(1))
+
+	const numTx = 5
+	txs := make([][]byte, numTx)
+	for i := range txs {
+		var err error
+		txs[i], err = u.MakeTransactionFromFaucet(addr)
+		require.NoError(t, err)
+		require.NoError(t, u.AddTransaction(txs[i]))
+	}
+
+	log := global.NewDefault()
+	local := NewSimpleTxBytesStore(common.NewInMemoryKVStore())
+	const token = "secret"
+	httpSrv := httptest.NewServer(NewServer(local, log, token).Handler())
+	defer httpSrv.Close()
+
+	remote := NewURLTxBytesStore(URLTxBytesStoreParams{URL: httpSrv.URL, CacheSize: 2, Token: token}, log)
+	require.NoError(t, remote.Ping())
+
+	coverage := uint64(1337)
+	// persisting requires the token
+	for _, wrongToken := range []string{"", "wrong"} {
+		unauthorized := NewURLTxBytesStore(URLTxBytesStoreParams{URL: httpSrv.URL, Token: wrongToken}, log)
+		_, err := unauthorized.PersistTxBytesWithMetadata(txs[0], &txmetadata.TransactionMetadata{LedgerCoverage: &coverage})
+		require.ErrorContains(t, err, "not authorized")
+	}
+	// oversized request
+	respBody, err := remote.do(http.MethodPost, PathPersistTx, make([]byte, MaxPersistRequestSize+1))
+	require.NoError(t, err)
+	var resp PersistTxResponse
+	require.NoError(t, json.Unmarshal(respBody, &resp))
+	require.Contains(t, resp.Error.Error, "too large")
+	// read-only server
+	readOnlySrv := httptest.NewServer(NewServer(local, log, "").Handler())
+	defer readOnlySrv.Close()
+	readOnly := NewURLTxBytesStore(URLTxBytesStoreParams{URL: readOnlySrv.URL, Token: token}, log)
+	_, err = readOnly.PersistTxBytesWithMetadata(txs[0], &txmetadata.TransactionMetadata{LedgerCoverage: &coverage})
+	require.ErrorContains(t, err, "read-only")
+
+	txids := make([]ledger.TransactionID, numTx)
+	for i, txBytes := range txs {
+		var err error
+		txids[i], err = remote.PersistTxBytesWithMetadata(txBytes, &txmetadata.TransactionMetadata{LedgerCoverage: &coverage})
+		require.NoError(t, err)
+		// persisted in the server
+		require.True(t, local.HasTxBytes(&txids[i]))
+	}
+	for i := range txids {
+		require.True(t, remote.HasTxBytes(&txids[i]))
+		data := remote.GetTxBytesWithMetadata(&txids[i])
+		require.EqualValues(t, local.GetTxBytesWithMetadata(&txids[i]), data)
+
+		mdBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(data)
+		require.NoError(t, err)
+		require.EqualValues(t, txs[i], txBytes)
+		md, err := txmetadata.TransactionMetadataFromBytes(mdBytes)
+		require.NoError(t, err)
+		require.EqualValues(t, coverage, *md.LedgerCoverage)
+	}
+	absent := ledger.RandomTransactionID(false)
+	require.False(t, remote.HasTxBytes(&absent))
+	require.Nil(t, remote.GetTxBytesWithMetadata(&absent))
+
+	// server responds with another transaction: rejected and not cached
+	wrongSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respBin, err := json.Marshal(GetTxResponse{Data: hex.EncodeToString(local.GetTxBytesWithMetadata(&txids[0]))})
+		require.NoError(t, err)
+		_, _ = w.Write(respBin)
+	}))
+	defer wrongSrv.Close()
+	wrong := NewURLTxBytesStore(URLTxBytesStoreParams{URL: wrongSrv.URL}, log)
+	require.NotNil(t, wrong.GetTxBytesWithMetadata(&txids[0]))
+	require.Nil(t, wrong.GetTxBytesWithMetadata(&txids[1]))
+	require.Nil(t, wrong.getFromCache(&txids[1]))
+
+	txidsBack, err := remote.TxIDsInSlots(0, txids[numTx-1].Slot())
+	require.NoError(t, err)
+	require.EqualValues(t, numTx, len(txidsBack))
+	for i := range txids {
+		require.Contains(t, txidsBack, txids[i])
+	}
+	// range bigger than allowed in one request
+	txidsBack, err = remote.TxIDsInSlots(0, txids[numTx-1].Slot()+3*MaxSlotSpanTxIDs)
+	require.NoError(t, err)
+	require.EqualValues(t, numTx, len(txidsBack))
+
+	// cached transactions are available when server is down, the rest is not
+	httpSrv.Close()
+	remote.par.Retries = 1
+	remote.par.RetryDelay = time.Millisecond
+	require.True(t, remote.HasTxBytes(&txids[numTx-1]))
+	require.False(t, remote.HasTxBytes(&txids[0]))
+	_, err = remote.PersistTxBytesWithMetadata(txs[0], nil)
+	require.Error(t, err)
+}
+
+func TestPrune(t *testing.T) {
+	stateStore := common.NewInMemoryKVStore()
+	seqID, root := multistate.InitStateStore(*ledger.L().ID, stateStore)
+	txStore := NewSimpleTxBytesStore(common.NewInMemoryKVStore())
+
+	const latestSlot = 12
+	randomTxID := func(slot ledger.Slot, seq bool) ledger.TransactionID {
+		randomID := ledger.RandomTransactionID(seq)
+		return ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 1), randomID.ShortID(), seq)
+	}
+	// each slot has one branch with one included transaction, orphaned milestone and orphaned transaction
+	included := make([]ledger.TransactionID, 0)
+	orphaned := make([]ledger.TransactionID, 0)
+	predStem := ledger.GenesisStemOutputID()
+	for slot := ledger.Slot(1); slot <= latestSlot; slot++ {
+		randomID := ledger.RandomTransactionID(true)
+		branchTxID := ledger.NewTransactionID(ledger.MustNewLedgerTime(slot, 0), randomID.ShortID(), true)
+		stem := ledger.NewOutputID(&branchTxID, 0)
+		txid := randomTxID(slot, false)
+
+		muts := multistate.NewMutations()
+		muts.InsertDelOutputMutation(predStem)
+		muts.InsertAddOutputMutation(stem, ledger.NewOutput(func(o *ledger.Output) {
+			o.WithAmount(0).WithLock(&ledger.StemLock{PredecessorOutputID: predStem})
+		}))
+		muts.InsertAddTxMutation(branchTxID, slot, 0)
+		muts.InsertAddTxMutation(txid, slot, 0)
+		upd := multistate.MustNewUpdatable(stateStore, root)
+		upd.MustUpdate(muts.Sort(), &multistate.RootRecordParams{
+			StemOutputID: stem,
+			SeqID:        seqID,
+			Coverage:     uint64(slot),
+			Supply:       ledger.L().ID.InitialSupply,
+		})
+		root, predStem = upd.Root(), stem
+
+		included = append(included, branchTxID, txid)
+		orphaned = append(orphaned, randomTxID(slot, true), randomTxID(slot, false))
+	}
+	for _, txid := range append(included, orphaned...) {
+		txStore.s.Set(txid[:], []byte("tx"))
+	}
+
+	par := DefaultPruningParams()
+	par.HorizonSlots = 5
+	par.DryRun = true
+	report, err := txStore.Prune(stateStore, par)
+	require.NoError(t, err)
+	t.Logf("%s", report.String())
+	require.EqualValues(t, 6, report.ToSlot)
+	require.EqualValues(t, 2*6, report.NumDeleted)
+	require.EqualValues(t, 2*6, report.NumKept)
+	for i := range orphaned {
+		require.True(t, txStore.HasTxBytes(&orphaned[i]))
+	}
+
+	par.DryRun = false
+	report, err = txStore.Prune(stateStore, par)
+	require.NoError(t, err)
+	require.EqualValues(t, 2*6, report.NumDeleted)
+	for i := range included {
+		require.True(t, txStore.HasTxBytes(&included[i]))
+	}
+	for i := range orphaned {
+		require.EqualValues(t, orphaned[i].Slot() > 6, txStore.HasTxBytes(&orphaned[i]))
+	}
+	// slots already pruned are not inspected again
+	report, err = txStore.Prune(stateStore, par)
+	require.NoError(t, err)
+	require.Nil(t, report)
+	// pruning cursor is persisted in the store
+	report, err = NewSimpleTxBytesStore(txStore.s).Prune(stateStore, par)
+	require.NoError(t, err)
+	require.Nil(t, report)
+
+	// only transactions known in the latest state are kept
+	par.KeepAllFinalized = false
+	par.HorizonSlots = 1
+	report, err = txStore.Prune(stateStore, par)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, report.FromSlot)
+	require.EqualValues(t, 2*4, report.NumDeleted)
+	for i := range included {
+		require.True(t, txStore.HasTxBytes(&included[i]))
+	}
+
+	par.Archive = true
+	report, err = txStore.Prune(stateStore, par)
+	require.NoError(t, err)
+	require.Nil(t, report)
+}
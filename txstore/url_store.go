@@ -0,0 +1,322 @@
+package txstore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lunfardo314/proxima/core/txmetadata"
+	"github.com/lunfardo314/proxima/global"
+	"github.com/lunfardo314/proxima/ledger"
+	"github.com/lunfardo314/proxima/ledger/transaction"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// URLTxBytesStore is a client of the remote transaction store server.
+	// Transactions are immutable, so recently persisted and fetched transactions are cached locally.
+	// Requests to the server are retried on network errors
+	URLTxBytesStore struct {
+		global.Logging
+		par   URLTxBytesStoreParams
+		c     http.Client
+		mutex sync.RWMutex
+		cache map[ledger.TransactionID][]byte
+		// FIFO order of cached transactions for eviction
+		cacheOrder []ledger.TransactionID
+		cacheNext  int
+	}
+
+	URLTxBytesStoreParams struct {
+		// URL of the transaction store server, for example 'http://localhost:4500'
+		URL string
+		// CacheSize maximum number of locally cached transactions
+		CacheSize int
+		// Retries is number of retries after a failed request
+		Retries int
+		// RetryDelay is delay before the first retry. Each next retry doubles the delay
+		RetryDelay time.Duration
+		// Timeout of one request
+		Timeout time.Duration
+		// Token is the persist token of the server. Without it, transactions cannot be persisted
+		Token string
+	}
+)
+
+const (
+	TraceTagURLStore = "txStoreURL"
+
+	DefaultURLStoreCacheSize  = 10_000
+	DefaultURLStoreRetries    = 3
+	DefaultURLStoreRetryDelay = 200 * time.Millisecond
+	DefaultURLStoreTimeout    = 5 * time.Second
+)
+
+func NewURLTxBytesStore(par URLTxBytesStoreParams, log global.Logging) *URLTxBytesStore {
+	if par.CacheSize <= 0 {
+		par.CacheSize = DefaultURLStoreCacheSize
+	}
+	if par.Retries < 0 {
+		par.Retries = 0
+	}
+	if par.RetryDelay <= 0 {
+		par.RetryDelay = DefaultURLStoreRetryDelay
+	}
+	if par.Timeout <= 0 {
+		par.Timeout = DefaultURLStoreTimeout
+	}
+	par.URL = strings.TrimSuffix(par.URL, "/")
+	return &URLTxBytesStore{
+		Logging:    log,
+		par:        par,
+		c:          http.Client{Timeout: par.Timeout},
+		cache:      make(map[ledger.TransactionID][]byte),
+		cacheOrder: make([]ledger.TransactionID, par.CacheSize),
+	}
+}
+
+// Ping checks if the server is reachable
+func (s *URLTxBytesStore) Ping() error {
+	var res Error
+	if err := s.getJSON(PathPing, &res); err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return fmt.Errorf("Ping: from server: %s", res.Error)
+	}
+	return nil
+}
+
+func (s *URLTxBytesStore) PersistTxBytesWithMetadata(txBytes []byte, metadata *txmetadata.TransactionMetadata) (ledger.TransactionID, error) {
+	txid, err := transaction.IDFromTransactionBytes(txBytes)
+	if err != nil {
+		return ledger.TransactionID{}, err
+	}
+	if metadata != nil {
+		mdTmp := *metadata
+		mdTmp.IsResponseToPull = false // saving without the irrelevant metadata flag
+		metadata = &mdTmp
+	}
+	data := common.ConcatBytes(metadata.Bytes(), txBytes)
+
+	var respBody []byte
+	err = s.withRetry(func() (err1 error) {
+		respBody, err1 = s.do(http.MethodPost, PathPersistTx, data)
+		return
+	})
+	if err != nil {
+		return ledger.TransactionID{}, fmt.Errorf("PersistTxBytesWithMetadata %s: %w", txid.StringShort(), err)
+	}
+	var res PersistTxResponse
+	if err = json.Unmarshal(respBody, &res); err != nil {
+		return ledger.TransactionID{}, fmt.Errorf("PersistTxBytesWithMetadata %s: %w", txid.StringShort(), err)
+	}
+	if res.Error.Error != "" {
+		return ledger.TransactionID{}, fmt.Errorf("PersistTxBytesWithMetadata %s: from server: %s", txid.StringShort(), res.Error.Error)
+	}
+	s.putToCache(txid, data)
+	s.Tracef(TraceTagURLStore, "persisted %s", txid.StringShort())
+	return txid, nil
+}
+
+// GetTxBytesWithMetadata returns nil if transaction is not in the store or server is not reachable.
+// Data from the server is only accepted and cached if it contains the requested transaction
+func (s *URLTxBytesStore) GetTxBytesWithMetadata(txid *ledger.TransactionID) []byte {
+	if ret := s.getFromCache(txid); ret != nil {
+		return ret
+	}
+	var res GetTxResponse
+	if err := s.getJSON(PathGetTx+"?txid="+txid.StringHex(), &res); err != nil {
+		s.Log().Errorf("GetTxBytesWithMetadata %s: %v", txid.StringShort(), err)
+		return nil
+	}
+	if res.Error.Error != "" {
+		s.Log().Errorf("GetTxBytesWithMetadata %s: from server: %s", txid.StringShort(), res.Error.Error)
+		return nil
+	}
+	if res.Data == "" {
+		return nil
+	}
+	ret, err := hex.DecodeString(res.Data)
+	if err != nil {
+		s.Log().Errorf("GetTxBytesWithMetadata %s: %v", txid.StringShort(), err)
+		return nil
+	}
+	if err = checkTxBytesWithMetadata(txid, ret); err != nil {
+		s.Log().Errorf("GetTxBytesWithMetadata %s: rejected data from server: %v", txid.StringShort(), err)
+		return nil
+	}
+	s.putToCache(*txid, ret)
+	return ret
+}
+
+// checkTxBytesWithMetadata checks if data consists of valid metadata and transaction bytes with the expected ID
+func checkTxBytesWithMetadata(txid *ledger.TransactionID, data []byte) error {
+	metadataBytes, txBytes, err := txmetadata.SplitTxBytesWithMetadata(data)
+	if err != nil {
+		return err
+	}
+	if _, err = txmetadata.TransactionMetadataFromBytes(metadataBytes); err != nil {
+		return err
+	}
+	txidBack, err := transaction.IDFromTransactionBytes(txBytes)
+	if err != nil {
+		return err
+	}
+	if txidBack != *txid {
+		return fmt.Errorf("transaction ID mismatch: got %s", txidBack.StringShort())
+	}
+	return nil
+}
+
+// HasTxBytes returns false if server is not reachable
+func (s *URLTxBytesStore) HasTxBytes(txid *ledger.TransactionID) bool {
+	if s.getFromCache(txid) != nil {
+		return true
+	}
+	var res HasTxResponse
+	if err := s.getJSON(PathHasTx+"?txid="+txid.StringHex(), &res); err != nil {
+		s.Log().Errorf("HasTxBytes %s: %v", txid.StringShort(), err)
+		return false
+	}
+	if res.Error.Error != "" {
+		s.Log().Errorf("HasTxBytes %s: from server: %s", txid.StringShort(), res.Error.Error)
+		return false
+	}
+	return res.Has
+}
+
+// TxIDsInSlots returns IDs of all transactions in the slot range [fromSlot, toSlot] stored in the server
+func (s *URLTxBytesStore) TxIDsInSlots(fromSlot, toSlot ledger.Slot) ([]ledger.TransactionID, error) {
+	ret := make([]ledger.TransactionID, 0)
+	err := s.IterateTxIDsInSlots(fromSlot, toSlot, func(txid ledger.TransactionID) bool {
+		ret = append(ret, txid)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("TxIDsInSlots: %w", err)
+	}
+	return ret, nil
+}
+
+func (s *URLTxBytesStore) IterateTxIDsInSlots(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	return s.iterateTxIDs(PathTxIDs+"?", fromSlot, toSlot, fun)
+}
+
+func (s *URLTxBytesStore) IterateBranchTxIDs(fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	return s.iterateTxIDs(PathBranches+"?", fromSlot, toSlot, fun)
+}
+
+func (s *URLTxBytesStore) IterateSequencerMilestones(seqID ledger.ChainID, fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	return s.iterateTxIDs(PathSequencer+"?seq="+seqID.StringHex()+"&", fromSlot, toSlot, fun)
+}
+
+// iterateTxIDs requests transaction IDs from the server in chunks of maximum allowed slot span
+func (s *URLTxBytesStore) iterateTxIDs(pathPrefix string, fromSlot, toSlot ledger.Slot, fun func(txid ledger.TransactionID) bool) error {
+	for from := fromSlot; from <= toSlot; from += MaxSlotSpanTxIDs {
+		to := toSlot
+		if toSlot-from >= MaxSlotSpanTxIDs {
+			to = from + MaxSlotSpanTxIDs - 1
+		}
+		var res TxIDsResponse
+		if err := s.getJSON(fmt.Sprintf(pathPrefix+"from=%d&to=%d", from, to), &res); err != nil {
+			return err
+		}
+		if res.Error.Error != "" {
+			return fmt.Errorf("from server: %s", res.Error.Error)
+		}
+		for _, str := range res.TxIDs {
+			txid, err := ledger.TransactionIDFromHexString(str)
+			if err != nil {
+				return fmt.Errorf("wrong transaction ID from server: %s", str)
+			}
+			if !fun(txid) {
+				return nil
+			}
+		}
+		if to == toSlot {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *URLTxBytesStore) getFromCache(txid *ledger.TransactionID) []byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.cache[*txid]
+}
+
+func (s *URLTxBytesStore) putToCache(txid ledger.TransactionID, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, already := s.cache[txid]; already {
+		return
+	}
+	if len(s.cache) >= s.par.CacheSize {
+		delete(s.cache, s.cacheOrder[s.cacheNext])
+	}
+	s.cache[txid] = data
+	s.cacheOrder[s.cacheNext] = txid
+	s.cacheNext = (s.cacheNext + 1) % s.par.CacheSize
+}
+
+func (s *URLTxBytesStore) getJSON(path string, res any) error {
+	var body []byte
+	err := s.withRetry(func() (err1 error) {
+		body, err1 = s.do(http.MethodGet, path, nil)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, res)
+}
+
+// withRetry repeats the request with exponential back-off until success or number of retries is exhausted
+func (s *URLTxBytesStore) withRetry(fun func() error) error {
+	delay := s.par.RetryDelay
+	var err error
+	for i := 0; ; i++ {
+		if err = fun(); err == nil {
+			return nil
+		}
+		if i >= s.par.Retries {
+			return err
+		}
+		s.Tracef(TraceTagURLStore, "request failed, retry in %v: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (s *URLTxBytesStore) do(method, path string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.par.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if s.par.Token != "" {
+			req.Header.Set("Authorization", authorizationBearerPrefix+s.par.Token)
+		}
+	}
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: status %s", method, path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -39,7 +39,7 @@ func updateValidateOptions(u *multistate.Updatable, txBytes []byte, traceOption
 		return nil, err
 	}
 
-	muts := tx.StateMutations()
+	muts := multistate.MutationsFromTransaction(tx)
 	if err := ConsistencyCheckBeforeAddTransaction(tx, u.Readable()); err != nil {
 		return nil, err
 	}